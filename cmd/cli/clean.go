@@ -0,0 +1,92 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/peterbourgon/ff/v3/ffcli"
+	"github.com/sigstore/cosign/pkg/cosign/oci"
+)
+
+func Clean() *ffcli.Command {
+	var (
+		flagset = flag.NewFlagSet("cosign clean", flag.ExitOnError)
+		force   = flagset.Bool("force", false, "don't ask for confirmation before deleting")
+		ro      = registryFlags(flagset)
+	)
+	return &ffcli.Command{
+		Name:       "clean",
+		ShortUsage: "cosign clean [-force] [-registry-username <user> -registry-password <pass>] <image uri>",
+		ShortHelp:  "Remove all signatures from the supplied container image",
+		FlagSet:    flagset,
+		Exec: func(ctx context.Context, args []string) error {
+			ro.Context = ctx
+			if len(args) != 1 {
+				return flag.ErrHelp
+			}
+			return CleanCmd(ctx, args[0], *force, *ro)
+		},
+	}
+}
+
+// CleanCmd deletes every signature of imageRef. Unless force is set, it asks
+// for confirmation on stdin first.
+func CleanCmd(ctx context.Context, imageRef string, force bool, ro oci.RegistryOptions) error {
+	ref, err := parseReference(imageRef, ro)
+	if err != nil {
+		return err
+	}
+
+	if !force {
+		ok, err := confirm(os.Stdin, fmt.Sprintf("This deletes all signatures of %s. Are you sure? [y/N] ", ref))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errors.New("aborted")
+		}
+	}
+
+	if err := oci.CleanSignatures(ctx, ref, ro); err != nil {
+		return err
+	}
+	logger.Infow("Deleted signatures", "ref", ref.String())
+	return nil
+}
+
+// confirm asks the question on stderr, and reports whether the answer read
+// from r was yes.
+func confirm(r io.Reader, question string) (bool, error) {
+	fmt.Fprint(os.Stderr, question)
+	answer, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true, nil
+	}
+	return false, nil
+}
@@ -0,0 +1,194 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/peterbourgon/ff/v3/ffcli"
+)
+
+// Completion prints a completion script for the subcommands of root, and
+// their flags. It has to be added to root once root is otherwise complete.
+func Completion(root *ffcli.Command) *ffcli.Command {
+	var (
+		flagset = flag.NewFlagSet("cosign completion", flag.ExitOnError)
+	)
+	return &ffcli.Command{
+		Name:       "completion",
+		ShortUsage: "cosign completion bash|zsh|fish|powershell",
+		ShortHelp:  "Print a shell completion script",
+		LongHelp: `Print a shell completion script.
+
+For example, for bash:
+
+  cosign completion bash > /etc/bash_completion.d/cosign`,
+		FlagSet: flagset,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 1 {
+				return flag.ErrHelp
+			}
+			return CompletionCmd(ctx, root, args[0], os.Stdout)
+		},
+	}
+}
+
+// CompletionCmd writes the completion script of shell for root to w.
+func CompletionCmd(_ context.Context, root *ffcli.Command, shell string, w io.Writer) error {
+	tmpl, ok := completionTemplates[shell]
+	if !ok {
+		return fmt.Errorf("unsupported shell %q, expected one of bash, zsh, fish or powershell", shell)
+	}
+	return template.Must(template.New(shell).Funcs(completionFuncs).Parse(tmpl)).Execute(w, completionCommands(root))
+}
+
+type completionCommand struct {
+	Name      string
+	ShortHelp string
+	Flags     []completionFlag
+}
+
+type completionFlag struct {
+	Name  string
+	Usage string
+	Bool  bool
+}
+
+func completionCommands(root *ffcli.Command) []completionCommand {
+	cmds := []completionCommand{}
+	for _, sub := range root.Subcommands {
+		cmd := completionCommand{
+			Name:      sub.Name,
+			ShortHelp: sub.ShortHelp,
+		}
+		if sub.FlagSet != nil {
+			sub.FlagSet.VisitAll(func(f *flag.Flag) {
+				bf, ok := f.Value.(interface{ IsBoolFlag() bool })
+				cmd.Flags = append(cmd.Flags, completionFlag{
+					Name:  "-" + f.Name,
+					Usage: f.Usage,
+					Bool:  ok && bf.IsBoolFlag(),
+				})
+			})
+		}
+		cmds = append(cmds, cmd)
+	}
+	return cmds
+}
+
+var completionFuncs = template.FuncMap{
+	// sq single quotes s for bash and zsh.
+	"sq": func(s string) string {
+		return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+	},
+	// fishq single quotes s for fish.
+	"fishq": func(s string) string {
+		return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s) + "'"
+	},
+	// psq single quotes s for powershell.
+	"psq": func(s string) string {
+		return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+	},
+	// zshdesc escapes the characters that are special in _arguments and
+	// _describe descriptions.
+	"zshdesc": func(s string) string {
+		return strings.NewReplacer(`\`, `\\`, "[", `\[`, "]", `\]`, ":", `\:`).Replace(s)
+	},
+}
+
+var completionTemplates = map[string]string{
+	"bash": `# bash completion for cosign
+
+_cosign() {
+    local cur="${COMP_WORDS[COMP_CWORD]}"
+    if [ "$COMP_CWORD" -eq 1 ]; then
+        COMPREPLY=($(compgen -W "{{range .}}{{.Name}} {{end}}" -- "$cur"))
+        return
+    fi
+    case "${COMP_WORDS[1]}" in
+{{- range .}}
+    {{.Name}})
+        COMPREPLY=($(compgen -W "{{range .Flags}}{{.Name}} {{end}}" -- "$cur"))
+        ;;
+{{- end}}
+    esac
+}
+
+complete -o default -F _cosign cosign
+`,
+
+	"zsh": `#compdef cosign
+
+_cosign() {
+    local -a subcommands
+    subcommands=(
+{{- range .}}
+        {{sq (printf "%s:%s" .Name (zshdesc .ShortHelp))}}
+{{- end}}
+    )
+    if (( CURRENT == 2 )); then
+        _describe 'command' subcommands
+        return
+    fi
+    case "${words[2]}" in
+{{- range .}}
+    {{.Name}})
+        _arguments{{range .Flags}} {{if .Bool}}{{sq (printf "%s[%s]" .Name (zshdesc .Usage))}}{{else}}{{sq (printf "%s[%s]:value:_files" .Name (zshdesc .Usage))}}{{end}}{{end}} '*:file:_files'
+        ;;
+{{- end}}
+    esac
+}
+
+_cosign "$@"
+`,
+
+	"fish": `# fish completion for cosign
+{{range .}}
+complete -c cosign -f -n '__fish_use_subcommand' -a {{fishq .Name}} -d {{fishq .ShortHelp}}
+{{- $name := .Name}}
+{{- range .Flags}}
+complete -c cosign -n '__fish_seen_subcommand_from {{$name}}' -o {{fishq (slice .Name 1)}}{{if not .Bool}} -r{{end}} -d {{fishq .Usage}}
+{{- end}}
+{{end}}`,
+
+	"powershell": `# powershell completion for cosign
+
+Register-ArgumentCompleter -Native -CommandName cosign -ScriptBlock {
+    param($wordToComplete, $commandAst, $cursorPosition)
+    $commands = @{
+{{- range .}}
+        {{psq .Name}} = @({{range $i, $f := .Flags}}{{if $i}}, {{end}}{{psq $f.Name}}{{end}})
+{{- end}}
+    }
+    $elements = @($commandAst.CommandElements | ForEach-Object { $_.ToString() })
+    if ($elements.Count -eq 1 -or ($elements.Count -eq 2 -and $wordToComplete)) {
+        $candidates = $commands.Keys
+    } else {
+        $candidates = $commands[$elements[1]]
+    }
+    $candidates | Where-Object { $_ -like "$wordToComplete*" } | Sort-Object | ForEach-Object {
+        [System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_)
+    }
+}
+`,
+}
@@ -0,0 +1,220 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/peterbourgon/ff/v3/ffcli"
+	"github.com/sigstore/cosign/pkg/cosign"
+	"github.com/sigstore/cosign/pkg/cosign/oci"
+)
+
+func Dockerfile() *ffcli.Command {
+	flagset := flag.NewFlagSet("cosign dockerfile", flag.ExitOnError)
+	return &ffcli.Command{
+		Name:        "dockerfile",
+		ShortUsage:  "cosign dockerfile <subcommand>",
+		ShortHelp:   "Sign or verify the images a Dockerfile builds on",
+		FlagSet:     flagset,
+		Subcommands: []*ffcli.Command{dockerfileSign(), dockerfileVerify()},
+		Exec: func(context.Context, []string) error {
+			return flag.ErrHelp
+		},
+	}
+}
+
+func dockerfileSign() *ffcli.Command {
+	var (
+		flagset     = flag.NewFlagSet("cosign dockerfile sign", flag.ExitOnError)
+		key         = flagset.String("key", "", "path to the private key")
+		output      = flagset.String("output", "-", "where to write the manifest of what was signed, - for stdout")
+		referrers   = flagset.Bool("referrers", false, "store the signatures with the OCI referrers API, if the registry supports it")
+		annotations = annotationsMap{}
+		ro          = registryFlags(flagset)
+	)
+	flagset.Var(&annotations, "a", "extra key=value pairs to sign; keys starting with cosign. are reserved")
+	return &ffcli.Command{
+		Name:       "sign",
+		ShortUsage: "cosign dockerfile sign -key <key> [-output <file>] [-a key=value] [-referrers] [-registry-username <user> -registry-password <pass>] <Dockerfile>",
+		ShortHelp:  "Sign every base image in the FROM instructions of a Dockerfile",
+		FlagSet:    flagset,
+		Exec: func(ctx context.Context, args []string) error {
+			ro.Context = ctx
+			if *key == "" || len(args) != 1 {
+				return flag.ErrHelp
+			}
+			if err := checkReservedAnnotations(annotations.annotations); err != nil {
+				return err
+			}
+			w := io.Writer(os.Stdout)
+			if *output != "-" {
+				f, err := os.Create(*output)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				w = f
+			}
+			so := SignOptions{
+				Upload:      true,
+				Annotations: annotations.annotations,
+				Referrers:   *referrers,
+				Registry:    *ro,
+			}
+			return DockerfileSignCmd(ctx, args[0], *key, so, getPass, w)
+		},
+	}
+}
+
+// DockerfileSignCmd signs every base image of the Dockerfile at
+// dockerfilePath, see cosign.DockerfileBaseImages, with the key at keyPath.
+// Each image is resolved to its digest first, so what's signed is what the
+// FROM refers to now. Once they're all signed, it writes a manifest to w, one
+// line per image with its FROM reference, digest reference and signature
+// tag, separated by tabs.
+func DockerfileSignCmd(ctx context.Context, dockerfilePath, keyPath string, so SignOptions, pf cosign.PassFunc, w io.Writer) error {
+	images, err := cosign.DockerfileBaseImages(dockerfilePath)
+	if err != nil {
+		return err
+	}
+	if len(images) == 0 {
+		return fmt.Errorf("%s has no base images to sign", dockerfilePath)
+	}
+	so, pks, err := prepareSign([]string{keyPath}, so, pf)
+	if err != nil {
+		return err
+	}
+
+	lines := make([]string, 0, len(images))
+	for _, image := range images {
+		ref, err := parseReference(image, so.Registry)
+		if err != nil {
+			return fmt.Errorf("%s: %v", image, err)
+		}
+		desc, err := so.Registry.Remote().Get(ref)
+		if err != nil {
+			return fmt.Errorf("resolving %s: %v", image, err)
+		}
+		digestRef := ref.Context().Digest(desc.Digest.String())
+		logger.Infow("Signing base image", "image", image, "digest", desc.Digest.String())
+		if err := signImage(ctx, pks, digestRef.String(), so, ioutil.Discard); err != nil {
+			return fmt.Errorf("signing %s: %v", image, err)
+		}
+		lines = append(lines, fmt.Sprintf("%s\t%s\t%s", image, digestRef, ref.Context().Tag(oci.Munge(desc))))
+	}
+	for _, l := range lines {
+		if _, err := fmt.Fprintln(w, l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func dockerfileVerify() *ffcli.Command {
+	var (
+		flagset       = flag.NewFlagSet("cosign dockerfile verify", flag.ExitOnError)
+		policyPath    = flagset.String("policy", "", "path to the YAML or JSON signature policy every base image must satisfy")
+		updateDigests = flagset.Bool("update-digests", false, "if every base image is verified, pin each FROM instruction to the verified digest, rewriting the Dockerfile in place")
+		tsaCerts      = flagset.String("timestamp-certs", "", "path to the PEM encoded root certificates of the timestamp authority, needed by a policy with maxSignatureAge")
+		ro            = registryFlags(flagset)
+	)
+	return &ffcli.Command{
+		Name:       "verify",
+		ShortUsage: "cosign dockerfile verify -policy <policy.yaml> [-update-digests] [-timestamp-certs <roots.pem>] [-registry-username <user> -registry-password <pass>] <Dockerfile>",
+		ShortHelp:  "Verify every base image in the FROM instructions of a Dockerfile against a signature policy",
+		FlagSet:    flagset,
+		Exec: func(ctx context.Context, args []string) error {
+			ro.Context = ctx
+			if *policyPath == "" || len(args) != 1 {
+				return flag.ErrHelp
+			}
+			opts := []cosign.VerifyOption{}
+			if *tsaCerts != "" {
+				roots, err := cosign.LoadCertPool(*tsaCerts)
+				if err != nil {
+					return fmt.Errorf("loading timestamp certs: %v", err)
+				}
+				opts = append(opts, cosign.VerifyTimestampAuthority(roots))
+			}
+			return DockerfileVerifyCmd(ctx, args[0], *policyPath, *updateDigests, *ro, os.Stdout, opts...)
+		},
+	}
+}
+
+// DockerfileVerifyCmd checks every base image of the Dockerfile at
+// dockerfilePath against the policy at policyPath, see
+// cosign.VerifyImagePolicy. Each image is resolved to its digest first, and
+// a line is written to w per image with its FROM reference, digest reference
+// and whether it's signed, separated by tabs. It fails if any image doesn't
+// satisfy the policy. Otherwise, if updateDigests is set, the FROM
+// instructions are pinned to the digests that were verified.
+func DockerfileVerifyCmd(ctx context.Context, dockerfilePath, policyPath string, updateDigests bool, ro oci.RegistryOptions, w io.Writer, opts ...cosign.VerifyOption) error {
+	policy, err := cosign.LoadPolicy(policyPath)
+	if err != nil {
+		return err
+	}
+	images, err := cosign.DockerfileBaseImages(dockerfilePath)
+	if err != nil {
+		return err
+	}
+	if len(images) == 0 {
+		return fmt.Errorf("%s has no base images to verify", dockerfilePath)
+	}
+	// Each image is checked against the same keys, so load them once.
+	opts = append(opts, cosign.VerifyRegistryOptions(ro), cosign.WithKeyCache(len(policy.RequiredKeys), 0))
+
+	digests := map[string]string{}
+	failed := 0
+	for _, image := range images {
+		ref, err := parseReference(image, ro)
+		if err != nil {
+			return fmt.Errorf("%s: %v", image, err)
+		}
+		desc, err := ro.Remote().Get(ref)
+		if err != nil {
+			return fmt.Errorf("resolving %s: %v", image, err)
+		}
+		digestRef := ref.Context().Digest(desc.Digest.String())
+		status := "signed"
+		if err := cosign.VerifyImagePolicy(digestRef, policy, opts...); err != nil {
+			logger.Errorw("Base image failed the policy", "image", image, "digest", desc.Digest.String(), "error", err)
+			status = "unsigned: " + err.Error()
+			failed++
+		} else {
+			digests[image] = desc.Digest.String()
+		}
+		if _, err := fmt.Fprintf(w, "%s\t%s\t%s\n", image, digestRef, status); err != nil {
+			return err
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d base image(s) failed the policy", failed, len(images))
+	}
+	if updateDigests {
+		if err := cosign.PinDockerfileBaseImages(dockerfilePath, digests); err != nil {
+			return fmt.Errorf("pinning digests: %v", err)
+		}
+		logger.Infow("Pinned base images to their verified digests", "dockerfile", dockerfilePath)
+	}
+	return nil
+}
@@ -22,40 +22,43 @@ import (
 	"flag"
 	"fmt"
 
-	"github.com/google/go-containerregistry/pkg/name"
 	"github.com/peterbourgon/ff/v3/ffcli"
-	"github.com/sigstore/cosign/pkg/cosign"
+	"github.com/sigstore/cosign/pkg/cosign/oci"
 )
 
 func Download() *ffcli.Command {
 	var (
 		flagset = flag.NewFlagSet("cosign download", flag.ExitOnError)
+		ro      = registryFlags(flagset)
 	)
 	return &ffcli.Command{
 		Name:       "download",
-		ShortUsage: "cosign download <image uri>",
+		ShortUsage: "cosign download [-registry-username <user> -registry-password <pass>] <image uri>",
 		ShortHelp:  "Download signatures from the supplied container image",
 		FlagSet:    flagset,
 		Exec: func(ctx context.Context, args []string) error {
+			ro.Context = ctx
 			if len(args) != 1 {
 				return flag.ErrHelp
 			}
-			return DownloadCmd(ctx, args[0])
+			return DownloadCmd(ctx, args[0], *ro)
 		},
 	}
 }
 
-func DownloadCmd(_ context.Context, imageRef string) error {
-	ref, err := name.ParseReference(imageRef)
+func DownloadCmd(ctx context.Context, imageRef string, ro oci.RegistryOptions) error {
+	ro.Context = ctx
+	ref, err := parseReference(imageRef, ro)
 	if err != nil {
 		return err
 	}
 
-	signatures, _, err := cosign.FetchSignatures(ref)
+	res, err := oci.ResolveAndFetchSignatures(ref, ro)
 	if err != nil {
 		return err
 	}
-	for _, sig := range signatures {
+	logger.Infow("Fetched signatures", "ref", ref.String(), "digest", res.ResolvedDigest, "signatures", len(res.Signatures))
+	for _, sig := range res.Signatures {
 		b, err := json.Marshal(sig)
 		if err != nil {
 			return err
@@ -27,7 +27,7 @@ import (
 	"github.com/google/go-containerregistry/pkg/name"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
 	"github.com/peterbourgon/ff/v3/ffcli"
-	"github.com/sigstore/cosign/pkg/cosign"
+	"github.com/sigstore/cosign/pkg/cosign/oci"
 )
 
 func Generate() *ffcli.Command {
@@ -62,7 +62,7 @@ func GenerateCmd(_ context.Context, imageRef string, a map[string]string, w io.W
 		return err
 	}
 
-	payload, err := cosign.Payload(get.Descriptor, a)
+	payload, err := oci.Payload(get.Descriptor, a)
 	if err != nil {
 		return err
 	}
@@ -18,13 +18,17 @@ package cli
 
 import (
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
 	"errors"
 	"flag"
 	"fmt"
 	"io/ioutil"
+	"math"
 	"os"
 
 	"github.com/sigstore/cosign/pkg/cosign"
+	"github.com/sigstore/cosign/pkg/cosign/keyring"
 
 	"github.com/peterbourgon/ff/v3/ffcli"
 	"golang.org/x/term"
@@ -32,35 +36,107 @@ import (
 
 func GenerateKeyPair() *ffcli.Command {
 	var (
-		flagset = flag.NewFlagSet("cosign generate-key-pair", flag.ExitOnError)
+		flagset     = flag.NewFlagSet("cosign generate-key-pair", flag.ExitOnError)
+		kdf         = flagset.String("kdf", "scrypt", "how to derive the key encrypting the private key: scrypt or argon2id")
+		keyringName = flagset.String("local-keyring", "", "store the private key under this name in the OS keychain, and write the public key to <name>.pub; where there's no keychain, the private key is written to <name>.key")
+		memory      = flagset.Uint("argon2-memory", uint(cosign.DefaultArgon2Params.Memory), "with -kdf argon2id, the memory to use in KiB")
+		iterations  = flagset.Uint("argon2-iterations", uint(cosign.DefaultArgon2Params.Iterations), "with -kdf argon2id, the number of iterations")
+		parallelism = flagset.Uint("argon2-parallelism", uint(cosign.DefaultArgon2Params.Parallelism), "with -kdf argon2id, the number of lanes")
 	)
 
 	return &ffcli.Command{
 		Name:       "generate-key-pair",
-		ShortUsage: "cosign generate-key-pair",
+		ShortUsage: "cosign generate-key-pair [-kdf scrypt|argon2id [-argon2-memory <KiB>] [-argon2-iterations <n>] [-argon2-parallelism <n>]] [-local-keyring <name>]",
 		ShortHelp:  "generate-key-pair generates a key-pair",
 		FlagSet:    flagset,
 		Exec: func(ctx context.Context, args []string) error {
-			return GenerateKeyPairCmd(ctx)
+			params := cosign.DefaultArgon2Params
+			argon2Flags := false
+			flagset.Visit(func(f *flag.Flag) {
+				switch f.Name {
+				case "argon2-memory", "argon2-iterations", "argon2-parallelism":
+					argon2Flags = true
+				}
+			})
+			if argon2Flags {
+				if *kdf != "argon2id" {
+					return errors.New("-argon2-memory, -argon2-iterations and -argon2-parallelism need -kdf argon2id")
+				}
+				if *memory > math.MaxUint32 || *iterations > math.MaxUint32 || *parallelism > math.MaxUint8 {
+					return errors.New("argon2 parameters out of range")
+				}
+				params = cosign.Argon2Params{
+					Memory:      uint32(*memory),
+					Iterations:  uint32(*iterations),
+					Parallelism: uint8(*parallelism),
+				}
+				if err := params.Validate(); err != nil {
+					return err
+				}
+			}
+			return GenerateKeyPairCmd(ctx, *kdf, *keyringName, params)
 		},
 	}
 }
 
-func GenerateKeyPairCmd(ctx context.Context) error {
-	keys, err := cosign.GenerateKeyPair(getPass)
+// GenerateKeyPairCmd writes a new key pair to cosign.key and cosign.pub. With
+// keyringName, the private key is stored in the OS keychain instead, if there
+// is one, and the files are named after keyringName. params are used with the
+// argon2id kdf.
+func GenerateKeyPairCmd(ctx context.Context, kdf, keyringName string, params cosign.Argon2Params) error {
+	privPath, pubPath := "cosign.key", "cosign.pub"
+	if keyringName != "" {
+		privPath, pubPath = keyringName+".key", keyringName+".pub"
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return err
+		}
+		switch err := keyring.Set(keyringName, priv); err {
+		case nil:
+			logger.Infow("Stored private key in the OS keychain", "name", keyringName)
+			return writePublicKey(pubPath, pub)
+		case keyring.ErrUnavailable:
+			logger.Warnw("OS keychain not available, writing the private key to a file instead", "path", privPath)
+		default:
+			return err
+		}
+	}
+
+	var keys *cosign.Keys
+	var err error
+	switch kdf {
+	case "scrypt":
+		keys, err = cosign.GenerateKeyPair(getPass)
+	case "argon2id":
+		keys, err = cosign.GenerateKeyPairArgon2(getPass, params)
+	default:
+		return fmt.Errorf("unsupported kdf: %s", kdf)
+	}
 	if err != nil {
 		return err
 	}
 	// TODO: make sure the perms are locked down first.
-	if err := ioutil.WriteFile("cosign.key", keys.PrivateBytes, 0600); err != nil {
+	if err := ioutil.WriteFile(privPath, keys.PrivateBytes, 0600); err != nil {
 		return err
 	}
-	fmt.Fprintln(os.Stderr, "Private key written to cosign.key")
+	logger.Infow("Wrote private key", "path", privPath)
 
-	if err := ioutil.WriteFile("cosign.pub", keys.PublicBytes, 0600); err != nil {
+	if err := ioutil.WriteFile(pubPath, keys.PublicBytes, 0600); err != nil {
+		return err
+	}
+	logger.Infow("Wrote public key", "path", pubPath)
+	return nil
+}
+
+func writePublicKey(path string, pub ed25519.PublicKey) error {
+	b, err := cosign.MarshalPublicKey(pub)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path, b, 0600); err != nil {
 		return err
 	}
-	fmt.Fprintln(os.Stderr, "Public key written to cosign.pub")
+	logger.Infow("Wrote public key", "path", path)
 	return nil
 }
 
@@ -0,0 +1,130 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/peterbourgon/ff/v3/ffcli"
+	"github.com/sigstore/cosign/pkg/cosign"
+	"github.com/sigstore/cosign/pkg/cosign/tuf"
+)
+
+func Initialize() *ffcli.Command {
+	var (
+		flagset   = flag.NewFlagSet("cosign initialize", flag.ExitOnError)
+		rekorURL  = flagset.String("rekor-url", cosign.DefaultRekorURL, "address of the rekor server")
+		fulcioURL = flagset.String("fulcio-url", cosign.DefaultFulcioURL, "address of the fulcio server")
+		refresh   = flagset.Bool("refresh", false, "replace roots that have already been pinned")
+		tufMirror = flagset.String("tuf-mirror", "", "get the roots from the TUF repository at this address instead")
+		tufRoot   = flagset.String("tuf-root", "", "path to a root.json of the -tuf-mirror repository to trust, instead of the last one used or the embedded one")
+	)
+	return &ffcli.Command{
+		Name:       "initialize",
+		ShortUsage: "cosign initialize [-rekor-url <url>] [-fulcio-url <url>] [-refresh] [-tuf-mirror <url> [-tuf-root <path>]]",
+		ShortHelp:  "Fetch and pin the rekor public key and fulcio root certificate",
+		FlagSet:    flagset,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 0 {
+				return flag.ErrHelp
+			}
+			if *tufRoot != "" && *tufMirror == "" {
+				return errors.New("-tuf-root requires -tuf-mirror")
+			}
+			path, err := cosign.RootsPath()
+			if err != nil {
+				return err
+			}
+			if *tufMirror != "" {
+				return InitializeTUFCmd(ctx, *tufMirror, *tufRoot, *rekorURL, *fulcioURL, path)
+			}
+			return InitializeCmd(ctx, *rekorURL, *fulcioURL, path, *refresh)
+		},
+	}
+}
+
+// InitializeCmd pins the roots rekorURL and fulcioURL serve at path, unless
+// some are already pinned. With refresh, they're replaced, but only by roots
+// that continue them, see cosign.Roots.CheckContinuity, unless the pinned ones
+// are invalid. To pin unrelated roots, remove the pinned ones first.
+func InitializeCmd(ctx context.Context, rekorURL, fulcioURL, path string, refresh bool) error {
+	var pinned *cosign.Roots
+	if _, err := os.Stat(path); err == nil {
+		pinned, err = cosign.LoadRoots(path)
+		if err != nil && !refresh {
+			return fmt.Errorf("pinned roots at %s are invalid, use -refresh to replace them: %v", path, err)
+		}
+		if !refresh {
+			logger.Infow("Roots already pinned, use -refresh to update them", "path", path)
+			return nil
+		}
+	}
+
+	roots, err := cosign.FetchRoots(ctx, rekorURL, fulcioURL)
+	if err != nil {
+		return err
+	}
+	if pinned != nil {
+		if err := roots.CheckContinuity(pinned); err != nil {
+			return fmt.Errorf("roots from %s and %s can't replace the ones pinned at %s, remove it to pin them anyway: %v", rekorURL, fulcioURL, path, err)
+		}
+	}
+	if err := cosign.WriteRoots(path, roots); err != nil {
+		return err
+	}
+	logger.Infow("Wrote roots", "path", path)
+	return nil
+}
+
+// InitializeTUFCmd pins the roots the TUF repository at mirror currently
+// lists. It starts from the root.json at rootPath if it's set, or else the one
+// saved by the last run next to the roots at path, or else the embedded one,
+// and saves the root.json it ends up trusting for the next run. The roots are
+// always replaced, as TUF decides whether they're current.
+func InitializeTUFCmd(ctx context.Context, mirror, rootPath, rekorURL, fulcioURL, path string) error {
+	savedRoot := filepath.Join(filepath.Dir(path), "tuf-root.json")
+	if rootPath == "" {
+		rootPath = savedRoot
+	}
+	root, err := ioutil.ReadFile(rootPath)
+	if err != nil && (rootPath != savedRoot || !os.IsNotExist(err)) {
+		return err
+	}
+
+	c, err := tuf.NewClient(mirror, root)
+	if err != nil {
+		return err
+	}
+	roots, err := c.Update(ctx, rekorURL, fulcioURL)
+	if err != nil {
+		return err
+	}
+	if err := cosign.WriteRoots(path, roots); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(savedRoot, c.Root(), 0600); err != nil {
+		return err
+	}
+	logger.Infow("Wrote roots from TUF", "path", path, "mirror", mirror)
+	return nil
+}
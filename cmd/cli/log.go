@@ -0,0 +1,79 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// logger is where diagnostics go. Output meant for other tools, like
+// payloads and signatures, still goes to stdout.
+var logger = mustLogger(os.Stderr, "text", "info")
+
+// SetupLogging sends diagnostics to w, formatted as json or text, dropping
+// anything below level (debug, info, warn or error).
+func SetupLogging(w io.Writer, format, level string) error {
+	l, err := newLogger(w, format, level)
+	if err != nil {
+		return err
+	}
+	logger = l
+	return nil
+}
+
+// Logger returns the logger that SetupLogging configured.
+func Logger() *zap.SugaredLogger {
+	return logger
+}
+
+func newLogger(w io.Writer, format, level string) (*zap.SugaredLogger, error) {
+	var lvl zapcore.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q, expected debug, info, warn or error", level)
+	}
+
+	var enc zapcore.Encoder
+	switch format {
+	case "json":
+		ec := zap.NewProductionEncoderConfig()
+		ec.EncodeTime = zapcore.ISO8601TimeEncoder
+		enc = zapcore.NewJSONEncoder(ec)
+	case "text":
+		// People read this one, so leave out the noise.
+		ec := zap.NewDevelopmentEncoderConfig()
+		ec.TimeKey = ""
+		ec.CallerKey = ""
+		ec.StacktraceKey = ""
+		enc = zapcore.NewConsoleEncoder(ec)
+	default:
+		return nil, fmt.Errorf("invalid log format %q, expected json or text", format)
+	}
+	return zap.New(zapcore.NewCore(enc, zapcore.AddSync(w), lvl)).Sugar(), nil
+}
+
+func mustLogger(w io.Writer, format, level string) *zap.SugaredLogger {
+	l, err := newLogger(w, format, level)
+	if err != nil {
+		panic(err)
+	}
+	return l
+}
@@ -0,0 +1,44 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	"github.com/sigstore/cosign/pkg/cosign/metrics"
+)
+
+// ServeMetrics serves the Prometheus metrics at /metrics on addr, until the
+// returned function is called.
+func ServeMetrics(addr string) (func(), error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	s := &http.Server{Handler: mux}
+	go func() {
+		if err := s.Serve(l); err != http.ErrServerClosed {
+			logger.Warnw("Serving metrics failed", "error", err)
+		}
+	}()
+	logger.Infow("Serving metrics", "address", "http://"+l.Addr().String()+"/metrics")
+	return func() { s.Shutdown(context.Background()) }, nil
+}
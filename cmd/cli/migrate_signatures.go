@@ -0,0 +1,159 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"context"
+	"crypto/ed25519"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/peterbourgon/ff/v3/ffcli"
+	"github.com/sigstore/cosign/pkg/cosign"
+	"github.com/sigstore/cosign/pkg/cosign/oci"
+)
+
+func MigrateSignatures() *ffcli.Command {
+	var (
+		flagset   = flag.NewFlagSet("cosign migrate-signatures", flag.ExitOnError)
+		oldKey    = flagset.String("old-key", "", "path to the public key the existing signatures were made with")
+		newKey    = flagset.String("new-key", "", "path to the private key to re-sign with")
+		dryRun    = flagset.Bool("dry-run", false, "only print what would be re-signed")
+		verifyOld = flagset.Bool("verify-old-key-still-valid", false, "after migrating, check that the old signatures still verify")
+	)
+	return &ffcli.Command{
+		Name:       "migrate-signatures",
+		ShortUsage: "cosign migrate-signatures -old-key <key> -new-key <key> [-dry-run] [-verify-old-key-still-valid] <repository>",
+		ShortHelp:  "Re-sign every image in a repository that verifies with one key using another",
+		FlagSet:    flagset,
+		Exec: func(ctx context.Context, args []string) error {
+			if *oldKey == "" || *newKey == "" {
+				return flag.ErrHelp
+			}
+			if len(args) != 1 {
+				return flag.ErrHelp
+			}
+			return MigrateSignaturesCmd(ctx, *oldKey, *newKey, args[0], *dryRun, *verifyOld, getPass)
+		},
+	}
+}
+
+func MigrateSignaturesCmd(ctx context.Context, oldKeyRef, newKeyPath, repoRef string, dryRun, verifyOld bool, pf cosign.PassFunc) error {
+	repo, err := name.NewRepository(repoRef)
+	if err != nil {
+		return err
+	}
+
+	oldPub, err := cosign.LoadPublicKey(oldKeyRef)
+	if err != nil {
+		return err
+	}
+
+	var newPriv ed25519.PrivateKey
+	if !dryRun {
+		newPriv, err = loadPrivateKey(newKeyPath, false, pf)
+		if err != nil {
+			return err
+		}
+	}
+
+	ro := oci.RegistryOptions{Context: ctx}
+	c := ro.Remote()
+	tags, err := c.List(repo)
+	if err != nil {
+		return err
+	}
+
+	var migrated, skipped, failed int
+	seen := map[string]bool{}
+	digests := []name.Digest{}
+	for _, tag := range tags {
+		// Signature tags are migrated through the images they sign.
+		if strings.HasSuffix(tag, ".cosign") {
+			continue
+		}
+		desc, err := c.Get(repo.Tag(tag))
+		if err != nil {
+			logger.Errorw("Failed to get image", "ref", repo.Tag(tag).String(), "error", err)
+			failed++
+			continue
+		}
+		// Several tags can point at the same image, only sign it once.
+		if seen[desc.Digest.String()] {
+			continue
+		}
+		seen[desc.Digest.String()] = true
+		digest := repo.Digest(desc.Digest.String())
+
+		verified, err := cosign.Verify(digest, oldPub, true, nil, cosign.VerifyRegistryOptions(ro))
+		if err != nil {
+			logger.Warnw("Skipping image, no signatures from the old key", "image", digest.String(), "error", err)
+			skipped++
+			continue
+		}
+
+		dstTag := repo.Tag(oci.Munge(desc))
+		if dryRun {
+			logger.Infow("Would re-sign image", "image", digest.String(), "signatures", len(verified), "ref", dstTag.String())
+			migrated++
+			continue
+		}
+
+		ok := true
+		for _, vp := range verified {
+			signature := ed25519.Sign(newPriv, vp.Payload)
+			if err := oci.Upload(signature, vp.Payload, dstTag, oci.UploadRegistryOptions(ro)); err != nil {
+				logger.Errorw("Failed to upload signature", "image", digest.String(), "error", err)
+				ok = false
+				break
+			}
+		}
+		if !ok {
+			failed++
+			continue
+		}
+		logger.Infow("Re-signed image", "image", digest.String(), "signatures", len(verified))
+		digests = append(digests, digest)
+		migrated++
+	}
+
+	msg := "Migrated images"
+	if dryRun {
+		msg = "Would migrate images"
+	}
+	logger.Infow(msg, "migrated", migrated, "skipped", skipped, "failed", failed)
+
+	if failed > 0 {
+		return fmt.Errorf("%d image(s) failed to migrate", failed)
+	}
+
+	if verifyOld && !dryRun {
+		invalid := 0
+		for _, digest := range digests {
+			if _, err := cosign.Verify(digest, oldPub, true, nil, cosign.VerifyRegistryOptions(ro)); err != nil {
+				logger.Errorw("Old signatures no longer verify", "image", digest.String(), "error", err)
+				invalid++
+			}
+		}
+		if invalid > 0 {
+			return fmt.Errorf("%d image(s) no longer verify with the old key", invalid)
+		}
+	}
+	return nil
+}
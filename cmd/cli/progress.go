@@ -0,0 +1,65 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/sigstore/cosign/pkg/cosign/oci"
+)
+
+const progressWidth = 30
+
+// progressBar draws the progress of uploads and fetches as a bar on w, which
+// should be a terminal. The bar is redrawn in place, and only when the
+// percentage changes.
+func progressBar(w io.Writer) oci.ProgressFunc {
+	last := -1
+	return func(event string, done, total int64) {
+		pct := 100
+		if total > 0 {
+			pct = int(done * 100 / total)
+		}
+		if pct == last && done != total {
+			return
+		}
+		last = pct
+		filled := pct * progressWidth / 100
+		fmt.Fprintf(w, "\r%-6s [%s%s] %3d%% %s/%s", event,
+			strings.Repeat("=", filled), strings.Repeat(" ", progressWidth-filled),
+			pct, humanBytes(done), humanBytes(total))
+		if done == total {
+			fmt.Fprintln(w)
+			last = -1
+		}
+	}
+}
+
+func humanBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,77 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"flag"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/peterbourgon/ff/v3/ffcli"
+	"github.com/sigstore/cosign/pkg/cosign"
+)
+
+func PublicKey() *ffcli.Command {
+	var (
+		flagset = flag.NewFlagSet("cosign public-key", flag.ExitOnError)
+		key     = flagset.String("key", "", "path to the private key")
+		out     = flagset.String("out", "", "path to write the public key to, rather than stdout")
+	)
+	return &ffcli.Command{
+		Name:       "public-key",
+		ShortUsage: "cosign public-key -key <key> [-out <pub.pem>]",
+		ShortHelp:  "Print the PEM encoded public key of the supplied private key",
+		FlagSet:    flagset,
+		Exec: func(ctx context.Context, args []string) error {
+			if *key == "" || len(args) != 0 {
+				return flag.ErrHelp
+			}
+			return PublicKeyCmd(ctx, *key, *out, getPass, os.Stdout)
+		},
+	}
+}
+
+// PublicKeyCmd writes the PEM encoded public key of the private key at keyPath
+// to out, or to w if out is empty.
+func PublicKeyCmd(_ context.Context, keyPath, out string, pf cosign.PassFunc, w io.Writer) error {
+	// Fail before prompting for a password that wouldn't be used.
+	if strings.HasPrefix(keyPath, "kms://") {
+		return errors.New("KMS keys aren't supported, -key must be the path to a cosign private key")
+	}
+	pk, err := loadPrivateKey(keyPath, false, pf)
+	if err != nil {
+		return err
+	}
+	pub, err := cosign.MarshalPublicKey(pk.Public().(ed25519.PublicKey))
+	if err != nil {
+		return err
+	}
+	if out == "" {
+		_, err := w.Write(pub)
+		return err
+	}
+	if err := ioutil.WriteFile(out, pub, 0600); err != nil {
+		return err
+	}
+	logger.Infow("Wrote public key", "path", out)
+	return nil
+}
@@ -0,0 +1,63 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"flag"
+	"os"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+
+	"github.com/sigstore/cosign/pkg/cosign/oci"
+	"golang.org/x/term"
+)
+
+// registryFlags adds the flags that configure how to talk to the registry to
+// flagset. Without them, credentials come from the docker config.
+func registryFlags(flagset *flag.FlagSet) *oci.RegistryOptions {
+	ro := &oci.RegistryOptions{}
+	flagset.StringVar(&ro.Username, "registry-username", "", "username to authenticate to the registry with, instead of the docker config")
+	flagset.StringVar(&ro.Password, "registry-password", "", "password to authenticate to the registry with, instead of the docker config")
+	flagset.BoolVar(&ro.AllowInsecure, "allow-insecure-registry", false, "allow talking to the registry over plain HTTP, or HTTPS without verifying its certificate")
+	flagset.BoolVar(&ro.SkipTLSVerify, "insecure-skip-tls-verify", false, "don't verify the registry's TLS certificate, e.g. to allow self-signed certificates")
+	flagset.IntVar(&ro.Retry.MaxAttempts, "retry-attempts", 3, "how many times to try registry requests that fail with a transient error (429 or 5xx)")
+	flagset.DurationVar(&ro.Retry.InitialDelay, "retry-delay", time.Second, "delay before the first retry, doubling after each one")
+	ro.Retry.MaxDelay = 30 * time.Second
+	flagset.DurationVar(&ro.PushTimeout, "push-timeout", 0, "timeout for uploading signatures, within -timeout")
+	flagset.DurationVar(&ro.FetchTimeout, "fetch-timeout", 0, "timeout for fetching signatures, within -timeout")
+	// Signing big indexes can take a while, so show how it's going.
+	if term.IsTerminal(int(os.Stderr.Fd())) {
+		ro.Progress = progressBar(os.Stderr)
+	}
+	return ro
+}
+
+// parseReference parses imageRef for the registry settings in ro, and warns
+// if they are insecure.
+func parseReference(imageRef string, ro oci.RegistryOptions) (name.Reference, error) {
+	warnInsecure(ro)
+	return name.ParseReference(imageRef, ro.NameOptions()...)
+}
+
+func warnInsecure(ro oci.RegistryOptions) {
+	if ro.AllowInsecure {
+		logger.Warn("-allow-insecure-registry is set, registry traffic may be sent over plain HTTP and TLS certificates are not verified!")
+	} else if ro.SkipTLSVerify {
+		logger.Warn("-insecure-skip-tls-verify is set, TLS certificates of the registry are not verified!")
+	}
+}
@@ -0,0 +1,62 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/sigstore/cosign/pkg/cosign/oci"
+)
+
+// sbomFormats are the syft outputs of each -sbom-format.
+var sbomFormats = map[string]struct {
+	output    string
+	mediaType types.MediaType
+}{
+	"cyclonedx": {output: "cyclonedx-json", mediaType: oci.CycloneDXMediaType},
+	"spdx":      {output: "spdx-json", mediaType: oci.SPDXMediaType},
+}
+
+// GenerateSBOM generates an SBOM of the image ref points at with syft, which
+// has to be in $PATH, in format, cyclonedx or spdx. It returns the SBOM and
+// its media type.
+func GenerateSBOM(ref name.Reference, format string) ([]byte, types.MediaType, error) {
+	f, ok := sbomFormats[format]
+	if !ok {
+		return nil, "", fmt.Errorf("unknown SBOM format %q, wanted cyclonedx or spdx", format)
+	}
+	syft, err := exec.LookPath("syft")
+	if err != nil {
+		return nil, "", errors.New("generating an SBOM needs syft in $PATH")
+	}
+	cmd := exec.Command(syft, "-q", "registry:"+ref.String(), "-o", f.output) // #nosec G204
+	cmd.Stderr = os.Stderr
+	sbom, err := cmd.Output()
+	if err != nil {
+		return nil, "", fmt.Errorf("syft: %v", err)
+	}
+	if !json.Valid(sbom) {
+		return nil, "", fmt.Errorf("syft output isn't %s JSON", format)
+	}
+	return sbom, f.mediaType, nil
+}
@@ -17,20 +17,36 @@ limitations under the License.
 package cli
 
 import (
+	"bytes"
 	"context"
+	"crypto"
 	"crypto/ed25519"
+	"crypto/rand"
 	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"strings"
+	"sync"
+	"time"
 
-	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
 	"github.com/peterbourgon/ff/v3/ffcli"
 	"github.com/sigstore/cosign/pkg/cosign"
+	"github.com/sigstore/cosign/pkg/cosign/fulcio"
+	"github.com/sigstore/cosign/pkg/cosign/keyring"
+	"github.com/sigstore/cosign/pkg/cosign/metrics"
+	"github.com/sigstore/cosign/pkg/cosign/oci"
+	"github.com/spiffe/go-spiffe/v2/svid/x509svid"
+	"github.com/spiffe/go-spiffe/v2/workloadapi"
+	"golang.org/x/term"
 )
 
 type annotationsMap struct {
@@ -45,11 +61,97 @@ func (a *annotationsMap) Set(s string) error {
 	if len(kvp) != 2 {
 		return fmt.Errorf("invalid flag: %s, expected key=value", s)
 	}
+	if _, ok := a.annotations[kvp[0]]; ok {
+		return fmt.Errorf("duplicate annotation: %s", kvp[0])
+	}
 
 	a.annotations[kvp[0]] = kvp[1]
 	return nil
 }
 
+// reservedAnnotationPrefix starts annotation keys that are reserved for cosign
+// itself, which can't be signed with -a.
+const reservedAnnotationPrefix = "cosign."
+
+// checkReservedAnnotations rejects annotations with reserved keys.
+func checkReservedAnnotations(annotations map[string]string) error {
+	for k := range annotations {
+		if strings.HasPrefix(k, reservedAnnotationPrefix) {
+			return fmt.Errorf("annotation %s: keys starting with %q are reserved", k, reservedAnnotationPrefix)
+		}
+	}
+	return nil
+}
+
+// withAnnotations returns annotations with extra added, for annotations that
+// cosign sets from its own flags. Empty values in extra are skipped. It
+// doesn't change annotations.
+func withAnnotations(annotations, extra map[string]string) (map[string]string, error) {
+	with := map[string]string{}
+	for k, v := range extra {
+		if v == "" {
+			continue
+		}
+		if _, ok := annotations[k]; ok {
+			return nil, fmt.Errorf("annotation %s is set by its own flag, it can't be passed with -a too", k)
+		}
+		with[k] = v
+	}
+	if len(with) == 0 {
+		return annotations, nil
+	}
+	for k, v := range annotations {
+		with[k] = v
+	}
+	return with, nil
+}
+
+// inGitHubActions reports whether cosign is running in a GitHub Actions
+// workflow.
+func inGitHubActions() bool {
+	return os.Getenv("GITHUB_ACTIONS") == "true"
+}
+
+// githubAnnotations returns the annotations describing the GitHub Actions
+// run, see cosign.GitHubRepositoryAnnotation.
+func githubAnnotations() (map[string]string, error) {
+	repo := os.Getenv("GITHUB_REPOSITORY")
+	if repo == "" {
+		return nil, errors.New("GITHUB_REPOSITORY isn't set, -github-annotations only works in GitHub Actions")
+	}
+	return map[string]string{
+		cosign.GitHubRepositoryAnnotation: repo,
+		cosign.GitHubRefAnnotation:        os.Getenv("GITHUB_REF"),
+		cosign.GitHubSHAAnnotation:        os.Getenv("GITHUB_SHA"),
+		cosign.GitHubWorkflowAnnotation:   os.Getenv("GITHUB_WORKFLOW"),
+	}, nil
+}
+
+// signerAnnotations returns the annotations that so adds to the generated
+// payload on top of so.Annotations.
+func signerAnnotations(so SignOptions) (map[string]string, error) {
+	extra := map[string]string{cosign.SignerIdentityAnnotation: so.Identity}
+	if so.GitHubAnnotations {
+		gh, err := githubAnnotations()
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range gh {
+			extra[k] = v
+		}
+	}
+	if so.ExpireIn > 0 {
+		extra[cosign.ExpiryAnnotation] = time.Now().Add(so.ExpireIn).UTC().Format(time.RFC3339)
+	}
+	if !so.NotBefore.IsZero() {
+		extra[cosign.NotBeforeAnnotation] = so.NotBefore.UTC().Format(time.RFC3339)
+	}
+	if so.RecordCreationTimestamp {
+		extra[cosign.TimestampAnnotation] = time.Now().UTC().Format(time.RFC3339)
+	}
+	return extra, nil
+}
+
 func (a *annotationsMap) String() string {
 	s := []string{}
 	for k, v := range a.annotations {
@@ -58,81 +160,1079 @@ func (a *annotationsMap) String() string {
 	return strings.Join(s, ",")
 }
 
+// keysFlag is a -key flag that can be repeated, to sign with several keys.
+type keysFlag []string
+
+func (k *keysFlag) Set(s string) error {
+	*k = append(*k, s)
+	return nil
+}
+
+func (k *keysFlag) String() string {
+	return strings.Join(*k, ",")
+}
+
+// platformsFlag is a -platform flag that can be repeated, each an
+// os/arch[/variant], see oci.ParsePlatform.
+type platformsFlag []v1.Platform
+
+func (p *platformsFlag) Set(s string) error {
+	platform, err := oci.ParsePlatform(s)
+	if err != nil {
+		return err
+	}
+	*p = append(*p, platform)
+	return nil
+}
+
+func (p *platformsFlag) String() string {
+	s := []string{}
+	for _, platform := range *p {
+		s = append(s, oci.FormatPlatform(platform))
+	}
+	return strings.Join(s, ",")
+}
+
 func Sign() *ffcli.Command {
 	var (
 		flagset     = flag.NewFlagSet("cosign sign", flag.ExitOnError)
-		key         = flagset.String("key", "", "path to the private key")
+		keys        = keysFlag{}
 		upload      = flagset.Bool("upload", true, "whether to upload the signature")
+		dryRun      = flagset.Bool("dry-run", false, "print the signature tag, payload and signature that would be uploaded, without uploading them")
+		recursive   = flagset.Bool("recursive", false, "if the image is an index, also sign every manifest in it")
+		sboms       = flagset.Bool("recursive-sbom", false, "also sign each CycloneDX and SPDX SBOM layer attached to the image as a referrer, storing the signatures as referrers of the layers")
+		sbom        = flagset.Bool("sbom", false, "generate an SBOM of the image with syft, attach it as a referrer and sign it, along with the image")
+		sbomFormat  = flagset.String("sbom-format", "cyclonedx", "format of the SBOM -sbom generates, cyclonedx or spdx")
 		payloadPath = flagset.String("payload", "", "path to a payload file to use rather than generating one.")
+		payloadOut  = flagset.String("output-payload", "", "write the payload signed for the image to this path, before signing it; with -dsse, the DSSE envelope")
+		referrers   = flagset.Bool("referrers", false, "store the signature with the OCI referrers API, if the registry supports it")
+		yes         = flagset.Bool("yes", false, "don't ask for confirmation of the digest a tag resolves to before signing it; only asked when stdin is a terminal. It doesn't imply -force")
+		force       = flagset.Bool("force", false, "replace signatures of the image by the same key(s) instead of adding another, so re-signing doesn't grow the signature tag")
+		upgradeKey  = flagset.Bool("auto-upgrade-key", false, "re-encrypt a scrypt encrypted private key with argon2id")
+		localImage  = flagset.Bool("local-image", false, "sign the images in the OCI image layout at the given path, rather than an image in a registry")
+		layoutOut   = flagset.String("oci-layout-output", "", "after signing, also write the image and its signatures to the OCI image layout at this path, creating it if needed")
+		manifest    = flagset.String("manifest", "", "path to a CSV file of images to sign, one per row, each followed by key=value annotations, which are signed along with -a")
+		imagesFile  = flagset.String("images-file", "", "path to a file of images to sign, one reference per line; blank lines and # comments are skipped")
+		parallelism = flagset.Int("parallelism", 4, "how many images from -manifest or -images-file to sign at once")
+		digest      = flagset.String("digest", "", "sign the image with this digest (sha256:...) in the given repository, rather than whatever its tag points at")
+		dsse        = flagset.Bool("dsse", false, "wrap the payload in a DSSE envelope, stored as a layer with media type "+string(cosign.DSSEMediaType))
+		predType    = flagset.String("predicate-type", "", "with -predicate, the predicateType of the in-toto statement, e.g. https://slsa.dev/provenance/v0.2")
+		predicate   = flagset.String("predicate", "", "path to a JSON predicate to sign as an in-toto attestation about the image, in a DSSE envelope, rather than a simple signing payload")
+		signConfig  = flagset.Bool("sign-container-config", false, "also sign the image's config blob, with a separate signature")
+		tsaURL      = flagset.String("timestamp-authority", "", "URL of an RFC 3161 timestamp authority to countersign the signature")
+		certPath    = flagset.String("cert", "", "path to the PEM encoded certificate for the key, to store with the signature")
+		chainPath   = flagset.String("cert-chain", "", "path to the PEM encoded intermediate certificates that issued -cert, to store with it")
+		identity    = flagset.String("identity", "", "who is signing, e.g. alice@example.com, signed along with the annotations")
+		github      = flagset.Bool("github-annotations", false, "sign the GitHub repository, ref, commit and workflow from the GITHUB_* environment variables; on by default in GitHub Actions")
+		keyless     = flagset.Bool("keyless", false, "sign with an ephemeral key and a certificate from Fulcio for the identity in an OIDC token, instead of -key")
+		oidcProv    = flagset.String("oidc-provider", "", "with -keyless, where to get the OIDC token without a browser: google (the GCE/GKE metadata server), github (GitHub Actions), gitlab (GitLab CI, from $"+fulcio.GitLabTokenEnv+") or custom")
+		oidcURL     = flagset.String("oidc-token-url", "", "with -oidc-provider custom, the URL to GET the OIDC token from")
+		idToken     = flagset.String("identity-token", "", "sign keylessly with this OIDC token instead of -oidc-provider: the token, a file holding it, or github-actions to get it from GitHub Actions")
+		spiffeSock  = flagset.String("spiffe-socket", "", "sign with the X.509 SVID from the SPIFFE Workload API at this address, e.g. unix:///tmp/spire-agent/public/api.sock, instead of -key")
+		fulcioURL   = flagset.String("fulcio-url", cosign.DefaultFulcioURL, "with -keyless, address of the fulcio server")
+		expireIn    = flagset.Duration("expire-in", 0, "sign an expiry this long from now, e.g. 720h, after which verify rejects the signature")
+		notBefore   = flagset.String("not-before", "", "sign a time (RFC 3339) before which verify rejects the signature, e.g. the start of a deployment window")
+		recordTime  = flagset.Bool("record-creation-timestamp", false, "sign the time of signing, by the local clock, so verify -assert-signed-after can check it")
+		keyringName = flagset.String("local-keyring", "", "sign with the private key stored under this name in the OS keychain by generate-key-pair -local-keyring, or <name>.key if there's no keychain")
 		annotations = annotationsMap{}
+		platforms   = platformsFlag{}
+		ro          = registryFlags(flagset)
 	)
-	flagset.Var(&annotations, "a", "extra key=value pairs to sign")
+	flagset.Var(&keys, "key", "path to the private key; repeat it to sign with several keys at once")
+	flagset.Var(&platforms, "platform", "if the image is an index, sign the manifest for this platform (os/arch[/variant]) in it instead; repeat it to sign several")
+	flagset.Var(&annotations, "a", "extra key=value pairs to sign; keys starting with cosign. are reserved")
+	flagset.Var(&annotations, "annotations", "same as -a")
+	flagset.BoolVar(yes, "y", false, "same as -yes")
+	flagset.BoolVar(yes, "assume-yes", false, "same as -yes")
+	flagset.BoolVar(yes, "skip-confirmation", false, "same as -yes")
 	return &ffcli.Command{
 		Name:       "sign",
-		ShortUsage: "cosign sign -key <key> [-payload <path>] [-a key=value] [-upload=true|false] <image uri>",
+		ShortUsage: "cosign sign -key <key> [-key <key>...]|-keyless -oidc-provider google|github|gitlab|custom [-oidc-token-url <url>]|-identity-token <token|path|github-actions> [-fulcio-url <url>]|-spiffe-socket <address> [-local-keyring <name>] [-payload <path>] [-output-payload <path>] [-a key=value] [-identity <signer>] [-github-annotations] [-expire-in <duration>] [-not-before <time>] [-record-creation-timestamp] [-upload=true|false] [-dry-run] [-yes|-y] [-force] [-recursive] [-recursive-sbom] [-sbom [-sbom-format cyclonedx|spdx]] [-dsse] [-predicate <file.json> -predicate-type <uri>] [-sign-container-config] [-timestamp-authority <url>] [-cert <cert.pem> [-cert-chain <chain.pem>]] [-referrers] [-digest sha256:...] [-platform <os/arch>...] [-oci-layout-output <dir>] [-registry-username <user> -registry-password <pass>] <image uri>\n  cosign sign -key <key> -local-image [-a key=value] [-expire-in <duration>] [-not-before <time>] [-record-creation-timestamp] <oci layout path>\n  cosign sign -key <key> -manifest <file.csv> [-a key=value] [-parallelism <n>]\n  cosign sign -key <key> [-key <key>...] -images-file <file> [-parallelism <n>] [-a key=value]",
 		ShortHelp:  "Sign the supplied container image",
 		FlagSet:    flagset,
 		Exec: func(ctx context.Context, args []string) error {
-			if *key == "" {
+			ro.Context = ctx
+			// -identity-token is only used for keyless signing, so it implies it.
+			if *idToken != "" {
+				*keyless = true
+			}
+			if len(keys) == 0 && *keyringName == "" && !*keyless && *spiffeSock == "" {
 				return flag.ErrHelp
 			}
+			if *spiffeSock != "" && (*keyless || len(keys) != 0 || *keyringName != "" || *certPath != "" || *manifest != "" || *localImage || *imagesFile != "") {
+				return errors.New("-spiffe-socket can't be used with -keyless, -identity-token, -key, -local-keyring, -cert, -manifest, -local-image or -images-file")
+			}
+			var tp fulcio.OIDCTokenProvider
+			if *keyless {
+				if len(keys) != 0 || *keyringName != "" || *certPath != "" || *manifest != "" || *localImage || *imagesFile != "" {
+					return errors.New("-keyless and -identity-token can't be used with -key, -local-keyring, -cert, -manifest, -local-image or -images-file")
+				}
+				switch {
+				case *idToken != "" && (*oidcProv != "" || *oidcURL != ""):
+					return errors.New("-identity-token can't be used with -oidc-provider or -oidc-token-url")
+				case *idToken != "":
+					tp = fulcio.NewIdentityTokenProvider(*idToken)
+				case *oidcProv == "":
+					return errors.New("-keyless needs -oidc-provider or -identity-token, the interactive browser flow isn't supported")
+				default:
+					var err error
+					if tp, err = fulcio.NewOIDCTokenProvider(*oidcProv, *oidcURL); err != nil {
+						return err
+					}
+				}
+			} else if *oidcProv != "" || *oidcURL != "" {
+				return errors.New("-oidc-provider and -oidc-token-url need -keyless")
+			}
+			if err := checkReservedAnnotations(annotations.annotations); err != nil {
+				return err
+			}
+			if len(keys) > 1 && (*manifest != "" || *localImage || *certPath != "") {
+				return errors.New("only one -key can be used with -manifest, -local-image or -cert")
+			}
+			if *imagesFile != "" && (*manifest != "" || *localImage || *payloadPath != "" || *digest != "" || !*upload || *dryRun) {
+				return errors.New("-images-file can't be used with -manifest, -local-image, -payload, -digest, -upload=false or -dry-run")
+			}
+			if *manifest != "" && (!*upload || *dryRun) {
+				return errors.New("-manifest uploads the signature of every image in it, it can't be used with -upload=false or -dry-run")
+			}
+			if *keyringName != "" && (*manifest != "" || *localImage) {
+				return errors.New("-local-keyring can't be used with -manifest or -local-image")
+			}
+			if *keyringName != "" && len(keys) != 0 && *certPath != "" {
+				return errors.New("only one of -key and -local-keyring can be used with -cert")
+			}
+
+			if *dsse && (*manifest != "" || *localImage || *signConfig) {
+				return errors.New("-dsse can't be used with -manifest, -local-image or -sign-container-config")
+			}
+			if *predicate != "" {
+				if *predType == "" {
+					return errors.New("-predicate needs -predicate-type")
+				}
+				if *manifest != "" || *localImage || *payloadPath != "" || *signConfig || *sbom || *sboms || *recursive || len(annotations.annotations) != 0 || *identity != "" {
+					return errors.New("-predicate is signed as an in-toto statement, it can't be used with -manifest, -local-image, -payload, -sign-container-config, -sbom, -recursive-sbom, -recursive, -a or -identity")
+				}
+			} else if *predType != "" {
+				return errors.New("-predicate-type needs -predicate")
+			}
+			if *sboms && (*manifest != "" || *localImage) {
+				return errors.New("-recursive-sbom can't be used with -manifest or -local-image")
+			}
+			if *sbom && (*manifest != "" || *localImage || *payloadPath != "" || !*upload || *dryRun) {
+				return errors.New("-sbom attaches the SBOM and signs its digest in the generated payload, it can't be used with -manifest, -local-image, -payload, -upload=false or -dry-run")
+			}
+			if *digest != "" && (*manifest != "" || *localImage) {
+				return errors.New("-digest can't be used with -manifest or -local-image")
+			}
+			if *tsaURL != "" && (*manifest != "" || *localImage || !*upload) {
+				return errors.New("-timestamp-authority is only stored with uploaded signatures, it can't be used with -manifest, -local-image or -upload=false")
+			}
+			if *force && (*keyless || *manifest != "" || *localImage || *referrers || !*upload) {
+				return errors.New("-force replaces signatures in the signature tag by the same key, it can't be used with -keyless, -manifest, -local-image, -referrers or -upload=false")
+			}
+			if len(platforms) != 0 && (*manifest != "" || *localImage || *imagesFile != "" || *payloadPath != "" || *recursive) {
+				return errors.New("-platform can't be used with -manifest, -local-image, -images-file, -payload or -recursive")
+			}
+			if *payloadOut != "" && (*manifest != "" || *localImage || *imagesFile != "" || *recursive || len(platforms) != 0 || *predicate != "") {
+				return errors.New("-output-payload writes the payload of one image, it can't be used with -manifest, -local-image, -images-file, -recursive, -platform or -predicate")
+			}
+			if *layoutOut != "" && (*manifest != "" || *localImage || *imagesFile != "" || !*upload || *dryRun) {
+				return errors.New("-oci-layout-output writes the uploaded signatures, it can't be used with -manifest, -local-image, -images-file, -upload=false or -dry-run")
+			}
+			if *certPath != "" && (*manifest != "" || *localImage || !*upload) {
+				return errors.New("-cert is only stored with uploaded signatures, it can't be used with -manifest, -local-image or -upload=false")
+			}
+			cert, chain, err := readCertificateFlags(*certPath, *chainPath)
+			if err != nil {
+				return err
+			}
+			if *identity != "" && *manifest != "" {
+				return errors.New("-identity can't be used with -manifest")
+			}
+			if *expireIn < 0 {
+				return errors.New("-expire-in must be positive")
+			}
+			if *expireIn != 0 && (*manifest != "" || *payloadPath != "" || *predicate != "") {
+				return errors.New("-expire-in is signed into the generated payload, it can't be used with -manifest, -payload or -predicate")
+			}
+			if *recordTime && (*manifest != "" || *payloadPath != "" || *predicate != "") {
+				return errors.New("-record-creation-timestamp is signed into the generated payload, it can't be used with -manifest, -payload or -predicate")
+			}
+			var notBeforeTime time.Time
+			if *notBefore != "" {
+				if *manifest != "" || *payloadPath != "" || *predicate != "" {
+					return errors.New("-not-before is signed into the generated payload, it can't be used with -manifest, -payload or -predicate")
+				}
+				var err error
+				if notBeforeTime, err = time.Parse(time.RFC3339, *notBefore); err != nil {
+					return fmt.Errorf("invalid -not-before: %v", err)
+				}
+				if *expireIn != 0 && !notBeforeTime.Before(time.Now().Add(*expireIn)) {
+					return errors.New("-not-before must be before the signature expires with -expire-in")
+				}
+			}
+			githubSet := false
+			flagset.Visit(func(f *flag.Flag) {
+				githubSet = githubSet || f.Name == "github-annotations"
+			})
+			if !githubSet {
+				// In GitHub Actions, sign where the image came from whenever
+				// cosign generates the payload.
+				*github = inGitHubActions() && *manifest == "" && *payloadPath == "" && *predicate == ""
+			} else if *github && (*manifest != "" || *predicate != "") {
+				return errors.New("-github-annotations can't be used with -manifest or -predicate")
+			}
+
+			if *manifest != "" {
+				if len(args) != 0 {
+					return flag.ErrHelp
+				}
+				return SignManifestCmd(ctx, keys[0], *manifest, annotations.annotations, *parallelism, *referrers, *upgradeKey, *ro, getPass, os.Stdout)
+			}
 
-			if len(args) != 1 {
+			if *imagesFile != "" {
+				if len(args) != 0 {
+					return flag.ErrHelp
+				}
+			} else if len(args) != 1 {
 				return flag.ErrHelp
 			}
 
-			return SignCmd(ctx, *key, args[0], *upload, *payloadPath, annotations.annotations, getPass)
+			if *localImage {
+				extra, err := signerAnnotations(SignOptions{Identity: *identity, GitHubAnnotations: *github, ExpireIn: *expireIn, NotBefore: notBeforeTime, RecordCreationTimestamp: *recordTime})
+				if err != nil {
+					return err
+				}
+				signed, err := withAnnotations(annotations.annotations, extra)
+				if err != nil {
+					return err
+				}
+				if err := cosign.SignOCILayout(args[0], keys[0], signed, getPass); err != nil {
+					return err
+				}
+				logger.Infow("Wrote signatures", "layout", args[0])
+				return nil
+			}
+
+			var imageRef string
+			if len(args) == 1 {
+				imageRef = args[0]
+			}
+			if *digest != "" {
+				if imageRef, err = DigestReference(imageRef, *digest, *ro); err != nil {
+					return err
+				}
+			}
+
+			format := ""
+			if *sbom {
+				format = *sbomFormat
+			}
+			so := SignOptions{
+				Upload:                  *upload,
+				DryRun:                  *dryRun,
+				PayloadPath:             *payloadPath,
+				OutputPayload:           *payloadOut,
+				Annotations:             annotations.annotations,
+				Identity:                *identity,
+				GitHubAnnotations:       *github,
+				ExpireIn:                *expireIn,
+				NotBefore:               notBeforeTime,
+				RecordCreationTimestamp: *recordTime,
+				Referrers:               *referrers,
+				Force:                   *force,
+				Confirm:                 !*yes && *upload && !*dryRun && *imagesFile == "" && term.IsTerminal(int(os.Stdin.Fd())),
+				UpgradeKey:              *upgradeKey,
+				Recursive:               *recursive,
+				RecursiveSBOM:           *sboms,
+				SBOMFormat:              format,
+				SignConfig:              *signConfig,
+				DSSE:                    *dsse,
+				TimestampAuthority:      *tsaURL,
+				Cert:                    cert,
+				CertChain:               chain,
+				LocalKeyring:            *keyringName,
+				OCILayoutOutput:         *layoutOut,
+				Platforms:               platforms,
+				Registry:                *ro,
+			}
+			if *predicate != "" {
+				if so.Predicate, err = ioutil.ReadFile(*predicate); err != nil {
+					return err
+				}
+				so.PredicateType = *predType
+			}
+			if *keyless {
+				return SignKeylessCmd(ctx, tp, *fulcioURL, imageRef, so)
+			}
+			if *spiffeSock != "" {
+				return SignSPIFFECmd(ctx, *spiffeSock, imageRef, so)
+			}
+			if *imagesFile != "" {
+				return SignImagesFileCmd(ctx, keys, *imagesFile, *parallelism, so, getPass)
+			}
+			return SignKeysCmd(ctx, keys, imageRef, so, getPass)
 		},
 	}
 }
 
-func SignCmd(ctx context.Context, keyPath string,
-	imageRef string, upload bool, payloadPath string,
-	annotations map[string]string, pf cosign.PassFunc) error {
-	ref, err := name.ParseReference(imageRef)
+// SignOptions configures SignCmd.
+type SignOptions struct {
+	// Upload pushes the signature to the registry. Without it, the signature
+	// is printed instead.
+	Upload bool
+	// DryRun prints the tag, payload and signature that Upload would push,
+	// and doesn't push anything.
+	DryRun bool
+	// PayloadPath is a payload to sign, rather than generating one.
+	PayloadPath string
+	// OutputPayload, if set, is where the image's payload is written before
+	// it's signed, so it's there even if signing fails. With DSSE, it's the
+	// envelope.
+	OutputPayload string
+	// Annotations are added to the generated payload.
+	Annotations map[string]string
+	// Identity names who is signing, and is added to the generated payload
+	// as cosign.SignerIdentityAnnotation.
+	Identity string
+	// GitHubAnnotations adds the cosign.GitHubRepositoryAnnotation and friends
+	// to the generated payload, from the GITHUB_* environment variables.
+	GitHubAnnotations bool
+	// ExpireIn, if set, adds cosign.ExpiryAnnotation to the generated
+	// payload, this long from when it's signed.
+	ExpireIn time.Duration
+	// NotBefore, if set, adds cosign.NotBeforeAnnotation to the generated
+	// payload, so it isn't valid until then.
+	NotBefore time.Time
+	// RecordCreationTimestamp adds cosign.TimestampAnnotation, the time of
+	// signing, to the generated payload.
+	RecordCreationTimestamp bool
+	// Referrers stores the signature with the OCI referrers API too.
+	Referrers bool
+	// Confirm asks on stdin whether to sign the digest a tag resolves to,
+	// before signing it. Images referred to by digest aren't asked about.
+	Confirm bool
+	// Force replaces the signatures already uploaded by the same keys, with
+	// the same media type, rather than adding another, see
+	// oci.UploadReplace.
+	Force bool
+	// UpgradeKey re-encrypts a scrypt encrypted private key with argon2id.
+	UpgradeKey bool
+	// Recursive also signs every manifest in an index, each with its own
+	// signature.
+	Recursive bool
+	// RecursiveSBOM also signs each SBOM layer attached to the image, see
+	// oci.SBOMLayers. Their signatures are stored as referrers of the layers.
+	RecursiveSBOM bool
+	// SBOMFormat, if set, generates an SBOM of the image in this format with
+	// GenerateSBOM, attaches it as a referrer and signs it. Its digest is
+	// signed in the image's payload as cosign.SBOMAnnotation.
+	SBOMFormat string
+	// SignConfig also signs the config blob of the image, see
+	// cosign.ContainerConfigMediaType.
+	SignConfig bool
+	// DSSE wraps payloads in a DSSE envelope signed by the keys, which is
+	// stored with media type cosign.DSSEMediaType.
+	DSSE bool
+	// Predicate, if set, is signed as an in-toto statement of PredicateType
+	// about the image, see cosign.AttestationPayload, rather than a
+	// generated payload. The statement is always wrapped in a DSSE envelope.
+	Predicate     []byte
+	PredicateType string
+	// TimestampAuthority is the URL of an RFC 3161 timestamp authority to
+	// countersign uploaded signatures.
+	TimestampAuthority string
+	// Cert is the PEM encoded certificate for the key, stored with uploaded
+	// signatures along with CertChain, its PEM encoded intermediates.
+	Cert      []byte
+	CertChain []byte
+	// LocalKeyring is the name of a private key in the OS keychain to sign
+	// with, along with the keys at the paths given to SignKeysCmd. Where there
+	// is no keychain, the key is loaded from <name>.key instead.
+	LocalKeyring string
+	// OCILayoutOutput, if set, is the path of an OCI image layout to write
+	// the image and its signatures to once it's signed, see
+	// cosign.ExportOCILayout.
+	OCILayoutOutput string
+	// Platforms, if set, signs the manifest for each of these platforms in
+	// the index, rather than the index itself, see oci.PlatformManifest.
+	Platforms []v1.Platform
+	Registry  oci.RegistryOptions
+}
+
+func SignCmd(ctx context.Context, keyPath string, imageRef string, so SignOptions, pf cosign.PassFunc) error {
+	return SignKeysCmd(ctx, []string{keyPath}, imageRef, so, pf)
+}
+
+// SignKeysCmd is SignCmd, signing with each of the keys at keyPaths. Their
+// signatures of each image are uploaded together.
+func SignKeysCmd(ctx context.Context, keyPaths []string, imageRef string, so SignOptions, pf cosign.PassFunc) error {
+	so, pks, err := prepareSign(keyPaths, so, pf)
+	if err != nil {
+		return err
+	}
+	return signImage(ctx, pks, imageRef, so, os.Stdout)
+}
+
+// AttestCmd signs the JSON predicate at predicatePath as an in-toto
+// attestation of predicateType about imageRef, with each of the keys at
+// keyPaths. It's SignKeysCmd with so.Predicate set.
+func AttestCmd(ctx context.Context, keyPaths []string, imageRef, predicateType, predicatePath string, so SignOptions, pf cosign.PassFunc) error {
+	predicate, err := ioutil.ReadFile(predicatePath)
+	if err != nil {
+		return err
+	}
+	so.Predicate, so.PredicateType = predicate, predicateType
+	return SignKeysCmd(ctx, keyPaths, imageRef, so, pf)
+}
+
+// SignImagesFileCmd is SignKeysCmd for each image listed in the file at
+// imagesPath (see cosign.ParseImagesFile), parallelism at a time. Each image
+// that fails to sign is logged with its error. If the file can't be read, the
+// error is an ExitError with code 2.
+func SignImagesFileCmd(ctx context.Context, keyPaths []string, imagesPath string, parallelism int, so SignOptions, pf cosign.PassFunc) error {
+	if parallelism < 1 {
+		return fmt.Errorf("invalid parallelism: %d", parallelism)
+	}
+	refs, err := cosign.ParseImagesFile(imagesPath)
+	if err != nil {
+		return &ExitError{Code: 2, Err: err}
+	}
+	so, pks, err := prepareSign(keyPaths, so, pf)
+	if err != nil {
+		return err
+	}
+
+	errs := make([]error, len(refs))
+	sem := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	for i, ref := range refs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, ref string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			errs[i] = signImage(ctx, pks, ref, so, ioutil.Discard)
+		}(i, ref)
+	}
+	wg.Wait()
+
+	failed := 0
+	for i, ref := range refs {
+		if errs[i] != nil {
+			logger.Errorw("Failed to sign image", "image", ref, "error", errs[i])
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d image(s) failed to sign", failed, len(refs))
+	}
+	logger.Infow("Signed images", "count", len(refs))
+	return nil
+}
+
+// prepareSign adds the signer annotations to so and loads the private keys
+// to sign with.
+func prepareSign(keyPaths []string, so SignOptions, pf cosign.PassFunc) (SignOptions, []crypto.Signer, error) {
+	so, err := withSignerAnnotations(so)
+	if err != nil {
+		return so, nil, err
+	}
+	pks := make([]crypto.Signer, 0, len(keyPaths))
+	for _, keyPath := range keyPaths {
+		if len(keyPaths) > 1 {
+			logger.Infow("Loading private key", "path", keyPath)
+		}
+		pk, err := loadPrivateKey(keyPath, so.UpgradeKey, pf)
+		if err != nil {
+			return so, nil, fmt.Errorf("%s: %v", keyPath, err)
+		}
+		pks = append(pks, pk)
+	}
+	if so.LocalKeyring != "" {
+		pk, err := loadKeyringKey(so.LocalKeyring, so.UpgradeKey, pf)
+		if err != nil {
+			return so, nil, err
+		}
+		pks = append(pks, pk)
+	}
+	if len(pks) == 0 {
+		return so, nil, errors.New("no private key to sign with")
+	}
+	return so, pks, nil
+}
+
+// withSignerAnnotations adds the identity, GitHub and validity annotations so
+// asks for to its annotations.
+func withSignerAnnotations(so SignOptions) (SignOptions, error) {
+	if so.Identity == "" && !so.GitHubAnnotations && so.ExpireIn == 0 && so.NotBefore.IsZero() && !so.RecordCreationTimestamp {
+		return so, nil
+	}
+	if so.PayloadPath != "" {
+		return so, errors.New("the identity, GitHub, expiry, not-before and timestamp annotations are signed into the generated payload, they can't be used with -payload")
+	}
+	extra, err := signerAnnotations(so)
+	if err != nil {
+		return so, err
+	}
+	so.Annotations, err = withAnnotations(so.Annotations, extra)
+	return so, err
+}
+
+// SignKeylessCmd signs imageRef with an ephemeral key, certified by the
+// Fulcio instance at fulcioURL for the identity in the OIDC token from tp. The
+// certificate and its chain are stored with the signature, and the key is
+// thrown away.
+func SignKeylessCmd(ctx context.Context, tp fulcio.OIDCTokenProvider, fulcioURL, imageRef string, so SignOptions) error {
+	if !so.Upload || so.DryRun {
+		return errors.New("keyless signatures are only verifiable with their certificate, which is stored with uploaded signatures")
+	}
+	so, err := withSignerAnnotations(so)
+	if err != nil {
+		return err
+	}
+	token, err := tp.GetToken(ctx)
+	if err != nil {
+		return err
+	}
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	sc, err := fulcio.NewClient(fulcioURL).GetSigningCertificate(ctx, token, pub)
+	if err != nil {
+		return err
+	}
+	logger.Infow("Got a signing certificate", "fulcio", fulcioURL)
+	so.Cert, so.CertChain = sc.CertPEM, sc.ChainPEM
+	return signImage(ctx, []crypto.Signer{priv}, imageRef, so, os.Stdout)
+}
+
+// SignSPIFFECmd signs imageRef with the X.509 SVID the SPIFFE Workload API
+// at socket, e.g. unix:///tmp/spire-agent/public/api.sock, issues to this
+// workload. See SignSVIDCmd.
+func SignSPIFFECmd(ctx context.Context, socket, imageRef string, so SignOptions) error {
+	svid, err := workloadapi.FetchX509SVID(ctx, workloadapi.WithAddr(socket))
+	if err != nil {
+		return fmt.Errorf("fetching an X.509 SVID from %s: %v", socket, err)
+	}
+	logger.Infow("Got an X.509 SVID", "spiffeID", svid.ID.String(), "expires", svid.Certificates[0].NotAfter)
+	return SignSVIDCmd(ctx, svid, imageRef, so)
+}
+
+// SignSVIDCmd signs imageRef with the private key of svid, and stores its
+// certificate and intermediates with the signature, so verify
+// -expected-spiffe-id can check the SPIFFE ID in it. SPIRE issues ECDSA SVIDs
+// by default; RSA ones can't sign.
+func SignSVIDCmd(ctx context.Context, svid *x509svid.SVID, imageRef string, so SignOptions) error {
+	if !so.Upload || so.DryRun {
+		return errors.New("SVID signatures are only verifiable with their certificate, which is stored with uploaded signatures")
+	}
+	so, err := withSignerAnnotations(so)
+	if err != nil {
+		return err
+	}
+	so.Cert = cosign.MarshalCertificates(svid.Certificates[:1])
+	so.CertChain = cosign.MarshalCertificates(svid.Certificates[1:])
+	return signImage(ctx, []crypto.Signer{svid.PrivateKey}, imageRef, so, os.Stdout)
+}
+
+// DigestReference returns the reference to the image with digest in the
+// repository of imageRef. A tag in imageRef is dropped, so what gets signed
+// can't change between resolving the tag and signing it.
+func DigestReference(imageRef, digest string, ro oci.RegistryOptions) (string, error) {
+	if _, err := v1.NewHash(digest); err != nil {
+		return "", fmt.Errorf("invalid -digest %q: %v", digest, err)
+	}
+	ref, err := name.ParseReference(imageRef, ro.NameOptions()...)
+	if err != nil {
+		return "", err
+	}
+	switch r := ref.(type) {
+	case name.Digest:
+		if r.DigestStr() != digest {
+			return "", fmt.Errorf("%s doesn't match -digest %s", imageRef, digest)
+		}
+	case name.Tag:
+		// name.ParseReference fills in "latest", only mention tags that were given.
+		if strings.HasSuffix(imageRef, ":"+r.TagStr()) {
+			logger.Infow("Signing the digest rather than the tag", "tag", r.String(), "digest", digest)
+		}
+	}
+	return ref.Context().Digest(digest).String(), nil
+}
+
+// signImage signs imageRef with each of pks, and uploads the signature unless so says
+// not to. Signatures that aren't uploaded are written to w.
+func signImage(ctx context.Context, pks []crypto.Signer, imageRef string, so SignOptions, w io.Writer) error {
+	defer metrics.ObserveSince(metrics.SignDuration, time.Now())
+	ro := so.Registry
+	ref, err := parseReference(imageRef, ro)
 	if err != nil {
 		return err
 	}
+	if len(so.Platforms) != 0 {
+		if so.Recursive || so.PayloadPath != "" {
+			return errors.New("-platform picks the manifests to sign, it can't be used with -recursive or -payload")
+		}
+		// Resolve them all first, so nothing is signed if any is missing.
+		refs := make([]name.Digest, 0, len(so.Platforms))
+		for _, p := range so.Platforms {
+			d, err := oci.PlatformManifest(ref, p, ro)
+			if err != nil {
+				return err
+			}
+			refs = append(refs, d)
+		}
+		platforms := so.Platforms
+		so.Platforms = nil
+		for i, d := range refs {
+			logger.Infow("Signing platform", "ref", ref.String(), "platform", oci.FormatPlatform(platforms[i]), "digest", d.DigestStr())
+			if err := signImage(ctx, pks, d.String(), so, w); err != nil {
+				return fmt.Errorf("%s: %v", oci.FormatPlatform(platforms[i]), err)
+			}
+		}
+		return nil
+	}
+	if so.Recursive && so.PayloadPath != "" {
+		return errors.New("-recursive can't be used with -payload, each manifest needs its own payload")
+	}
+	if so.Cert != nil {
+		if len(pks) != 1 {
+			return errors.New("a certificate is for one key, it can't be used with several")
+		}
+		if err := checkSigningCertificate(so.Cert, so.CertChain, pks[0]); err != nil {
+			return err
+		}
+	}
 
-	get, err := remote.Get(ref, remote.WithAuthFromKeychain(authn.DefaultKeychain))
+	get, err := remote.Get(ref, ro.RemoteOptions()...)
 	if err != nil {
 		return err
 	}
+	// Tags can move between a push and signing, so say what's signed.
+	logger.Infow("Signing image", "ref", ref.String(), "digest", get.Digest.String())
+	if _, isDigest := ref.(name.Digest); so.Confirm && !isDigest {
+		ok, err := confirm(os.Stdin, fmt.Sprintf("%s resolves to %s. Sign it? [y/N] ", ref, get.Digest))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errors.New("aborted")
+		}
+	}
+	if so.DSSE && so.SignConfig {
+		return errors.New("config signatures are told apart by their media type, they can't be wrapped in a DSSE envelope")
+	}
+	if so.SignConfig && get.MediaType.IsIndex() {
+		return errors.New("-sign-container-config needs an image, indexes don't have a config")
+	}
+	if so.Predicate != nil {
+		if err := attestImage(pks, ref.Context(), get.Descriptor, so, w); err != nil {
+			return err
+		}
+		return exportSigned(ref, so)
+	}
+
+	// The SBOM goes up first, so its digest can be signed in the payload.
+	var sbom *v1.Descriptor
+	if so.SBOMFormat != "" {
+		if sbom, err = attachSBOM(ref.Context().Digest(get.Digest.String()), get.Descriptor, so.SBOMFormat, ro); err != nil {
+			return err
+		}
+	}
 
 	// The payload can be specified via a flag to skip generation.
 	var payload []byte
-	if payloadPath != "" {
-		fmt.Fprintln(os.Stderr, "Using payload from:", payloadPath)
-		payload, err = ioutil.ReadFile(payloadPath)
+	if so.PayloadPath != "" {
+		logger.Infow("Using payload", "path", so.PayloadPath)
+		if payload, err = ioutil.ReadFile(so.PayloadPath); err != nil {
+			return err
+		}
+		if err := checkPayloadDigest(payload, get.Digest); err != nil {
+			return fmt.Errorf("%s: %v", so.PayloadPath, err)
+		}
 	} else {
-		payload, err = cosign.Payload(get.Descriptor, annotations)
+		annotations := so.Annotations
+		if sbom != nil {
+			if annotations, err = withAnnotations(annotations, map[string]string{cosign.SBOMAnnotation: sbom.Digest.String()}); err != nil {
+				return err
+			}
+		}
+		if payload, err = oci.Payload(get.Descriptor, annotations); err != nil {
+			return err
+		}
+	}
+	// With DSSE, the envelope is what's signed, so it's what's written.
+	mso := so
+	var mt types.MediaType
+	if so.DSSE {
+		if payload, err = dsseEnvelope(pks, "", payload); err != nil {
+			return err
+		}
+		mt = cosign.DSSEMediaType
+		mso.DSSE = false
+	}
+	if so.OutputPayload != "" {
+		if err := ioutil.WriteFile(so.OutputPayload, payload, 0644); err != nil {
+			return err
+		}
+		logger.Infow("Wrote payload", "path", so.OutputPayload)
 	}
+
+	if err := signDescriptor(pks, ref.Context(), get.Descriptor, payload, mt, mso, w); err != nil {
+		return err
+	}
+	if sbom != nil {
+		if err := signSBOM(pks, ref.Context(), *sbom, so, w); err != nil {
+			return err
+		}
+	}
+	if so.SignConfig {
+		img, err := get.Image()
+		if err != nil {
+			return err
+		}
+		config, err := img.ConfigName()
+		if err != nil {
+			return err
+		}
+		payload, err := oci.Payload(v1.Descriptor{Digest: config}, so.Annotations)
+		if err != nil {
+			return err
+		}
+		if err := signDescriptor(pks, ref.Context(), get.Descriptor, payload, cosign.ContainerConfigMediaType, so, w); err != nil {
+			return err
+		}
+	}
+	if so.RecursiveSBOM {
+		if err := signSBOMs(pks, ref.Context(), get.Descriptor, so, w); err != nil {
+			return err
+		}
+	}
+	if so.Recursive && get.MediaType.IsIndex() {
+		idx, err := get.ImageIndex()
+		if err != nil {
+			return err
+		}
+		if err := signManifests(pks, ref.Context(), idx, so, w); err != nil {
+			return err
+		}
+	}
+	return exportSigned(ref, so)
+}
+
+// exportSigned writes ref and its signatures to so.OCILayoutOutput, if it's
+// set.
+func exportSigned(ref name.Reference, so SignOptions) error {
+	if so.OCILayoutOutput == "" {
+		return nil
+	}
+	if err := cosign.ExportOCILayout(ref, so.OCILayoutOutput, so.Registry); err != nil {
+		return fmt.Errorf("writing %s: %v", so.OCILayoutOutput, err)
+	}
+	logger.Infow("Wrote OCI layout", "layout", so.OCILayoutOutput, "ref", ref.String())
+	return nil
+}
+
+// attestImage signs so.Predicate as an in-toto statement about desc in repo,
+// wrapped in a DSSE envelope.
+func attestImage(pks []crypto.Signer, repo name.Repository, desc v1.Descriptor, so SignOptions, w io.Writer) error {
+	if so.PayloadPath != "" || so.SignConfig || so.SBOMFormat != "" || so.Recursive || so.RecursiveSBOM || len(so.Annotations) != 0 {
+		return errors.New("an attestation is an in-toto statement, it can't have a payload, annotations, a config signature, SBOMs or be recursive")
+	}
+	payload, err := cosign.AttestationPayload(repo, desc, so.PredicateType, so.Predicate)
 	if err != nil {
 		return err
 	}
+	logger.Infow("Signing attestation", "predicateType", so.PredicateType, "digest", desc.Digest.String())
+	so.DSSE = true
+	return signDescriptor(pks, repo, desc, payload, cosign.InTotoMediaType, so, w)
+}
 
-	pass, err := pf(false)
+// checkPayloadDigest checks that payload, a simple signing payload, is about
+// the image with digest, so a payload for some other image isn't signed and
+// uploaded where it would never verify.
+func checkPayloadDigest(payload []byte, digest v1.Hash) error {
+	claims, err := cosign.ParsePayload(oci.SimpleSigningMediaType, payload)
+	if err != nil {
+		return fmt.Errorf("invalid payload: %v", err)
+	}
+	if len(claims.Digests) == 0 {
+		return errors.New("payload has no image digest")
+	}
+	for _, d := range claims.Digests {
+		if d == digest.Hex {
+			return nil
+		}
+	}
+	return fmt.Errorf("payload is for %s, not the image being signed, %s", strings.Join(claims.Digests, ", "), digest)
+}
+
+// signSBOMs signs each SBOM layer attached to desc in repo, with a payload
+// naming the layer's digest, and stores the signatures as referrers of the
+// layers.
+func signSBOMs(pks []crypto.Signer, repo name.Repository, desc v1.Descriptor, so SignOptions, w io.Writer) error {
+	sboms, err := oci.SBOMLayers(repo, desc, so.Registry)
 	if err != nil {
 		return err
 	}
-	kb, err := ioutil.ReadFile(keyPath)
+	if len(sboms) == 0 {
+		return fmt.Errorf("no SBOMs are attached to %s", desc.Digest)
+	}
+	for _, l := range sboms {
+		if err := signSBOM(pks, repo, l, so, w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// signSBOM signs the SBOM layer l in repo, storing the signature as a
+// referrer of the layer.
+func signSBOM(pks []crypto.Signer, repo name.Repository, l v1.Descriptor, so SignOptions, w io.Writer) error {
+	logger.Infow("Signing SBOM", "digest", l.Digest.String(), "mediaType", string(l.MediaType))
+	payload, err := oci.Payload(l, so.Annotations)
 	if err != nil {
 		return err
 	}
-	pk, err := cosign.LoadPrivateKey(kb, pass)
+	so.Referrers = true
+	return signDescriptor(pks, repo, l, payload, "", so, w)
+}
+
+// attachSBOM generates an SBOM of the image ref in format, and attaches it to
+// the image, desc, as a referrer. It returns the descriptor of the SBOM layer.
+func attachSBOM(ref name.Digest, desc v1.Descriptor, format string, ro oci.RegistryOptions) (*v1.Descriptor, error) {
+	logger.Infow("Generating SBOM", "format", format, "ref", ref.String())
+	sbom, mt, err := GenerateSBOM(ref, format)
+	if err != nil {
+		return nil, err
+	}
+	if err := oci.UploadSBOM(sbom, mt, desc, ref.Context(), ro); err != nil {
+		return nil, fmt.Errorf("attaching SBOM: %v", err)
+	}
+	h, size, err := v1.SHA256(bytes.NewReader(sbom))
+	if err != nil {
+		return nil, err
+	}
+	return &v1.Descriptor{MediaType: mt, Size: size, Digest: h}, nil
+}
+
+// signManifests signs every manifest in idx, and in any indexes nested in it.
+func signManifests(pks []crypto.Signer, repo name.Repository, idx v1.ImageIndex, so SignOptions, w io.Writer) error {
+	im, err := idx.IndexManifest()
 	if err != nil {
 		return err
 	}
-	signature := ed25519.Sign(pk, payload)
+	for _, desc := range im.Manifests {
+		payload, err := oci.Payload(desc, so.Annotations)
+		if err != nil {
+			return err
+		}
+		if err := signDescriptor(pks, repo, desc, payload, "", so, w); err != nil {
+			return err
+		}
+		if desc.MediaType.IsIndex() {
+			child, err := idx.ImageIndex(desc.Digest)
+			if err != nil {
+				return err
+			}
+			if err := signManifests(pks, repo, child, so, w); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// signDescriptor signs payload, the payload for desc in repo, with each of
+// pks, and uploads the signatures together unless so says not to. The payload
+// is stored with media type mt, or the default if it's empty.
+func signDescriptor(pks []crypto.Signer, repo name.Repository, desc v1.Descriptor, payload []byte, mt types.MediaType, so SignOptions, w io.Writer) error {
+	if so.DSSE {
+		var err error
+		if payload, err = dsseEnvelope(pks, mt, payload); err != nil {
+			return err
+		}
+		mt = cosign.DSSEMediaType
+	}
+	signatures := make([][]byte, 0, len(pks))
+	for _, pk := range pks {
+		signature, err := cosign.SignPayload(pk, payload)
+		if err != nil {
+			return err
+		}
+		signatures = append(signatures, signature)
+	}
 
-	if !upload {
-		fmt.Println(base64.StdEncoding.EncodeToString(signature))
+	if !so.Upload {
+		for _, signature := range signatures {
+			fmt.Fprintln(w, base64.StdEncoding.EncodeToString(signature))
+		}
 		return nil
 	}
 
 	// sha256:... -> sha256-...
-	dstTag := ref.Context().Tag(cosign.Munge(get.Descriptor))
+	dstTag := repo.Tag(oci.Munge(desc))
+
+	if so.DryRun {
+		fmt.Fprintln(w, "tag:", dstTag.String())
+		if mt != "" {
+			fmt.Fprintln(w, "mediaType:", mt)
+		}
+		fmt.Fprintln(w, "payload:", base64.StdEncoding.EncodeToString(payload))
+		for _, signature := range signatures {
+			fmt.Fprintln(w, "signature:", base64.StdEncoding.EncodeToString(signature))
+		}
+		return nil
+	}
 
-	fmt.Fprintln(os.Stderr, "Pushing signature to:", dstTag.String())
-	return cosign.Upload(signature, payload, dstTag)
+	opts := []oci.UploadOption{oci.UploadRegistryOptions(so.Registry)}
+	if so.Referrers {
+		opts = append(opts, oci.WithReferrers(desc))
+	}
+	if so.Force {
+		pubs := make([]ed25519.PublicKey, 0, len(pks))
+		for _, pk := range pks {
+			pub, ok := pk.Public().(ed25519.PublicKey)
+			if !ok {
+				return errors.New("-force only replaces signatures by ed25519 keys")
+			}
+			pubs = append(pubs, pub)
+		}
+		opts = append(opts, oci.UploadReplace(pubs...))
+	}
+	sps := make([]oci.SignedPayload, 0, len(signatures))
+	for _, signature := range signatures {
+		sp := oci.SignedPayload{
+			Base64Signature: base64.StdEncoding.EncodeToString(signature),
+			Payload:         payload,
+			MediaType:       mt,
+		}
+		if so.TimestampAuthority != "" {
+			token, err := cosign.RequestTimestamp(so.TimestampAuthority, signature)
+			if err != nil {
+				return fmt.Errorf("timestamping signature: %v", err)
+			}
+			sp.Base64Timestamp = base64.StdEncoding.EncodeToString(token)
+		}
+		if so.Cert != nil {
+			sp.Base64Certificate = base64.StdEncoding.EncodeToString(so.Cert)
+			if so.CertChain != nil {
+				sp.Base64Chain = base64.StdEncoding.EncodeToString(so.CertChain)
+			}
+		}
+		sps = append(sps, sp)
+	}
+
+	logger.Infow("Pushing signature", "ref", dstTag.String())
+	return oci.UploadSignatures(sps, dstTag, opts...)
+}
+
+// dsseEnvelope wraps payload, with media type mt or simple signing if it's
+// empty, in a DSSE envelope signed by each of pks.
+func dsseEnvelope(pks []crypto.Signer, mt types.MediaType, payload []byte) ([]byte, error) {
+	if mt == "" {
+		mt = oci.SimpleSigningMediaType
+	}
+	env, err := cosign.SignDSSE(pks[0], string(mt), payload)
+	if err != nil {
+		return nil, err
+	}
+	for _, pk := range pks[1:] {
+		if err := cosign.AddDSSESignature(env, pk); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(env)
+}
+
+// readCertificateFlags reads the files passed with -cert and -cert-chain, if
+// they were.
+func readCertificateFlags(certPath, chainPath string) ([]byte, []byte, error) {
+	if certPath == "" {
+		if chainPath != "" {
+			return nil, nil, errors.New("-cert-chain needs -cert")
+		}
+		return nil, nil, nil
+	}
+	cert, err := ioutil.ReadFile(certPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	if chainPath == "" {
+		return cert, nil, nil
+	}
+	chain, err := ioutil.ReadFile(chainPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cert, chain, nil
+}
+
+// checkSigningCertificate checks that cert is a certificate for pk, and that
+// both it and chain parse, before they're stored with signatures.
+func checkSigningCertificate(cert, chain []byte, pk crypto.Signer) error {
+	certs, err := cosign.ParseCertificates(cert)
+	if err != nil {
+		return fmt.Errorf("-cert: %v", err)
+	}
+	if err := cosign.CheckCertificate(certs[0], pk.Public()); err != nil {
+		return fmt.Errorf("-cert: %v", err)
+	}
+	if chain != nil {
+		if _, err := cosign.ParseCertificates(chain); err != nil {
+			return fmt.Errorf("-cert-chain: %v", err)
+		}
+	}
+	return nil
+}
+
+// loadKeyringKey returns the private key stored as name in the OS keychain,
+// or if there is no keychain, the one at name.key, like
+// GenerateKeyPairCmd stores it.
+func loadKeyringKey(name string, upgrade bool, pf cosign.PassFunc) (ed25519.PrivateKey, error) {
+	pk, err := keyring.Get(name)
+	if err == keyring.ErrUnavailable {
+		keyPath := name + ".key"
+		logger.Warnw("OS keychain not available, using the private key file instead", "path", keyPath)
+		return loadPrivateKey(keyPath, upgrade, pf)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return pk, nil
+}
+
+// loadPrivateKey prompts for the password and decrypts the private key at
+// keyPath. If upgrade is set, a scrypt encrypted key is rewritten in place
+// using argon2id.
+func loadPrivateKey(keyPath string, upgrade bool, pf cosign.PassFunc) (ed25519.PrivateKey, error) {
+	pass, err := pf(false)
+	if err != nil {
+		return nil, err
+	}
+	kb, err := ioutil.ReadFile(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	pk, err := cosign.LoadPrivateKey(kb, pass)
+	if err != nil {
+		return nil, err
+	}
+	if !upgrade {
+		return pk, nil
+	}
+
+	upgraded, ok, err := cosign.UpgradePrivateKey(kb, pass)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		if err := ioutil.WriteFile(keyPath, upgraded, 0600); err != nil {
+			return nil, err
+		}
+		logger.Infow("Re-encrypted private key with argon2id", "path", keyPath)
+	}
+	return pk, nil
 }
@@ -20,6 +20,8 @@ import (
 	"context"
 	"crypto/ed25519"
 	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io/ioutil"
@@ -31,13 +33,21 @@ import (
 
 func SignBlob() *ffcli.Command {
 	var (
-		flagset = flag.NewFlagSet("cosign sign-blob", flag.ExitOnError)
-		key     = flagset.String("key", "", "path to the private key")
-		b64     = flagset.Bool("b64", true, "whether to base64 encode the output")
+		flagset     = flag.NewFlagSet("cosign sign-blob", flag.ExitOnError)
+		key         = flagset.String("key", "", "path to the private key")
+		b64         = flagset.Bool("b64", true, "whether to base64 encode the output")
+		upgradeKey  = flagset.Bool("auto-upgrade-key", false, "re-encrypt a scrypt encrypted private key with argon2id")
+		bundleOut   = flagset.String("bundle-out", "", "also write the signature to this path as a Sigstore bundle (.sigstore)")
+		tsaURL      = flagset.String("timestamp-authority", "", "URL of an RFC 3161 timestamp authority to countersign the signature, stored in the -bundle-out bundle")
+		certPath    = flagset.String("cert", "", "path to the PEM encoded certificate for the key, stored in the -bundle-out bundle")
+		chainPath   = flagset.String("cert-chain", "", "path to the PEM encoded intermediate certificates that issued -cert, stored in the -bundle-out bundle")
+		dsse        = flagset.Bool("dsse", false, "output a DSSE envelope wrapping the blob, as JSON, rather than the signature")
+		payloadType = flagset.String("payload-type", "application/octet-stream", "the payloadType of the -dsse envelope, e.g. application/vnd.in-toto+json")
+		payloadOut  = flagset.String("output-payload", "", "with -dsse, also write the envelope to this path, before it's timestamped or bundled")
 	)
 	return &ffcli.Command{
 		Name:       "sign-blob",
-		ShortUsage: "cosign sign-blob -key <key> [-sig <sig path>] <blob>",
+		ShortUsage: "cosign sign-blob -key <key> [-dsse [-payload-type <type>] [-output-payload <path>]] [-bundle-out <file.sigstore> [-timestamp-authority <url>] [-cert <cert.pem> [-cert-chain <chain.pem>]]] <blob>",
 		ShortHelp:  "Sign the supplied blob, outputting the base64-nocded signature to stdout",
 		FlagSet:    flagset,
 		Exec: func(ctx context.Context, args []string) error {
@@ -48,38 +58,125 @@ func SignBlob() *ffcli.Command {
 			if len(args) != 1 {
 				return flag.ErrHelp
 			}
+			if *tsaURL != "" && *bundleOut == "" {
+				return errors.New("-timestamp-authority needs -bundle-out, the bundle is where the timestamp is kept")
+			}
+			if *certPath != "" && *bundleOut == "" {
+				return errors.New("-cert needs -bundle-out, the bundle is where the certificate is kept")
+			}
+			if *payloadOut != "" && !*dsse {
+				return errors.New("-output-payload needs -dsse, without it the blob is the payload")
+			}
+			cert, chain, err := readCertificateFlags(*certPath, *chainPath)
+			if err != nil {
+				return err
+			}
+			dssePayloadType := ""
+			if *dsse {
+				dssePayloadType = *payloadType
+			}
 
-			return SignBlobCmd(ctx, *key, args[0], *b64, getPass)
+			return SignBlobCmd(ctx, *key, args[0], *b64, *upgradeKey, *bundleOut, *tsaURL, cert, chain, dssePayloadType, *payloadOut, getPass)
 		},
 	}
 }
 
-func SignBlobCmd(ctx context.Context, keyPath, payloadPath string, b64 bool, pf cosign.PassFunc) error {
+// SignBlobCmd signs the blob at payloadPath. If bundleOut is set, the
+// signature is also written there as a bundle, with a timestamp from tsaURL
+// and the PEM encoded certificate cert and its intermediates chain, if they
+// are set. If dssePayloadType is set, a DSSE envelope of that payloadType
+// wrapping the blob is written to stdout instead of the signature, and is
+// what the bundle holds. If outputPayload is set too, the envelope is also
+// written there as soon as it's signed. Bundled envelopes of an image's
+// payload can be verified with verify -local-bundle.
+func SignBlobCmd(ctx context.Context, keyPath, payloadPath string, b64, upgradeKey bool, bundleOut, tsaURL string, cert, chain []byte, dssePayloadType, outputPayload string, pf cosign.PassFunc) error {
 	var payload []byte
 	var err error
 	if payloadPath == "-" {
 		payload, err = ioutil.ReadAll(os.Stdin)
 	} else {
-		fmt.Fprintln(os.Stderr, "Using payload from:", payloadPath)
+		logger.Infow("Using payload", "path", payloadPath)
 		payload, err = ioutil.ReadFile(payloadPath)
 	}
 	if err != nil {
 		return err
 	}
 
-	pass, err := pf(false)
+	pk, err := loadPrivateKey(keyPath, upgradeKey, pf)
 	if err != nil {
 		return err
 	}
-	kb, err := ioutil.ReadFile(keyPath)
-	if err != nil {
-		return err
+	if cert != nil {
+		if err := checkSigningCertificate(cert, chain, pk); err != nil {
+			return err
+		}
 	}
-	pk, err := cosign.LoadPrivateKey(kb, pass)
-	if err != nil {
-		return err
+	pub := pk.Public().(ed25519.PublicKey)
+	var env *cosign.DSSEEnvelope
+	var signature []byte
+	if dssePayloadType != "" {
+		if env, err = cosign.SignDSSE(pk, dssePayloadType, payload); err != nil {
+			return err
+		}
+		if signature, err = base64.StdEncoding.DecodeString(env.Signatures[0].Sig); err != nil {
+			return err
+		}
+		if outputPayload != "" {
+			b, err := json.Marshal(env)
+			if err != nil {
+				return err
+			}
+			if err := ioutil.WriteFile(outputPayload, b, 0644); err != nil {
+				return err
+			}
+			logger.Infow("Wrote payload", "path", outputPayload)
+		}
+	} else {
+		signature = ed25519.Sign(pk, payload)
 	}
-	signature := ed25519.Sign(pk, payload)
+
+	if bundleOut != "" {
+		var b *cosign.Bundle
+		if env != nil {
+			b, err = cosign.NewDSSEBundle(pub, env)
+		} else {
+			b, err = cosign.NewBundle(pub, payload, signature)
+		}
+		if err != nil {
+			return err
+		}
+		if tsaURL != "" {
+			token, err := cosign.RequestTimestamp(tsaURL, signature)
+			if err != nil {
+				return fmt.Errorf("timestamping signature: %v", err)
+			}
+			b.VerificationMaterial.TimestampVerificationData = &cosign.TimestampVerificationData{
+				RFC3161Timestamps: []cosign.RFC3161SignedTimestamp{{SignedTimestamp: token}},
+			}
+			logger.Infow("Timestamped signature", "tsa", tsaURL)
+		}
+		if cert != nil {
+			if b.VerificationMaterial.X509CertificateChain, err = bundleCertificates(cert, chain); err != nil {
+				return err
+			}
+			// The certificate says which key it is, so the hint goes.
+			b.VerificationMaterial.PublicKey = nil
+		}
+		if err := cosign.WriteBundle(bundleOut, b); err != nil {
+			return err
+		}
+		logger.Infow("Wrote bundle", "path", bundleOut)
+	}
+
+	if env != nil {
+		b, err := json.Marshal(env)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+		return nil
+	}
+
 	if b64 {
 		fmt.Println(base64.StdEncoding.EncodeToString(signature))
 	} else {
@@ -88,3 +185,18 @@ func SignBlobCmd(ctx context.Context, keyPath, payloadPath string, b64 bool, pf
 	}
 	return nil
 }
+
+// bundleCertificates converts the PEM encoded cert and chain to the DER
+// certificates of a bundle, leaf first.
+func bundleCertificates(cert, chain []byte) (*cosign.X509CertificateChain, error) {
+	pemBytes := append(append([]byte{}, cert...), '\n')
+	certs, err := cosign.ParseCertificates(append(pemBytes, chain...))
+	if err != nil {
+		return nil, err
+	}
+	bc := &cosign.X509CertificateChain{}
+	for _, c := range certs {
+		bc.Certificates = append(bc.Certificates, cosign.X509Certificate{RawBytes: c.Raw})
+	}
+	return bc, nil
+}
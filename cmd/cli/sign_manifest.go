@@ -0,0 +1,111 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"context"
+	"crypto"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"sync"
+
+	"github.com/sigstore/cosign/pkg/cosign"
+	"github.com/sigstore/cosign/pkg/cosign/oci"
+)
+
+// SignManifestCmd signs every image listed in the CSV file at manifestPath
+// (see cosign.ParseSignManifest) with the same key, parallelism at a time.
+// Each image is signed with annotations as well as those in its row, which
+// can't set the same keys. It writes the manifest back to w as CSV, with the
+// result of each row appended: "success" or the error.
+func SignManifestCmd(ctx context.Context, keyPath, manifestPath string, annotations map[string]string, parallelism int, referrers, upgradeKey bool, ro oci.RegistryOptions, pf cosign.PassFunc, w io.Writer) error {
+	if parallelism < 1 {
+		return fmt.Errorf("invalid parallelism: %d", parallelism)
+	}
+	reqs, err := cosign.ParseSignManifest(manifestPath)
+	if err != nil {
+		return err
+	}
+	pk, err := loadPrivateKey(keyPath, upgradeKey, pf)
+	if err != nil {
+		return err
+	}
+
+	errs := make([]error, len(reqs))
+	sem := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	for i, req := range reqs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, req cosign.SignRequest) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			signed := map[string]string{}
+			for k, v := range req.Annotations {
+				signed[k] = v
+			}
+			for k, v := range annotations {
+				if _, ok := signed[k]; ok {
+					errs[i] = fmt.Errorf("annotation %s is set by both -a and the manifest", k)
+					return
+				}
+				signed[k] = v
+			}
+			errs[i] = signImage(ctx, []crypto.Signer{pk}, req.Ref, SignOptions{
+				Upload:      true,
+				Annotations: signed,
+				Referrers:   referrers,
+				Registry:    ro,
+			}, ioutil.Discard)
+		}(i, req)
+	}
+	wg.Wait()
+
+	cw := csv.NewWriter(w)
+	failed := 0
+	for i, req := range reqs {
+		record := []string{req.Ref}
+		keys := []string{}
+		for k := range req.Annotations {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			record = append(record, k+"="+req.Annotations[k])
+		}
+		result := "success"
+		if errs[i] != nil {
+			result = errs[i].Error()
+			failed++
+		}
+		if err := cw.Write(append(record, result)); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d image(s) failed to sign", failed, len(reqs))
+	}
+	return nil
+}
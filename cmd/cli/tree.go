@@ -0,0 +1,124 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/peterbourgon/ff/v3/ffcli"
+	"github.com/sigstore/cosign/pkg/cosign/oci"
+)
+
+func Tree() *ffcli.Command {
+	var (
+		flagset   = flag.NewFlagSet("cosign tree", flag.ExitOnError)
+		depth     = flagset.Int("depth", 3, "how deep to follow attachments of attachments, such as signatures of signatures")
+		noUnicode = flagset.Bool("no-unicode", false, "draw the tree with plain ASCII")
+		ro        = registryFlags(flagset)
+	)
+	return &ffcli.Command{
+		Name:       "tree",
+		ShortUsage: "cosign tree [-depth <n>] [-no-unicode] [-registry-username <user> -registry-password <pass>] <image uri>",
+		ShortHelp:  "Display the signatures and other artifacts attached to the supplied container image",
+		FlagSet:    flagset,
+		Exec: func(ctx context.Context, args []string) error {
+			ro.Context = ctx
+			if len(args) != 1 || *depth < 1 {
+				return flag.ErrHelp
+			}
+			return TreeCmd(ctx, args[0], *depth, !*noUnicode, *ro, os.Stdout)
+		},
+	}
+}
+
+// treeBranches are the prefixes of tree lines: a child, the last child, and
+// the continuation under each of them.
+type treeBranches struct {
+	child, last, pipe, space string
+}
+
+var (
+	unicodeBranches = treeBranches{"├── ", "└── ", "│   ", "    "}
+	asciiBranches   = treeBranches{"|-- ", "`-- ", "|   ", "    "}
+)
+
+// TreeCmd writes the manifests attached to imageRef to w as a tree, along
+// with their layers, following attachments of attachments up to depth levels.
+func TreeCmd(ctx context.Context, imageRef string, depth int, unicode bool, ro oci.RegistryOptions, w io.Writer) error {
+	ro.Context = ctx
+	ref, err := parseReference(imageRef, ro)
+	if err != nil {
+		return err
+	}
+	desc, err := ro.Remote().Get(ref)
+	if err != nil {
+		return err
+	}
+	atts, err := oci.FetchAttachments(ref.Context(), desc, depth, ro)
+	if err != nil {
+		return err
+	}
+
+	b := asciiBranches
+	if unicode {
+		b = unicodeBranches
+	}
+	fmt.Fprintf(w, "%s (%s)\n", ref.Context().Digest(desc.Digest.String()), desc.MediaType)
+	if len(atts) == 0 {
+		fmt.Fprintln(w, b.last+"no attachments")
+	}
+	writeAttachments(w, atts, "", b)
+	return nil
+}
+
+func writeAttachments(w io.Writer, atts []oci.Attachment, prefix string, b treeBranches) {
+	for i, a := range atts {
+		branch, next := b.child, prefix+b.pipe
+		if i == len(atts)-1 {
+			branch, next = b.last, prefix+b.space
+		}
+		if a.Tag != "" {
+			fmt.Fprintf(w, "%stag %s (%s)\n", prefix+branch, a.Tag, a.Descriptor.Digest)
+		} else {
+			fmt.Fprintf(w, "%sreferrer %s (%s)\n", prefix+branch, a.Descriptor.Digest, a.ArtifactType)
+		}
+
+		for j, l := range a.Layers {
+			lb := b.child
+			if j == len(a.Layers)-1 && len(a.Attachments) == 0 {
+				lb = b.last
+			}
+			fmt.Fprintf(w, "%s%s\n", next+lb, describeLayer(l))
+		}
+		writeAttachments(w, a.Attachments, next, b)
+	}
+}
+
+// describeLayer names a layer by its media type and digest, and says whether
+// it is a signature.
+func describeLayer(l v1.Descriptor) string {
+	s := fmt.Sprintf("%s %s", l.MediaType, l.Digest)
+	if _, ok := l.Annotations[oci.SignatureAnnotationKey]; ok {
+		s += " (signature)"
+	}
+	return s
+}
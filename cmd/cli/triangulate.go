@@ -20,44 +20,62 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"net/http"
 
 	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/name"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
 	"github.com/peterbourgon/ff/v3/ffcli"
-	"github.com/sigstore/cosign/pkg/cosign"
+	"github.com/sigstore/cosign/pkg/cosign/oci"
 )
 
 func Triangulate() *ffcli.Command {
 	var (
-		flagset = flag.NewFlagSet("cosign triangulate", flag.ExitOnError)
+		flagset      = flag.NewFlagSet("cosign triangulate", flag.ExitOnError)
+		verifyExists = flagset.Bool("verify-exists", false, "check that the signature tag exists, exiting with 2 if it doesn't")
 	)
 	return &ffcli.Command{
 		Name:       "triangulate",
-		ShortUsage: "cosign triangulate <image uri>",
+		ShortUsage: "cosign triangulate [-verify-exists] <image uri>",
 		ShortHelp:  "Outputs the located cosign image reference. This is the location cosign stores signatures.",
 		FlagSet:    flagset,
 		Exec: func(ctx context.Context, args []string) error {
 			if len(args) != 1 {
 				return flag.ErrHelp
 			}
-			return MungeCmd(ctx, args[0])
+			return MungeCmd(ctx, args[0], *verifyExists)
 		},
 	}
 }
 
-func MungeCmd(_ context.Context, imageRef string) error {
+// MungeCmd prints the signature tag of imageRef. With verifyExists, it also
+// checks the tag exists, without fetching the signatures, and returns an
+// ExitError with code 2 if it doesn't. Signatures stored as referrers aren't
+// in the tag, so they aren't found.
+func MungeCmd(ctx context.Context, imageRef string, verifyExists bool) error {
 	ref, err := name.ParseReference(imageRef)
 	if err != nil {
 		return err
 	}
 
 	// TODO: just return the descriptor directly if we have a digest reference.
-	desc, err := remote.Get(ref, remote.WithAuthFromKeychain(authn.DefaultKeychain))
+	opts := []remote.Option{remote.WithAuthFromKeychain(authn.DefaultKeychain), remote.WithContext(ctx)}
+	desc, err := remote.Get(ref, opts...)
 	if err != nil {
 		return err
 	}
 
-	fmt.Println(ref.Context().Tag(cosign.Munge(desc.Descriptor)))
+	sigTag := ref.Context().Tag(oci.Munge(desc.Descriptor))
+	fmt.Println(sigTag)
+	if !verifyExists {
+		return nil
+	}
+	if _, err := remote.Head(sigTag, opts...); err != nil {
+		if te, ok := err.(*transport.Error); ok && te.StatusCode == http.StatusNotFound {
+			return &ExitError{Code: 2, Err: fmt.Errorf("%s doesn't exist", sigTag)}
+		}
+		return err
+	}
 	return nil
 }
@@ -24,35 +24,38 @@ import (
 	"io/ioutil"
 	"os"
 
-	"github.com/google/go-containerregistry/pkg/authn"
-	"github.com/google/go-containerregistry/pkg/name"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
 	"github.com/peterbourgon/ff/v3/ffcli"
-	"github.com/sigstore/cosign/pkg/cosign"
+	"github.com/sigstore/cosign/pkg/cosign/oci"
 )
 
 func Upload() *ffcli.Command {
 	var (
-		flagset   = flag.NewFlagSet("cosign upload", flag.ExitOnError)
-		signature = flagset.String("signature", "", "path to the signature or {-} for stdin")
-		payload   = flagset.String("payload", "", "path to the payload covered by the signature (if using another format)")
+		flagset     = flag.NewFlagSet("cosign upload", flag.ExitOnError)
+		signature   = flagset.String("signature", "", "path to the signature or {-} for stdin")
+		payload     = flagset.String("payload", "", "path to the payload covered by the signature (if using another format)")
+		payloadType = flagset.String("payload-type", string(oci.SimpleSigningMediaType), "media type of the payload, which verify uses to parse it")
+		referrers   = flagset.Bool("referrers", false, "store the signature with the OCI referrers API, if the registry supports it")
+		ro          = registryFlags(flagset)
 	)
 	return &ffcli.Command{
 		Name:       "upload",
-		ShortUsage: "cosign upload <image uri>",
+		ShortUsage: "cosign upload [-signature <sig>] [-payload <path>] [-payload-type <media type>] <image uri>",
 		ShortHelp:  "upload signatures to the supplied container image",
 		FlagSet:    flagset,
 		Exec: func(ctx context.Context, args []string) error {
+			ro.Context = ctx
 			if len(args) != 1 {
 				return flag.ErrHelp
 			}
 
-			return UploadCmd(ctx, *signature, *payload, args[0])
+			return UploadCmd(ctx, *signature, *payload, *payloadType, args[0], *referrers, *ro)
 		},
 	}
 }
 
-func UploadCmd(ctx context.Context, sigRef, payloadRef, imageRef string) error {
+func UploadCmd(ctx context.Context, sigRef, payloadRef, payloadType, imageRef string, referrers bool, ro oci.RegistryOptions) error {
 	var b64SigBytes []byte
 	var err error
 
@@ -71,21 +74,21 @@ func UploadCmd(ctx context.Context, sigRef, payloadRef, imageRef string) error {
 		return errors.New("empty signature")
 	}
 
-	ref, err := name.ParseReference(imageRef)
+	ref, err := parseReference(imageRef, ro)
 	if err != nil {
 		return err
 	}
 
-	get, err := remote.Get(ref, remote.WithAuthFromKeychain(authn.DefaultKeychain))
+	get, err := remote.Get(ref, ro.RemoteOptions()...)
 	if err != nil {
 		return err
 	}
 
-	dstTag := ref.Context().Tag(cosign.Munge(get.Descriptor))
+	dstTag := ref.Context().Tag(oci.Munge(get.Descriptor))
 
 	var payload []byte
 	if payloadRef == "" {
-		payload, err = cosign.Payload(get.Descriptor, nil)
+		payload, err = oci.Payload(get.Descriptor, nil)
 	} else {
 		payload, err = ioutil.ReadFile(payloadRef)
 	}
@@ -98,5 +101,12 @@ func UploadCmd(ctx context.Context, sigRef, payloadRef, imageRef string) error {
 	if err != nil {
 		return err
 	}
-	return cosign.Upload(sigBytes, payload, dstTag)
+	opts := []oci.UploadOption{oci.UploadRegistryOptions(ro)}
+	if payloadType != "" {
+		opts = append(opts, oci.UploadMediaType(types.MediaType(payloadType)))
+	}
+	if referrers {
+		opts = append(opts, oci.WithReferrers(get.Descriptor))
+	}
+	return oci.Upload(sigBytes, payload, dstTag, opts...)
 }
@@ -17,54 +17,354 @@ limitations under the License.
 package cli
 
 import (
+	"bytes"
 	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/peterbourgon/ff/v3/ffcli"
 	"github.com/sigstore/cosign/pkg/cosign"
+	"github.com/sigstore/cosign/pkg/cosign/oci"
+	"github.com/sigstore/cosign/pkg/cosign/opa"
+	"golang.org/x/term"
 )
 
 func Verify() *ffcli.Command {
 	var (
 		flagset     = flag.NewFlagSet("cosign verify", flag.ExitOnError)
-		key         = flagset.String("key", "", "path to the public key")
+		keys        = keysFlag{}
+		keyring     = flagset.String("keyring", "", "path to a file of PEM encoded public keys, any of which may have signed the image")
+		certChain   = flagset.String("cert-chain", "", "path to PEM encoded certificates, instead of a key: each signature's key comes from the certificate stored with it, which must chain up to one of the self-signed ones; the rest are used as intermediates")
+		keyless     = flagset.Bool("keyless", false, "instead of a key, verify signatures from sign -keyless: each signature's key comes from the certificate stored with it, which must chain up to the fulcio root pinned by cosign initialize")
+		systemRoots = flagset.Bool("use-system-roots", false, "with -cert-chain, trust the system roots for code signing certificates instead, and use every certificate in -cert-chain as an intermediate")
 		checkClaims = flagset.Bool("check-claims", true, "whether to check the claims found")
+		strict      = flagset.Bool("strict-annotations", false, "reject payloads with annotations other than the ones passed with -a")
+		after       = flagset.String("assert-signed-after", "", "reject signatures without a sign -record-creation-timestamp at or after this RFC 3339 time")
+		noExpiry    = flagset.Bool("ignore-expiry", false, "accept signatures past the expiry sign -expire-in signed into them")
+		noFailFast  = flagset.Bool("no-fail-fast", false, "check every signature and report all errors, rather than stopping at the first failed step; the ones that verify are still output, and verify exits with 3 if there are any, 1 if not")
+		maxSigs     = flagset.Int("max-signatures", 0, "stop checking signatures once this many pass every check, 0 checks them all")
+		recursive   = flagset.Bool("recursive", false, "if the image is an index, also require every manifest in it to be signed")
+		config      = flagset.Bool("verify-container-config", false, "also require the image's config blob to be signed, see sign -sign-container-config")
+		tsaCerts    = flagset.String("timestamp-certs", "", "path to the PEM encoded root certificates of the timestamp authority, to require signatures to have a trusted RFC 3161 timestamp")
+		since       = flagset.String("monitor-since", "", "only output signatures timestamped after this RFC 3339 time, as JSON, and exit with 2 if there are none; needs -timestamp-certs")
+		localImage  = flagset.Bool("local-image", false, "verify the images in the OCI image layout at the given path, rather than an image in a registry")
+		rekorBundle = flagset.String("rekor-bundle", "", "path to the bundle Rekor returned for the signature, checked against the pinned Rekor key instead of querying Rekor")
+		localBundle = flagset.String("local-bundle", "", "path to a Sigstore bundle (.sigstore) with a DSSE envelope signing the image's payload, e.g. from sign-blob -dsse -bundle-out, to verify instead of the signatures in the registry")
+		identity    = flagset.String("expected-identity", "", "require the signer identity signed with sign -identity to be this")
+		githubRepo  = flagset.String("github-repository", "", "require the image to be signed in GitHub Actions in this repository, e.g. acme/app")
+		githubRef   = flagset.String("github-ref", "", "require the image to be signed in GitHub Actions on this ref, e.g. refs/heads/main")
+		checkCT     = flagset.Bool("check-ct-inclusion", false, "with -cert-chain, require each certificate to be in the CT log at $"+cosign.CTLogURLEnv+", as proven by its embedded SCTs")
+		certEmail   = flagset.String("cert-email", "", "with -cert-chain, require each certificate to have a SAN email address matching this, e.g. alice@example.com or *@example.com")
+		certIdent   = flagset.String("certificate-identity", "", "with -cert-chain or -keyless, require each certificate to have a SAN email address or URI matching this, e.g. alice@example.com or https://github.com/acme/app/.github/workflows/*@refs/heads/main")
+		certIssuer  = flagset.String("certificate-oidc-issuer", "", "with -cert-chain or -keyless, require each certificate to be issued by Fulcio for an OIDC token from this issuer, e.g. https://token.actions.githubusercontent.com")
+		spiffeID    = flagset.String("expected-spiffe-id", "", "with -cert-chain, require each certificate to be an X.509 SVID for this SPIFFE ID, e.g. spiffe://example.org/ns/default/sa/builder")
+		builderID   = flagset.String("builder-id", "", "verify the image's SLSA provenance attestation (sign -predicate) instead of its signatures, requiring it to be from this builder; needs -source-repo")
+		sourceRepo  = flagset.String("source-repo", "", "with -builder-id, require the provenance's first material to be this repository, e.g. git+https://github.com/acme/app")
+		sbom        = flagset.String("sbom", "", "verify the signatures of the SBOM layer with this digest (sha256:...) attached to the image, rather than the image's")
+		parallel    = flagset.Bool("parallel", false, "verify every image given, several at once, and print a table of the results")
+		parallelism = flagset.Int("parallelism", 4, "how many images to verify at once with -parallel")
+		watch       = flagset.Bool("watch", false, "keep verifying the image every -interval, and alert on stderr, and -webhook if set, when its digest changes, a valid signature disappears or a new signature appears")
+		interval    = flagset.Duration("interval", 5*time.Minute, "with -watch, how often to verify the image")
+		webhook     = flagset.String("webhook", "", "with -watch, a URL to POST each change to, as JSON")
+		policyFile  = flagset.String("policy-file", "", "path to a Rego policy (.rego) to check each verified signature against; its deny rules in package cosign say what's wrong")
+		outputFile  = flagset.String("output-file", "", "write the verified payloads, or the results of -parallel, a tag pattern or -monitor-since, to this file instead of stdout")
+		overwrite   = flagset.Bool("overwrite", false, "with -output-file, replace the file if it already exists")
+		showPayload = flagset.Bool("show-payload", false, "pretty-print the verified payloads as indented JSON, rather than one per line; on by default when stdout is a terminal")
 		annotations = annotationsMap{}
+		platforms   = platformsFlag{}
+		ro          = registryFlags(flagset)
 	)
+	flagset.Var(&keys, "key", "path to the public key; repeat it to accept signatures by any of several keys, e.g. while rotating keys")
+	flagset.Var(&platforms, "platform", "if the image is an index, verify the signatures of the manifest for this platform (os/arch[/variant]) in it instead; repeat it to require several")
 	flagset.Var(&annotations, "a", "extra key=value pairs to sign")
 
 	return &ffcli.Command{
 		Name:       "verify",
-		ShortUsage: "cosign verify -key <key> <image uri>",
+		ShortUsage: "cosign verify -key <key> [-key <key>...]|-keyring <keyring>|-cert-chain <chain.pem> [-use-system-roots]|-keyless [-check-ct-inclusion] [-certificate-identity <pattern>] [-certificate-oidc-issuer <url>] [-cert-email <pattern>] [-expected-spiffe-id <spiffe://...>] [-a key=value] [-expected-identity <signer>] [-github-repository <owner/repo>] [-github-ref <ref>] [-strict-annotations] [-ignore-expiry] [-assert-signed-after <time>] [-no-fail-fast] [-max-signatures <n>] [-recursive] [-verify-container-config] [-timestamp-certs <roots.pem> [-monitor-since <time>]] [-rekor-bundle <path>|-local-bundle <file.sigstore>] [-policy-file <policy.rego>] [-show-payload] [-output-file <path> [-overwrite]] [-registry-username <user> -registry-password <pass>] <image uri or repo:tag-pattern>\n  cosign verify -key <key> -platform <os/arch> [-platform <os/arch>...] [-a key=value] <image uri>\n  cosign verify -key <key> -builder-id <id> -source-repo <repo> <image uri>\n  cosign verify -key <key> -watch [-interval <duration>] [-webhook <url>] [-a key=value] <image uri>\n  cosign verify -key <key> -sbom <sha256:...> [-a key=value] <image uri>\n  cosign verify -key <key> -parallel [-parallelism <n>] [-a key=value] <image uri>...\n  cosign verify -key <key> [-local-image] [-a key=value] <oci layout path>",
 		ShortHelp:  "Verify a signature on the supplied container image",
 		FlagSet:    flagset,
 		Exec: func(ctx context.Context, args []string) error {
-			if *key == "" {
+			ro.Context = ctx
+			trust := 0
+			for _, f := range []string{keys.String(), *keyring, *certChain} {
+				if f != "" {
+					trust++
+				}
+			}
+			if *keyless {
+				trust++
+			}
+			// Signatures are verified with the certificates stored with them.
+			certs := *certChain != "" || *keyless
+			if trust != 1 {
 				return flag.ErrHelp
 			}
-			if len(args) != 1 {
+			if len(args) == 0 || (len(args) > 1 && !*parallel) {
 				return flag.ErrHelp
 			}
-			verified, err := VerifyCmd(ctx, *key, args[0], *checkClaims, annotations.annotations)
+			var key string
+			if len(keys) == 1 {
+				key = keys[0]
+			}
+			if len(keys) > 1 && (*parallel || *sbom != "" || *rekorBundle != "" || *localImage || *recursive || *config || cosign.IsOCILayout(args[0]) || cosign.IsPattern(args[0])) {
+				return errors.New("several -key can't be combined with -parallel, -sbom, -rekor-bundle, -local-image, -recursive, -verify-container-config or a tag pattern")
+			}
+			if *parallel && (key == "" || *rekorBundle != "" || *localImage || *since != "") {
+				return errors.New("-parallel can't be combined with -keyring, -cert-chain, -rekor-bundle, -local-image or -monitor-since")
+			}
+			if certs && (*rekorBundle != "" || *localImage || *recursive || *config || cosign.IsOCILayout(args[0]) || cosign.IsPattern(args[0])) {
+				return errors.New("-cert-chain and -keyless can't be combined with -rekor-bundle, -local-image, -recursive, -verify-container-config or a tag pattern")
+			}
+			if *localBundle != "" && (key == "" || *parallel || *sbom != "" || *rekorBundle != "" || *localImage || *recursive || *config || *since != "" || cosign.IsOCILayout(args[0]) || cosign.IsPattern(args[0])) {
+				return errors.New("-local-bundle needs a single -key, and can't be combined with -parallel, -sbom, -rekor-bundle, -local-image, -recursive, -verify-container-config, -monitor-since or a tag pattern")
+			}
+			if *watch && (key == "" || *parallel || *sbom != "" || *rekorBundle != "" || *localBundle != "" || *localImage || *recursive || *config || *since != "" || cosign.IsOCILayout(args[0]) || cosign.IsPattern(args[0])) {
+				return errors.New("-watch needs a single -key, and can't be combined with -parallel, -sbom, -rekor-bundle, -local-bundle, -local-image, -recursive, -verify-container-config, -monitor-since or a tag pattern")
+			}
+			if (*builderID == "") != (*sourceRepo == "") {
+				return errors.New("-builder-id and -source-repo go together")
+			}
+			if *builderID != "" && (key == "" || *watch || *parallel || *sbom != "" || *rekorBundle != "" || *localBundle != "" || *localImage || *recursive || *config || *since != "" || len(annotations.annotations) != 0 || cosign.IsOCILayout(args[0]) || cosign.IsPattern(args[0])) {
+				return errors.New("-builder-id needs a single -key, and can't be combined with -watch, -parallel, -sbom, -rekor-bundle, -local-bundle, -local-image, -recursive, -verify-container-config, -monitor-since, -a or a tag pattern")
+			}
+			if len(platforms) != 0 && (key == "" || *builderID != "" || *watch || *parallel || *sbom != "" || *rekorBundle != "" || *localBundle != "" || *localImage || *recursive || cosign.IsOCILayout(args[0]) || cosign.IsPattern(args[0])) {
+				return errors.New("-platform needs a single -key, and can't be combined with -builder-id, -watch, -parallel, -sbom, -rekor-bundle, -local-bundle, -local-image, -recursive or a tag pattern")
+			}
+			if *policyFile != "" && (*builderID != "" || *watch || *parallel || *since != "" || cosign.IsPattern(args[0])) {
+				return errors.New("-policy-file can't be combined with -builder-id, -watch, -parallel, -monitor-since or a tag pattern")
+			}
+			if *webhook != "" && !*watch {
+				return errors.New("-webhook needs -watch")
+			}
+			if *systemRoots && *certChain == "" {
+				return errors.New("-use-system-roots needs -cert-chain, the intermediates that chain up to them")
+			}
+			if *checkCT && !certs {
+				return errors.New("-check-ct-inclusion needs -cert-chain or -keyless, only certificates are in CT logs")
+			}
+			if *certEmail != "" && !certs {
+				return errors.New("-cert-email needs -cert-chain or -keyless, the email address comes from the certificate")
+			}
+			if *spiffeID != "" && !certs {
+				return errors.New("-expected-spiffe-id needs -cert-chain or -keyless, the SPIFFE ID comes from the certificate")
+			}
+			if (*certIdent != "" || *certIssuer != "") && !certs {
+				return errors.New("-certificate-identity and -certificate-oidc-issuer need -cert-chain or -keyless, they're checked against the certificate")
+			}
+			// -cert-email and -expected-spiffe-id check the identity too.
+			if certs && *certIdent == "" && *certIssuer == "" && *certEmail == "" && *spiffeID == "" {
+				logger.Warnw("Neither -certificate-identity nor -certificate-oidc-issuer was given, so any certificate the roots issued is accepted, whoever it is for")
+			}
+			if *keyring != "" && (*rekorBundle != "" || *localImage || cosign.IsOCILayout(args[0]) || cosign.IsPattern(args[0])) {
+				return errors.New("-keyring can't be combined with -rekor-bundle, -local-image or a tag pattern")
+			}
+			if *sbom != "" && (key == "" || *parallel || *rekorBundle != "" || *localImage || *recursive || *config || !*checkClaims || cosign.IsOCILayout(args[0]) || cosign.IsPattern(args[0])) {
+				return errors.New("-sbom needs -key, and can't be combined with -parallel, -rekor-bundle, -local-image, -recursive, -verify-container-config, -check-claims=false or a tag pattern")
+			}
+			if *config && (*localImage || cosign.IsOCILayout(args[0])) {
+				return errors.New("-verify-container-config can't be combined with -local-image")
+			}
+			if (*identity != "" || *githubRepo != "" || *githubRef != "") && !*checkClaims {
+				return errors.New("-expected-identity, -github-repository and -github-ref are claims, they can't be checked with -check-claims=false")
+			}
+			wanted, err := withAnnotations(annotations.annotations, map[string]string{
+				cosign.SignerIdentityAnnotation:   *identity,
+				cosign.GitHubRepositoryAnnotation: *githubRepo,
+				cosign.GitHubRefAnnotation:        *githubRef,
+			})
 			if err != nil {
 				return err
 			}
-			if !*checkClaims {
-				fmt.Fprintln(os.Stderr, "Warning: the following claims have not been verified:")
+
+			var monitorSince time.Time
+			if *since != "" {
+				if *tsaCerts == "" {
+					return errors.New("-monitor-since needs -timestamp-certs, signatures are only new as of their trusted timestamp")
+				}
+				if cosign.IsPattern(args[0]) {
+					return errors.New("-monitor-since can't be combined with a tag pattern")
+				}
+				var err error
+				if monitorSince, err = time.Parse(time.RFC3339, *since); err != nil {
+					return fmt.Errorf("invalid -monitor-since: %v", err)
+				}
+			}
+			opts := []cosign.VerifyOption{}
+			if *strict {
+				opts = append(opts, cosign.VerifyAnnotationsExact)
+			}
+			if *noExpiry {
+				opts = append(opts, cosign.VerifyIgnoreExpiry)
+			}
+			if *after != "" {
+				if !*checkClaims {
+					return errors.New("-assert-signed-after checks the timestamp claim, it can't be used with -check-claims=false")
+				}
+				signedAfter, err := time.Parse(time.RFC3339, *after)
+				if err != nil {
+					return fmt.Errorf("invalid -assert-signed-after: %v", err)
+				}
+				opts = append(opts, cosign.VerifySignedAfter(signedAfter))
+			}
+			if *noFailFast {
+				opts = append(opts, cosign.WithFailFast(false))
+			}
+			if *maxSigs < 0 {
+				return errors.New("-max-signatures can't be negative")
+			}
+			if *maxSigs > 0 {
+				opts = append(opts, cosign.VerifyMaxSignatures(*maxSigs))
 			}
-			for _, vp := range verified {
-				fmt.Println(string(vp.Payload))
+			if *recursive {
+				opts = append(opts, cosign.VerifyRecursive)
 			}
-			return nil
+			if *config {
+				opts = append(opts, cosign.VerifyContainerConfig)
+			}
+			if *checkCT {
+				ctLogURL := os.Getenv(cosign.CTLogURLEnv)
+				if ctLogURL == "" {
+					return fmt.Errorf("-check-ct-inclusion needs the CT log URL in $%s", cosign.CTLogURLEnv)
+				}
+				opts = append(opts, cosign.VerifyCTInclusion(ctLogURL))
+			}
+			if *certEmail != "" {
+				opts = append(opts, cosign.VerifyCertEmail(*certEmail))
+			}
+			if *spiffeID != "" {
+				opts = append(opts, cosign.VerifySPIFFEID(*spiffeID))
+			}
+			if *certIdent != "" {
+				opts = append(opts, cosign.VerifyCertIdentity(*certIdent))
+			}
+			if *certIssuer != "" {
+				opts = append(opts, cosign.VerifyCertOIDCIssuer(*certIssuer))
+			}
+			var tsaRoots *x509.CertPool
+			if *tsaCerts != "" {
+				var err error
+				if tsaRoots, err = cosign.LoadCertPool(*tsaCerts); err != nil {
+					return err
+				}
+				opts = append(opts, cosign.VerifyTimestampAuthority(tsaRoots))
+			}
+
+			if *outputFile != "" && (*builderID != "" || *watch) {
+				return errors.New("-output-file can't be combined with -builder-id or -watch, they don't output payloads")
+			}
+			if *overwrite && *outputFile == "" {
+				return errors.New("-overwrite needs -output-file")
+			}
+			var out io.Writer = os.Stdout
+			pretty := term.IsTerminal(int(os.Stdout.Fd()))
+			if *outputFile != "" {
+				f, err := createOutputFile(*outputFile, *overwrite)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				out, pretty = f, false
+			}
+
+			// Without fail-fast, what did verify is returned along with the errors.
+			var verified []oci.SignedPayload
+			switch {
+			case len(platforms) != 0:
+				verified, err = VerifyPlatformsCmd(ctx, key, args[0], platforms, *checkClaims, wanted, *ro, opts...)
+			case *builderID != "":
+				return VerifyProvenanceCmd(ctx, key, args[0], *builderID, *sourceRepo, *ro, opts...)
+			case *watch:
+				return VerifyWatchCmd(ctx, key, args[0], *checkClaims, wanted, *interval, *webhook, *ro, opts...)
+			case *parallel:
+				return VerifyParallelCmd(ctx, key, args, *parallelism, *checkClaims, wanted, *ro, out, opts...)
+			case *certChain != "":
+				verified, err = VerifyCertificatesCmd(ctx, *certChain, *systemRoots, args[0], *checkClaims, wanted, *ro, opts...)
+			case *keyless:
+				verified, err = VerifyKeylessCmd(ctx, args[0], *checkClaims, wanted, *ro, opts...)
+			case len(keys) > 1:
+				verified, err = VerifyKeysCmd(ctx, keys, args[0], *checkClaims, wanted, *ro, opts...)
+			case *keyring != "":
+				verified, err = VerifyKeyringCmd(ctx, *keyring, args[0], *checkClaims, wanted, *ro, opts...)
+			case *sbom != "":
+				verified, err = VerifySBOMCmd(ctx, key, args[0], *sbom, wanted, *ro, opts...)
+			case *localBundle != "":
+				var res *cosign.ImageVerification
+				if res, err = VerifyLocalBundleCmd(ctx, key, args[0], *localBundle, *checkClaims, wanted, *ro, opts...); err == nil {
+					verified = res.Verified
+					logger.Infow("Verified signature", "source", string(res.Source), "bundle", *localBundle, "tlog", res.Logged)
+				}
+			case *rekorBundle != "":
+				verified, err = VerifyOfflineCmd(ctx, key, args[0], *rekorBundle, *checkClaims, wanted, *ro, opts...)
+			case *localImage || cosign.IsOCILayout(args[0]):
+				verified, err = VerifyOCILayoutCmd(ctx, key, args[0], *checkClaims, wanted, opts...)
+			case cosign.IsPattern(args[0]):
+				return VerifyPatternCmd(ctx, key, args[0], *checkClaims, wanted, *ro, out, opts...)
+			default:
+				verified, err = VerifyCmd(ctx, key, args[0], *checkClaims, wanted, *ro, opts...)
+			}
+			if *policyFile != "" && err == nil {
+				if err := CheckPolicyFileCmd(ctx, *policyFile, verified, tsaRoots, *rekorBundle); err != nil {
+					return err
+				}
+			}
+			if *since != "" {
+				if len(verified) == 0 {
+					return err
+				}
+				if printErr := printNewSignatures(out, verified, monitorSince, tsaRoots); printErr != nil {
+					return printErr
+				}
+				return verifyResult(verified, err)
+			}
+			if len(verified) != 0 && !*checkClaims {
+				logger.Warn("The following claims have not been verified")
+			}
+			flagset.Visit(func(f *flag.Flag) {
+				if f.Name == "show-payload" {
+					pretty = *showPayload
+				}
+			})
+			if printErr := printPayloads(out, verified, pretty); printErr != nil {
+				return printErr
+			}
+			return verifyResult(verified, err)
 		},
 	}
 }
 
-func VerifyCmd(_ context.Context, keyRef string, imageRef string, checkClaims bool, annotations map[string]string) ([]cosign.SignedPayload, error) {
-	ref, err := name.ParseReference(imageRef)
+// createOutputFile creates the file at path for verify -output-file. It fails
+// if the file already exists, unless overwrite is set.
+func createOutputFile(path string, overwrite bool) (*os.File, error) {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if !overwrite {
+		flags |= os.O_EXCL
+	}
+	f, err := os.OpenFile(path, flags, 0644)
+	if os.IsExist(err) {
+		return nil, fmt.Errorf("%s already exists, pass -overwrite to replace it", path)
+	}
+	return f, err
+}
+
+func VerifyCmd(ctx context.Context, keyRef string, imageRef string, checkClaims bool, annotations map[string]string, ro oci.RegistryOptions, opts ...cosign.VerifyOption) ([]oci.SignedPayload, error) {
+	ro.Context = ctx
+	ref, err := parseReference(imageRef, ro)
 	if err != nil {
 		return nil, err
 	}
@@ -74,5 +374,521 @@ func VerifyCmd(_ context.Context, keyRef string, imageRef string, checkClaims bo
 		return nil, err
 	}
 
-	return cosign.Verify(ref, pubKey, checkClaims, annotations)
+	opts = append(opts, cosign.VerifyRegistryOptions(ro))
+	return cosign.Verify(ref, pubKey, checkClaims, annotations, opts...)
+}
+
+// CheckPolicyFileCmd checks each of the verified signatures against the Rego
+// policy at policyPath, see opa.CheckPolicy. The policy's input has the
+// verified timestamp of a signature if tsaRoots is set, and the entry in the
+// Rekor bundle at rekorBundlePath if that is.
+func CheckPolicyFileCmd(ctx context.Context, policyPath string, verified []oci.SignedPayload, tsaRoots *x509.CertPool, rekorBundlePath string) error {
+	switch filepath.Ext(policyPath) {
+	case ".rego":
+	case ".cue":
+		return errors.New("CUE policies aren't supported yet, write the policy in Rego (.rego) instead")
+	default:
+		return fmt.Errorf("%s: unknown policy language, wanted a Rego (.rego) file", policyPath)
+	}
+	policy, err := ioutil.ReadFile(policyPath)
+	if err != nil {
+		return err
+	}
+	var rb *cosign.RekorBundle
+	if rekorBundlePath != "" {
+		if rb, err = cosign.LoadRekorBundle(rekorBundlePath); err != nil {
+			return err
+		}
+	}
+	if err := opa.CheckPolicy(ctx, string(policy), verified, tsaRoots, rb); err != nil {
+		return err
+	}
+	logger.Infow("Signatures satisfy the policy", "policy", policyPath, "signatures", len(verified))
+	return nil
+}
+
+// VerifyPlatformsCmd verifies the signatures of the manifest for each of
+// platforms in the index imageRef, see oci.PlatformManifest, rather than
+// those of the index. Every platform has to verify.
+func VerifyPlatformsCmd(ctx context.Context, keyRef, imageRef string, platforms []v1.Platform, checkClaims bool, annotations map[string]string, ro oci.RegistryOptions, opts ...cosign.VerifyOption) ([]oci.SignedPayload, error) {
+	ro.Context = ctx
+	ref, err := parseReference(imageRef, ro)
+	if err != nil {
+		return nil, err
+	}
+	pubKey, err := cosign.LoadPublicKey(keyRef)
+	if err != nil {
+		return nil, err
+	}
+
+	opts = append(opts, cosign.VerifyRegistryOptions(ro))
+	verified := []oci.SignedPayload{}
+	for _, p := range platforms {
+		d, err := oci.PlatformManifest(ref, p, ro)
+		if err != nil {
+			return nil, err
+		}
+		sps, err := cosign.Verify(d, pubKey, checkClaims, annotations, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", oci.FormatPlatform(p), err)
+		}
+		logger.Infow("Verified platform", "ref", ref.String(), "platform", oci.FormatPlatform(p), "digest", d.DigestStr())
+		verified = append(verified, sps...)
+	}
+	return verified, nil
+}
+
+// VerifySBOMCmd verifies the signatures of the SBOM layer with digest sbom
+// that is attached to imageRef, see cosign.VerifySBOM.
+func VerifySBOMCmd(ctx context.Context, keyRef, imageRef, sbom string, annotations map[string]string, ro oci.RegistryOptions, opts ...cosign.VerifyOption) ([]oci.SignedPayload, error) {
+	ro.Context = ctx
+	ref, err := parseReference(imageRef, ro)
+	if err != nil {
+		return nil, err
+	}
+	h, err := v1.NewHash(sbom)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -sbom %q: %v", sbom, err)
+	}
+
+	pubKey, err := cosign.LoadPublicKey(keyRef)
+	if err != nil {
+		return nil, err
+	}
+
+	opts = append(opts, cosign.VerifyRegistryOptions(ro))
+	return cosign.VerifySBOM(ref, h, pubKey, annotations, opts...)
+}
+
+// VerifyProvenanceCmd checks that imageRef has a SLSA provenance attestation
+// signed by the key at keyRef, saying it was built by builderID from
+// sourceRepo, see cosign.VerifySLSAProvenance.
+func VerifyProvenanceCmd(ctx context.Context, keyRef, imageRef, builderID, sourceRepo string, ro oci.RegistryOptions, opts ...cosign.VerifyOption) error {
+	ro.Context = ctx
+	ref, err := parseReference(imageRef, ro)
+	if err != nil {
+		return err
+	}
+	pubKey, err := cosign.LoadPublicKey(keyRef)
+	if err != nil {
+		return err
+	}
+
+	opts = append(opts, cosign.VerifyRegistryOptions(ro))
+	if err := cosign.VerifySLSAProvenance(ref, builderID, sourceRepo, pubKey, opts...); err != nil {
+		return err
+	}
+	logger.Infow("Verified SLSA provenance", "ref", ref.String(), "builder", builderID, "source", sourceRepo)
+	return nil
+}
+
+// watchAlert is what VerifyWatchCmd posts to the webhook for each change.
+type watchAlert struct {
+	Ref string `json:"ref"`
+	cosign.ChangeEvent
+}
+
+// VerifyWatchCmd verifies imageRef every interval until ctx is done, see
+// cosign.WatchVerify. Each change, or poll that failed, is logged as a
+// warning and, if webhookURL is set, posted to it as JSON. A webhook that
+// fails is logged, and the watch goes on.
+func VerifyWatchCmd(ctx context.Context, keyRef, imageRef string, checkClaims bool, annotations map[string]string, interval time.Duration, webhookURL string, ro oci.RegistryOptions, opts ...cosign.VerifyOption) error {
+	ref, err := parseReference(imageRef, ro)
+	if err != nil {
+		return err
+	}
+	pubKey, err := cosign.LoadPublicKey(keyRef)
+	if err != nil {
+		return err
+	}
+
+	onChange := func(e cosign.ChangeEvent) {
+		if e.Type == cosign.ChangePollFailed {
+			logger.Warnw("Polling image failed", "ref", ref.String(), "error", e.Error)
+		} else {
+			logger.Warnw("Image changed", "ref", ref.String(), "change", string(e.Type), "oldDigest", e.OldDigest.String(), "newDigest", e.NewDigest.String(), "signatures", len(e.Changed))
+		}
+		if webhookURL == "" {
+			return
+		}
+		if err := postWatchAlert(ctx, webhookURL, watchAlert{Ref: ref.String(), ChangeEvent: e}); err != nil {
+			logger.Errorw("Posting change to webhook", "url", webhookURL, "error", err)
+		}
+	}
+	logger.Infow("Watching image", "ref", ref.String(), "interval", interval.String())
+	opts = append(opts, cosign.VerifyRegistryOptions(ro))
+	return cosign.WatchVerify(ctx, ref, pubKey, checkClaims, annotations, interval, onChange, opts...)
+}
+
+func postWatchAlert(ctx context.Context, url string, alert watchAlert) error {
+	b, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return nil
+}
+
+// printPayloads writes each payload in verified to w, either as is, one per
+// line, or if pretty is set, as indented JSON. Payloads that aren't JSON are
+// always written as is.
+func printPayloads(w io.Writer, verified []oci.SignedPayload, pretty bool) error {
+	for _, vp := range verified {
+		payload := vp.Payload
+		if pretty {
+			var b bytes.Buffer
+			if err := json.Indent(&b, vp.Payload, "", "  "); err == nil {
+				payload = b.Bytes()
+			}
+		}
+		if _, err := fmt.Fprintln(w, string(payload)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PartiallyVerifiedExitCode is what verify -no-fail-fast exits with when some
+// signatures verified and others failed; it exits with 1 when none verified.
+const PartiallyVerifiedExitCode = 3
+
+// verifyResult turns the errors from checking every signature into an
+// ExitError with PartiallyVerifiedExitCode if some signatures verified anyway,
+// so scripts can tell that apart from none verifying.
+func verifyResult(verified []oci.SignedPayload, err error) error {
+	if _, ok := err.(cosign.VerifyErrors); ok && len(verified) != 0 {
+		return &ExitError{Code: PartiallyVerifiedExitCode, Err: err}
+	}
+	return err
+}
+
+// ExitError makes cosign exit with Code, rather than 1, when Err is returned
+// from a command.
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+func (e *ExitError) Error() string {
+	return e.Err.Error()
+}
+
+// monitoredSignature is a signature printed by verify -monitor-since, along
+// with the time it was timestamped.
+type monitoredSignature struct {
+	oci.SignedPayload
+	Timestamp time.Time
+}
+
+// printNewSignatures writes the signatures in verified that were timestamped
+// after since to w, as a JSON array, oldest first. If there are none, it
+// returns an ExitError with code 2, so a polling job can tell no news apart
+// from a failure to verify.
+func printNewSignatures(w io.Writer, verified []oci.SignedPayload, since time.Time, tsaRoots *x509.CertPool) error {
+	found := []monitoredSignature{}
+	for _, sp := range verified {
+		ts, err := cosign.SignatureTimestamp(tsaRoots, sp)
+		if err != nil {
+			return err
+		}
+		if ts.After(since) {
+			found = append(found, monitoredSignature{SignedPayload: sp, Timestamp: ts})
+		}
+	}
+	if len(found) == 0 {
+		return &ExitError{Code: 2, Err: fmt.Errorf("no signatures timestamped after %s", since.Format(time.RFC3339))}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].Timestamp.Before(found[j].Timestamp) })
+	b, err := json.MarshalIndent(found, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(b))
+	return err
+}
+
+// VerifyKeyringCmd is VerifyCmd, for signatures by any of the keys in the
+// keyring at keyringPath. It logs which key verified each signature.
+func VerifyKeyringCmd(ctx context.Context, keyringPath string, imageRef string, checkClaims bool, annotations map[string]string, ro oci.RegistryOptions, opts ...cosign.VerifyOption) ([]oci.SignedPayload, error) {
+	ro.Context = ctx
+	ref, err := parseReference(imageRef, ro)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := cosign.LoadKeyring(keyringPath)
+	if err != nil {
+		return nil, err
+	}
+
+	opts = append(opts, cosign.VerifyRegistryOptions(ro))
+	verified, err := cosign.VerifyKeyring(ref, keys, checkClaims, annotations, opts...)
+	for _, vp := range verified {
+		fp, fpErr := cosign.PublicKeyFingerprint(vp.PublicKey)
+		if fpErr != nil {
+			return nil, fpErr
+		}
+		logger.Infow("Verified signature", "ref", ref.String(), "key", fp)
+	}
+	return verified, err
+}
+
+// VerifyKeysCmd is VerifyCmd, for signatures by any of the keys at keyRefs.
+// It logs which key verified each signature, and if none did, the error of
+// each key.
+func VerifyKeysCmd(ctx context.Context, keyRefs []string, imageRef string, checkClaims bool, annotations map[string]string, ro oci.RegistryOptions, opts ...cosign.VerifyOption) ([]oci.SignedPayload, error) {
+	ro.Context = ctx
+	ref, err := parseReference(imageRef, ro)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]ed25519.PublicKey, 0, len(keyRefs))
+	for _, keyRef := range keyRefs {
+		pubKey, err := cosign.LoadPublicKey(keyRef)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", keyRef, err)
+		}
+		keys = append(keys, pubKey)
+	}
+
+	opts = append(opts, cosign.VerifyRegistryOptions(ro))
+	verified, err := cosign.VerifyKeyring(ref, keys, checkClaims, annotations, opts...)
+	for _, vp := range verified {
+		for i, key := range keys {
+			if key.Equal(vp.PublicKey) {
+				logger.Infow("Verified signature", "ref", ref.String(), "key", keyRefs[i])
+				break
+			}
+		}
+	}
+	if errs, ok := err.(cosign.VerifyErrors); ok {
+		for i, e := range errs {
+			if ke, ok := e.(*cosign.KeyError); ok {
+				errs[i] = fmt.Errorf("%s: %v", keyRefs[ke.Index], ke.Err)
+			}
+		}
+	}
+	return verified, err
+}
+
+// VerifyCertificatesCmd is VerifyCmd, for signatures stored with a
+// certificate that chains up to the roots at chainPath, through the
+// intermediates there, see cosign.LoadCertChain. With systemRoots, they all
+// chain up to the system roots instead, see cosign.VerifyCertificate. It logs
+// the subject of each certificate that verified a signature.
+func VerifyCertificatesCmd(ctx context.Context, chainPath string, systemRoots bool, imageRef string, checkClaims bool, annotations map[string]string, ro oci.RegistryOptions, opts ...cosign.VerifyOption) ([]oci.SignedPayload, error) {
+	ro.Context = ctx
+	ref, err := parseReference(imageRef, ro)
+	if err != nil {
+		return nil, err
+	}
+
+	var roots *x509.CertPool
+	var intermediates []*x509.Certificate
+	if systemRoots {
+		intermediates, err = cosign.LoadCertificates(chainPath)
+	} else {
+		roots, intermediates, err = cosign.LoadCertChain(chainPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, cosign.VerifyCertIntermediates(intermediates))
+	return verifyCertificates(ref, roots, checkClaims, annotations, ro, opts...)
+}
+
+// VerifyKeylessCmd is VerifyCertificatesCmd, for signatures from sign
+// -keyless, whose certificates chain up to the fulcio root pinned by
+// `cosign initialize`.
+func VerifyKeylessCmd(ctx context.Context, imageRef string, checkClaims bool, annotations map[string]string, ro oci.RegistryOptions, opts ...cosign.VerifyOption) ([]oci.SignedPayload, error) {
+	ro.Context = ctx
+	ref, err := parseReference(imageRef, ro)
+	if err != nil {
+		return nil, err
+	}
+	roots, err := cosign.PinnedFulcioRoots()
+	if err != nil {
+		return nil, err
+	}
+	return verifyCertificates(ref, roots, checkClaims, annotations, ro, opts...)
+}
+
+func verifyCertificates(ref name.Reference, roots *x509.CertPool, checkClaims bool, annotations map[string]string, ro oci.RegistryOptions, opts ...cosign.VerifyOption) ([]oci.SignedPayload, error) {
+	opts = append(opts, cosign.VerifyRegistryOptions(ro))
+	verified, err := cosign.VerifyWithCertificates(ref, roots, checkClaims, annotations, opts...)
+	for _, vp := range verified {
+		fp, fpErr := cosign.PublicKeyFingerprint(vp.PublicKey)
+		if fpErr != nil {
+			return nil, fpErr
+		}
+		logger.Infow("Verified signature", "ref", ref.String(), "key", fp)
+	}
+	return verified, err
+}
+
+// VerifyOfflineCmd is VerifyCmd, also requiring the signature to be in the
+// Rekor bundle at bundlePath.
+func VerifyOfflineCmd(ctx context.Context, keyRef string, imageRef string, bundlePath string, checkClaims bool, annotations map[string]string, ro oci.RegistryOptions, opts ...cosign.VerifyOption) ([]oci.SignedPayload, error) {
+	ro.Context = ctx
+	ref, err := parseReference(imageRef, ro)
+	if err != nil {
+		return nil, err
+	}
+
+	pubKey, err := cosign.LoadPublicKey(keyRef)
+	if err != nil {
+		return nil, err
+	}
+
+	opts = append(opts, cosign.VerifyRegistryOptions(ro))
+	return cosign.VerifyOffline(ref, pubKey, bundlePath, checkClaims, annotations, opts...)
+}
+
+// VerifyLocalBundleCmd verifies the signature in the Sigstore bundle at
+// bundlePath against imageRef, see cosign.VerifyImageBundle. Tlog entries in
+// the bundle are checked against the Rekor key pinned by `cosign initialize`.
+func VerifyLocalBundleCmd(ctx context.Context, keyRef, imageRef, bundlePath string, checkClaims bool, annotations map[string]string, ro oci.RegistryOptions, opts ...cosign.VerifyOption) (*cosign.ImageVerification, error) {
+	ro.Context = ctx
+	ref, err := parseReference(imageRef, ro)
+	if err != nil {
+		return nil, err
+	}
+	pubKey, err := cosign.LoadPublicKey(keyRef)
+	if err != nil {
+		return nil, err
+	}
+	b, err := cosign.LoadBundle(bundlePath)
+	if err != nil {
+		return nil, err
+	}
+	var rekorKey crypto.PublicKey
+	if len(b.VerificationMaterial.TlogEntries) != 0 {
+		if rekorKey, err = cosign.PinnedRekorKey(); err != nil {
+			return nil, err
+		}
+	}
+
+	opts = append(opts, cosign.VerifyRegistryOptions(ro))
+	return cosign.VerifyImageBundle(ref, b, pubKey, rekorKey, checkClaims, annotations, opts...)
+}
+
+// VerifyOCILayoutCmd verifies the images in the OCI image layout at layoutPath.
+func VerifyOCILayoutCmd(ctx context.Context, keyRef string, layoutPath string, checkClaims bool, annotations map[string]string, opts ...cosign.VerifyOption) ([]oci.SignedPayload, error) {
+	pubKey, err := cosign.LoadPublicKey(keyRef)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, cosign.VerifyContext(ctx))
+	return cosign.VerifyOCILayout(layoutPath, pubKey, checkClaims, annotations, opts...)
+}
+
+// VerifyPatternCmd verifies every image with a tag matching pattern, and writes
+// a table of which passed and which failed to w.
+func VerifyPatternCmd(ctx context.Context, keyRef string, pattern string, checkClaims bool, annotations map[string]string, ro oci.RegistryOptions, w io.Writer, opts ...cosign.VerifyOption) error {
+	warnInsecure(ro)
+	pubKey, err := cosign.LoadPublicKey(keyRef)
+	if err != nil {
+		return err
+	}
+
+	opts = append(opts, cosign.VerifyRegistryOptions(ro))
+	verified, failed, err := cosign.VerifyPattern(ctx, pattern, pubKey, checkClaims, annotations, opts...)
+	if err != nil {
+		return err
+	}
+	if len(verified)+len(failed) == 0 {
+		return fmt.Errorf("no images match %s", pattern)
+	}
+
+	refs := []string{}
+	for ref := range verified {
+		refs = append(refs, ref)
+	}
+	for ref := range failed {
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+
+	rows := make([]verifyRow, 0, len(refs))
+	for _, ref := range refs {
+		rows = append(rows, verifyRow{ref: ref, verified: len(verified[ref]), err: failed[ref]})
+	}
+	return writeVerifyTable(w, rows)
+}
+
+// VerifyParallelCmd verifies every image in imageRefs, parallelism at a time,
+// and writes a table of which passed and which failed to w, in the order they
+// were given.
+func VerifyParallelCmd(ctx context.Context, keyRef string, imageRefs []string, parallelism int, checkClaims bool, annotations map[string]string, ro oci.RegistryOptions, w io.Writer, opts ...cosign.VerifyOption) error {
+	if parallelism < 1 {
+		return fmt.Errorf("invalid parallelism: %d", parallelism)
+	}
+	warnInsecure(ro)
+	refs := make([]name.Reference, 0, len(imageRefs))
+	for _, imageRef := range imageRefs {
+		if cosign.IsPattern(imageRef) {
+			return fmt.Errorf("can't verify the tag pattern %s with other images", imageRef)
+		}
+		ref, err := name.ParseReference(imageRef, ro.NameOptions()...)
+		if err != nil {
+			return err
+		}
+		refs = append(refs, ref)
+	}
+	pubKey, err := cosign.LoadPublicKey(keyRef)
+	if err != nil {
+		return err
+	}
+
+	opts = append(opts, cosign.VerifyRegistryOptions(ro), cosign.VerifyParallelism(parallelism))
+	results := cosign.VerifyAll(ctx, refs, pubKey, checkClaims, annotations, opts...)
+	rows := make([]verifyRow, 0, len(results))
+	for i, r := range results {
+		rows = append(rows, verifyRow{ref: imageRefs[i], verified: len(r.Verified), err: r.Err})
+	}
+	return writeVerifyTable(w, rows)
+}
+
+// verifyRow is one image in the table written by writeVerifyTable.
+type verifyRow struct {
+	ref      string
+	verified int
+	err      error
+}
+
+// writeVerifyTable writes a table of which images passed and which failed to
+// w, and returns an error if any failed.
+func writeVerifyTable(w io.Writer, rows []verifyRow) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "IMAGE\tRESULT")
+	failed := 0
+	for _, r := range rows {
+		if r.err != nil {
+			fmt.Fprintf(tw, "%s\tFAIL: %s\n", r.ref, strings.ReplaceAll(r.err.Error(), "\n", " "))
+			failed++
+			continue
+		}
+		fmt.Fprintf(tw, "%s\tPASS: %d signature(s)\n", r.ref, r.verified)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d image(s) failed to verify", failed, len(rows))
+	}
+	return nil
 }
@@ -0,0 +1,96 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"context"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/peterbourgon/ff/v3/ffcli"
+	"github.com/sigstore/cosign/pkg/cosign"
+)
+
+func VerifyBundle() *ffcli.Command {
+	var (
+		flagset = flag.NewFlagSet("cosign verify-bundle", flag.ExitOnError)
+		key     = flagset.String("key", "", "path to the public key")
+		bundle  = flagset.String("bundle", "", "path to the Sigstore bundle written by sign-blob -bundle-out")
+		certs   = flagset.String("cert-chain", "", "path to the PEM encoded certificates to trust, instead of a key: the key comes from the certificate in the bundle, which must chain up to one of them")
+		tsaCert = flagset.String("timestamp-certs", "", "path to the PEM encoded root certificates of the timestamp authority, to require a trusted timestamp")
+	)
+	return &ffcli.Command{
+		Name:       "verify-bundle",
+		ShortUsage: "cosign verify-bundle -key <key>|-cert-chain <roots.pem> -bundle <file.sigstore> [-timestamp-certs <roots.pem>] <blob>",
+		ShortHelp:  "Verify a Sigstore bundle against the supplied blob",
+		FlagSet:    flagset,
+		Exec: func(ctx context.Context, args []string) error {
+			if (*key == "") == (*certs == "") || *bundle == "" {
+				return flag.ErrHelp
+			}
+			if len(args) != 1 {
+				return flag.ErrHelp
+			}
+			return VerifyBundleCmd(ctx, *key, *certs, *bundle, args[0], *tsaCert)
+		},
+	}
+}
+
+// VerifyBundleCmd verifies the bundle at bundlePath against the blob at
+// blobRef, with the key keyRef or, if it's empty, the certificate in the
+// bundle, which must chain up to the ones at certsPath.
+func VerifyBundleCmd(_ context.Context, keyRef, certsPath, bundlePath, blobRef, tsaCertsPath string) error {
+	var blob []byte
+	var err error
+	if blobRef == "-" {
+		blob, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		blob, err = ioutil.ReadFile(blobRef)
+	}
+	if err != nil {
+		return err
+	}
+
+	var tsaRoots *x509.CertPool
+	if tsaCertsPath != "" {
+		if tsaRoots, err = cosign.LoadCertPool(tsaCertsPath); err != nil {
+			return err
+		}
+	}
+
+	if keyRef != "" {
+		err = cosign.VerifyBundle(bundlePath, keyRef, blob, tsaRoots)
+	} else {
+		err = verifyBundleWithCertificates(certsPath, bundlePath, blob, tsaRoots)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Println("Verified OK")
+	return nil
+}
+
+func verifyBundleWithCertificates(certsPath, bundlePath string, blob []byte, tsaRoots *x509.CertPool) error {
+	roots, err := cosign.LoadCertPool(certsPath)
+	if err != nil {
+		return err
+	}
+	return cosign.VerifyBundleWithCertificates(bundlePath, blob, roots, tsaRoots)
+}
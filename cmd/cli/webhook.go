@@ -0,0 +1,84 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/peterbourgon/ff/v3/ffcli"
+	"github.com/sigstore/cosign/pkg/cosign/oci"
+	"github.com/sigstore/cosign/pkg/cosign/webhook"
+)
+
+func Webhook() *ffcli.Command {
+	var (
+		flagset  = flag.NewFlagSet("cosign webhook", flag.ExitOnError)
+		port     = flagset.Int("port", 8443, "port to serve the webhook on")
+		certFile = flagset.String("tls-cert", "", "path to the PEM encoded TLS certificate to serve with")
+		keyFile  = flagset.String("tls-key", "", "path to the PEM encoded private key of the TLS certificate")
+		config   = flagset.String("config", "", "path to the YAML list of rules, each with an imagePattern, pubKey and threshold")
+		ro       = registryFlags(flagset)
+	)
+	return &ffcli.Command{
+		Name:       "webhook",
+		ShortUsage: "cosign webhook -tls-cert <cert.pem> -tls-key <key.pem> -config <rules.yaml> [-port <port>] [-registry-username <user> -registry-password <pass>]",
+		ShortHelp:  "Serve a Kubernetes admission webhook that only admits pods with signed images",
+		FlagSet:    flagset,
+		Exec: func(ctx context.Context, args []string) error {
+			ro.Context = ctx
+			if *certFile == "" || *keyFile == "" || *config == "" || len(args) != 0 {
+				return flag.ErrHelp
+			}
+			return WebhookCmd(ctx, *port, *certFile, *keyFile, *config, *ro)
+		},
+	}
+}
+
+// WebhookCmd serves the admission webhook, see webhook.Webhook, with the
+// rules of configFile on port, until ctx is done.
+func WebhookCmd(ctx context.Context, port int, certFile, keyFile, configFile string, ro oci.RegistryOptions) error {
+	rules, err := webhook.LoadConfig(configFile)
+	if err != nil {
+		return err
+	}
+	warnInsecure(ro)
+
+	mux := http.NewServeMux()
+	mux.Handle("/validate", webhook.New(rules, ro))
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	s := &http.Server{Addr: net.JoinHostPort("", strconv.Itoa(port)), Handler: mux}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- s.ListenAndServeTLS(certFile, keyFile)
+	}()
+	logger.Infow("Serving admission webhook", "address", "https://"+s.Addr+"/validate", "rules", len(rules))
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+		s.Shutdown(context.Background())
+		return nil
+	}
+}
@@ -29,6 +29,10 @@ import (
 var (
 	rootFlagSet = flag.NewFlagSet("cosign", flag.ExitOnError)
 	verbose     = rootFlagSet.Bool("v", false, "increase log verbosity")
+	logFormat   = rootFlagSet.String("log-format", "text", "format of the log output, json or text")
+	logLevel    = rootFlagSet.String("log-level", "info", "only log messages at or above this level: debug, info, warn or error")
+	timeout     = rootFlagSet.Duration("timeout", 0, "give up on the command after this long, e.g. 30s or 5m; no timeout if 0")
+	metricsAddr = rootFlagSet.String("metrics-addr", "", "serve Prometheus metrics at /metrics on this address, e.g. :9090, while the command runs")
 )
 
 func main() {
@@ -36,17 +40,45 @@ func main() {
 		ShortUsage: "cosign [flags] <subcommand>",
 		FlagSet:    rootFlagSet,
 		Subcommands: []*ffcli.Command{
-			cli.Verify(), cli.Sign(), cli.Upload(), cli.Generate(), cli.Download(), cli.GenerateKeyPair(), cli.SignBlob(), cli.VerifyBlob(), cli.Triangulate()},
+			cli.Verify(), cli.Sign(), cli.Upload(), cli.Generate(), cli.Download(), cli.GenerateKeyPair(), cli.SignBlob(), cli.VerifyBlob(), cli.VerifyBundle(), cli.Triangulate(), cli.MigrateSignatures(), cli.Initialize(), cli.Clean(), cli.PublicKey(), cli.Tree(), cli.Dockerfile(), cli.Webhook()},
 		Exec: func(context.Context, []string) error {
 			return flag.ErrHelp
 		},
 	}
 
-	if err := root.ParseAndRun(context.Background(), os.Args[1:]); err != nil {
+	root.Subcommands = append(root.Subcommands, cli.Completion(root))
+
+	if err := root.Parse(os.Args[1:]); err != nil {
+		fail(err)
+	}
+	if err := cli.SetupLogging(os.Stderr, *logFormat, *logLevel); err != nil {
+		fail(err)
+	}
+	if *metricsAddr != "" {
+		stop, err := cli.ServeMetrics(*metricsAddr)
+		if err != nil {
+			fail(err)
+		}
+		defer stop()
+	}
+	ctx := context.Background()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+	if err := root.Run(ctx); err != nil {
 		if *verbose {
 			fmt.Print("verbose!")
 		}
-		fmt.Fprintf(os.Stderr, "error: %v\n", err)
-		os.Exit(1)
+		fail(err)
+	}
+}
+
+func fail(err error) {
+	cli.Logger().Errorw("Command failed", "error", err)
+	if ee, ok := err.(*cli.ExitError); ok {
+		os.Exit(ee.Code)
 	}
+	os.Exit(1)
 }
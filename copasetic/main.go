@@ -21,6 +21,7 @@ import (
 	"github.com/open-policy-agent/opa/cmd"
 	"github.com/open-policy-agent/opa/rego"
 	"github.com/open-policy-agent/opa/types"
+	"github.com/sigstore/cosign/pkg/cosign/oci"
 )
 
 func main() {
@@ -116,7 +117,7 @@ func main() {
 				return nil, err
 			}
 
-			sps, _, err := cosign.FetchSignatures(ref)
+			sps, _, err := oci.FetchSignatures(ref, oci.RegistryOptions{})
 			if err != nil {
 				return nil, err
 			}
@@ -0,0 +1,161 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cosign
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/nacl/secretbox"
+)
+
+// PEM headers describing how an argon2id encrypted private key was encrypted.
+// Keys without a kdfHeader were encrypted with scrypt.
+const (
+	kdfHeader         = "KDF"
+	memoryHeader      = "Argon2-Memory"
+	iterationsHeader  = "Argon2-Iterations"
+	parallelismHeader = "Argon2-Parallelism"
+	saltHeader        = "Salt"
+	nonceHeader       = "Nonce"
+
+	kdfArgon2id = "argon2id"
+)
+
+// Argon2Params are the argon2id parameters used to derive the key that
+// encrypts a private key.
+type Argon2Params struct {
+	// Memory is in KiB.
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+}
+
+// DefaultArgon2Params uses 64MB of memory, 3 iterations and 4 lanes.
+var DefaultArgon2Params = Argon2Params{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 4,
+}
+
+// The most memory and iterations a key may ask for. The parameters of a key
+// come from its PEM headers, so without a limit, loading a key could use up
+// all the memory or take forever.
+const (
+	maxArgon2Memory     = 4 * 1024 * 1024
+	maxArgon2Iterations = 100
+)
+
+// Validate checks that the parameters are at least 1, and that Memory and
+// Iterations are at most 4GB and 100.
+func (p Argon2Params) Validate() error {
+	if p.Memory < 1 || p.Memory > maxArgon2Memory {
+		return fmt.Errorf("argon2 memory must be between 1 and %d KiB, got %d", maxArgon2Memory, p.Memory)
+	}
+	if p.Iterations < 1 || p.Iterations > maxArgon2Iterations {
+		return fmt.Errorf("argon2 iterations must be between 1 and %d, got %d", maxArgon2Iterations, p.Iterations)
+	}
+	if p.Parallelism < 1 {
+		return errors.New("argon2 parallelism must be at least 1")
+	}
+	return nil
+}
+
+// EncryptPrivateKeyArgon2 encrypts priv with a key derived from pass using
+// argon2id, and returns it PEM encoded. The parameters, salt and nonce are
+// stored in the PEM headers so LoadPrivateKey can decrypt it again.
+func EncryptPrivateKeyArgon2(priv, pass []byte, params Argon2Params) ([]byte, error) {
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+	var salt [32]byte
+	if _, err := rand.Read(salt[:]); err != nil {
+		return nil, err
+	}
+	var nonce [24]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return nil, err
+	}
+	key := argon2Key(pass, salt[:], params)
+
+	return pem.EncodeToMemory(&pem.Block{
+		Type: pemType,
+		Headers: map[string]string{
+			kdfHeader:         kdfArgon2id,
+			memoryHeader:      strconv.FormatUint(uint64(params.Memory), 10),
+			iterationsHeader:  strconv.FormatUint(uint64(params.Iterations), 10),
+			parallelismHeader: strconv.FormatUint(uint64(params.Parallelism), 10),
+			saltHeader:        base64.StdEncoding.EncodeToString(salt[:]),
+			nonceHeader:       base64.StdEncoding.EncodeToString(nonce[:]),
+		},
+		Bytes: secretbox.Seal(nil, priv, &nonce, key),
+	}), nil
+}
+
+func decryptArgon2(p *pem.Block, pass []byte) ([]byte, error) {
+	memory, err := strconv.ParseUint(p.Headers[memoryHeader], 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", memoryHeader, err)
+	}
+	iterations, err := strconv.ParseUint(p.Headers[iterationsHeader], 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", iterationsHeader, err)
+	}
+	parallelism, err := strconv.ParseUint(p.Headers[parallelismHeader], 10, 8)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", parallelismHeader, err)
+	}
+	salt, err := base64.StdEncoding.DecodeString(p.Headers[saltHeader])
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", saltHeader, err)
+	}
+	n, err := base64.StdEncoding.DecodeString(p.Headers[nonceHeader])
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", nonceHeader, err)
+	}
+	var nonce [24]byte
+	if len(n) != len(nonce) {
+		return nil, fmt.Errorf("invalid %s: wrong length", nonceHeader)
+	}
+	copy(nonce[:], n)
+
+	params := Argon2Params{
+		Memory:      uint32(memory),
+		Iterations:  uint32(iterations),
+		Parallelism: uint8(parallelism),
+	}
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+	key := argon2Key(pass, salt, params)
+	priv, ok := secretbox.Open(nil, p.Bytes, &nonce, key)
+	if !ok {
+		return nil, errors.New("decryption failed")
+	}
+	return priv, nil
+}
+
+func argon2Key(pass, salt []byte, params Argon2Params) *[32]byte {
+	var key [32]byte
+	copy(key[:], argon2.IDKey(pass, salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key))))
+	return &key
+}
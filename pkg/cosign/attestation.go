@@ -0,0 +1,65 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cosign
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// InTotoStatementType is the _type of the in-toto statements cosign
+// generates.
+const InTotoStatementType = "https://in-toto.io/Statement/v0.1"
+
+// InTotoStatement is an in-toto statement, see
+// https://github.com/in-toto/attestation. sign -predicate signs them, wrapped
+// in a DSSE envelope, as attestations about an image.
+type InTotoStatement struct {
+	Type          string          `json:"_type"`
+	Subject       []InTotoSubject `json:"subject"`
+	PredicateType string          `json:"predicateType"`
+	Predicate     json.RawMessage `json:"predicate"`
+}
+
+// InTotoSubject is an artifact an InTotoStatement is about.
+type InTotoSubject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+// AttestationPayload returns an in-toto statement with predicate, of
+// predicateType, about the image desc in repo. predicate has to be JSON.
+func AttestationPayload(repo name.Repository, desc v1.Descriptor, predicateType string, predicate []byte) ([]byte, error) {
+	if predicateType == "" {
+		return nil, errors.New("an attestation needs a predicate type")
+	}
+	if !json.Valid(predicate) {
+		return nil, errors.New("the predicate isn't valid JSON")
+	}
+	return json.Marshal(InTotoStatement{
+		Type: InTotoStatementType,
+		Subject: []InTotoSubject{{
+			Name:   repo.Name(),
+			Digest: map[string]string{desc.Digest.Algorithm: desc.Digest.Hex},
+		}},
+		PredicateType: predicateType,
+		Predicate:     json.RawMessage(predicate),
+	})
+}
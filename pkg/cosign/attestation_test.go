@@ -0,0 +1,63 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cosign
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+func TestAttestationPayload(t *testing.T) {
+	repo, err := name.NewRepository("registry.example.com/image")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := v1.Hash{Algorithm: "sha256", Hex: "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"}
+	desc := v1.Descriptor{Digest: h}
+	predicateType := "https://slsa.dev/provenance/v0.2"
+
+	if _, err := AttestationPayload(repo, desc, "", []byte(`{}`)); err == nil {
+		t.Error("AttestationPayload() without a predicate type, wanted error")
+	}
+	if _, err := AttestationPayload(repo, desc, predicateType, []byte("not json")); err == nil {
+		t.Error("AttestationPayload() with an invalid predicate, wanted error")
+	}
+
+	payload, err := AttestationPayload(repo, desc, predicateType, []byte(`{"builder": {"id": "ci"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := InTotoStatement{}
+	if err := json.Unmarshal(payload, &st); err != nil {
+		t.Fatal(err)
+	}
+	if st.Type != InTotoStatementType || st.PredicateType != predicateType || len(st.Subject) != 1 || st.Subject[0].Name != repo.Name() {
+		t.Errorf("AttestationPayload() = %s", payload)
+	}
+
+	// Verify finds the image in the statement's subjects.
+	claims, err := ParsePayload(InTotoMediaType, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(claims.Digests) != 1 || claims.Digests[0] != h.Hex {
+		t.Errorf("ParsePayload() digests = %v, wanted %s", claims.Digests, h.Hex)
+	}
+}
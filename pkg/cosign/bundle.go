@@ -0,0 +1,303 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cosign
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/sigstore/cosign/pkg/cosign/bundle"
+)
+
+const (
+	// BundleMediaType is the media type of a Sigstore bundle.
+	BundleMediaType = bundle.MediaType
+
+	bundleDigestAlgorithm = "SHA2_256"
+)
+
+// Bundle is a Sigstore bundle: everything needed to verify the signature of a
+// blob, in one file. The verification material is a public key hint, or the
+// certificate chain of the key. There may be an RFC 3161 timestamp of the
+// signature, and the Rekor entries of the signature.
+//
+// The signature is either a MessageSignature of the blob, or a DSSEEnvelope
+// wrapping it. Only envelopes have the signed payload in them, so image
+// signatures, whose payload can't be derived from the image, are always
+// envelopes.
+type Bundle = bundle.Bundle
+
+// The parts of a Bundle, see package bundle.
+type (
+	VerificationMaterial      = bundle.VerificationMaterial
+	PublicKeyIdentifier       = bundle.PublicKeyIdentifier
+	X509CertificateChain      = bundle.X509CertificateChain
+	X509Certificate           = bundle.X509Certificate
+	TimestampVerificationData = bundle.TimestampVerificationData
+	RFC3161SignedTimestamp    = bundle.RFC3161SignedTimestamp
+	MessageSignature          = bundle.MessageSignature
+	MessageDigest             = bundle.MessageDigest
+	LogID                     = bundle.LogID
+	InclusionPromise          = bundle.InclusionPromise
+)
+
+// TlogEntry is a Rekor entry of the signature in a bundle. It holds the same
+// things as a RekorBundle.
+type TlogEntry = bundle.TransparencyLogEntry
+
+// NewTlogEntry converts a RekorBundle, as returned by Rekor, to a TlogEntry.
+func NewTlogEntry(rb *RekorBundle) (TlogEntry, error) {
+	body, err := base64.StdEncoding.DecodeString(rb.Payload.Body)
+	if err != nil {
+		return TlogEntry{}, fmt.Errorf("invalid bundle body: %v", err)
+	}
+	logID, err := hex.DecodeString(rb.Payload.LogID)
+	if err != nil {
+		return TlogEntry{}, fmt.Errorf("invalid log ID: %v", err)
+	}
+	e := TlogEntry{
+		LogIndex:          rb.Payload.LogIndex,
+		LogID:             LogID{KeyID: logID},
+		IntegratedTime:    rb.Payload.IntegratedTime,
+		InclusionPromise:  &InclusionPromise{SignedEntryTimestamp: rb.SignedEntryTimestamp},
+		CanonicalizedBody: body,
+	}
+	kv := struct {
+		Kind       string `json:"kind"`
+		APIVersion string `json:"apiVersion"`
+	}{}
+	if json.Unmarshal(body, &kv) == nil && kv.Kind != "" {
+		e.KindVersion = &bundle.KindVersion{Kind: kv.Kind, Version: kv.APIVersion}
+	}
+	return e, nil
+}
+
+// tlogRekorBundle converts e back to the RekorBundle its SET signs.
+func tlogRekorBundle(e TlogEntry) (*RekorBundle, error) {
+	if e.InclusionPromise == nil {
+		return nil, errors.New("tlog entry has no inclusion promise")
+	}
+	return &RekorBundle{
+		SignedEntryTimestamp: e.InclusionPromise.SignedEntryTimestamp,
+		Payload: RekorPayload{
+			Body:           base64.StdEncoding.EncodeToString(e.CanonicalizedBody),
+			IntegratedTime: e.IntegratedTime,
+			LogID:          hex.EncodeToString(e.LogID.KeyID),
+			LogIndex:       e.LogIndex,
+		},
+	}, nil
+}
+
+// NewBundle bundles signature, the signature of blob by the private half of pub.
+func NewBundle(pub ed25519.PublicKey, blob, signature []byte) (*Bundle, error) {
+	hint, err := PublicKeyFingerprint(pub)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(blob)
+	return &Bundle{
+		MediaType: BundleMediaType,
+		VerificationMaterial: VerificationMaterial{
+			PublicKey: &PublicKeyIdentifier{Hint: hint},
+		},
+		MessageSignature: &MessageSignature{
+			MessageDigest: MessageDigest{
+				Algorithm: bundleDigestAlgorithm,
+				Digest:    digest[:],
+			},
+			Signature: signature,
+		},
+	}, nil
+}
+
+// NewDSSEBundle bundles env, an envelope signed by the private half of pub.
+func NewDSSEBundle(pub ed25519.PublicKey, env *DSSEEnvelope) (*Bundle, error) {
+	hint, err := PublicKeyFingerprint(pub)
+	if err != nil {
+		return nil, err
+	}
+	return &Bundle{
+		MediaType: BundleMediaType,
+		VerificationMaterial: VerificationMaterial{
+			PublicKey: &PublicKeyIdentifier{Hint: hint},
+		},
+		DSSEEnvelope: env,
+	}, nil
+}
+
+// WriteBundle writes b to path as JSON.
+func WriteBundle(path string, b *Bundle) error {
+	out, err := bundle.Marshal(b)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(out, '\n'), 0644)
+}
+
+// LoadBundle reads the bundle at path.
+func LoadBundle(path string) (*Bundle, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	b, err := bundle.Unmarshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return b, nil
+}
+
+// VerifyBundle verifies that the bundle at bundlePath is a signature of blob
+// by the public key keyRef, which is anything LoadPublicKey accepts. ed25519
+// signs the whole message rather than its digest, so the blob is needed too.
+// If tsaRoots is set, the bundle must also have a timestamp of the signature
+// from an authority that chains up to them.
+func VerifyBundle(bundlePath, keyRef string, blob []byte, tsaRoots *x509.CertPool) error {
+	b, err := LoadBundle(bundlePath)
+	if err != nil {
+		return err
+	}
+	pub, err := LoadPublicKey(keyRef)
+	if err != nil {
+		return err
+	}
+	return verifyBundle(b, pub, blob, tsaRoots)
+}
+
+// VerifyBundleWithCertificates is VerifyBundle, but the key comes from the
+// certificate chain in the bundle, which must chain up to roots.
+func VerifyBundleWithCertificates(bundlePath string, blob []byte, roots, tsaRoots *x509.CertPool) error {
+	b, err := LoadBundle(bundlePath)
+	if err != nil {
+		return err
+	}
+	chain := b.VerificationMaterial.X509CertificateChain
+	if chain == nil || len(chain.Certificates) == 0 {
+		return errors.New("bundle has no certificate")
+	}
+	certs := make([]*x509.Certificate, 0, len(chain.Certificates))
+	for _, c := range chain.Certificates {
+		cert, err := x509.ParseCertificate(c.RawBytes)
+		if err != nil {
+			return fmt.Errorf("invalid certificate: %v", err)
+		}
+		certs = append(certs, cert)
+	}
+	pub, err := VerifyCertificate(certs[0], certs[1:], roots)
+	if err != nil {
+		return err
+	}
+	return verifyBundle(b, pub, blob, tsaRoots)
+}
+
+func verifyBundle(b *Bundle, pub ed25519.PublicKey, blob []byte, tsaRoots *x509.CertPool) error {
+	if err := checkBundleHint(b, pub); err != nil {
+		return err
+	}
+	signature, err := verifyBundleSignature(b, pub, blob)
+	if err != nil {
+		return err
+	}
+	if tsaRoots == nil {
+		return nil
+	}
+	_, err = bundleTimestamp(b, signature, tsaRoots)
+	return err
+}
+
+// checkBundleHint checks that b is signed by pub, if it says which key it is.
+func checkBundleHint(b *Bundle, pub ed25519.PublicKey) error {
+	if b.VerificationMaterial.PublicKey == nil || b.VerificationMaterial.PublicKey.Hint == "" {
+		return nil
+	}
+	hint := b.VerificationMaterial.PublicKey.Hint
+	want, err := PublicKeyFingerprint(pub)
+	if err != nil {
+		return err
+	}
+	if hint != want {
+		return fmt.Errorf("bundle was signed by a different key, hint %s", hint)
+	}
+	return nil
+}
+
+// verifyBundleSignature checks that the signature in b is pub's signature of
+// blob, and returns it.
+func verifyBundleSignature(b *Bundle, pub ed25519.PublicKey, blob []byte) ([]byte, error) {
+	if env := b.DSSEEnvelope; env != nil {
+		payload, err := VerifyDSSE(pub, env)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(payload, blob) {
+			return nil, errors.New("bundle envelope is for a different blob")
+		}
+		return envelopeSignature(env)
+	}
+	if b.MessageSignature == nil {
+		return nil, errors.New("bundle has no signature")
+	}
+	md := b.MessageSignature.MessageDigest
+	if md.Algorithm != bundleDigestAlgorithm {
+		return nil, fmt.Errorf("unsupported digest algorithm %q", md.Algorithm)
+	}
+	digest := sha256.Sum256(blob)
+	if !bytes.Equal(md.Digest, digest[:]) {
+		return nil, fmt.Errorf("bundle is for a different blob, digest %s", hex.EncodeToString(md.Digest))
+	}
+
+	if !ed25519.Verify(pub, blob, b.MessageSignature.Signature) {
+		return nil, fmt.Errorf("unable to verify signature")
+	}
+	return b.MessageSignature.Signature, nil
+}
+
+// envelopeSignature returns the signature of a single-signature envelope,
+// the one a bundle's timestamps and tlog entries are for.
+func envelopeSignature(env *DSSEEnvelope) ([]byte, error) {
+	if len(env.Signatures) != 1 {
+		return nil, fmt.Errorf("bundle envelope has %d signatures, wanted 1", len(env.Signatures))
+	}
+	return base64.StdEncoding.DecodeString(env.Signatures[0].Sig)
+}
+
+// bundleTimestamp checks that b has a timestamp of signature from an
+// authority that chains up to tsaRoots, and returns the time it was made.
+func bundleTimestamp(b *Bundle, signature []byte, tsaRoots *x509.CertPool) (time.Time, error) {
+	tvd := b.VerificationMaterial.TimestampVerificationData
+	if tvd == nil || len(tvd.RFC3161Timestamps) == 0 {
+		return time.Time{}, errors.New("bundle has no timestamp")
+	}
+	var tsErr error
+	for _, ts := range tvd.RFC3161Timestamps {
+		t, err := VerifyTimestamp(ts.SignedTimestamp, signature, tsaRoots)
+		if err == nil {
+			return t, nil
+		}
+		tsErr = err
+	}
+	return time.Time{}, tsErr
+}
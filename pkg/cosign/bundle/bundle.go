@@ -0,0 +1,192 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package bundle is the Sigstore bundle format, the JSON encoding of the
+// Bundle message of https://github.com/sigstore/protobuf-specs, as written
+// to .sigstore files. It only has the types and their encoding; signing and
+// verifying bundles is in package cosign.
+package bundle
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// MediaType is the media type of the bundles this package writes.
+	MediaType = "application/vnd.dev.sigstore.bundle+json;version=0.1"
+
+	// mediaTypePrefix is what the media types of every version of the bundle
+	// start with.
+	mediaTypePrefix = "application/vnd.dev.sigstore.bundle"
+)
+
+// Bundle is everything needed to verify a signature, in one file.
+//
+// The signature is either a MessageSignature of a blob, or an Envelope
+// wrapping the signed payload; exactly one of them is set.
+type Bundle struct {
+	MediaType            string               `json:"mediaType"`
+	VerificationMaterial VerificationMaterial `json:"verificationMaterial"`
+	MessageSignature     *MessageSignature    `json:"messageSignature,omitempty"`
+	DSSEEnvelope         *Envelope            `json:"dsseEnvelope,omitempty"`
+}
+
+// VerificationMaterial says which key the signature should verify with,
+// either with a PublicKey hint or an X509CertificateChain, along with
+// timestamps of the signature and its transparency log entries.
+type VerificationMaterial struct {
+	PublicKey                 *PublicKeyIdentifier       `json:"publicKey,omitempty"`
+	X509CertificateChain      *X509CertificateChain      `json:"x509CertificateChain,omitempty"`
+	TlogEntries               []TransparencyLogEntry     `json:"tlogEntries,omitempty"`
+	TimestampVerificationData *TimestampVerificationData `json:"timestampVerificationData,omitempty"`
+}
+
+// PublicKeyIdentifier identifies a key without including it.
+type PublicKeyIdentifier struct {
+	Hint string `json:"hint"`
+}
+
+// X509CertificateChain is the certificate for the signing key, followed by
+// its intermediates.
+type X509CertificateChain struct {
+	Certificates []X509Certificate `json:"certificates"`
+}
+
+// X509Certificate is a DER encoded certificate.
+type X509Certificate struct {
+	RawBytes []byte `json:"rawBytes"`
+}
+
+// TransparencyLogEntry is a Rekor entry of the signature, with the inclusion
+// promise (the SET) Rekor returned for it, and a proof of its inclusion in
+// the log if there is one.
+type TransparencyLogEntry struct {
+	LogIndex          int64             `json:"logIndex,string"`
+	LogID             LogID             `json:"logId"`
+	KindVersion       *KindVersion      `json:"kindVersion,omitempty"`
+	IntegratedTime    int64             `json:"integratedTime,string"`
+	InclusionPromise  *InclusionPromise `json:"inclusionPromise,omitempty"`
+	InclusionProof    *InclusionProof   `json:"inclusionProof,omitempty"`
+	CanonicalizedBody []byte            `json:"canonicalizedBody"`
+}
+
+// LogID identifies a log by the SHA-256 hash of its public key.
+type LogID struct {
+	KeyID []byte `json:"keyId"`
+}
+
+// KindVersion is the type of a Rekor entry, e.g. hashedrekord 0.0.1.
+type KindVersion struct {
+	Kind    string `json:"kind"`
+	Version string `json:"version"`
+}
+
+// InclusionPromise is the signed entry timestamp of a TransparencyLogEntry.
+type InclusionPromise struct {
+	SignedEntryTimestamp []byte `json:"signedEntryTimestamp"`
+}
+
+// InclusionProof is a Merkle proof that an entry is in the log, as of the
+// signed Checkpoint.
+type InclusionProof struct {
+	LogIndex   int64      `json:"logIndex,string"`
+	RootHash   []byte     `json:"rootHash"`
+	TreeSize   int64      `json:"treeSize,string"`
+	Hashes     [][]byte   `json:"hashes"`
+	Checkpoint Checkpoint `json:"checkpoint"`
+}
+
+// Checkpoint is a signed note of the log's size and root hash.
+type Checkpoint struct {
+	Envelope string `json:"envelope"`
+}
+
+// TimestampVerificationData holds timestamps countersigning the signature.
+type TimestampVerificationData struct {
+	RFC3161Timestamps []RFC3161SignedTimestamp `json:"rfc3161Timestamps"`
+}
+
+// RFC3161SignedTimestamp is a DER encoded RFC 3161 timestamp token.
+type RFC3161SignedTimestamp struct {
+	SignedTimestamp []byte `json:"signedTimestamp"`
+}
+
+// MessageSignature is the signature of a blob, along with its digest.
+type MessageSignature struct {
+	MessageDigest MessageDigest `json:"messageDigest"`
+	Signature     []byte        `json:"signature"`
+}
+
+// MessageDigest is the digest of the signed blob. The algorithm is named as
+// in the HashAlgorithm enum, e.g. SHA2_256.
+type MessageDigest struct {
+	Algorithm string `json:"algorithm"`
+	Digest    []byte `json:"digest"`
+}
+
+// Envelope is a Dead Simple Signing Envelope, see
+// https://github.com/secure-systems-lab/dsse.
+type Envelope struct {
+	PayloadType string `json:"payloadType"`
+	// Payload is base64 encoded.
+	Payload    string      `json:"payload"`
+	Signatures []Signature `json:"signatures"`
+}
+
+// Signature is a signature in an Envelope.
+type Signature struct {
+	KeyID string `json:"keyid"`
+	// Sig is the base64 encoded signature of the PAE of the payload.
+	Sig string `json:"sig"`
+}
+
+// Marshal encodes b as indented JSON.
+func Marshal(b *Bundle) ([]byte, error) {
+	if err := b.validate(); err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(b, "", "  ")
+}
+
+// Unmarshal decodes the bundle in data. Bundles of any version are accepted,
+// but fields this package doesn't know are dropped.
+func Unmarshal(data []byte) (*Bundle, error) {
+	b := &Bundle{}
+	if err := json.Unmarshal(data, b); err != nil {
+		return nil, err
+	}
+	if err := b.validate(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// validate checks that b has a media type and exactly one signature.
+func (b *Bundle) validate() error {
+	if !strings.HasPrefix(b.MediaType, mediaTypePrefix) {
+		return fmt.Errorf("unsupported media type %q", b.MediaType)
+	}
+	switch {
+	case b.MessageSignature != nil && b.DSSEEnvelope != nil:
+		return errors.New("bundle has both a message signature and an envelope")
+	case b.MessageSignature == nil && b.DSSEEnvelope == nil:
+		return errors.New("bundle has no signature")
+	}
+	return nil
+}
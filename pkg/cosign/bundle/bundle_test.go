@@ -0,0 +1,113 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bundle
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	for _, name := range []string{"message-signature.sigstore", "dsse.sigstore"} {
+		t.Run(name, func(t *testing.T) {
+			want, err := ioutil.ReadFile(filepath.Join("testdata", name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := Unmarshal(want)
+			if err != nil {
+				t.Fatalf("Unmarshal() = %v", err)
+			}
+			got, err := Marshal(b)
+			if err != nil {
+				t.Fatalf("Marshal() = %v", err)
+			}
+			if !bytes.Equal(got, bytes.TrimSpace(want)) {
+				t.Errorf("Marshal(Unmarshal()) =\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "message-signature.sigstore"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vm := b.VerificationMaterial
+	if vm.PublicKey != nil || vm.X509CertificateChain == nil || len(vm.X509CertificateChain.Certificates) != 2 {
+		t.Errorf("VerificationMaterial = %+v, want a chain of 2 certificates", vm)
+	}
+	if len(vm.TlogEntries) != 1 {
+		t.Fatalf("got %d tlog entries, want 1", len(vm.TlogEntries))
+	}
+	e := vm.TlogEntries[0]
+	if e.LogIndex != 25579 || e.IntegratedTime != 1679594430 || e.KindVersion == nil || e.KindVersion.Kind != "hashedrekord" {
+		t.Errorf("tlog entry = %+v", e)
+	}
+	if e.InclusionProof == nil || e.InclusionProof.TreeSize != 25580 || len(e.InclusionProof.Hashes) != 3 || len(e.InclusionProof.RootHash) != 32 {
+		t.Errorf("inclusion proof = %+v", e.InclusionProof)
+	}
+	if b.MessageSignature == nil || b.MessageSignature.MessageDigest.Algorithm != "SHA2_256" || len(b.MessageSignature.Signature) != 64 {
+		t.Errorf("MessageSignature = %+v", b.MessageSignature)
+	}
+
+	for _, test := range []struct {
+		name    string
+		data    string
+		wantErr string
+	}{{
+		name:    "not json",
+		data:    "hello",
+		wantErr: "invalid character",
+	}, {
+		name:    "media type",
+		data:    `{"mediaType": "application/json", "messageSignature": {}}`,
+		wantErr: "unsupported media type",
+	}, {
+		name:    "no signature",
+		data:    `{"mediaType": "` + MediaType + `"}`,
+		wantErr: "no signature",
+	}, {
+		name:    "two signatures",
+		data:    `{"mediaType": "` + MediaType + `", "messageSignature": {}, "dsseEnvelope": {}}`,
+		wantErr: "both",
+	}, {
+		name: "newer version",
+		data: `{"mediaType": "application/vnd.dev.sigstore.bundle.v0.3+json", "messageSignature": {}}`,
+	}} {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Unmarshal([]byte(test.data))
+			if test.wantErr == "" {
+				if err != nil {
+					t.Errorf("Unmarshal() = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("Unmarshal() = %v, want error containing %q", err, test.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cosign
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestVerifyBundle(t *testing.T) {
+	td := t.TempDir()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPath := writePublicKey(t, td, "cosign.pub", pub)
+	otherKeyPath := writePublicKey(t, td, "other.pub", otherPub)
+
+	blob := []byte("hello world")
+	b, err := NewBundle(pub, blob, ed25519.Sign(priv, blob))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundlePath := filepath.Join(td, "blob.sigstore")
+	if err := WriteBundle(bundlePath, b); err != nil {
+		t.Fatal(err)
+	}
+
+	// The fields from the spec are all there.
+	raw, err := ioutil.ReadFile(bundlePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{"mediaType", "verificationMaterial", "messageSignature"} {
+		if _, ok := fields[f]; !ok {
+			t.Errorf("bundle is missing %q", f)
+		}
+	}
+
+	if err := VerifyBundle(bundlePath, keyPath, blob, nil); err != nil {
+		t.Errorf("VerifyBundle() = %v", err)
+	}
+	if err := VerifyBundle(bundlePath, otherKeyPath, blob, nil); err == nil {
+		t.Error("VerifyBundle() with the wrong key, wanted error")
+	}
+	if err := VerifyBundle(bundlePath, keyPath, []byte("goodbye world"), nil); err == nil {
+		t.Error("VerifyBundle() with the wrong blob, wanted error")
+	}
+
+	// A bundle that claims the right digest, but not its signature.
+	b.MessageSignature.Signature = ed25519.Sign(priv, []byte("goodbye world"))
+	if err := WriteBundle(bundlePath, b); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyBundle(bundlePath, keyPath, blob, nil); err == nil {
+		t.Error("VerifyBundle() with a bad signature, wanted error")
+	}
+}
+
+func writePublicKey(t *testing.T, dir, name string, pub ed25519.PublicKey) string {
+	t.Helper()
+	b, err := MarshalPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(p, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestVerifyDSSEBundle(t *testing.T) {
+	td := t.TempDir()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPath := writePublicKey(t, td, "cosign.pub", pub)
+
+	blob := []byte(`{"_type": "https://in-toto.io/Statement/v0.1"}`)
+	env, err := SignDSSE(priv, string(InTotoMediaType), blob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewDSSEBundle(pub, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundlePath := filepath.Join(td, "blob.sigstore")
+	if err := WriteBundle(bundlePath, b); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := VerifyBundle(bundlePath, keyPath, blob, nil); err != nil {
+		t.Errorf("VerifyBundle() = %v", err)
+	}
+	if err := VerifyBundle(bundlePath, keyPath, []byte("{}"), nil); err == nil {
+		t.Error("VerifyBundle() with the wrong blob, wanted error")
+	}
+}
@@ -0,0 +1,139 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cosign
+
+import (
+	"container/list"
+	"crypto/ed25519"
+	"sync"
+	"time"
+)
+
+// KeyLoader loads the public key that keyRef refers to. LoadPublicKey is the
+// default; a KeyLoader can fetch keys from a KMS or a registry instead.
+type KeyLoader func(keyRef string) (ed25519.PublicKey, error)
+
+// VerifyKeyLoader loads the keys that are given by reference, such as the
+// RequiredKeys of an ImageSignaturePolicy, with l rather than LoadPublicKey.
+func VerifyKeyLoader(l KeyLoader) VerifyOption {
+	return func(o *verifyOpts) {
+		o.keyLoader = l
+	}
+}
+
+// WithKeyCache keeps the keys loaded by reference in memory, so that calls
+// verifying in a loop, like an admission webhook, don't load them again each
+// time. Up to size keys are kept, the least recently used going first, each
+// for up to ttl, or until evicted if ttl isn't positive. Failures aren't
+// cached. The cache is created here and is safe for concurrent use: create
+// the option once and pass it to every call that should share it. A size
+// below 1 caches nothing.
+func WithKeyCache(size int, ttl time.Duration) VerifyOption {
+	var c *keyCache
+	if size > 0 {
+		c = newKeyCache(size, ttl)
+	}
+	return func(o *verifyOpts) {
+		o.keyCache = c
+	}
+}
+
+// loadKey loads the key keyRef refers to with the configured KeyLoader,
+// through the key cache if there is one.
+func (o *verifyOpts) loadKey(keyRef string) (ed25519.PublicKey, error) {
+	load := o.keyLoader
+	if load == nil {
+		load = LoadPublicKey
+	}
+	if o.keyCache == nil {
+		return load(keyRef)
+	}
+	if key, ok := o.keyCache.get(keyRef); ok {
+		return key, nil
+	}
+	key, err := load(keyRef)
+	if err != nil {
+		return nil, err
+	}
+	o.keyCache.add(keyRef, key)
+	return key, nil
+}
+
+// keyCache is an LRU cache of public keys by reference, whose entries
+// expire after ttl.
+type keyCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	now     func() time.Time
+	entries map[string]*list.Element
+	// lru holds *keyCacheEntry, most recently used first.
+	lru *list.List
+}
+
+type keyCacheEntry struct {
+	keyRef  string
+	key     ed25519.PublicKey
+	expires time.Time
+}
+
+func newKeyCache(size int, ttl time.Duration) *keyCache {
+	return &keyCache{
+		size:    size,
+		ttl:     ttl,
+		now:     time.Now,
+		entries: map[string]*list.Element{},
+		lru:     list.New(),
+	}
+}
+
+// get returns the cached key for keyRef, if it hasn't expired.
+func (c *keyCache) get(keyRef string) (ed25519.PublicKey, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[keyRef]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*keyCacheEntry)
+	if c.ttl > 0 && !c.now().Before(e.expires) {
+		c.lru.Remove(el)
+		delete(c.entries, keyRef)
+		return nil, false
+	}
+	c.lru.MoveToFront(el)
+	return e.key, true
+}
+
+// add caches key for keyRef, evicting the least recently used key if the
+// cache is full.
+func (c *keyCache) add(keyRef string, key ed25519.PublicKey) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := &keyCacheEntry{keyRef: keyRef, key: key, expires: c.now().Add(c.ttl)}
+	if el, ok := c.entries[keyRef]; ok {
+		el.Value = e
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.entries[keyRef] = c.lru.PushFront(e)
+	if c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*keyCacheEntry).keyRef)
+	}
+}
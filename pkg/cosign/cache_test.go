@@ -0,0 +1,153 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cosign
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/sigstore/cosign/pkg/cosign/oci"
+)
+
+// fakeKMS serves public keys by reference, counting how often each is
+// loaded.
+type fakeKMS struct {
+	mu    sync.Mutex
+	keys  map[string]ed25519.PublicKey
+	loads map[string]int
+}
+
+func (k *fakeKMS) load(keyRef string) (ed25519.PublicKey, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.loads[keyRef]++
+	key, ok := k.keys[keyRef]
+	if !ok {
+		return nil, errors.New("key not found")
+	}
+	return key, nil
+}
+
+func (k *fakeKMS) count(keyRef string) int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.loads[keyRef]
+}
+
+func TestWithKeyCache(t *testing.T) {
+	ro, ref, h := writeRandomImage(t, "cache")
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := oci.Payload(v1.Descriptor{Digest: h}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := oci.Upload(ed25519.Sign(priv, payload), payload, ref.Context().Tag(oci.Munge(v1.Descriptor{Digest: h})), oci.UploadRegistryOptions(ro)); err != nil {
+		t.Fatal(err)
+	}
+
+	const keyRef = "kms://projects/p/keys/release"
+	kms := &fakeKMS{keys: map[string]ed25519.PublicKey{keyRef: pub}, loads: map[string]int{}}
+	policy := ImageSignaturePolicy{RequiredKeys: []string{keyRef}}
+
+	// Without a cache, every call loads the key.
+	for i := 0; i < 2; i++ {
+		if err := VerifyImagePolicy(ref, policy, VerifyRegistryOptions(ro), VerifyKeyLoader(kms.load)); err != nil {
+			t.Fatalf("VerifyImagePolicy() = %v", err)
+		}
+	}
+	if got := kms.count(keyRef); got != 2 {
+		t.Errorf("KMS loaded the key %d times without a cache, wanted 2", got)
+	}
+
+	// With one, only the first call does, even from several goroutines.
+	kms.loads = map[string]int{}
+	cache := WithKeyCache(10, time.Hour)
+	if err := VerifyImagePolicy(ref, policy, VerifyRegistryOptions(ro), VerifyKeyLoader(kms.load), cache); err != nil {
+		t.Fatalf("VerifyImagePolicy() = %v", err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := VerifyImagePolicy(ref, policy, VerifyRegistryOptions(ro), VerifyKeyLoader(kms.load), cache); err != nil {
+				t.Errorf("VerifyImagePolicy() = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := kms.count(keyRef); got != 1 {
+		t.Errorf("KMS loaded the key %d times with a cache, wanted 1", got)
+	}
+
+	// Failures aren't cached.
+	missing := ImageSignaturePolicy{RequiredKeys: []string{"kms://missing"}}
+	for i := 0; i < 2; i++ {
+		if err := VerifyImagePolicy(ref, missing, VerifyRegistryOptions(ro), VerifyKeyLoader(kms.load), cache); err == nil {
+			t.Error("VerifyImagePolicy() with a missing key, wanted error")
+		}
+	}
+	if got := kms.count("kms://missing"); got != 2 {
+		t.Errorf("KMS was asked for a missing key %d times, wanted 2", got)
+	}
+}
+
+func TestKeyCache(t *testing.T) {
+	now := time.Unix(0, 0)
+	c := newKeyCache(2, time.Minute)
+	c.now = func() time.Time { return now }
+	key := func(b byte) ed25519.PublicKey {
+		return ed25519.PublicKey{b}
+	}
+	has := func(keyRef string, want bool) {
+		t.Helper()
+		if _, ok := c.get(keyRef); ok != want {
+			t.Errorf("get(%q) = %t, wanted %t", keyRef, ok, want)
+		}
+	}
+
+	c.add("a", key(1))
+	c.add("b", key(2))
+	has("a", true)
+	// b is now the least recently used, and goes first.
+	c.add("c", key(3))
+	has("b", false)
+	has("a", true)
+	has("c", true)
+
+	// Entries expire after the TTL.
+	now = now.Add(30 * time.Second)
+	c.add("a", key(4))
+	now = now.Add(45 * time.Second)
+	has("c", false)
+	if got, ok := c.get("a"); !ok || !got.Equal(key(4)) {
+		t.Errorf("get(a) = %v, %t, wanted the re-added key", got, ok)
+	}
+	now = now.Add(time.Minute)
+	has("a", false)
+	if c.lru.Len() != 0 || len(c.entries) != 0 {
+		t.Errorf("cache has %d entries left, wanted none", c.lru.Len())
+	}
+}
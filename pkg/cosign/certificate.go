@@ -0,0 +1,427 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cosign
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/sigstore/cosign/pkg/cosign/oci"
+)
+
+// LoadCertificates reads the PEM encoded certificates at path, in order.
+func LoadCertificates(path string) ([]*x509.Certificate, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	certs, err := ParseCertificates(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return certs, nil
+}
+
+// LoadCertChain reads the PEM encoded certificates at path, returning the self
+// signed ones as roots and the rest as intermediates. There has to be at least
+// one root: a file of intermediates doesn't say which roots to trust.
+func LoadCertChain(path string) (*x509.CertPool, []*x509.Certificate, error) {
+	certs, err := LoadCertificates(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	var roots *x509.CertPool
+	intermediates := []*x509.Certificate{}
+	for _, c := range certs {
+		if !bytes.Equal(c.RawIssuer, c.RawSubject) || c.CheckSignatureFrom(c) != nil {
+			intermediates = append(intermediates, c)
+			continue
+		}
+		if roots == nil {
+			roots = x509.NewCertPool()
+		}
+		roots.AddCert(c)
+	}
+	if roots == nil {
+		return nil, nil, fmt.Errorf("%s: no self-signed root certificate", path)
+	}
+	return roots, intermediates, nil
+}
+
+// ParseCertificates parses the PEM encoded certificates in b, in order. Other
+// PEM blocks are skipped, but there must be at least one certificate.
+func ParseCertificates(b []byte) ([]*x509.Certificate, error) {
+	certs := []*x509.Certificate{}
+	for {
+		var p *pem.Block
+		p, b = pem.Decode(b)
+		if p == nil {
+			break
+		}
+		if p.Type != certPemType {
+			continue
+		}
+		c, err := x509.ParseCertificate(p.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, c)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("no certificates found")
+	}
+	return certs, nil
+}
+
+// MarshalCertificates PEM encodes certs, in order, the way ParseCertificates
+// reads them.
+func MarshalCertificates(certs []*x509.Certificate) []byte {
+	var b []byte
+	for _, c := range certs {
+		b = append(b, pem.EncodeToMemory(&pem.Block{Type: certPemType, Bytes: c.Raw})...)
+	}
+	return b
+}
+
+// CheckCertificate checks that cert is a certificate for pub, an ed25519 or
+// ECDSA key, so signatures by its private half can be shipped with it.
+func CheckCertificate(cert *x509.Certificate, pub crypto.PublicKey) error {
+	certPub, err := signingKey(cert)
+	if err != nil {
+		return err
+	}
+	if !certPub.(interface{ Equal(crypto.PublicKey) bool }).Equal(pub) {
+		return errors.New("certificate is for a different key")
+	}
+	return nil
+}
+
+// signingKey returns the key cert is for, if it's one cosign signs with.
+func signingKey(cert *x509.Certificate) (crypto.PublicKey, error) {
+	switch k := cert.PublicKey.(type) {
+	case ed25519.PublicKey, *ecdsa.PublicKey:
+		return k, nil
+	default:
+		return nil, fmt.Errorf("certificate is for a %T, not an ed25519 or ECDSA key", cert.PublicKey)
+	}
+}
+
+// VerifyCertificate checks that cert chains up to roots, through
+// intermediates, and returns the ed25519 key it is for. The chain is checked
+// as of now, so a certificate that has expired no longer verifies. If roots is
+// nil, the system roots are used, and as any public CA chains up to those,
+// cert also has to be for code signing.
+func VerifyCertificate(cert *x509.Certificate, intermediates []*x509.Certificate, roots *x509.CertPool) (ed25519.PublicKey, error) {
+	_, pub, err := verifyCertificateChain(cert, intermediates, roots)
+	if err != nil {
+		return nil, err
+	}
+	ed, ok := pub.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("certificate is for a %T, not an ed25519 key", pub)
+	}
+	return ed, nil
+}
+
+// verifyCertificateChain is VerifyCertificate, also returning the chain from
+// cert up to a root, for ECDSA keys too.
+func verifyCertificateChain(cert *x509.Certificate, intermediates []*x509.Certificate, roots *x509.CertPool) ([]*x509.Certificate, crypto.PublicKey, error) {
+	pool := x509.NewCertPool()
+	for _, c := range intermediates {
+		pool.AddCert(c)
+	}
+	usage := x509.ExtKeyUsageAny
+	if roots == nil {
+		usage = x509.ExtKeyUsageCodeSigning
+	}
+	chains, err := cert.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: pool,
+		KeyUsages:     []x509.ExtKeyUsage{usage},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	pub, err := signingKey(cert)
+	if err != nil {
+		return nil, nil, err
+	}
+	return chains[0], pub, nil
+}
+
+// checkCertificateEmail checks that one of the SAN email addresses of cert
+// matches pattern.
+func checkCertificateEmail(cert *x509.Certificate, pattern string) error {
+	if len(cert.EmailAddresses) == 0 {
+		return fmt.Errorf("certificate has no SAN email address, wanted %s", pattern)
+	}
+	for _, email := range cert.EmailAddresses {
+		if ok, _ := filepath.Match(pattern, email); ok {
+			return nil
+		}
+	}
+	return fmt.Errorf("certificate SAN email %s doesn't match %s", strings.Join(cert.EmailAddresses, ", "), pattern)
+}
+
+// checkCertificateIdentity checks that one of the SAN email addresses or URIs
+// of cert matches pattern.
+func checkCertificateIdentity(cert *x509.Certificate, pattern string) error {
+	sans := append([]string{}, cert.EmailAddresses...)
+	for _, u := range cert.URIs {
+		sans = append(sans, u.String())
+	}
+	if len(sans) == 0 {
+		return fmt.Errorf("certificate has no SAN email address or URI, wanted %s", pattern)
+	}
+	for _, san := range sans {
+		if ok, _ := filepath.Match(pattern, san); ok {
+			return nil
+		}
+	}
+	return fmt.Errorf("certificate identity %s doesn't match %s", strings.Join(sans, ", "), pattern)
+}
+
+// The extensions Fulcio records the issuer of the OIDC token in: the original
+// one holds the raw issuer URL, its replacement a DER encoded UTF8String.
+var (
+	oidcIssuerOID   = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 1}
+	oidcIssuerV2OID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 8}
+)
+
+// CertificateOIDCIssuer returns the issuer of the OIDC token Fulcio issued
+// cert for, or "" if it doesn't say.
+func CertificateOIDCIssuer(cert *x509.Certificate) string {
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(oidcIssuerV2OID) {
+			var issuer string
+			if _, err := asn1.UnmarshalWithParams(ext.Value, &issuer, "utf8"); err == nil {
+				return issuer
+			}
+		}
+	}
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(oidcIssuerOID) {
+			return string(ext.Value)
+		}
+	}
+	return ""
+}
+
+// checkCertificateOIDCIssuer checks that cert was issued for an OIDC token
+// from issuer.
+func checkCertificateOIDCIssuer(cert *x509.Certificate, issuer string) error {
+	got := CertificateOIDCIssuer(cert)
+	if got == "" {
+		return fmt.Errorf("certificate has no OIDC issuer extension, wanted %s", issuer)
+	}
+	if got != issuer {
+		return fmt.Errorf("certificate OIDC issuer %s doesn't match %s", got, issuer)
+	}
+	return nil
+}
+
+// checkSPIFFEID checks that id is a SPIFFE ID: a spiffe:// URI with a trust
+// domain, and nothing but a path after it.
+func checkSPIFFEID(id string) error {
+	u, err := url.Parse(id)
+	if err != nil {
+		return err
+	}
+	switch {
+	case u.Scheme != "spiffe":
+		return errors.New("scheme must be spiffe")
+	case u.Host == "":
+		return errors.New("no trust domain")
+	case u.User != nil || u.Port() != "" || u.RawQuery != "" || u.Fragment != "":
+		return errors.New("only a trust domain and path are allowed")
+	}
+	return nil
+}
+
+// checkCertificateSPIFFEID checks that cert is an X.509 SVID for id. An SVID
+// has exactly one URI SAN, its SPIFFE ID.
+func checkCertificateSPIFFEID(cert *x509.Certificate, id string) error {
+	if len(cert.URIs) != 1 {
+		return fmt.Errorf("certificate has %d SAN URIs, an SVID has exactly one, wanted %s", len(cert.URIs), id)
+	}
+	if got := cert.URIs[0].String(); got != id {
+		return fmt.Errorf("certificate SPIFFE ID %s doesn't match %s", got, id)
+	}
+	return nil
+}
+
+// ExtractCertificate returns the certificate stored with sp, in its
+// oci.CertificateAnnotationKey annotation.
+func ExtractCertificate(sp oci.SignedPayload) (*x509.Certificate, error) {
+	if sp.Base64Certificate == "" {
+		return nil, errors.New("signature has no certificate")
+	}
+	b, err := base64.StdEncoding.DecodeString(sp.Base64Certificate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate: %v", err)
+	}
+	certs, err := ParseCertificates(b)
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate: %v", err)
+	}
+	return certs[0], nil
+}
+
+// signatureCertificates returns the certificate stored with sp, and its
+// chain.
+func signatureCertificates(sp oci.SignedPayload) (*x509.Certificate, []*x509.Certificate, error) {
+	cert, err := ExtractCertificate(sp)
+	if err != nil {
+		return nil, nil, err
+	}
+	if sp.Base64Chain == "" {
+		return cert, nil, nil
+	}
+	b, err := base64.StdEncoding.DecodeString(sp.Base64Chain)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid certificate chain: %v", err)
+	}
+	chain, err := ParseCertificates(b)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid certificate chain: %v", err)
+	}
+	return cert, chain, nil
+}
+
+// VerifyWithCertificates is Verify, but the key of each signature comes from
+// the certificate stored with it, which must chain up to roots, or to the
+// system roots for code signing if roots is nil, see VerifyCertificate. It
+// succeeds if at least one signature verifies, and the PublicKey of each
+// payload returned is the key from its certificate.
+func VerifyWithCertificates(ref name.Reference, roots *x509.CertPool, checkClaims bool, annotations map[string]string, opts ...VerifyOption) ([]oci.SignedPayload, error) {
+	o := newVerifyOpts(opts)
+	if o.recursive || o.containerConfig {
+		return nil, errors.New("can't verify recursively or container configs with certificates")
+	}
+	if err := checkCertificateOpts(o); err != nil {
+		return nil, err
+	}
+
+	signatures, desc, err := oci.FetchSignatures(ref, o.registry)
+	if err != nil {
+		return nil, err
+	}
+	return verifyCertificateSignatures(roots, desc.Digest.Hex, checkClaims, annotations, signatures, o)
+}
+
+// checkCertificateOpts checks the certificate requirements in o are valid,
+// before any signatures are checked against them.
+func checkCertificateOpts(o *verifyOpts) error {
+	if o.certEmail != "" {
+		if _, err := filepath.Match(o.certEmail, ""); err != nil {
+			return fmt.Errorf("invalid email pattern %q: %v", o.certEmail, err)
+		}
+	}
+	if o.spiffeID != "" {
+		if err := checkSPIFFEID(o.spiffeID); err != nil {
+			return fmt.Errorf("invalid SPIFFE ID %q: %v", o.spiffeID, err)
+		}
+	}
+	if o.certIdentity != "" {
+		if _, err := filepath.Match(o.certIdentity, ""); err != nil {
+			return fmt.Errorf("invalid identity pattern %q: %v", o.certIdentity, err)
+		}
+	}
+	return nil
+}
+
+// verifyCertificateSignatures returns the signatures of the image with digest
+// that verify with the key in the certificate stored with them, which must
+// chain up to roots.
+func verifyCertificateSignatures(roots *x509.CertPool, digest string, checkClaims bool, annotations map[string]string, signatures []oci.SignedPayload, o *verifyOpts) ([]oci.SignedPayload, error) {
+	verified := []oci.SignedPayload{}
+	errs := VerifyErrors{}
+	for i, sp := range signatures {
+		if sp.MediaType == ContainerConfigMediaType {
+			continue
+		}
+		cert, chain, err := signatureCertificates(sp)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("signature %d: %v", i, err))
+			continue
+		}
+		if o.certEmail != "" {
+			if err := checkCertificateEmail(cert, o.certEmail); err != nil {
+				errs = append(errs, fmt.Errorf("signature %d: %v", i, err))
+				continue
+			}
+		}
+		if o.spiffeID != "" {
+			if err := checkCertificateSPIFFEID(cert, o.spiffeID); err != nil {
+				errs = append(errs, fmt.Errorf("signature %d: %v", i, err))
+				continue
+			}
+		}
+		if o.certIdentity != "" {
+			if err := checkCertificateIdentity(cert, o.certIdentity); err != nil {
+				errs = append(errs, fmt.Errorf("signature %d: %v", i, err))
+				continue
+			}
+		}
+		if o.certOIDCIssuer != "" {
+			if err := checkCertificateOIDCIssuer(cert, o.certOIDCIssuer); err != nil {
+				errs = append(errs, fmt.Errorf("signature %d: %v", i, err))
+				continue
+			}
+		}
+		verifiedChain, pub, err := verifyCertificateChain(cert, append(chain, o.intermediates...), roots)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("signature %d: %v", i, err))
+			continue
+		}
+		if o.ctLogURL != "" {
+			if len(verifiedChain) < 2 {
+				errs = append(errs, fmt.Errorf("signature %d: a root certificate has no precertificate in a CT log", i))
+				continue
+			}
+			if err := verifyCertificateCTInclusion(cert, verifiedChain[1], o.ctLogURL); err != nil {
+				errs = append(errs, fmt.Errorf("signature %d: %v", i, err))
+				continue
+			}
+		}
+		v, err := verifySignatures(pub, digest, checkClaims, annotations, []oci.SignedPayload{sp}, o)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("signature %d: %v", i, err))
+		}
+		verified = append(verified, v...)
+	}
+	if len(verified) == 0 {
+		if len(errs) == 0 {
+			return nil, errors.New("no signatures found")
+		}
+		return nil, errs
+	}
+	return verified, nil
+}
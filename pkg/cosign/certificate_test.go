@@ -0,0 +1,545 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cosign
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/sigstore/cosign/pkg/cosign/oci"
+)
+
+// testCA is a root and an intermediate, which issues leaf certificates.
+type testCA struct {
+	root            *x509.Certificate
+	roots           *x509.CertPool
+	intermediate    *x509.Certificate
+	intermediateKey crypto.Signer
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	rootKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := createCert(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test root"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil, &rootKey.PublicKey, rootKey)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	intermediate := createCert(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: "test intermediate"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, root, &key.PublicKey, rootKey)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+	return &testCA{root: root, roots: roots, intermediate: intermediate, intermediateKey: key}
+}
+
+// issue returns a certificate for pub, and its chain, both PEM encoded.
+func (ca *testCA) issue(t *testing.T, pub ed25519.PublicKey, emails ...string) ([]byte, []byte) {
+	t.Helper()
+	return ca.issueTemplate(t, pub, &x509.Certificate{EmailAddresses: emails})
+}
+
+// issueTemplate is issue, with the subject alternative names of tmpl.
+func (ca *testCA) issueTemplate(t *testing.T, pub ed25519.PublicKey, tmpl *x509.Certificate) ([]byte, []byte) {
+	t.Helper()
+	tmpl.SerialNumber = big.NewInt(3)
+	tmpl.Subject = pkix.Name{CommonName: "signer"}
+	tmpl.KeyUsage = x509.KeyUsageDigitalSignature
+	tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning}
+	cert := createCert(t, tmpl, ca.intermediate, pub, ca.intermediateKey)
+	return pem.EncodeToMemory(&pem.Block{Type: certPemType, Bytes: cert.Raw}),
+		pem.EncodeToMemory(&pem.Block{Type: certPemType, Bytes: ca.intermediate.Raw})
+}
+
+// createCert creates tmpl, signed by parent, or self signed if it's nil.
+func createCert(t *testing.T, tmpl, parent *x509.Certificate, pub crypto.PublicKey, priv crypto.Signer) *x509.Certificate {
+	t.Helper()
+	tmpl.NotBefore = time.Now().Add(-time.Hour)
+	tmpl.NotAfter = time.Now().Add(time.Hour)
+	if parent == nil {
+		parent = tmpl
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, pub, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestCheckCertificate(t *testing.T) {
+	ca := newTestCA(t)
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM, chainPEM := ca.issue(t, pub)
+	certs, err := ParseCertificates(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain, err := ParseCertificates(chainPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CheckCertificate(certs[0], pub); err != nil {
+		t.Errorf("CheckCertificate() = %v", err)
+	}
+	other, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckCertificate(certs[0], other); err == nil {
+		t.Error("CheckCertificate() with another key, wanted error")
+	}
+
+	got, err := VerifyCertificate(certs[0], chain, ca.roots)
+	if err != nil {
+		t.Fatalf("VerifyCertificate() = %v", err)
+	}
+	if !got.Equal(pub) {
+		t.Error("VerifyCertificate() returned the wrong key")
+	}
+	if _, err := VerifyCertificate(certs[0], nil, ca.roots); err == nil {
+		t.Error("VerifyCertificate() without the intermediate, wanted error")
+	}
+	if _, err := VerifyCertificate(certs[0], chain, newTestCA(t).roots); err == nil {
+		t.Error("VerifyCertificate() with other roots, wanted error")
+	}
+}
+
+func TestExtractCertificate(t *testing.T) {
+	ca := newTestCA(t)
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := ca.issue(t, pub)
+	b64 := func(b []byte) string {
+		return base64.StdEncoding.EncodeToString(b)
+	}
+
+	tests := []struct {
+		name    string
+		cert    string
+		wantErr string
+	}{{
+		name: "valid",
+		cert: b64(cert),
+	}, {
+		name:    "missing",
+		wantErr: "no certificate",
+	}, {
+		name:    "malformed base64",
+		cert:    "not base64!",
+		wantErr: "invalid certificate",
+	}, {
+		name:    "not PEM",
+		cert:    b64([]byte("hello")),
+		wantErr: "no certificates found",
+	}, {
+		name:    "malformed DER",
+		cert:    b64(pem.EncodeToMemory(&pem.Block{Type: certPemType, Bytes: []byte("hello")})),
+		wantErr: "invalid certificate",
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ExtractCertificate(oci.SignedPayload{Base64Certificate: tt.cert})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("ExtractCertificate() = %v, wanted error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ExtractCertificate() = %v", err)
+			}
+			if !got.PublicKey.(ed25519.PublicKey).Equal(pub) {
+				t.Error("ExtractCertificate() returned a certificate for another key")
+			}
+		})
+	}
+}
+
+func TestVerifyWithCertificates(t *testing.T) {
+	ca := newTestCA(t)
+	ro, ref, h := writeRandomImage(t, "certificate")
+	sigTag := ref.Context().Tag(oci.Munge(v1.Descriptor{Digest: h}))
+	payload, err := oci.Payload(v1.Descriptor{Digest: h}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Without a certificate.
+	if err := oci.Upload(ed25519.Sign(priv, payload), payload, sigTag, oci.UploadRegistryOptions(ro)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyWithCertificates(ref, ca.roots, true, nil, VerifyRegistryOptions(ro)); err == nil {
+		t.Error("VerifyWithCertificates() without a certificate, wanted error")
+	}
+
+	cert, chain := ca.issue(t, pub)
+	if err := oci.Upload(ed25519.Sign(priv, payload), payload, sigTag, oci.UploadCertificate(cert, chain), oci.UploadRegistryOptions(ro)); err != nil {
+		t.Fatal(err)
+	}
+	verified, err := VerifyWithCertificates(ref, ca.roots, true, nil, VerifyRegistryOptions(ro))
+	if err != nil {
+		t.Fatalf("VerifyWithCertificates() = %v", err)
+	}
+	if len(verified) != 1 || !pub.Equal(verified[0].PublicKey) {
+		t.Errorf("VerifyWithCertificates() = %v, wanted the signature with a certificate", verified)
+	}
+	if _, err := VerifyWithCertificates(ref, newTestCA(t).roots, true, nil, VerifyRegistryOptions(ro)); err == nil {
+		t.Error("VerifyWithCertificates() with other roots, wanted error")
+	}
+
+	// A certificate for a different key than the one that signed.
+	other, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherRef := ref.Context().Tag("other")
+	otherImg, err := random.Image(512, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ro.Remote().Write(otherRef, otherImg); err != nil {
+		t.Fatal(err)
+	}
+	otherH, err := otherImg.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPayload, err := oci.Payload(v1.Descriptor{Digest: otherH}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherCert, otherChain := ca.issue(t, other)
+	otherSigTag := ref.Context().Tag(oci.Munge(v1.Descriptor{Digest: otherH}))
+	if err := oci.Upload(ed25519.Sign(priv, otherPayload), otherPayload, otherSigTag, oci.UploadCertificate(otherCert, otherChain), oci.UploadRegistryOptions(ro)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyWithCertificates(otherRef, ca.roots, true, nil, VerifyRegistryOptions(ro)); err == nil {
+		t.Error("VerifyWithCertificates() with a certificate for another key, wanted error")
+	}
+}
+
+func TestVerifyCertIntermediates(t *testing.T) {
+	ca := newTestCA(t)
+	ro, ref, h := writeRandomImage(t, "intermediates")
+	sigTag := ref.Context().Tag(oci.Munge(v1.Descriptor{Digest: h}))
+	payload, err := oci.Payload(v1.Descriptor{Digest: h}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only the leaf certificate is stored with the signature.
+	cert, _ := ca.issue(t, pub)
+	if err := oci.Upload(ed25519.Sign(priv, payload), payload, sigTag, oci.UploadCertificate(cert, nil), oci.UploadRegistryOptions(ro)); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "chain.pem")
+	chain := append(pem.EncodeToMemory(&pem.Block{Type: certPemType, Bytes: ca.intermediate.Raw}),
+		pem.EncodeToMemory(&pem.Block{Type: certPemType, Bytes: ca.root.Raw})...)
+	if err := ioutil.WriteFile(path, chain, 0600); err != nil {
+		t.Fatal(err)
+	}
+	roots, intermediates, err := LoadCertChain(path)
+	if err != nil {
+		t.Fatalf("LoadCertChain() = %v", err)
+	}
+	if roots == nil || len(intermediates) != 1 || !intermediates[0].Equal(ca.intermediate) {
+		t.Fatalf("LoadCertChain() = %v, %v, wanted the root and the intermediate", roots, intermediates)
+	}
+
+	if _, err := VerifyWithCertificates(ref, roots, true, nil, VerifyRegistryOptions(ro)); err == nil {
+		t.Error("VerifyWithCertificates() without the intermediate, wanted error")
+	}
+	if _, err := VerifyWithCertificates(ref, roots, true, nil, VerifyCertIntermediates(intermediates), VerifyRegistryOptions(ro)); err != nil {
+		t.Errorf("VerifyWithCertificates() with the intermediate = %v", err)
+	}
+
+	// Intermediates alone don't say which roots to trust.
+	if err := ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: certPemType, Bytes: ca.intermediate.Raw}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := LoadCertChain(path); err == nil {
+		t.Error("LoadCertChain() without a root, wanted error")
+	}
+}
+
+func TestVerifyCertEmail(t *testing.T) {
+	ca := newTestCA(t)
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign := func(emails ...string) (oci.RegistryOptions, name.Reference) {
+		ro, ref, h := writeRandomImage(t, "email")
+		payload, err := oci.Payload(v1.Descriptor{Digest: h}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, chain := ca.issue(t, pub, emails...)
+		sigTag := ref.Context().Tag(oci.Munge(v1.Descriptor{Digest: h}))
+		if err := oci.Upload(ed25519.Sign(priv, payload), payload, sigTag, oci.UploadCertificate(cert, chain), oci.UploadRegistryOptions(ro)); err != nil {
+			t.Fatal(err)
+		}
+		return ro, ref
+	}
+	ro, ref := sign("bob@example.org", "alice@example.com")
+	noEmailRO, noEmailRef := sign()
+
+	for _, test := range []struct {
+		pattern string
+		ro      oci.RegistryOptions
+		ref     name.Reference
+		wantErr string
+	}{
+		{pattern: "alice@example.com", ro: ro, ref: ref},
+		{pattern: "*@example.com", ro: ro, ref: ref},
+		{pattern: "*@example.net", ro: ro, ref: ref, wantErr: "certificate SAN email bob@example.org, alice@example.com doesn't match *@example.net"},
+		{pattern: "*@example.com", ro: noEmailRO, ref: noEmailRef, wantErr: "certificate has no SAN email address"},
+		{pattern: "[", ro: ro, ref: ref, wantErr: "invalid email pattern"},
+	} {
+		_, err := VerifyWithCertificates(test.ref, ca.roots, true, nil, VerifyRegistryOptions(test.ro), VerifyCertEmail(test.pattern))
+		if test.wantErr == "" && err != nil {
+			t.Errorf("VerifyCertEmail(%q) = %v", test.pattern, err)
+		} else if test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)) {
+			t.Errorf("VerifyCertEmail(%q) = %v, wanted %q", test.pattern, err, test.wantErr)
+		}
+	}
+}
+
+func TestVerifySPIFFEID(t *testing.T) {
+	ca := newTestCA(t)
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign := func(uris ...string) (oci.RegistryOptions, name.Reference) {
+		ro, ref, h := writeRandomImage(t, "spiffe")
+		payload, err := oci.Payload(v1.Descriptor{Digest: h}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tmpl := &x509.Certificate{}
+		for _, u := range uris {
+			parsed, err := url.Parse(u)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tmpl.URIs = append(tmpl.URIs, parsed)
+		}
+		cert, chain := ca.issueTemplate(t, pub, tmpl)
+		sigTag := ref.Context().Tag(oci.Munge(v1.Descriptor{Digest: h}))
+		if err := oci.Upload(ed25519.Sign(priv, payload), payload, sigTag, oci.UploadCertificate(cert, chain), oci.UploadRegistryOptions(ro)); err != nil {
+			t.Fatal(err)
+		}
+		return ro, ref
+	}
+	const id = "spiffe://example.org/ns/default/sa/cosign-builder"
+	ro, ref := sign(id)
+	twoRO, twoRef := sign(id, "spiffe://example.org/other")
+	noneRO, noneRef := sign()
+
+	for _, test := range []struct {
+		id      string
+		ro      oci.RegistryOptions
+		ref     name.Reference
+		wantErr string
+	}{
+		{id: id, ro: ro, ref: ref},
+		{id: "spiffe://example.org/ns/default/sa/other", ro: ro, ref: ref, wantErr: "certificate SPIFFE ID " + id + " doesn't match"},
+		{id: id, ro: twoRO, ref: twoRef, wantErr: "certificate has 2 SAN URIs"},
+		{id: id, ro: noneRO, ref: noneRef, wantErr: "certificate has 0 SAN URIs"},
+		{id: "https://example.org/ns/default", ro: ro, ref: ref, wantErr: "scheme must be spiffe"},
+		{id: "spiffe:///ns/default", ro: ro, ref: ref, wantErr: "no trust domain"},
+		{id: "spiffe://example.org/ns?x=1", ro: ro, ref: ref, wantErr: "only a trust domain and path"},
+	} {
+		_, err := VerifyWithCertificates(test.ref, ca.roots, true, nil, VerifyRegistryOptions(test.ro), VerifySPIFFEID(test.id))
+		if test.wantErr == "" && err != nil {
+			t.Errorf("VerifySPIFFEID(%q) = %v", test.id, err)
+		} else if test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)) {
+			t.Errorf("VerifySPIFFEID(%q) = %v, wanted %q", test.id, err, test.wantErr)
+		}
+	}
+}
+
+func TestVerifyCertIdentity(t *testing.T) {
+	ca := newTestCA(t)
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign := func(tmpl *x509.Certificate) (oci.RegistryOptions, name.Reference) {
+		ro, ref, h := writeRandomImage(t, "identity")
+		payload, err := oci.Payload(v1.Descriptor{Digest: h}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, chain := ca.issueTemplate(t, pub, tmpl)
+		sigTag := ref.Context().Tag(oci.Munge(v1.Descriptor{Digest: h}))
+		if err := oci.Upload(ed25519.Sign(priv, payload), payload, sigTag, oci.UploadCertificate(cert, chain), oci.UploadRegistryOptions(ro)); err != nil {
+			t.Fatal(err)
+		}
+		return ro, ref
+	}
+	const (
+		workflow = "https://github.com/acme/app/.github/workflows/release.yaml@refs/heads/main"
+		issuer   = "https://token.actions.githubusercontent.com"
+	)
+	workflowURI, err := url.Parse(workflow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuerV2, err := asn1.MarshalWithParams(issuer, "utf8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ghRO, ghRef := sign(&x509.Certificate{
+		URIs:            []*url.URL{workflowURI},
+		ExtraExtensions: []pkix.Extension{{Id: oidcIssuerOID, Value: []byte(issuer)}},
+	})
+	v2RO, v2Ref := sign(&x509.Certificate{
+		URIs:            []*url.URL{workflowURI},
+		ExtraExtensions: []pkix.Extension{{Id: oidcIssuerV2OID, Value: issuerV2}},
+	})
+	emailRO, emailRef := sign(&x509.Certificate{EmailAddresses: []string{"alice@example.com"}})
+	noneRO, noneRef := sign(&x509.Certificate{})
+
+	for _, test := range []struct {
+		identity, issuer string
+		ro               oci.RegistryOptions
+		ref              name.Reference
+		wantErr          string
+	}{
+		{identity: workflow, issuer: issuer, ro: ghRO, ref: ghRef},
+		{identity: "https://github.com/acme/app/.github/workflows/*@refs/heads/main", ro: ghRO, ref: ghRef},
+		{issuer: issuer, ro: v2RO, ref: v2Ref},
+		{identity: "https://github.com/acme/app/.github/workflows/*@refs/tags/*", ro: ghRO, ref: ghRef, wantErr: "certificate identity " + workflow + " doesn't match"},
+		{issuer: "https://accounts.google.com", ro: ghRO, ref: ghRef, wantErr: "certificate OIDC issuer " + issuer + " doesn't match"},
+		{identity: "*@example.com", ro: emailRO, ref: emailRef},
+		{issuer: issuer, ro: emailRO, ref: emailRef, wantErr: "certificate has no OIDC issuer extension"},
+		{identity: "*@example.com", ro: noneRO, ref: noneRef, wantErr: "certificate has no SAN email address or URI"},
+		{identity: "[", ro: emailRO, ref: emailRef, wantErr: "invalid identity pattern"},
+	} {
+		opts := []VerifyOption{VerifyRegistryOptions(test.ro)}
+		if test.identity != "" {
+			opts = append(opts, VerifyCertIdentity(test.identity))
+		}
+		if test.issuer != "" {
+			opts = append(opts, VerifyCertOIDCIssuer(test.issuer))
+		}
+		_, err := VerifyWithCertificates(test.ref, ca.roots, true, nil, opts...)
+		if test.wantErr == "" && err != nil {
+			t.Errorf("VerifyCertIdentity(%q), VerifyCertOIDCIssuer(%q) = %v", test.identity, test.issuer, err)
+		} else if test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)) {
+			t.Errorf("VerifyCertIdentity(%q), VerifyCertOIDCIssuer(%q) = %v, wanted %q", test.identity, test.issuer, err, test.wantErr)
+		}
+	}
+}
+
+func TestVerifyBundleWithCertificates(t *testing.T) {
+	ca := newTestCA(t)
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM, chainPEM := ca.issue(t, pub)
+	certs, err := ParseCertificates(append(certPEM, chainPEM...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blob := []byte("hello world")
+	b, err := NewBundle(pub, blob, ed25519.Sign(priv, blob))
+	if err != nil {
+		t.Fatal(err)
+	}
+	td := t.TempDir()
+	bundlePath := filepath.Join(td, "blob.sigstore")
+	if err := WriteBundle(bundlePath, b); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyBundleWithCertificates(bundlePath, blob, ca.roots, nil); err == nil {
+		t.Error("VerifyBundleWithCertificates() without a certificate, wanted error")
+	}
+
+	b.VerificationMaterial.PublicKey = nil
+	b.VerificationMaterial.X509CertificateChain = &X509CertificateChain{}
+	for _, c := range certs {
+		b.VerificationMaterial.X509CertificateChain.Certificates = append(b.VerificationMaterial.X509CertificateChain.Certificates, X509Certificate{RawBytes: c.Raw})
+	}
+	if err := WriteBundle(bundlePath, b); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyBundleWithCertificates(bundlePath, blob, ca.roots, nil); err != nil {
+		t.Errorf("VerifyBundleWithCertificates() = %v", err)
+	}
+	if err := VerifyBundleWithCertificates(bundlePath, []byte("goodbye world"), ca.roots, nil); err == nil {
+		t.Error("VerifyBundleWithCertificates() with the wrong blob, wanted error")
+	}
+	if err := VerifyBundleWithCertificates(bundlePath, blob, newTestCA(t).roots, nil); err == nil {
+		t.Error("VerifyBundleWithCertificates() with other roots, wanted error")
+	}
+}
@@ -0,0 +1,32 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cosign
+
+import (
+	"context"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/sigstore/cosign/pkg/cosign/oci"
+)
+
+// CleanSignatures deletes every signature of the image ref points at, the
+// signature tag and any signatures stored as referrers, authenticating with
+// the default keychain. Registries that don't allow deleting manifests are
+// an error. See oci.CleanSignatures to pass other registry options.
+func CleanSignatures(ctx context.Context, ref name.Reference) error {
+	return oci.CleanSignatures(ctx, ref, oci.RegistryOptions{Context: ctx})
+}
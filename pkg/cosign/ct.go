@@ -0,0 +1,286 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cosign
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// CTLogURLEnv is the environment variable holding the URL of the certificate
+// transparency log that verify -check-ct-inclusion asks for proofs.
+const CTLogURLEnv = "COSIGN_CT_LOG_URL"
+
+// sctListOID is the certificate extension holding the SCTs that CT logs
+// issued for its precertificate, see RFC 6962 section 3.3.
+var sctListOID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}
+
+// sct is the part of a signed certificate timestamp that goes into the log
+// entry. Its signature isn't needed to find the entry.
+type sct struct {
+	timestamp  uint64
+	extensions []byte
+}
+
+// verifyCertificateCTInclusion checks that the precertificate of cert, issued
+// by issuer, is included in the CT log at ctLogURL, for any of the SCTs
+// embedded in cert. The inclusion proof is checked against the log's current
+// signed tree head, whose signature isn't checked: that needs the log's key.
+func verifyCertificateCTInclusion(cert, issuer *x509.Certificate, ctLogURL string) error {
+	scts, err := embeddedSCTs(cert)
+	if err != nil {
+		return err
+	}
+	tbs, err := precertTBS(cert.RawTBSCertificate)
+	if err != nil {
+		return fmt.Errorf("invalid certificate: %v", err)
+	}
+	sth, err := getSTH(ctLogURL)
+	if err != nil {
+		return err
+	}
+
+	errs := []string{}
+	for _, s := range scts {
+		leaf := precertLeafHash(s, sha256.Sum256(issuer.RawSubjectPublicKeyInfo), tbs)
+		if err := verifyCTProof(ctLogURL, leaf, sth); err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		return nil
+	}
+	return fmt.Errorf("certificate isn't included in the CT log:\n  %s", strings.Join(errs, "\n  "))
+}
+
+// embeddedSCTs parses the SCT list extension of cert.
+func embeddedSCTs(cert *x509.Certificate) ([]sct, error) {
+	var list []byte
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(sctListOID) {
+			continue
+		}
+		if rest, err := asn1.Unmarshal(ext.Value, &list); err != nil || len(rest) != 0 {
+			return nil, errors.New("invalid SCT list extension")
+		}
+	}
+	if list == nil {
+		return nil, errors.New("certificate has no SCTs")
+	}
+
+	// The list is TLS encoded: a 2 byte length, then each SCT with its own
+	// 2 byte length.
+	list, ok := readOpaque16(list)
+	if !ok {
+		return nil, errors.New("invalid SCT list")
+	}
+	scts := []sct{}
+	for len(list) > 0 {
+		var b []byte
+		if b, list, ok = cutOpaque16(list); !ok {
+			return nil, errors.New("invalid SCT list")
+		}
+		// version (1), log ID (32), timestamp (8), extensions, signature.
+		if len(b) < 1+32+8 || b[0] != 0 {
+			return nil, errors.New("invalid or unsupported SCT")
+		}
+		s := sct{timestamp: binary.BigEndian.Uint64(b[33:41])}
+		if s.extensions, _, ok = cutOpaque16(b[41:]); !ok {
+			return nil, errors.New("invalid SCT")
+		}
+		scts = append(scts, s)
+	}
+	if len(scts) == 0 {
+		return nil, errors.New("certificate has no SCTs")
+	}
+	return scts, nil
+}
+
+// cutOpaque16 splits a TLS opaque value with a 2 byte length off of b.
+func cutOpaque16(b []byte) ([]byte, []byte, bool) {
+	if len(b) < 2 {
+		return nil, nil, false
+	}
+	n := int(binary.BigEndian.Uint16(b))
+	if len(b) < 2+n {
+		return nil, nil, false
+	}
+	return b[2 : 2+n], b[2+n:], true
+}
+
+// readOpaque16 is cutOpaque16, for a value that has to be all of b.
+func readOpaque16(b []byte) ([]byte, bool) {
+	v, rest, ok := cutOpaque16(b)
+	return v, ok && len(rest) == 0
+}
+
+// precertTBS returns tbs, a DER TBSCertificate, without the SCT list
+// extension, which is what the log saw in the precertificate.
+func precertTBS(tbs []byte) ([]byte, error) {
+	var seq asn1.RawValue
+	if rest, err := asn1.Unmarshal(tbs, &seq); err != nil || len(rest) != 0 {
+		return nil, errors.New("invalid TBSCertificate")
+	}
+	out := []byte{}
+	for b := seq.Bytes; len(b) > 0; {
+		var field asn1.RawValue
+		var err error
+		if b, err = asn1.Unmarshal(b, &field); err != nil {
+			return nil, err
+		}
+		// The extensions are [3] EXPLICIT.
+		if field.Class != asn1.ClassContextSpecific || field.Tag != 3 {
+			out = append(out, field.FullBytes...)
+			continue
+		}
+		var exts []pkix.Extension
+		if _, err := asn1.Unmarshal(field.Bytes, &exts); err != nil {
+			return nil, err
+		}
+		kept := []pkix.Extension{}
+		for _, ext := range exts {
+			if !ext.Id.Equal(sctListOID) {
+				kept = append(kept, ext)
+			}
+		}
+		extsDER, err := asn1.Marshal(kept)
+		if err != nil {
+			return nil, err
+		}
+		explicit, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 3, IsCompound: true, Bytes: extsDER})
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, explicit...)
+	}
+	return asn1.Marshal(asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSequence, IsCompound: true, Bytes: out})
+}
+
+// precertLeafHash is the Merkle leaf hash of the precert_entry the log made
+// for s, see RFC 6962 section 3.4.
+func precertLeafHash(s sct, issuerKeyHash [32]byte, tbs []byte) [32]byte {
+	var b bytes.Buffer
+	b.WriteByte(0) // leaf hash prefix
+	b.WriteByte(0) // version v1
+	b.WriteByte(0) // timestamped_entry
+	binary.Write(&b, binary.BigEndian, s.timestamp)
+	binary.Write(&b, binary.BigEndian, uint16(1)) // precert_entry
+	b.Write(issuerKeyHash[:])
+	b.Write([]byte{byte(len(tbs) >> 16), byte(len(tbs) >> 8), byte(len(tbs))})
+	b.Write(tbs)
+	binary.Write(&b, binary.BigEndian, uint16(len(s.extensions)))
+	b.Write(s.extensions)
+	return sha256.Sum256(b.Bytes())
+}
+
+// signedTreeHead is the response of get-sth, see RFC 6962 section 4.3.
+type signedTreeHead struct {
+	TreeSize  uint64 `json:"tree_size"`
+	RootHash  []byte `json:"sha256_root_hash"`
+	Timestamp uint64 `json:"timestamp"`
+}
+
+// inclusionProof is the response of get-proof-by-hash, see RFC 6962 section
+// 4.5.
+type inclusionProof struct {
+	LeafIndex uint64   `json:"leaf_index"`
+	AuditPath [][]byte `json:"audit_path"`
+}
+
+func getSTH(ctLogURL string) (*signedTreeHead, error) {
+	sth := &signedTreeHead{}
+	if err := getCTJSON(strings.TrimSuffix(ctLogURL, "/")+"/ct/v1/get-sth", sth); err != nil {
+		return nil, fmt.Errorf("fetching the CT log tree head: %v", err)
+	}
+	if len(sth.RootHash) != sha256.Size {
+		return nil, errors.New("invalid CT log tree head")
+	}
+	return sth, nil
+}
+
+// verifyCTProof fetches the inclusion proof of leaf in the tree sth is the
+// head of, and checks it.
+func verifyCTProof(ctLogURL string, leaf [32]byte, sth *signedTreeHead) error {
+	q := url.Values{}
+	q.Set("hash", base64.StdEncoding.EncodeToString(leaf[:]))
+	q.Set("tree_size", fmt.Sprint(sth.TreeSize))
+	proof := &inclusionProof{}
+	if err := getCTJSON(strings.TrimSuffix(ctLogURL, "/")+"/ct/v1/get-proof-by-hash?"+q.Encode(), proof); err != nil {
+		return fmt.Errorf("fetching the inclusion proof: %v", err)
+	}
+	return verifyInclusion(leaf, proof.LeafIndex, sth.TreeSize, proof.AuditPath, sth.RootHash)
+}
+
+func getCTJSON(u string, v interface{}) error {
+	resp, err := http.Get(u)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", u, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// verifyInclusion checks that path proves leaf is at index in the Merkle tree
+// of size with root, see RFC 9162 section 2.1.3.2.
+func verifyInclusion(leaf [32]byte, index, size uint64, path [][]byte, root []byte) error {
+	if index >= size {
+		return fmt.Errorf("leaf index %d is outside of the tree of size %d", index, size)
+	}
+	fn, sn := index, size-1
+	r := leaf[:]
+	for _, p := range path {
+		if sn == 0 {
+			return errors.New("inclusion proof is too long")
+		}
+		if fn&1 == 1 || fn == sn {
+			r = hashChildren(p, r)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			r = hashChildren(r, p)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	if sn != 0 || !bytes.Equal(r, root) {
+		return errors.New("inclusion proof doesn't match the tree head")
+	}
+	return nil
+}
+
+func hashChildren(l, r []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{1})
+	h.Write(l)
+	h.Write(r)
+	return h.Sum(nil)
+}
@@ -0,0 +1,226 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cosign
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/sigstore/cosign/pkg/cosign/oci"
+)
+
+// mth is the Merkle tree hash of leaves, which are leaf hashes, see RFC 6962
+// section 2.1.
+func mth(leaves [][]byte) []byte {
+	if len(leaves) == 1 {
+		return leaves[0]
+	}
+	k := splitPoint(len(leaves))
+	return hashChildren(mth(leaves[:k]), mth(leaves[k:]))
+}
+
+// auditPath is the inclusion proof of leaf m, see RFC 6962 section 2.1.1.
+func auditPath(m int, leaves [][]byte) [][]byte {
+	if len(leaves) == 1 {
+		return nil
+	}
+	k := splitPoint(len(leaves))
+	if m < k {
+		return append(auditPath(m, leaves[:k]), mth(leaves[k:]))
+	}
+	return append(auditPath(m-k, leaves[k:]), mth(leaves[:k]))
+}
+
+// splitPoint is the largest power of two smaller than n.
+func splitPoint(n int) int {
+	k := 1
+	for k<<1 < n {
+		k <<= 1
+	}
+	return k
+}
+
+func randomLeaves(t *testing.T, n int) [][]byte {
+	t.Helper()
+	leaves := [][]byte{}
+	for i := 0; i < n; i++ {
+		h := sha256.Sum256([]byte(fmt.Sprint(i)))
+		leaves = append(leaves, h[:])
+	}
+	return leaves
+}
+
+func TestVerifyInclusion(t *testing.T) {
+	for size := 1; size <= 9; size++ {
+		leaves := randomLeaves(t, size)
+		root := mth(leaves)
+		for i := range leaves {
+			var leaf [32]byte
+			copy(leaf[:], leaves[i])
+			path := auditPath(i, leaves)
+			if err := verifyInclusion(leaf, uint64(i), uint64(size), path, root); err != nil {
+				t.Errorf("verifyInclusion(%d of %d) = %v", i, size, err)
+			}
+			if err := verifyInclusion(leaf, uint64(i+1), uint64(size), path, root); err == nil && size > 1 {
+				t.Errorf("verifyInclusion(%d of %d) at the wrong index, wanted error", i, size)
+			}
+			if size > 1 {
+				if err := verifyInclusion(leaf, uint64(i), uint64(size), path[1:], root); err == nil {
+					t.Errorf("verifyInclusion(%d of %d) with a short path, wanted error", i, size)
+				}
+			}
+		}
+	}
+}
+
+// fakeCTLog serves get-sth and get-proof-by-hash for a tree of leaf hashes.
+func fakeCTLog(t *testing.T, leaves [][]byte) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ct/v1/get-sth":
+			json.NewEncoder(w).Encode(signedTreeHead{TreeSize: uint64(len(leaves)), RootHash: mth(leaves)})
+		case "/ct/v1/get-proof-by-hash":
+			h, err := base64.StdEncoding.DecodeString(r.URL.Query().Get("hash"))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			for i, l := range leaves {
+				if string(l) == string(h) {
+					json.NewEncoder(w).Encode(inclusionProof{LeafIndex: uint64(i), AuditPath: auditPath(i, leaves)})
+					return
+				}
+			}
+			http.NotFound(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+// issueWithSCT returns a certificate for pub with an embedded SCT, PEM
+// encoded, and the Merkle leaf hash of its precertificate.
+func (ca *testCA) issueWithSCT(t *testing.T, pub ed25519.PublicKey) ([]byte, []byte) {
+	t.Helper()
+	const timestamp = 1600000000000
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(4),
+		Subject:      pkix.Name{CommonName: "signer"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}
+	precert, err := x509.CreateCertificate(rand.Reader, tmpl, ca.intermediate, pub, ca.intermediateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pre, err := x509.ParseCertificate(precert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// version, log ID, timestamp, no extensions, then a signature that
+	// isn't checked.
+	sctBytes := append(make([]byte, 1+32), make([]byte, 8)...)
+	binary.BigEndian.PutUint64(sctBytes[33:], timestamp)
+	sctBytes = append(sctBytes, 0, 0, 4, 3, 0, 2, 0xca, 0xfe)
+	list := append([]byte{byte(len(sctBytes) >> 8), byte(len(sctBytes))}, sctBytes...)
+	list = append([]byte{byte(len(list) >> 8), byte(len(list))}, list...)
+	ext, err := asn1.Marshal(list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl.ExtraExtensions = []pkix.Extension{{Id: sctListOID, Value: ext}}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.intermediate, pub, ca.intermediateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leaf := precertLeafHash(sct{timestamp: timestamp}, sha256.Sum256(ca.intermediate.RawSubjectPublicKeyInfo), pre.RawTBSCertificate)
+	return pem.EncodeToMemory(&pem.Block{Type: certPemType, Bytes: der}), leaf[:]
+}
+
+func TestVerifyCertificateCTInclusion(t *testing.T) {
+	ca := newTestCA(t)
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM, leaf := ca.issueWithSCT(t, pub)
+	certs, err := ParseCertificates(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leaves := randomLeaves(t, 6)
+	logged := fakeCTLog(t, append(leaves[:3:3], append([][]byte{leaf}, leaves[3:]...)...))
+	defer logged.Close()
+	notLogged := fakeCTLog(t, leaves)
+	defer notLogged.Close()
+
+	if err := verifyCertificateCTInclusion(certs[0], ca.intermediate, logged.URL); err != nil {
+		t.Errorf("verifyCertificateCTInclusion() = %v", err)
+	}
+	if err := verifyCertificateCTInclusion(certs[0], ca.intermediate, notLogged.URL); err == nil {
+		t.Error("verifyCertificateCTInclusion() of a certificate that isn't logged, wanted error")
+	}
+	if err := verifyCertificateCTInclusion(certs[0], newTestCA(t).intermediate, logged.URL); err == nil {
+		t.Error("verifyCertificateCTInclusion() with another issuer, wanted error")
+	}
+	plainPEM, chainPEM := ca.issue(t, pub)
+	plain, err := ParseCertificates(plainPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyCertificateCTInclusion(plain[0], ca.intermediate, logged.URL); err == nil {
+		t.Error("verifyCertificateCTInclusion() of a certificate without SCTs, wanted error")
+	}
+
+	// Through VerifyWithCertificates.
+	ro, ref, h := writeRandomImage(t, "ct")
+	payload, err := oci.Payload(v1.Descriptor{Digest: h}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sigTag := ref.Context().Tag(oci.Munge(v1.Descriptor{Digest: h}))
+	if err := oci.Upload(ed25519.Sign(priv, payload), payload, sigTag, oci.UploadCertificate(certPEM, chainPEM), oci.UploadRegistryOptions(ro)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyWithCertificates(ref, ca.roots, true, nil, VerifyRegistryOptions(ro), VerifyCTInclusion(logged.URL)); err != nil {
+		t.Errorf("VerifyWithCertificates() = %v", err)
+	}
+	if _, err := VerifyWithCertificates(ref, ca.roots, true, nil, VerifyRegistryOptions(ro), VerifyCTInclusion(notLogged.URL)); err == nil {
+		t.Error("VerifyWithCertificates() with a CT log missing the certificate, wanted error")
+	}
+}
@@ -0,0 +1,236 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cosign
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// DockerfileBaseImages returns the images the FROM instructions of the
+// Dockerfile at path build on, each once, in the order they first appear.
+// FROM scratch and FROM of an earlier build stage are skipped. ARGs declared
+// before the first FROM are substituted, with their defaults.
+//
+// Only what's needed to find the FROM instructions is parsed: parser
+// directives, comments, line continuations and ARG.
+func DockerfileBaseImages(path string) ([]string, error) {
+	lines, err := readDockerfile(path)
+	if err != nil {
+		return nil, err
+	}
+	froms, err := parseDockerfileFroms(lines)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	seen := map[string]bool{}
+	images := []string{}
+	for _, f := range froms {
+		if !seen[f.image] {
+			seen[f.image] = true
+			images = append(images, f.image)
+		}
+	}
+	return images, nil
+}
+
+// PinDockerfileBaseImages rewrites the FROM instructions of the Dockerfile
+// at path whose image, as returned by DockerfileBaseImages, is a key of
+// digests, to refer to the image by the digest it maps to (sha256:...). The
+// tag is kept for readers, e.g. FROM golang:1.16@sha256:... Images that are
+// already pinned to a digest are left alone.
+func PinDockerfileBaseImages(path string, digests map[string]string) error {
+	lines, err := readDockerfile(path)
+	if err != nil {
+		return err
+	}
+	froms, err := parseDockerfileFroms(lines)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	for _, f := range froms {
+		digest, ok := digests[f.image]
+		if !ok || strings.Contains(f.image, "@") {
+			continue
+		}
+		if !replaceDockerfileField(lines, f, f.image+"@"+digest) {
+			return fmt.Errorf("%s: line %d: can't find %q to pin it", path, f.start+1, f.raw)
+		}
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, []byte(strings.Join(lines, "")), info.Mode())
+}
+
+// readDockerfile reads the Dockerfile at path as lines, with their line
+// endings, so it can be written back as it was.
+func readDockerfile(path string) ([]string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return strings.SplitAfter(string(b), "\n"), nil
+}
+
+// dockerfileFrom is the FROM instruction of a base image.
+type dockerfileFrom struct {
+	// image is the image, with ARGs substituted, and raw is how it's
+	// written.
+	image, raw string
+	// The instruction is on lines start to end, 0-based and inclusive.
+	start, end int
+}
+
+var (
+	escapeDirective = regexp.MustCompile(`^#\s*escape\s*=\s*(\S)\s*$`)
+	dockerfileVar   = regexp.MustCompile(`\$(?:\{([A-Za-z_][A-Za-z0-9_]*)(?::?-([^}]*))?\}|([A-Za-z_][A-Za-z0-9_]*))`)
+)
+
+// parseDockerfileFroms returns the FROM instructions in lines that build on
+// an image, rather than scratch or an earlier stage.
+func parseDockerfileFroms(lines []string) ([]dockerfileFrom, error) {
+	escape := `\`
+	args := map[string]string{}
+	stages := map[string]bool{}
+	froms := []dockerfileFrom{}
+	sawFrom := false
+
+	instruction, start := "", 0
+	directives := true
+	for i, l := range lines {
+		text := strings.TrimSpace(l)
+		if directives {
+			if m := escapeDirective.FindStringSubmatch(text); m != nil {
+				escape = m[1]
+				continue
+			}
+			directives = false
+		}
+		// Comments are dropped, even in the middle of a continued instruction.
+		if strings.HasPrefix(text, "#") || (text == "" && instruction == "") {
+			continue
+		}
+		if instruction == "" {
+			start = i
+		}
+		if strings.HasSuffix(text, escape) {
+			instruction += strings.TrimSuffix(text, escape) + " "
+			continue
+		}
+		instruction += text
+		fields := strings.Fields(instruction)
+		instruction = ""
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch strings.ToUpper(fields[0]) {
+		case "ARG":
+			if sawFrom {
+				continue
+			}
+			for _, a := range fields[1:] {
+				kv := strings.SplitN(a, "=", 2)
+				if len(kv) == 2 {
+					args[kv[0]] = strings.Trim(kv[1], `"'`)
+				} else if _, ok := args[kv[0]]; !ok {
+					args[kv[0]] = ""
+				}
+			}
+		case "FROM":
+			sawFrom = true
+			rest := fields[1:]
+			for len(rest) > 0 && strings.HasPrefix(rest[0], "--") {
+				rest = rest[1:]
+			}
+			if len(rest) == 0 {
+				return nil, fmt.Errorf("line %d: FROM without an image", start+1)
+			}
+			if len(rest) != 1 && (len(rest) != 3 || !strings.EqualFold(rest[1], "AS")) {
+				return nil, fmt.Errorf("line %d: expected FROM [--flags] <image> [AS <name>], got %q", start+1, strings.Join(fields, " "))
+			}
+			image, err := expandDockerfileArgs(rest[0], args)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", start+1, err)
+			}
+			base := !strings.EqualFold(image, "scratch") && !stages[strings.ToLower(image)]
+			if len(rest) == 3 {
+				// The stage can only be used by later FROMs.
+				stages[strings.ToLower(rest[2])] = true
+			}
+			if base {
+				froms = append(froms, dockerfileFrom{image: image, raw: rest[0], start: start, end: i})
+			}
+		}
+	}
+	return froms, nil
+}
+
+// replaceDockerfileField replaces the image of f, the first field after FROM
+// and its flags that is f.raw, with image.
+func replaceDockerfileField(lines []string, f dockerfileFrom, image string) bool {
+	sawFrom := false
+	for i := f.start; i <= f.end; i++ {
+		l := lines[i]
+		if strings.HasPrefix(strings.TrimSpace(l), "#") {
+			continue
+		}
+		for _, loc := range dockerfileField.FindAllStringIndex(l, -1) {
+			field := l[loc[0]:loc[1]]
+			switch {
+			case !sawFrom:
+				sawFrom = strings.EqualFold(field, "FROM")
+			case field == f.raw:
+				lines[i] = l[:loc[0]] + image + l[loc[1]:]
+				return true
+			}
+		}
+	}
+	return false
+}
+
+var dockerfileField = regexp.MustCompile(`\S+`)
+
+// expandDockerfileArgs substitutes $NAME, ${NAME} and ${NAME:-default} in
+// image with the ARGs declared before the first FROM.
+func expandDockerfileArgs(image string, args map[string]string) (string, error) {
+	var undefined []string
+	expanded := dockerfileVar.ReplaceAllStringFunc(image, func(v string) string {
+		m := dockerfileVar.FindStringSubmatch(v)
+		name, def := m[1], m[2]
+		if name == "" {
+			name = m[3]
+		}
+		if val, ok := args[name]; ok && val != "" {
+			return val
+		}
+		if def != "" {
+			return def
+		}
+		undefined = append(undefined, name)
+		return ""
+	})
+	if len(undefined) != 0 {
+		return "", fmt.Errorf("FROM %s uses ARG %s, which has no default", image, strings.Join(undefined, ", "))
+	}
+	return expanded, nil
+}
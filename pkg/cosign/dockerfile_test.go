@@ -0,0 +1,128 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cosign
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDockerfileBaseImages(t *testing.T) {
+	tests := []struct {
+		name       string
+		dockerfile string
+		want       []string
+		wantErr    bool
+	}{{
+		name:       "single",
+		dockerfile: "FROM golang:1.16\nRUN go build ./...\n",
+		want:       []string{"golang:1.16"},
+	}, {
+		name: "multi-stage",
+		dockerfile: `# syntax=docker/dockerfile:1
+FROM --platform=$BUILDPLATFORM golang:1.16 AS build
+RUN go build -o /app ./cmd/app
+
+from build as test
+RUN go test ./...
+
+FROM gcr.io/distroless/static
+COPY --from=build /app /app
+
+FROM scratch
+COPY --from=build /app /app
+FROM golang:1.16
+`,
+		want: []string{"golang:1.16", "gcr.io/distroless/static"},
+	}, {
+		name: "args",
+		dockerfile: `ARG REGISTRY=gcr.io
+ARG TAG="nonroot"
+ARG DIGEST
+FROM ${REGISTRY}/distroless/static:$TAG
+FROM alpine:${ALPINE:-3.14}
+ARG IGNORED=after-from
+`,
+		want: []string{"gcr.io/distroless/static:nonroot", "alpine:3.14"},
+	}, {
+		name:       "continuations and comments",
+		dockerfile: "FROM \\\n# the base image\n  golang:1.16 \\\n  AS build\n",
+		want:       []string{"golang:1.16"},
+	}, {
+		name:       "escape directive",
+		dockerfile: "# escape=`\nFROM mcr.microsoft.com/windows/servercore:ltsc2019 `\n  AS base\n",
+		want:       []string{"mcr.microsoft.com/windows/servercore:ltsc2019"},
+	}, {
+		name:       "only scratch",
+		dockerfile: "FROM scratch\n",
+		want:       []string{},
+	}, {
+		name:       "undefined arg",
+		dockerfile: "ARG BASE\nFROM $BASE\n",
+		wantErr:    true,
+	}, {
+		name:       "no image",
+		dockerfile: "FROM --platform=linux/amd64\n",
+		wantErr:    true,
+	}, {
+		name:       "extra words",
+		dockerfile: "FROM golang:1.16 build\n",
+		wantErr:    true,
+	}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "Dockerfile")
+			if err := ioutil.WriteFile(path, []byte(test.dockerfile), 0600); err != nil {
+				t.Fatal(err)
+			}
+			got, err := DockerfileBaseImages(path)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("DockerfileBaseImages() = %v, wanted error: %t", err, test.wantErr)
+			}
+			if !test.wantErr && !reflect.DeepEqual(got, test.want) {
+				t.Errorf("DockerfileBaseImages() = %v, wanted %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestPinDockerfileBaseImages(t *testing.T) {
+	const digest = "sha256:0000000000000000000000000000000000000000000000000000000000000001"
+	dockerfile := "ARG TAG=1.16\r\nFROM --platform=$BUILDPLATFORM golang:${TAG} AS build\r\nFROM build AS test\r\nFROM alpine@" + digest + "\r\nFROM golang:${TAG}\r\n"
+	want := "ARG TAG=1.16\r\nFROM --platform=$BUILDPLATFORM golang:1.16@" + digest + " AS build\r\nFROM build AS test\r\nFROM alpine@" + digest + "\r\nFROM golang:1.16@" + digest + "\r\n"
+
+	path := filepath.Join(t.TempDir(), "Dockerfile")
+	if err := ioutil.WriteFile(path, []byte(dockerfile), 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err := PinDockerfileBaseImages(path, map[string]string{"golang:1.16": digest, "alpine@" + digest: digest}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("PinDockerfileBaseImages() wrote %q, wanted %q", got, want)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0640 {
+		t.Errorf("PinDockerfileBaseImages() changed the mode: %v, %v", info.Mode(), err)
+	}
+}
@@ -0,0 +1,155 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cosign
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/sigstore/cosign/pkg/cosign/bundle"
+	"github.com/sigstore/cosign/pkg/cosign/oci"
+)
+
+// DSSEMediaType is the media type of DSSE envelopes. sign -dsse stores them
+// as the signature layer, with the payload they wrap as their payloadType.
+const DSSEMediaType types.MediaType = "application/vnd.dsse.envelope.v1+json"
+
+// DSSEEnvelope is a Dead Simple Signing Envelope, see
+// https://github.com/secure-systems-lab/dsse. It signs the payload along with
+// its type, so it can't be mistaken for a payload of another type.
+type DSSEEnvelope = bundle.Envelope
+
+// DSSESignature is a signature in a DSSEEnvelope.
+type DSSESignature = bundle.Signature
+
+// PAE is the DSSE pre-authentication encoding of payload, which is what gets
+// signed.
+func PAE(payloadType string, payload []byte) []byte {
+	return []byte(fmt.Sprintf("DSSEv1 %d %s %d %s", len(payloadType), payloadType, len(payload), payload))
+}
+
+// SignDSSE wraps payload, of type payloadType, in an envelope signed by
+// signer, which has to be an ed25519 or ECDSA key. More signatures can be
+// added with AddDSSESignature.
+func SignDSSE(signer crypto.Signer, payloadType string, payload []byte) (*DSSEEnvelope, error) {
+	env := &DSSEEnvelope{
+		PayloadType: payloadType,
+		Payload:     base64.StdEncoding.EncodeToString(payload),
+		Signatures:  []DSSESignature{},
+	}
+	if err := AddDSSESignature(env, signer); err != nil {
+		return nil, err
+	}
+	return env, nil
+}
+
+// AddDSSESignature signs the envelope e with signer too.
+func AddDSSESignature(e *DSSEEnvelope, signer crypto.Signer) error {
+	payload, err := base64.StdEncoding.DecodeString(e.Payload)
+	if err != nil {
+		return err
+	}
+	sig, err := SignPayload(signer, PAE(e.PayloadType, payload))
+	if err != nil {
+		return err
+	}
+	e.Signatures = append(e.Signatures, DSSESignature{Sig: base64.StdEncoding.EncodeToString(sig)})
+	return nil
+}
+
+// VerifyDSSE returns the payload of env if verifier, an ed25519 or ECDSA
+// public key, verifies any of its signatures.
+func VerifyDSSE(verifier crypto.PublicKey, env *DSSEEnvelope) ([]byte, error) {
+	payload, err := base64.StdEncoding.DecodeString(env.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("invalid envelope payload: %v", err)
+	}
+	pae := PAE(env.PayloadType, payload)
+	for _, s := range env.Signatures {
+		sig, err := base64.StdEncoding.DecodeString(s.Sig)
+		if err != nil {
+			continue
+		}
+		switch k := verifier.(type) {
+		case ed25519.PublicKey:
+			if ed25519.Verify(k, pae, sig) {
+				return payload, nil
+			}
+		case *ecdsa.PublicKey:
+			h := sha256.Sum256(pae)
+			if ecdsa.VerifyASN1(k, h[:], sig) {
+				return payload, nil
+			}
+		default:
+			return nil, fmt.Errorf("unsupported key type %T", verifier)
+		}
+	}
+	return nil, errors.New("no envelope signature verifies")
+}
+
+// ParseDSSE parses a DSSEEnvelope, as stored in DSSEMediaType layers.
+func ParseDSSE(b []byte) (*DSSEEnvelope, error) {
+	env := &DSSEEnvelope{}
+	if err := json.Unmarshal(b, env); err != nil {
+		return nil, fmt.Errorf("invalid envelope: %v", err)
+	}
+	if env.PayloadType == "" {
+		return nil, errors.New("invalid envelope: no payloadType")
+	}
+	return env, nil
+}
+
+// parseDSSE parses the payload wrapped in a DSSEMediaType envelope, as the
+// media type in its payloadType.
+func parseDSSE(b []byte) (*PayloadClaims, error) {
+	env, err := ParseDSSE(b)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := base64.StdEncoding.DecodeString(env.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("invalid envelope payload: %v", err)
+	}
+	if types.MediaType(env.PayloadType) == DSSEMediaType {
+		return nil, errors.New("envelopes can't be nested")
+	}
+	return digestAndClaims(types.MediaType(env.PayloadType), payload)
+}
+
+// verifyStoredSignature verifies the signature of sp, and for envelopes, that
+// pubKey signed the envelope too.
+func verifyStoredSignature(pubKey crypto.PublicKey, sp oci.SignedPayload) error {
+	if err := VerifySignature(pubKey, sp.Base64Signature, sp.Payload); err != nil {
+		return err
+	}
+	if sp.MediaType != DSSEMediaType {
+		return nil
+	}
+	env, err := ParseDSSE(sp.Payload)
+	if err != nil {
+		return err
+	}
+	_, err = VerifyDSSE(pubKey, env)
+	return err
+}
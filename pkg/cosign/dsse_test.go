@@ -0,0 +1,139 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cosign
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"testing"
+
+	"github.com/sigstore/cosign/pkg/cosign/oci"
+)
+
+func TestPAE(t *testing.T) {
+	// From the DSSE protocol description.
+	got := string(PAE("http://example.com/HelloWorld", []byte("hello world")))
+	want := "DSSEv1 29 http://example.com/HelloWorld 11 hello world"
+	if got != want {
+		t.Errorf("PAE() = %q, wanted %q", got, want)
+	}
+}
+
+func TestSignVerifyDSSE(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecPriv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env, err := SignDSSE(priv, "application/vnd.in-toto+json", []byte(`{"foo":"bar"}`))
+	if err != nil {
+		t.Fatalf("SignDSSE() = %v", err)
+	}
+	payload, err := VerifyDSSE(pub, env)
+	if err != nil {
+		t.Fatalf("VerifyDSSE() = %v", err)
+	}
+	if string(payload) != `{"foo":"bar"}` {
+		t.Errorf("VerifyDSSE() = %s, wanted the payload", payload)
+	}
+	if _, err := VerifyDSSE(otherPub, env); err == nil {
+		t.Error("VerifyDSSE() with the wrong key, wanted error")
+	}
+	if _, err := VerifyDSSE(&ecPriv.PublicKey, env); err == nil {
+		t.Error("VerifyDSSE() with an ECDSA key, wanted error")
+	}
+
+	// The payload type is signed too.
+	tampered := *env
+	tampered.PayloadType = "text/plain"
+	if _, err := VerifyDSSE(pub, &tampered); err == nil {
+		t.Error("VerifyDSSE() with another payload type, wanted error")
+	}
+
+	if err := AddDSSESignature(env, ecPriv); err != nil {
+		t.Fatalf("AddDSSESignature() = %v", err)
+	}
+	if _, err := VerifyDSSE(&ecPriv.PublicKey, env); err != nil {
+		t.Errorf("VerifyDSSE() with the ECDSA key = %v", err)
+	}
+	if _, err := VerifyDSSE(pub, env); err != nil {
+		t.Errorf("VerifyDSSE() with the first key = %v", err)
+	}
+}
+
+func TestVerifyDSSEPayload(t *testing.T) {
+	ro, ref, h := writeRandomImage(t, "image")
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, otherPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc, err := ro.Remote().Get(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := oci.Payload(desc, map[string]string{"foo": "bar"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	upload := func(envelopeKey ed25519.PrivateKey) {
+		t.Helper()
+		env, err := SignDSSE(envelopeKey, string(oci.SimpleSigningMediaType), payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := json.Marshal(env)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := oci.Upload(ed25519.Sign(priv, b), b, ref.Context().Tag(oci.Munge(desc)), oci.UploadRegistryOptions(ro), oci.UploadMediaType(DSSEMediaType)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The envelope has to be signed by the key too, not just the layer.
+	upload(otherPriv)
+	if _, err := Verify(ref, pub, true, nil, VerifyRegistryOptions(ro)); err == nil {
+		t.Error("Verify() of an envelope signed by another key, wanted error")
+	}
+
+	upload(priv)
+	sps, err := Verify(ref, pub, true, map[string]string{"foo": "bar"}, VerifyRegistryOptions(ro))
+	if err != nil {
+		t.Fatalf("Verify() = %v", err)
+	}
+	if len(sps) != 1 || sps[0].MediaType != DSSEMediaType {
+		t.Errorf("Verify() = %v, wanted the envelope", sps)
+	}
+	if _, err := Verify(ref.Context().Digest(h.String()), pub, true, map[string]string{"foo": "baz"}, VerifyRegistryOptions(ro)); err == nil {
+		t.Error("Verify() with the wrong annotations, wanted error")
+	}
+}
@@ -0,0 +1,168 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package fulcio gets signing certificates for ephemeral keys from Fulcio, in
+// exchange for an OIDC token.
+package fulcio
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/sigstore/cosign/pkg/cosign"
+)
+
+const signingCertPath = "/api/v1/signingCert"
+
+// Client talks to a Fulcio instance.
+type Client struct {
+	// URL is where Fulcio is, e.g. cosign.DefaultFulcioURL.
+	URL string
+	// HTTPClient, if set, is used instead of http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// NewClient returns a Client for the Fulcio instance at url.
+func NewClient(url string) *Client {
+	return &Client{URL: url}
+}
+
+// SigningCertificate is what Fulcio issued for a key.
+type SigningCertificate struct {
+	// CertPEM is the PEM encoded certificate for the key.
+	CertPEM []byte
+	// ChainPEM is the PEM encoded intermediates and root it was issued by,
+	// in that order.
+	ChainPEM []byte
+	// SCT is the signed certificate timestamp from Fulcio's CT log, if it
+	// sent one rather than embedding it in the certificate.
+	SCT []byte
+}
+
+// Chain parses the certificate and its chain, leaf first.
+func (sc *SigningCertificate) Chain() ([]*x509.Certificate, error) {
+	return ParseChain(append(append([]byte{}, sc.CertPEM...), sc.ChainPEM...))
+}
+
+type publicKey struct {
+	Content   []byte `json:"content"`
+	Algorithm string `json:"algorithm"`
+}
+
+type signingCertRequest struct {
+	PublicKey publicKey `json:"publicKey"`
+}
+
+// GetSigningCertificate asks Fulcio for a certificate for pubKey, for the
+// identity token vouches for. Newer Fulcio instances also want proof that the
+// caller holds the private key, which isn't sent.
+//
+// The request is a POST to /api/v1/signingCert with the token as a bearer
+// token and a JSON body of the DER encoded public key and its algorithm.
+// Fulcio answers 201 with the PEM encoded certificate, followed by the
+// certificate chain, and may put an SCT in the SCT header. The certificate
+// has the token's identity as its SAN and the token's issuer in the
+// 1.3.6.1.4.1.57264.1.1 extension, and is only valid for a few minutes.
+func (c *Client) GetSigningCertificate(ctx context.Context, token string, pubKey crypto.PublicKey) (*SigningCertificate, error) {
+	alg, err := algorithm(pubKey)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKIXPublicKey(pubKey)
+	if err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(signingCertRequest{PublicKey: publicKey{Content: der, Algorithm: alg}})
+	if err != nil {
+		return nil, err
+	}
+
+	u := strings.TrimSuffix(c.URL, "/") + signingCertPath
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/pem-certificate-chain")
+
+	hc := c.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("POST %s: %s: %s", u, resp.Status, strings.TrimSpace(string(b)))
+	}
+
+	// The response is the certificate followed by its chain.
+	block, rest := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("POST %s: no certificate in the response", u)
+	}
+	sc := &SigningCertificate{CertPEM: pem.EncodeToMemory(block)}
+	if len(bytes.TrimSpace(rest)) != 0 {
+		sc.ChainPEM = rest
+	}
+	if _, err := sc.Chain(); err != nil {
+		return nil, fmt.Errorf("POST %s: invalid certificate chain: %v", u, err)
+	}
+	if sct := resp.Header.Get("SCT"); sct != "" {
+		if sc.SCT, err = base64.StdEncoding.DecodeString(sct); err != nil {
+			return nil, fmt.Errorf("POST %s: invalid SCT header: %v", u, err)
+		}
+	}
+	return sc, nil
+}
+
+// ParseChain parses the PEM encoded certificates in b, in order.
+func ParseChain(b []byte) ([]*x509.Certificate, error) {
+	return cosign.ParseCertificates(b)
+}
+
+// algorithm names the type of pubKey the way Fulcio does.
+func algorithm(pubKey crypto.PublicKey) (string, error) {
+	switch pubKey.(type) {
+	case *ecdsa.PublicKey:
+		return "ecdsa", nil
+	case ed25519.PublicKey:
+		return "ed25519", nil
+	case *rsa.PublicKey:
+		return "rsa", nil
+	default:
+		return "", fmt.Errorf("unsupported public key type %T", pubKey)
+	}
+}
@@ -0,0 +1,149 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fulcio
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// issue returns a PEM encoded certificate for pub, and the self-signed root
+// that issued it.
+func issue(t *testing.T, pub *ecdsa.PublicKey) ([]byte, []byte) {
+	t.Helper()
+	rootKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "fulcio"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	rootDER, err := x509.CreateCertificate(rand.Reader, rootTmpl, rootTmpl, &rootKey.PublicKey, rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := x509.ParseCertificate(rootDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}, root, pub, rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leafDER}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: rootDER})
+}
+
+func TestGetSigningCertificate(t *testing.T) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, chain := issue(t, &priv.PublicKey)
+
+	var status int
+	var resp []byte
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != signingCertPath {
+			http.NotFound(w, r)
+			return
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer token" {
+			t.Errorf("Authorization = %q, wanted the token", got)
+		}
+		req := signingCertRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("request body: %v", err)
+		}
+		pub, err := x509.ParsePKIXPublicKey(req.PublicKey.Content)
+		if err != nil {
+			t.Errorf("request public key: %v", err)
+		} else if !priv.PublicKey.Equal(pub) || req.PublicKey.Algorithm != "ecdsa" {
+			t.Errorf("request public key = %v %s, wanted %v ecdsa", pub, req.PublicKey.Algorithm, priv.PublicKey)
+		}
+		w.Header().Set("SCT", "c2N0")
+		w.WriteHeader(status)
+		w.Write(resp)
+	}))
+	defer s.Close()
+	c := NewClient(s.URL + "/")
+
+	status, resp = http.StatusCreated, append(append([]byte{}, cert...), chain...)
+	sc, err := c.GetSigningCertificate(context.Background(), "token", &priv.PublicKey)
+	if err != nil {
+		t.Fatalf("GetSigningCertificate() = %v", err)
+	}
+	if string(sc.CertPEM) != string(cert) || string(sc.ChainPEM) != string(chain) || string(sc.SCT) != "sct" {
+		t.Errorf("GetSigningCertificate() = %+v, wanted the certificate, chain and SCT", sc)
+	}
+	certs, err := sc.Chain()
+	if err != nil {
+		t.Fatalf("Chain() = %v", err)
+	}
+	want, err := ParseChain(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(certs) != 2 || !reflect.DeepEqual(certs, want) {
+		t.Errorf("Chain() = %d certificates, wanted the leaf and root", len(certs))
+	}
+
+	for _, test := range []struct {
+		name   string
+		status int
+		resp   []byte
+	}{
+		{name: "unauthorized", status: http.StatusUnauthorized, resp: []byte("bad token")},
+		{name: "not a certificate", status: http.StatusCreated, resp: []byte("garbage")},
+		{name: "invalid chain", status: http.StatusCreated, resp: append(append([]byte{}, cert...), "-----BEGIN CERTIFICATE-----\nAAAA\n-----END CERTIFICATE-----\n"...)},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			status, resp = test.status, test.resp
+			if _, err := c.GetSigningCertificate(context.Background(), "token", &priv.PublicKey); err == nil {
+				t.Error("GetSigningCertificate() = nil, wanted error")
+			}
+		})
+	}
+
+	if _, err := c.GetSigningCertificate(context.Background(), "token", "not a key"); err == nil {
+		t.Error("GetSigningCertificate() with an unsupported key, wanted error")
+	}
+}
@@ -0,0 +1,225 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fulcio
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Audience is the audience Fulcio accepts OIDC tokens for.
+const Audience = "sigstore"
+
+// OIDCTokenProvider gets an OIDC identity token to exchange for a signing
+// certificate, without a browser, e.g. from the environment cosign runs in.
+type OIDCTokenProvider interface {
+	GetToken(ctx context.Context) (string, error)
+}
+
+// The providers NewOIDCTokenProvider knows.
+const (
+	ProviderGoogle = "google"
+	ProviderGitHub = "github"
+	ProviderGitLab = "gitlab"
+	ProviderCustom = "custom"
+)
+
+// NewOIDCTokenProvider returns the provider with name, one of the Provider
+// constants. tokenURL is only used by, and required for, ProviderCustom.
+func NewOIDCTokenProvider(name, tokenURL string) (OIDCTokenProvider, error) {
+	if tokenURL != "" && name != ProviderCustom {
+		return nil, fmt.Errorf("a token URL can only be used with the %s OIDC provider", ProviderCustom)
+	}
+	switch name {
+	case ProviderGoogle:
+		return &GoogleProvider{}, nil
+	case ProviderGitHub:
+		return &GitHubProvider{}, nil
+	case ProviderGitLab:
+		return &GitLabProvider{}, nil
+	case ProviderCustom:
+		if tokenURL == "" {
+			return nil, fmt.Errorf("the %s OIDC provider needs a token URL", ProviderCustom)
+		}
+		return &CustomProvider{URL: tokenURL}, nil
+	default:
+		return nil, fmt.Errorf("unknown OIDC provider %q, expected %s, %s, %s or %s", name, ProviderGoogle, ProviderGitHub, ProviderGitLab, ProviderCustom)
+	}
+}
+
+// DefaultGoogleMetadataURL is the identity endpoint of the GCE metadata
+// server, which GKE Workload Identity also serves.
+const DefaultGoogleMetadataURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/identity"
+
+// GoogleProvider gets an ID token for the service account of the GCE
+// instance or GKE workload cosign runs as, from the metadata server.
+type GoogleProvider struct {
+	// MetadataURL, if set, is used instead of DefaultGoogleMetadataURL.
+	MetadataURL string
+	HTTPClient  *http.Client
+}
+
+func (p *GoogleProvider) GetToken(ctx context.Context) (string, error) {
+	u := p.MetadataURL
+	if u == "" {
+		u = DefaultGoogleMetadataURL
+	}
+	u += "?" + url.Values{"audience": {Audience}, "format": {"full"}}.Encode()
+	return fetchToken(ctx, p.HTTPClient, u, http.Header{"Metadata-Flavor": {"Google"}}, "")
+}
+
+// GitHubProvider gets an ID token for the GitHub Actions workflow cosign runs
+// in, which needs the id-token: write permission.
+type GitHubProvider struct {
+	HTTPClient *http.Client
+}
+
+func (p *GitHubProvider) GetToken(ctx context.Context) (string, error) {
+	reqURL, reqToken := os.Getenv("ACTIONS_ID_TOKEN_REQUEST_URL"), os.Getenv("ACTIONS_ID_TOKEN_REQUEST_TOKEN")
+	if reqURL == "" || reqToken == "" {
+		return "", errors.New("$ACTIONS_ID_TOKEN_REQUEST_URL and $ACTIONS_ID_TOKEN_REQUEST_TOKEN aren't set, is this GitHub Actions with the id-token: write permission?")
+	}
+	sep := "?"
+	if strings.Contains(reqURL, "?") {
+		sep = "&"
+	}
+	u := reqURL + sep + url.Values{"audience": {Audience}}.Encode()
+	return fetchToken(ctx, p.HTTPClient, u, http.Header{"Authorization": {"Bearer " + reqToken}}, "value")
+}
+
+// GitLabTokenEnv is where GitLabProvider reads the token from. GitLab CI sets
+// it for jobs with an id_tokens entry for it, with the sigstore audience.
+const GitLabTokenEnv = "SIGSTORE_ID_TOKEN"
+
+// GitLabProvider gets the ID token of the GitLab CI job cosign runs in.
+type GitLabProvider struct{}
+
+func (p *GitLabProvider) GetToken(context.Context) (string, error) {
+	token := os.Getenv(GitLabTokenEnv)
+	if token == "" {
+		return "", fmt.Errorf("$%s isn't set, does the job have an id_tokens entry for it with aud: %s?", GitLabTokenEnv, Audience)
+	}
+	return token, nil
+}
+
+// CustomProvider gets a token from URL, which responds to GET with the raw
+// token.
+type CustomProvider struct {
+	URL        string
+	HTTPClient *http.Client
+}
+
+func (p *CustomProvider) GetToken(ctx context.Context) (string, error) {
+	return fetchToken(ctx, p.HTTPClient, p.URL, nil, "")
+}
+
+// ProviderGitHubActions is the -identity-token value that gets the token from
+// GitHub Actions, like ProviderGitHub.
+const ProviderGitHubActions = "github-actions"
+
+// NewIdentityTokenProvider returns a provider for the value of -identity-token:
+// ProviderGitHubActions, the path of a file holding the token, e.g. one a CI
+// system mounts, or else the token itself.
+//
+// Fulcio only accepts tokens with aud set to Audience, an iss it trusts, and
+// the identity to certify in the email claim (with email_verified true) or,
+// for workloads, in sub; tokens from GitHub Actions also carry the workflow in
+// job_workflow_ref, which Fulcio puts in the certificate's URI SAN.
+func NewIdentityTokenProvider(value string) OIDCTokenProvider {
+	if value == ProviderGitHubActions {
+		return &GitHubProvider{}
+	}
+	if fi, err := os.Stat(value); err == nil && fi.Mode().IsRegular() {
+		return &FileProvider{Path: value}
+	}
+	return StaticProvider(value)
+}
+
+// FileProvider reads the token from the file at Path each time, so it sees
+// tokens a CI system rotates in place.
+type FileProvider struct {
+	Path string
+}
+
+func (p *FileProvider) GetToken(context.Context) (string, error) {
+	b, err := ioutil.ReadFile(p.Path)
+	if err != nil {
+		return "", fmt.Errorf("reading the OIDC token: %v", err)
+	}
+	token := strings.TrimSpace(string(b))
+	if token == "" {
+		return "", fmt.Errorf("reading the OIDC token: %s is empty", p.Path)
+	}
+	return token, nil
+}
+
+// StaticProvider is a token given up front.
+type StaticProvider string
+
+func (p StaticProvider) GetToken(context.Context) (string, error) {
+	if p == "" {
+		return "", errors.New("empty OIDC token")
+	}
+	return string(p), nil
+}
+
+// fetchToken GETs u with header, and returns the token in the response: the
+// whole body, or the field of it if it's set.
+func fetchToken(ctx context.Context, hc *http.Client, u string, header http.Header, field string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return "", err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("getting an OIDC token: %v", err)
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	// Don't echo the body, it could be a token.
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("getting an OIDC token: GET %s: %s", req.URL.Redacted(), resp.Status)
+	}
+	token := strings.TrimSpace(string(b))
+	if field != "" {
+		var m map[string]interface{}
+		if err := json.Unmarshal(b, &m); err != nil {
+			return "", fmt.Errorf("getting an OIDC token: invalid response: %v", err)
+		}
+		token, _ = m[field].(string)
+	}
+	if token == "" {
+		return "", errors.New("getting an OIDC token: empty token")
+	}
+	return token, nil
+}
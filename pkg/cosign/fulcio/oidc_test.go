@@ -0,0 +1,157 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fulcio
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// setenv sets the environment variable k to v until the test ends.
+func setenv(t *testing.T, k, v string) {
+	t.Helper()
+	old, ok := os.LookupEnv(k)
+	os.Setenv(k, v)
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(k, old)
+		} else {
+			os.Unsetenv(k)
+		}
+	})
+}
+
+func TestNewOIDCTokenProvider(t *testing.T) {
+	for _, tc := range []struct {
+		name, url string
+		wantErr   bool
+	}{
+		{name: ProviderGoogle},
+		{name: ProviderGitHub},
+		{name: ProviderGitLab},
+		{name: ProviderCustom, url: "https://example.com/token"},
+		{name: ProviderCustom, wantErr: true},
+		{name: ProviderGitHub, url: "https://example.com/token", wantErr: true},
+		{name: "okta", wantErr: true},
+	} {
+		_, err := NewOIDCTokenProvider(tc.name, tc.url)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("NewOIDCTokenProvider(%q, %q) = %v, wanted error: %v", tc.name, tc.url, err, tc.wantErr)
+		}
+	}
+}
+
+func TestGoogleProvider(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" || r.URL.Query().Get("audience") != Audience {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte("google-token"))
+	}))
+	defer srv.Close()
+
+	got, err := (&GoogleProvider{MetadataURL: srv.URL}).GetToken(context.Background())
+	if err != nil || got != "google-token" {
+		t.Errorf("GetToken() = %q, %v, wanted google-token", got, err)
+	}
+}
+
+func TestGitHubProvider(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer request-token" || r.URL.Query().Get("audience") != Audience {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"count": 1, "value": "github-token"}`))
+	}))
+	defer srv.Close()
+
+	setenv(t, "ACTIONS_ID_TOKEN_REQUEST_URL", "")
+	if _, err := (&GitHubProvider{}).GetToken(context.Background()); err == nil {
+		t.Error("GetToken() outside GitHub Actions, wanted error")
+	}
+	setenv(t, "ACTIONS_ID_TOKEN_REQUEST_URL", srv.URL+"/token?api-version=2.0")
+	setenv(t, "ACTIONS_ID_TOKEN_REQUEST_TOKEN", "wrong-token")
+	if _, err := (&GitHubProvider{}).GetToken(context.Background()); err == nil {
+		t.Error("GetToken() with the wrong request token, wanted error")
+	}
+	setenv(t, "ACTIONS_ID_TOKEN_REQUEST_TOKEN", "request-token")
+	got, err := (&GitHubProvider{}).GetToken(context.Background())
+	if err != nil || got != "github-token" {
+		t.Errorf("GetToken() = %q, %v, wanted github-token", got, err)
+	}
+}
+
+func TestGitLabProvider(t *testing.T) {
+	setenv(t, GitLabTokenEnv, "")
+	if _, err := (&GitLabProvider{}).GetToken(context.Background()); err == nil {
+		t.Errorf("GetToken() without $%s, wanted error", GitLabTokenEnv)
+	}
+	setenv(t, GitLabTokenEnv, "gitlab-token")
+	got, err := (&GitLabProvider{}).GetToken(context.Background())
+	if err != nil || got != "gitlab-token" {
+		t.Errorf("GetToken() = %q, %v, wanted gitlab-token", got, err)
+	}
+}
+
+func TestCustomProvider(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("custom-token\n"))
+	}))
+	defer srv.Close()
+
+	tp, err := NewOIDCTokenProvider(ProviderCustom, srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := tp.GetToken(context.Background())
+	if err != nil || got != "custom-token" {
+		t.Errorf("GetToken() = %q, %v, wanted custom-token", got, err)
+	}
+}
+
+func TestNewIdentityTokenProvider(t *testing.T) {
+	if _, ok := NewIdentityTokenProvider(ProviderGitHubActions).(*GitHubProvider); !ok {
+		t.Errorf("NewIdentityTokenProvider(%q) isn't a GitHubProvider", ProviderGitHubActions)
+	}
+
+	path := filepath.Join(t.TempDir(), "token")
+	if err := ioutil.WriteFile(path, []byte("file-token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	got, err := NewIdentityTokenProvider(path).GetToken(context.Background())
+	if err != nil || got != "file-token" {
+		t.Errorf("GetToken() from a file = %q, %v, wanted file-token", got, err)
+	}
+	if err := ioutil.WriteFile(path, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewIdentityTokenProvider(path).GetToken(context.Background()); err == nil {
+		t.Error("GetToken() from an empty file, wanted error")
+	}
+
+	got, err = NewIdentityTokenProvider("eyJhbGciOi.eyJpc3Mi.c2lnbmF0dXJl").GetToken(context.Background())
+	if err != nil || got != "eyJhbGciOi.eyJpc3Mi.c2lnbmF0dXJl" {
+		t.Errorf("GetToken() of a token = %q, %v, wanted the token", got, err)
+	}
+}
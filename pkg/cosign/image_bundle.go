@@ -0,0 +1,129 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cosign
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/sigstore/cosign/pkg/cosign/metrics"
+	"github.com/sigstore/cosign/pkg/cosign/oci"
+)
+
+// VerificationSource is where verified signatures came from.
+type VerificationSource string
+
+const (
+	// SourceRegistry signatures were stored with the image in its registry.
+	SourceRegistry VerificationSource = "registry"
+	// SourceBundle signatures came from a Sigstore bundle, distributed
+	// separately from the image.
+	SourceBundle VerificationSource = "bundle"
+)
+
+// ImageVerification is what verifying the signatures of an image found.
+type ImageVerification struct {
+	Source   VerificationSource
+	Verified []oci.SignedPayload
+	// Logged is set if the signatures were found in the transparency log.
+	Logged bool
+}
+
+// VerifyImageBundle verifies that the bundle b has pubKey's signature of a
+// payload about the image ref, like Verify does for the signatures stored in
+// the registry. Only the image's digest comes from the registry.
+//
+// The bundle's signature has to be a DSSEEnvelope, which carries the signed
+// payload, e.g. one written by sign-blob -dsse -bundle-out. If the bundle has
+// tlog entries, their SETs have to verify with rekorKey; otherwise the
+// signature is looked up in the VerifyTransparencyLog option's log, if set.
+func VerifyImageBundle(ref name.Reference, b *Bundle, pubKey ed25519.PublicKey, rekorKey crypto.PublicKey, checkClaims bool, annotations map[string]string, opts ...VerifyOption) (*ImageVerification, error) {
+	defer metrics.ObserveSince(metrics.VerifyDuration, time.Now())
+	o := newVerifyOpts(opts)
+	env := b.DSSEEnvelope
+	if env == nil {
+		return nil, errors.New("bundle has no DSSE envelope, which has the payload an image signature is checked against")
+	}
+	if err := checkBundleHint(b, pubKey); err != nil {
+		return nil, err
+	}
+	payload, err := VerifyDSSE(pubKey, env)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := envelopeSignature(env)
+	if err != nil {
+		return nil, err
+	}
+	sp := oci.SignedPayload{
+		Base64Signature: base64.StdEncoding.EncodeToString(signature),
+		Payload:         payload,
+		MediaType:       types.MediaType(env.PayloadType),
+		PublicKey:       pubKey,
+	}
+
+	if checkClaims {
+		desc, err := o.registry.Remote().Get(ref)
+		if err != nil {
+			return nil, err
+		}
+		if err := verifyClaim(desc.Digest.Hex, annotations, sp, o); err != nil {
+			return nil, err
+		}
+	}
+	if o.tsaRoots != nil {
+		if _, err := bundleTimestamp(b, signature, o.tsaRoots); err != nil {
+			return nil, err
+		}
+	}
+
+	res := &ImageVerification{Source: SourceBundle, Verified: []oci.SignedPayload{sp}}
+	tl := o.tlog
+	if entries := b.VerificationMaterial.TlogEntries; len(entries) != 0 {
+		if rekorKey == nil {
+			return nil, errors.New("bundle has tlog entries, but there is no Rekor key to check them with")
+		}
+		rbs := make([]*RekorBundle, 0, len(entries))
+		for _, e := range entries {
+			rb, err := tlogRekorBundle(e)
+			if err != nil {
+				return nil, err
+			}
+			rbs = append(rbs, rb)
+		}
+		tl = NewOfflineTransparencyLog(rekorKey, rbs...)
+	}
+	if tl == nil {
+		return res, nil
+	}
+	// The envelope signs the PAE of the payload, so that's what was logged.
+	logged := oci.SignedPayload{
+		Base64Signature: sp.Base64Signature,
+		Payload:         PAE(env.PayloadType, payload),
+	}
+	if err := verifyLogged(o.context(), tl, pubKey, logged); err != nil {
+		return nil, fmt.Errorf("bundle: %v", err)
+	}
+	res.Logged = true
+	return res, nil
+}
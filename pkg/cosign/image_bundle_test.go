@@ -0,0 +1,125 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cosign
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/sigstore/cosign/pkg/cosign/oci"
+)
+
+func TestVerifyImageBundle(t *testing.T) {
+	ro, ref, h := writeRandomImage(t, "image:latest")
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rekorKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := []VerifyOption{VerifyRegistryOptions(ro)}
+
+	bundle := func(digest v1.Hash) *Bundle {
+		payload, err := oci.Payload(v1.Descriptor{Digest: digest}, map[string]string{"foo": "bar"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		env, err := SignDSSE(priv, string(oci.SimpleSigningMediaType), payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := NewDSSEBundle(pub, env)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	b := bundle(h)
+	res, err := VerifyImageBundle(ref, b, pub, nil, true, map[string]string{"foo": "bar"}, opts...)
+	if err != nil {
+		t.Fatalf("VerifyImageBundle() = %v", err)
+	}
+	if res.Source != SourceBundle || len(res.Verified) != 1 || res.Logged {
+		t.Errorf("VerifyImageBundle() = %+v, wanted one unlogged signature from the bundle", res)
+	}
+	if _, err := VerifyImageBundle(ref, b, otherPub, nil, true, nil, opts...); err == nil {
+		t.Error("VerifyImageBundle() with the wrong key, wanted error")
+	}
+	if _, err := VerifyImageBundle(ref, b, pub, nil, true, map[string]string{"foo": "baz"}, opts...); err == nil {
+		t.Error("VerifyImageBundle() with the wrong annotations, wanted error")
+	}
+	other := bundle(v1.Hash{Algorithm: "sha256", Hex: "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"})
+	if _, err := VerifyImageBundle(ref, other, pub, nil, true, nil, opts...); err == nil {
+		t.Error("VerifyImageBundle() of another image's bundle, wanted error")
+	}
+	blob := []byte("blob")
+	blobBundle, err := NewBundle(pub, blob, ed25519.Sign(priv, blob))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyImageBundle(ref, blobBundle, pub, nil, true, nil, opts...); err == nil {
+		t.Error("VerifyImageBundle() without an envelope, wanted error")
+	}
+
+	// With a tlog entry, its SET has to verify with the Rekor key.
+	payload, err := base64.StdEncoding.DecodeString(b.DSSEEnvelope.Payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, err := base64.StdEncoding.DecodeString(b.DSSEEnvelope.Signatures[0].Sig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, err := NewLogEntry(PAE(b.DSSEEnvelope.PayloadType, payload), signature, pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	te, err := NewTlogEntry(rekorBundle(t, rekorKey, entry, 7))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.VerificationMaterial.TlogEntries = []TlogEntry{te}
+	if _, err := VerifyImageBundle(ref, b, pub, nil, true, nil, opts...); err == nil {
+		t.Error("VerifyImageBundle() with tlog entries and no Rekor key, wanted error")
+	}
+	otherRekorKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyImageBundle(ref, b, pub, &otherRekorKey.PublicKey, true, nil, opts...); err == nil {
+		t.Error("VerifyImageBundle() with the wrong Rekor key, wanted error")
+	}
+	res, err = VerifyImageBundle(ref, b, pub, &rekorKey.PublicKey, true, nil, opts...)
+	if err != nil {
+		t.Fatalf("VerifyImageBundle() with a tlog entry = %v", err)
+	}
+	if !res.Logged {
+		t.Error("VerifyImageBundle() with a tlog entry, wanted it logged")
+	}
+}
@@ -0,0 +1,115 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cosign
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// KeyProvider loads the public key that keyRef refers to. It can return any
+// type of key, such as one in a KMS; the ones only ed25519 keys make sense
+// for, such as LoadPublicKey, reject the others.
+type KeyProvider func(keyRef string) (crypto.PublicKey, error)
+
+// KeyProviderRegistry loads keys with the KeyProvider registered for the
+// scheme of their reference, such as kms:// or pkcs11:, which is passed the
+// reference whole, scheme and all. It's safe for concurrent use, and its Load
+// method is a KeyProvider itself.
+type KeyProviderRegistry struct {
+	mu        sync.RWMutex
+	providers map[string]KeyProvider
+}
+
+// NewKeyProviderRegistry returns a registry without any providers.
+func NewKeyProviderRegistry() *KeyProviderRegistry {
+	return &KeyProviderRegistry{providers: map[string]KeyProvider{}}
+}
+
+// DefaultKeyProviders is the registry LoadPublicKey loads keys with. It has
+// the built-in providers: file: for PEM encoded files, and one for references
+// without a scheme, see LoadPublicKey.
+var DefaultKeyProviders = NewKeyProviderRegistry()
+
+func init() {
+	DefaultKeyProviders.Register("", ed25519Provider(loadLocalPublicKey))
+	DefaultKeyProviders.Register("file", ed25519Provider(loadFilePublicKey))
+}
+
+// ed25519Provider is the KeyProvider for load, which only loads ed25519 keys.
+func ed25519Provider(load KeyLoader) KeyProvider {
+	return func(keyRef string) (crypto.PublicKey, error) {
+		key, err := load(keyRef)
+		if err != nil {
+			return nil, err
+		}
+		return key, nil
+	}
+}
+
+// loadFilePublicKey loads the PEM encoded key at the path of a file: URL,
+// either file://path, file:///absolute/path or file:path.
+func loadFilePublicKey(keyRef string) (ed25519.PublicKey, error) {
+	path := strings.TrimPrefix(keyRef[len("file:"):], "//")
+	if path == "" {
+		return nil, fmt.Errorf("%q has no path", keyRef)
+	}
+	return loadPEMPublicKey(path)
+}
+
+// Register makes Load use provider for references with scheme, replacing any
+// provider already registered for it. The provider for the empty scheme loads
+// references without one.
+func (r *KeyProviderRegistry) Register(scheme string, provider KeyProvider) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.providers[strings.ToLower(scheme)] = provider
+}
+
+// Load loads the key keyRef refers to with the provider registered for its
+// scheme: whatever comes before the first colon. References with a scheme no
+// provider is registered for are loaded by the provider for the empty scheme,
+// unless they are URLs (scheme://...), which are an error.
+func (r *KeyProviderRegistry) Load(keyRef string) (crypto.PublicKey, error) {
+	scheme := ""
+	if i := strings.Index(keyRef, ":"); i > 0 {
+		scheme = strings.ToLower(keyRef[:i])
+	}
+	r.mu.RLock()
+	p, ok := r.providers[scheme]
+	if !ok {
+		if strings.HasPrefix(keyRef[len(scheme):], "://") {
+			r.mu.RUnlock()
+			return nil, fmt.Errorf("no key provider for %s:// keys", scheme)
+		}
+		p, ok = r.providers[""]
+	}
+	r.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("no key provider for %q", keyRef)
+	}
+	return p(keyRef)
+}
+
+// RegisterKeyProvider registers provider for scheme in DefaultKeyProviders.
+// Providers for KMSs and the like call it from an init function.
+func RegisterKeyProvider(scheme string, provider KeyProvider) {
+	DefaultKeyProviders.Register(scheme, provider)
+}
@@ -0,0 +1,129 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cosign
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestKeyProviderRegistry(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewKeyProviderRegistry()
+	if _, err := r.Load(hex.EncodeToString(pub)); err == nil {
+		t.Error("Load() without any providers, wanted error")
+	}
+
+	loaded := ""
+	r.Register("", ed25519Provider(loadLocalPublicKey))
+	r.Register("TEST", func(keyRef string) (crypto.PublicKey, error) {
+		loaded = keyRef
+		return pub, nil
+	})
+	r.Register("pkcs11", func(string) (crypto.PublicKey, error) {
+		return nil, errors.New("no token")
+	})
+
+	for _, keyRef := range []string{"test://key/1", "Test:key"} {
+		got, err := r.Load(keyRef)
+		if err != nil {
+			t.Fatalf("Load(%q) = %v", keyRef, err)
+		}
+		if !pub.Equal(got) || loaded != keyRef {
+			t.Errorf("Load(%q) = %x, loaded %q, wanted the test provider's key", keyRef, got, loaded)
+		}
+	}
+	if _, err := r.Load("pkcs11:token=cosign"); err == nil {
+		t.Error("Load() with a failing provider, wanted error")
+	}
+	// URLs need a provider for their scheme.
+	if _, err := r.Load("kms://projects/p/keys/k"); err == nil {
+		t.Error("Load() of a scheme without a provider, wanted error")
+	}
+	// Anything else goes to the provider without a scheme.
+	got, err := r.Load(hex.EncodeToString(pub))
+	if err != nil {
+		t.Fatalf("Load() = %v", err)
+	}
+	if !pub.Equal(got) {
+		t.Errorf("Load() = %x, wanted %x", got, pub)
+	}
+
+	// Providers can return keys of any type.
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Register("ecdsa", func(string) (crypto.PublicKey, error) {
+		return &ecKey.PublicKey, nil
+	})
+	if got, err := r.Load("ecdsa:key"); err != nil || !ecKey.PublicKey.Equal(got) {
+		t.Errorf("Load() = %v, %v, wanted the ecdsa key", got, err)
+	}
+}
+
+func TestLoadPublicKeyNotEd25519(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	RegisterKeyProvider("test-ecdsa", func(string) (crypto.PublicKey, error) {
+		return &ecKey.PublicKey, nil
+	})
+	if _, err := LoadPublicKey("test-ecdsa:key"); err == nil {
+		t.Error("LoadPublicKey() of an ecdsa key, wanted error")
+	}
+}
+
+func TestLoadFilePublicKey(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := MarshalPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "cosign.pub")
+	if err := ioutil.WriteFile(path, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, keyRef := range []string{"file://" + path, "file:" + path, "FILE:" + path} {
+		got, err := LoadPublicKey(keyRef)
+		if err != nil {
+			t.Fatalf("LoadPublicKey(%q) = %v", keyRef, err)
+		}
+		if !got.Equal(pub) {
+			t.Errorf("LoadPublicKey(%q) = %x, wanted %x", keyRef, got, pub)
+		}
+	}
+	if _, err := LoadPublicKey("file://"); err == nil {
+		t.Error("LoadPublicKey() without a path, wanted error")
+	}
+}
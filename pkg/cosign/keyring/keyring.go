@@ -0,0 +1,59 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package keyring stores cosign private keys in the OS keychain: the login
+// keychain on macOS, the Secret Service (libsecret) on Linux, and files
+// encrypted with DPAPI on Windows.
+package keyring
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// Service is what keys are stored under in the keychain, along with their
+// names.
+const Service = "cosign"
+
+// ErrUnavailable is returned when there is no keychain cosign can use, e.g.
+// because the tool it talks to it with isn't installed.
+var ErrUnavailable = errors.New("OS keychain not available")
+
+// ErrNotFound is returned by Get when there is no key with the name.
+var ErrNotFound = errors.New("key not found in the OS keychain")
+
+// Get returns the private key stored as name.
+func Get(name string) (ed25519.PrivateKey, error) {
+	secret, err := get(name)
+	if err != nil {
+		return nil, err
+	}
+	b, err := base64.StdEncoding.DecodeString(string(secret))
+	if err != nil || len(b) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("%s in the OS keychain isn't an ed25519 private key", name)
+	}
+	return ed25519.PrivateKey(b), nil
+}
+
+// Set stores pk as name, replacing any key already stored as name.
+func Set(name string, pk ed25519.PrivateKey) error {
+	if name == "" {
+		return errors.New("keychain key name is empty")
+	}
+	return set(name, []byte(base64.StdEncoding.EncodeToString(pk)))
+}
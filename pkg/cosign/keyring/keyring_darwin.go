@@ -0,0 +1,61 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keyring
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// The security tool exits with 44 when an item isn't in the keychain.
+const errSecItemNotFound = 44
+
+func get(name string) ([]byte, error) {
+	if _, err := exec.LookPath("security"); err != nil {
+		return nil, ErrUnavailable
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command("security", "find-generic-password", "-s", Service, "-a", name, "-w")
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if ee, ok := err.(*exec.ExitError); ok && ee.ExitCode() == errSecItemNotFound {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("security find-generic-password: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return bytes.TrimSpace(out), nil
+}
+
+func set(name string, secret []byte) error {
+	if _, err := exec.LookPath("security"); err != nil {
+		return ErrUnavailable
+	}
+	// The command is read from stdin, to keep the secret out of the process
+	// arguments.
+	var stderr bytes.Buffer
+	cmd := exec.Command("security", "-i")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s %s -a %s -w %s\n",
+		strconv.Quote(Service), strconv.Quote(name), secret))
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil || stderr.Len() != 0 {
+		return fmt.Errorf("security add-generic-password: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
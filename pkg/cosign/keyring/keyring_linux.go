@@ -0,0 +1,59 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keyring
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// secret-tool is the libsecret command line tool, talking to the Secret
+// Service, e.g. GNOME Keyring or KWallet.
+
+func get(name string) ([]byte, error) {
+	if _, err := exec.LookPath("secret-tool"); err != nil {
+		return nil, ErrUnavailable
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command("secret-tool", "lookup", "service", Service, "name", name)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if stderr.Len() == 0 {
+			// secret-tool fails silently when nothing matches.
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("secret-tool lookup: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return bytes.TrimSpace(out), nil
+}
+
+func set(name string, secret []byte) error {
+	if _, err := exec.LookPath("secret-tool"); err != nil {
+		return ErrUnavailable
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command("secret-tool", "store", "--label", "cosign private key "+name, "service", Service, "name", name)
+	cmd.Stdin = bytes.NewReader(secret)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("secret-tool store: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
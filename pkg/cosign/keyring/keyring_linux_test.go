@@ -0,0 +1,89 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keyring
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fakeSecretTool is a secret-tool that stores secrets in files next to it,
+// named after the last argument.
+const fakeSecretTool = `#!/bin/sh
+dir=$(dirname "$0")/store
+eval name=\$$#
+case "$1" in
+store) mkdir -p "$dir" && cat > "$dir/$name" ;;
+lookup) cat "$dir/$name" 2>/dev/null ;;
+*) echo "unknown command $1" >&2; exit 2 ;;
+esac
+`
+
+func setPath(t *testing.T, path string) {
+	t.Helper()
+	old := os.Getenv("PATH")
+	t.Cleanup(func() { os.Setenv("PATH", old) })
+	if err := os.Setenv("PATH", path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestKeyring(t *testing.T) {
+	_, pk, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := os.Getenv("PATH")
+	setPath(t, t.TempDir())
+	if err := Set("test", pk); err != ErrUnavailable {
+		t.Errorf("Set() without secret-tool = %v, wanted ErrUnavailable", err)
+	}
+	if _, err := Get("test"); err != ErrUnavailable {
+		t.Errorf("Get() without secret-tool = %v, wanted ErrUnavailable", err)
+	}
+
+	bin := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(bin, "secret-tool"), []byte(fakeSecretTool), 0700); err != nil { // #nosec G306
+		t.Fatal(err)
+	}
+	setPath(t, bin+string(os.PathListSeparator)+path)
+	if _, err := Get("test"); err != ErrNotFound {
+		t.Errorf("Get() before Set() = %v, wanted ErrNotFound", err)
+	}
+	if err := Set("test", pk); err != nil {
+		t.Fatalf("Set() = %v", err)
+	}
+	got, err := Get("test")
+	if err != nil {
+		t.Fatalf("Get() = %v", err)
+	}
+	if !got.Equal(pk) {
+		t.Error("Get() returned another key than was Set()")
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(bin, "store", "garbage"), []byte("not a key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Get("garbage"); err == nil {
+		t.Error("Get() of something that isn't a key, wanted error")
+	}
+}
@@ -0,0 +1,108 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package keyring
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+// Windows has no keychain for arbitrary secrets that's easy to get at, so
+// keys are kept in files encrypted with DPAPI, which only the current user
+// can decrypt.
+
+var (
+	crypt32                = syscall.NewLazyDLL("crypt32.dll")
+	kernel32               = syscall.NewLazyDLL("kernel32.dll")
+	procCryptProtectData   = crypt32.NewProc("CryptProtectData")
+	procCryptUnprotectData = crypt32.NewProc("CryptUnprotectData")
+	procLocalFree          = kernel32.NewProc("LocalFree")
+)
+
+const cryptProtectUIForbidden = 0x1
+
+type dataBlob struct {
+	size uint32
+	data *byte
+}
+
+func newBlob(b []byte) *dataBlob {
+	if len(b) == 0 {
+		return &dataBlob{}
+	}
+	return &dataBlob{size: uint32(len(b)), data: &b[0]}
+}
+
+func (b *dataBlob) bytes() []byte {
+	out := make([]byte, b.size)
+	copy(out, (*[1 << 30]byte)(unsafe.Pointer(b.data))[:b.size:b.size])
+	return out
+}
+
+func dpapi(proc *syscall.LazyProc, in []byte) ([]byte, error) {
+	if err := proc.Find(); err != nil {
+		return nil, ErrUnavailable
+	}
+	var out dataBlob
+	r, _, err := proc.Call(uintptr(unsafe.Pointer(newBlob(in))), 0, 0, 0, 0, cryptProtectUIForbidden, uintptr(unsafe.Pointer(&out)))
+	if r == 0 {
+		return nil, fmt.Errorf("%s: %v", proc.Name, err)
+	}
+	defer procLocalFree.Call(uintptr(unsafe.Pointer(out.data)))
+	return out.bytes(), nil
+}
+
+func path(name string) (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, Service, "keyring", filepath.Base(name)+".dpapi"), nil
+}
+
+func get(name string) ([]byte, error) {
+	p, err := path(name)
+	if err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadFile(p)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return dpapi(procCryptUnprotectData, b)
+}
+
+func set(name string, secret []byte) error {
+	p, err := path(name)
+	if err != nil {
+		return err
+	}
+	b, err := dpapi(procCryptProtectData, secret)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(p, b, 0600)
+}
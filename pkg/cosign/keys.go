@@ -1,9 +1,12 @@
 package cosign
 
 import (
+	"crypto"
 	"crypto/ed25519"
 	"crypto/rand"
+	"crypto/sha256"
 	"crypto/x509"
+	"encoding/hex"
 	"encoding/pem"
 
 	"github.com/theupdateframework/go-tuf/encrypted"
@@ -16,7 +19,39 @@ type Keys struct {
 	PublicBytes  []byte
 }
 
+// GenerateKeyPair generates an ed25519 key pair, encrypting the private key
+// with scrypt.
 func GenerateKeyPair(pf PassFunc) (*Keys, error) {
+	return generateKeyPair(pf, EncryptPrivateKey)
+}
+
+// GenerateKeyPairArgon2 generates an ed25519 key pair, encrypting the private
+// key with argon2id.
+func GenerateKeyPairArgon2(pf PassFunc, params Argon2Params) (*Keys, error) {
+	// Check before asking for the password.
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+	return generateKeyPair(pf, func(priv, pass []byte) ([]byte, error) {
+		return EncryptPrivateKeyArgon2(priv, pass, params)
+	})
+}
+
+// EncryptPrivateKey encrypts priv with a key derived from pass using scrypt,
+// and returns it PEM encoded.
+func EncryptPrivateKey(priv, pass []byte) ([]byte, error) {
+	encBytes, err := encrypted.Encrypt(priv, pass)
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{
+		Bytes: encBytes,
+		Type:  pemType,
+	}), nil
+}
+
+func generateKeyPair(pf PassFunc, encrypt func(priv, pass []byte) ([]byte, error)) (*Keys, error) {
 	pub, priv, err := ed25519.GenerateKey(rand.Reader)
 	if err != nil {
 		return nil, err
@@ -28,29 +63,42 @@ func GenerateKeyPair(pf PassFunc) (*Keys, error) {
 		return nil, err
 	}
 
-	encBytes, err := encrypted.Encrypt(priv, password)
+	privBytes, err := encrypt(priv, password)
 	if err != nil {
 		return nil, err
 	}
 
-	privBytes := pem.EncodeToMemory(&pem.Block{
-		Bytes: encBytes,
-		Type:  "ENCRYPTED COSIGN PRIVATE KEY",
-	})
-
-	b, err := x509.MarshalPKIXPublicKey(pub)
+	// Now do the public key
+	pubBytes, err := MarshalPublicKey(pub)
 	if err != nil {
 		return nil, err
 	}
 
-	// Now do the public key
-	pubBytes := pem.EncodeToMemory(&pem.Block{
-		Type:  "PUBLIC KEY",
-		Bytes: b,
-	})
-
 	return &Keys{
 		PrivateBytes: privBytes,
 		PublicBytes:  pubBytes,
 	}, nil
 }
+
+// MarshalPublicKey returns pub PEM encoded, the way LoadPublicKey reads it.
+func MarshalPublicKey(pub crypto.PublicKey) ([]byte, error) {
+	b, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  pubKeyPemType,
+		Bytes: b,
+	}), nil
+}
+
+// PublicKeyFingerprint identifies pub: it is the hex encoded sha256 of the
+// DER (PKIX) encoded key.
+func PublicKeyFingerprint(pub crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.Sum256(der)
+	return hex.EncodeToString(h[:]), nil
+}
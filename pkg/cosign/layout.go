@@ -0,0 +1,329 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cosign
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/match"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/sigstore/cosign/pkg/cosign/oci"
+)
+
+// refNameAnnotation names the manifests in an OCI image layout's index.json.
+const refNameAnnotation = "org.opencontainers.image.ref.name"
+
+// SignOCILayout signs every image in the OCI image layout at layoutPath with
+// the private key at keyPath, and writes the signatures back into the layout.
+// Signatures are stored like they are in a registry: as an image named with
+// the signature tag of the image they sign (see oci.MakeSignatureTag). Pushing
+// every manifest in the layout to a repository, tagged with its name, pushes
+// the signatures along with the images.
+func SignOCILayout(layoutPath, keyPath string, annotations map[string]string, pf PassFunc) error {
+	p, err := layout.FromPath(layoutPath)
+	if err != nil {
+		return err
+	}
+	ii, err := p.ImageIndex()
+	if err != nil {
+		return err
+	}
+	im, err := ii.IndexManifest()
+	if err != nil {
+		return err
+	}
+
+	kb, err := ioutil.ReadFile(keyPath)
+	if err != nil {
+		return err
+	}
+	pass, err := pf(false)
+	if err != nil {
+		return err
+	}
+	priv, err := LoadPrivateKey(kb, pass)
+	if err != nil {
+		return err
+	}
+
+	signed := 0
+	for _, desc := range im.Manifests {
+		if !isLayoutSubject(desc) {
+			continue
+		}
+		payload, err := oci.Payload(desc, annotations)
+		if err != nil {
+			return err
+		}
+		signature := ed25519.Sign(priv, payload)
+		if err := writeLayoutSignature(p, desc, signature, payload); err != nil {
+			return err
+		}
+		signed++
+	}
+	if signed == 0 {
+		return fmt.Errorf("no images to sign in %s", layoutPath)
+	}
+	return nil
+}
+
+// writeLayoutSignature adds signature to the signature image of desc in p,
+// creating it if there isn't one yet.
+func writeLayoutSignature(p layout.Path, desc v1.Descriptor, signature, payload []byte) error {
+	tag, err := oci.MakeSignatureTag(desc)
+	if err != nil {
+		return err
+	}
+	layers, err := layoutSignatureLayers(p, tag)
+	if err != nil {
+		return err
+	}
+	adds := []mutate.Addendum{}
+	for _, l := range layers {
+		b, err := p.Bytes(l.Digest)
+		if err != nil {
+			return err
+		}
+		adds = append(adds, mutate.Addendum{
+			Layer:       oci.StaticLayer(b, l.MediaType),
+			Annotations: l.Annotations,
+		})
+	}
+	img, err := mutate.Append(empty.Image, append(adds, oci.SignatureAddendum(signature, payload, oci.SimpleSigningMediaType))...)
+	if err != nil {
+		return err
+	}
+	return p.ReplaceImage(img, match.Name(tag), layout.WithAnnotations(map[string]string{
+		refNameAnnotation: tag,
+	}))
+}
+
+// layoutSignatureLayers returns the layers of the signature image named tag
+// in p, if there is one.
+// The layout package can only read gzipped layers, so callers read them as
+// blobs.
+func layoutSignatureLayers(p layout.Path, tag string) ([]v1.Descriptor, error) {
+	ii, err := p.ImageIndex()
+	if err != nil {
+		return nil, err
+	}
+	im, err := ii.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+	for _, desc := range im.Manifests {
+		if !match.Name(tag)(desc) {
+			continue
+		}
+		img, err := p.Image(desc.Digest)
+		if err != nil {
+			return nil, err
+		}
+		m, err := img.Manifest()
+		if err != nil {
+			return nil, err
+		}
+		return m.Layers, nil
+	}
+	return nil, nil
+}
+
+// ExportOCILayout writes the image or index ref points at to the OCI image
+// layout at layoutPath, creating it if it doesn't exist, along with the
+// signature images of it and, for an index, of its manifests. It's laid out
+// like SignOCILayout lays out signatures, so VerifyOCILayout can check the
+// signatures without the registry. Images already in the layout with the same
+// name are replaced. The image is named with its tag, if ref is a tag.
+func ExportOCILayout(ref name.Reference, layoutPath string, ro oci.RegistryOptions) error {
+	p, err := layout.FromPath(layoutPath)
+	if err != nil {
+		if p, err = layout.Write(layoutPath, empty.Index); err != nil {
+			return err
+		}
+	}
+	c := ro.Remote()
+	desc, err := c.Get(ref)
+	if err != nil {
+		return err
+	}
+	matcher, opts := match.Digests(desc.Digest), []layout.Option{}
+	if t, ok := ref.(name.Tag); ok {
+		matcher = match.Name(t.TagStr())
+		opts = append(opts, layout.WithAnnotations(map[string]string{refNameAnnotation: t.TagStr()}))
+	}
+
+	subjects := []v1.Descriptor{desc}
+	if desc.MediaType.IsIndex() {
+		idx, err := c.Index(ref)
+		if err != nil {
+			return err
+		}
+		im, err := idx.IndexManifest()
+		if err != nil {
+			return err
+		}
+		subjects = append(subjects, im.Manifests...)
+		if err := p.ReplaceIndex(idx, matcher, opts...); err != nil {
+			return err
+		}
+	} else {
+		img, err := c.Image(ref)
+		if err != nil {
+			return err
+		}
+		if err := p.ReplaceImage(img, matcher, opts...); err != nil {
+			return err
+		}
+	}
+
+	for _, s := range subjects {
+		tag, err := oci.MakeSignatureTag(s)
+		if err != nil {
+			return err
+		}
+		sig, err := c.Image(ref.Context().Tag(tag))
+		if te, ok := err.(*transport.Error); ok && te.StatusCode == http.StatusNotFound {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if err := p.ReplaceImage(sig, match.Name(tag), layout.WithAnnotations(map[string]string{
+			refNameAnnotation: tag,
+		})); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IsOCILayout reports whether path is an OCI image layout directory.
+func IsOCILayout(path string) bool {
+	fi, err := os.Stat(filepath.Join(path, "oci-layout"))
+	return err == nil && !fi.IsDir()
+}
+
+// FetchSignaturesFromLayout returns the signatures of every image in the OCI
+// image layout at layoutPath, as written by SignOCILayout, keyed by the
+// digest of the image they sign.
+func FetchSignaturesFromLayout(layoutPath string) (map[v1.Hash][]oci.SignedPayload, error) {
+	p, err := layout.FromPath(layoutPath)
+	if err != nil {
+		return nil, err
+	}
+	ii, err := p.ImageIndex()
+	if err != nil {
+		return nil, err
+	}
+	im, err := ii.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+
+	signatures := map[v1.Hash][]oci.SignedPayload{}
+	for _, desc := range im.Manifests {
+		if !isLayoutSubject(desc) {
+			continue
+		}
+		tag, err := oci.MakeSignatureTag(desc)
+		if err != nil {
+			return nil, err
+		}
+		layers, err := layoutSignatureLayers(p, tag)
+		if err != nil {
+			return nil, err
+		}
+		sps := []oci.SignedPayload{}
+		for _, l := range layers {
+			base64sig, ok := l.Annotations[oci.SignatureAnnotationKey]
+			if !ok {
+				continue
+			}
+			payload, err := p.Bytes(l.Digest)
+			if err != nil {
+				return nil, err
+			}
+			sps = append(sps, oci.SignedPayload{
+				Payload:         payload,
+				Base64Signature: base64sig,
+				MediaType:       l.MediaType,
+			})
+		}
+		signatures[desc.Digest] = sps
+	}
+	if len(signatures) == 0 {
+		return nil, fmt.Errorf("no images in %s", layoutPath)
+	}
+	return signatures, nil
+}
+
+// VerifyOCILayout verifies every image in the OCI image layout at layoutPath,
+// like Verify does for an image in a registry. Every image has to verify.
+// Without fail-fast, what did verify is returned along with a VerifyErrors.
+func VerifyOCILayout(layoutPath string, pubKey ed25519.PublicKey, checkClaims bool, annotations map[string]string, opts ...VerifyOption) ([]oci.SignedPayload, error) {
+	o := newVerifyOpts(opts)
+	signatures, err := FetchSignaturesFromLayout(layoutPath)
+	if err != nil {
+		return nil, err
+	}
+
+	digests := []v1.Hash{}
+	for h := range signatures {
+		digests = append(digests, h)
+	}
+	sort.Slice(digests, func(i, j int) bool { return digests[i].String() < digests[j].String() })
+
+	verified := []oci.SignedPayload{}
+	errs := VerifyErrors{}
+	for _, h := range digests {
+		if len(signatures[h]) == 0 {
+			errs = append(errs, fmt.Errorf("%s: no signatures found", h))
+		} else if sps, err := verifySignatures(pubKey, h.Hex, checkClaims, annotations, signatures[h], o); err != nil {
+			verified = append(verified, sps...)
+			errs = append(errs, fmt.Errorf("%s: %v", h, err))
+		} else {
+			verified = append(verified, sps...)
+		}
+		if len(errs) != 0 && o.failFast {
+			return nil, errs[0]
+		}
+	}
+	if len(errs) != 0 {
+		return verified, errs
+	}
+	return verified, nil
+}
+
+// isLayoutSubject reports whether desc is an image, or index, in a layout
+// that can be signed, rather than a signature.
+func isLayoutSubject(desc v1.Descriptor) bool {
+	if !desc.MediaType.IsImage() && !desc.MediaType.IsIndex() {
+		return false
+	}
+	return !strings.HasSuffix(desc.Annotations[refNameAnnotation], oci.SignatureTagSuffix)
+}
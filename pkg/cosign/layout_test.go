@@ -0,0 +1,193 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cosign
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/sigstore/cosign/pkg/cosign/oci"
+)
+
+func TestSignOCILayout(t *testing.T) {
+	td := t.TempDir()
+	layoutPath := filepath.Join(td, "layout")
+	p, err := layout.Write(layoutPath, empty.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := random.Image(512, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.AppendImage(img); err != nil {
+		t.Fatal(err)
+	}
+	h, err := img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !IsOCILayout(layoutPath) {
+		t.Errorf("IsOCILayout(%s) = false", layoutPath)
+	}
+	if IsOCILayout(td) {
+		t.Errorf("IsOCILayout(%s) = true", td)
+	}
+
+	keys, err := GenerateKeyPair(pass("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPath := filepath.Join(td, "cosign.key")
+	if err := ioutil.WriteFile(keyPath, keys.PrivateBytes, 0600); err != nil {
+		t.Fatal(err)
+	}
+	pubPath := filepath.Join(td, "cosign.pub")
+	if err := ioutil.WriteFile(pubPath, keys.PublicBytes, 0600); err != nil {
+		t.Fatal(err)
+	}
+	pub, err := LoadPublicKey(pubPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := VerifyOCILayout(layoutPath, pub, true, nil); err == nil {
+		t.Error("VerifyOCILayout() before signing, wanted error")
+	}
+
+	// Signing twice should add a second signature to the same signature image.
+	for i := 0; i < 2; i++ {
+		if err := SignOCILayout(layoutPath, keyPath, map[string]string{"foo": "bar"}, pass("hello")); err != nil {
+			t.Fatalf("SignOCILayout() = %v", err)
+		}
+	}
+
+	ii, err := p.ImageIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	im, err := ii.IndexManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(im.Manifests) != 2 {
+		t.Fatalf("got %d manifests, wanted the image and its signatures", len(im.Manifests))
+	}
+	sigDesc := im.Manifests[1]
+	wantTag := "sha256-" + h.Hex + ".cosign"
+	if got := sigDesc.Annotations[refNameAnnotation]; got != wantTag {
+		t.Errorf("signature image named %q, wanted %q", got, wantTag)
+	}
+
+	sigImg, err := p.Image(sigDesc.Digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := sigImg.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Layers) != 2 {
+		t.Fatalf("got %d signatures, wanted 2", len(m.Layers))
+	}
+	for _, desc := range m.Layers {
+		payload, err := p.Bytes(desc.Digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := VerifySignature(pub, desc.Annotations[oci.SignatureAnnotationKey], payload); err != nil {
+			t.Errorf("VerifySignature() = %v", err)
+		}
+		if _, err := verifyClaims(h.Hex, map[string]string{"foo": "bar"}, []oci.SignedPayload{{Payload: payload}}, &verifyOpts{}); err != nil {
+			t.Errorf("verifyClaims() = %v", err)
+		}
+	}
+
+	verified, err := VerifyOCILayout(layoutPath, pub, true, map[string]string{"foo": "bar"})
+	if err != nil {
+		t.Fatalf("VerifyOCILayout() = %v", err)
+	}
+	if len(verified) != 2 {
+		t.Errorf("VerifyOCILayout() = %d signatures, wanted 2", len(verified))
+	}
+	if _, err := VerifyOCILayout(layoutPath, pub, true, map[string]string{"foo": "baz"}); err == nil {
+		t.Error("VerifyOCILayout() with the wrong annotations, wanted error")
+	}
+}
+
+func TestExportOCILayout(t *testing.T) {
+	ro, ref, h := writeRandomImage(t, "export:v1")
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	layoutPath := filepath.Join(t.TempDir(), "layout")
+
+	// Without signatures, only the image is written.
+	if err := ExportOCILayout(ref, layoutPath, ro); err != nil {
+		t.Fatalf("ExportOCILayout() = %v", err)
+	}
+	if _, err := VerifyOCILayout(layoutPath, pub, true, nil); err == nil {
+		t.Error("VerifyOCILayout() of an unsigned image, wanted error")
+	}
+
+	payload, err := oci.Payload(v1.Descriptor{Digest: h}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := oci.Upload(ed25519.Sign(priv, payload), payload, ref.Context().Tag(oci.Munge(v1.Descriptor{Digest: h})), oci.UploadRegistryOptions(ro)); err != nil {
+		t.Fatal(err)
+	}
+	if err := ExportOCILayout(ref, layoutPath, ro); err != nil {
+		t.Fatalf("ExportOCILayout() = %v", err)
+	}
+	sps, err := VerifyOCILayout(layoutPath, pub, true, nil)
+	if err != nil {
+		t.Fatalf("VerifyOCILayout() = %v", err)
+	}
+	if len(sps) != 1 {
+		t.Errorf("VerifyOCILayout() verified %d signatures, want 1", len(sps))
+	}
+
+	// Exporting again replaces what's there rather than adding to it.
+	p, err := layout.FromPath(layoutPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ii, err := p.ImageIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	im, err := ii.IndexManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(im.Manifests) != 2 {
+		t.Errorf("layout has %d manifests, want the image and its signatures", len(im.Manifests))
+	}
+	if got := im.Manifests[0].Annotations[refNameAnnotation]; got != "v1" {
+		t.Errorf("image is named %q, want v1", got)
+	}
+}
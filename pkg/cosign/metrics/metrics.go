@@ -0,0 +1,104 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package metrics has the Prometheus metrics cosign records, for when it runs
+// as part of a service, e.g. an admission controller. They are registered
+// with the default Prometheus registry.
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	// SignDuration is how long signing an image takes, from generating its
+	// payload to storing the signature.
+	SignDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name: "cosign_sign_duration_seconds",
+		Help: "How long signing an image takes.",
+	})
+
+	// VerifyDuration is how long verifying the signatures of an image takes.
+	VerifyDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name: "cosign_verify_duration_seconds",
+		Help: "How long verifying the signatures of an image takes.",
+	})
+
+	// RegistryRequests counts the registry operations, by the operation and
+	// its status: ok, the HTTP status code the registry failed it with, or
+	// error.
+	RegistryRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "cosign_registry_request_total",
+		Help: "Registry operations, by operation and status.",
+	}, []string{"operation", "status"})
+
+	// RegistryDuration is how long the registry operations take.
+	RegistryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "cosign_registry_request_duration_seconds",
+		Help: "How long registry operations take, by operation.",
+	}, []string{"operation"})
+
+	// TLogLookupDuration is how long looking up an entry in the transparency
+	// log takes.
+	TLogLookupDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name: "cosign_tlog_lookup_duration_seconds",
+		Help: "How long transparency log lookups take.",
+	})
+)
+
+// The operations RegistryRequests and RegistryDuration are labeled with.
+const (
+	OperationUpload          = "upload"
+	OperationFetchSignatures = "fetch_signatures"
+)
+
+// ObserveSince records the time since start in o, e.g. with
+//
+//	defer metrics.ObserveSince(metrics.SignDuration, time.Now())
+func ObserveSince(o prometheus.Observer, start time.Time) {
+	o.Observe(time.Since(start).Seconds())
+}
+
+// ObserveRegistry records a registry operation that started at start and
+// ended with err.
+func ObserveRegistry(operation string, start time.Time, err error) {
+	ObserveSince(RegistryDuration.WithLabelValues(operation), start)
+	RegistryRequests.WithLabelValues(operation, status(err)).Inc()
+}
+
+func status(err error) string {
+	if err == nil {
+		return "ok"
+	}
+	var te *transport.Error
+	if errors.As(err, &te) {
+		return strconv.Itoa(te.StatusCode)
+	}
+	return "error"
+}
+
+// Handler serves the metrics for Prometheus to scrape.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
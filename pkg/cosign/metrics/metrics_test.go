@@ -0,0 +1,63 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestObserveRegistry(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want string
+	}{
+		{nil, "ok"},
+		{errors.New("connection refused"), "error"},
+		{&transport.Error{StatusCode: http.StatusNotFound}, "404"},
+		{fmt.Errorf("wrapped: %w", &transport.Error{StatusCode: http.StatusUnauthorized}), "401"},
+	} {
+		c := RegistryRequests.WithLabelValues("test", tc.want)
+		before := testutil.ToFloat64(c)
+		ObserveRegistry("test", time.Now(), tc.err)
+		if got := testutil.ToFloat64(c) - before; got != 1 {
+			t.Errorf("ObserveRegistry(%v) counted %v requests with status %s, wanted 1", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	ObserveSince(SignDuration, time.Now())
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /metrics = %d", rec.Code)
+	}
+	for _, name := range []string{"cosign_sign_duration_seconds", "cosign_registry_request_total"} {
+		if !strings.Contains(rec.Body.String(), name) {
+			t.Errorf("GET /metrics doesn't have %s", name)
+		}
+	}
+}
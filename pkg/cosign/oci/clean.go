@@ -0,0 +1,78 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oci
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+// CleanSignatures deletes every signature of the image ref points at: the
+// signature tag, and any signatures stored as referrers.
+func CleanSignatures(ctx context.Context, ref name.Reference, ro RegistryOptions) error {
+	c := ro.remote(ctx)
+	desc, err := c.Get(ref)
+	if err != nil {
+		return err
+	}
+
+	toDelete := []name.Reference{}
+	sigTag := ref.Context().Tag(Munge(desc))
+	sigDesc, err := c.Get(sigTag)
+	if err == nil {
+		// Registries delete manifests by digest, the tag goes with it.
+		toDelete = append(toDelete, ref.Context().Digest(sigDesc.Digest.String()), sigTag)
+	} else if !hasStatus(err, http.StatusNotFound) {
+		return err
+	}
+
+	refs, _, err := c.Referrers(ref.Context(), desc.Digest)
+	if err != nil {
+		return err
+	}
+	for _, r := range refs {
+		if r.ArtifactType == SignatureArtifactType {
+			toDelete = append(toDelete, ref.Context().Digest(r.Digest.String()))
+		}
+	}
+
+	if len(toDelete) == 0 {
+		return fmt.Errorf("no signatures found for %s", ref)
+	}
+	for _, r := range toDelete {
+		err := c.Delete(r)
+		switch {
+		case err == nil:
+		case hasStatus(err, http.StatusNotFound):
+			// Already gone along with its manifest.
+		case hasStatus(err, http.StatusMethodNotAllowed):
+			return fmt.Errorf("%s doesn't allow deleting manifests, signatures of %s are left in place", ref.Context().RegistryStr(), ref)
+		default:
+			return fmt.Errorf("deleting %s: %v", r, err)
+		}
+	}
+	return nil
+}
+
+func hasStatus(err error, code int) bool {
+	te, ok := err.(*transport.Error)
+	return ok && te.StatusCode == code
+}
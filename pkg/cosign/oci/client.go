@@ -0,0 +1,101 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package oci stores and fetches cosign signatures in OCI registries. It
+// doesn't sign or verify anything, that is up to package cosign.
+package oci
+
+import (
+	"context"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// Client is what this package needs from a registry. Errors for things that
+// don't exist are a *transport.Error with http.StatusNotFound, like the
+// registry would return.
+type Client interface {
+	// Get returns the descriptor of the manifest ref points at.
+	Get(ref name.Reference) (v1.Descriptor, error)
+	// Image returns the image ref points at.
+	Image(ref name.Reference) (v1.Image, error)
+	// Index returns the index ref points at.
+	Index(ref name.Reference) (v1.ImageIndex, error)
+	// Layer returns the blob ref points at.
+	Layer(ref name.Digest) (v1.Layer, error)
+	// Write uploads img, and its layers, to ref.
+	Write(ref name.Reference, img v1.Image) error
+	// Delete deletes the manifest ref points at.
+	Delete(ref name.Reference) error
+	// List returns the tags in repo.
+	List(repo name.Repository) ([]string, error)
+	// Referrers returns the descriptors of all manifests in repo that have
+	// subject as their subject. The bool is false if the registry doesn't
+	// support the referrers API.
+	Referrers(repo name.Repository, subject v1.Hash) ([]Referrer, bool, error)
+}
+
+// remoteClient talks to registries with the remote package.
+type remoteClient struct {
+	ro   RegistryOptions
+	opts []remote.Option
+}
+
+func newRemoteClient(ctx context.Context, ro RegistryOptions) *remoteClient {
+	ro.Context = ctx
+	return &remoteClient{
+		ro:   ro,
+		opts: append(ro.RemoteOptions(), remote.WithContext(ctx)),
+	}
+}
+
+func (c *remoteClient) Get(ref name.Reference) (v1.Descriptor, error) {
+	desc, err := remote.Get(ref, c.opts...)
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	return desc.Descriptor, nil
+}
+
+func (c *remoteClient) Image(ref name.Reference) (v1.Image, error) {
+	return remote.Image(ref, c.opts...)
+}
+
+func (c *remoteClient) Index(ref name.Reference) (v1.ImageIndex, error) {
+	return remote.Index(ref, c.opts...)
+}
+
+func (c *remoteClient) Layer(ref name.Digest) (v1.Layer, error) {
+	return remote.Layer(ref, c.opts...)
+}
+
+func (c *remoteClient) Write(ref name.Reference, img v1.Image) error {
+	return remote.Write(ref, img, c.opts...)
+}
+
+func (c *remoteClient) Delete(ref name.Reference) error {
+	return remote.Delete(ref, c.opts...)
+}
+
+func (c *remoteClient) List(repo name.Repository) ([]string, error) {
+	return remote.List(repo, c.opts...)
+}
+
+func (c *remoteClient) Referrers(repo name.Repository, subject v1.Hash) ([]Referrer, bool, error) {
+	return remoteReferrers(repo, subject, c.ro)
+}
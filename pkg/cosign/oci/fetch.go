@@ -0,0 +1,336 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oci
+
+import (
+	"crypto"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/sigstore/cosign/pkg/cosign/metrics"
+)
+
+const (
+	// SignatureAnnotationKey is the annotation holding the base64 encoded
+	// signature of the payload in a layer of a signature image.
+	SignatureAnnotationKey = "dev.cosignproject.cosign/signature"
+	// TimestampAnnotationKey is the annotation holding the base64 encoded
+	// RFC 3161 timestamp token countersigning a signature.
+	TimestampAnnotationKey = "dev.cosignproject.cosign/timestamp"
+	// CertificateAnnotationKey is the annotation holding the base64 encoded
+	// PEM of the certificate for the key that made a signature.
+	CertificateAnnotationKey = "dev.cosignproject.cosign/certificate"
+	// ChainAnnotationKey is the annotation holding the base64 encoded PEM of
+	// the certificates between CertificateAnnotationKey and a root, leaf
+	// first.
+	ChainAnnotationKey = "dev.cosignproject.cosign/chain"
+)
+
+// SignedPayload is a signature, and the payload it signs, as stored in a
+// layer of a signature image.
+type SignedPayload struct {
+	Base64Signature string
+	Payload         []byte
+	// Base64Timestamp is the RFC 3161 timestamp token countersigning the
+	// signature, if there is one.
+	Base64Timestamp string `json:",omitempty"`
+	// Base64Certificate is the PEM encoded certificate for the signing key,
+	// and Base64Chain its intermediates, if they were stored with it.
+	Base64Certificate string `json:",omitempty"`
+	Base64Chain       string `json:",omitempty"`
+	// MediaType is the media type of the layer the payload was stored in,
+	// which says how to parse it.
+	MediaType types.MediaType `json:"-"`
+	// PublicKey is the key that verified the signature, once it has: an
+	// ed25519 key, or for signatures with a certificate, its key, which can
+	// also be ECDSA. It is never stored.
+	PublicKey crypto.PublicKey `json:"-"`
+}
+
+// SignatureTagSuffix is appended to the munged digest of an image to get the
+// tag of its signatures.
+const SignatureTagSuffix = ".cosign"
+
+// Munge returns the tag that signatures of desc are stored under, in the same
+// repository as desc. Tags can't contain ":", so the ":" between the algorithm
+// and the hex of the digest is replaced with "-", and ".cosign" is appended.
+// Nothing is truncated or hashed, so Demunge can recover the digest:
+//
+//	sha256:abc123... -> sha256-abc123....cosign
+func Munge(desc v1.Descriptor) string {
+	// sha256:... -> sha256-...
+	munged := strings.ReplaceAll(desc.Digest.String(), ":", "-")
+	munged += SignatureTagSuffix
+	return munged
+}
+
+// Demunge is the inverse of Munge: it returns the digest of the image whose
+// signatures are stored under tag.
+//
+//	sha256-abc123....cosign -> sha256:abc123...
+func Demunge(tag string) (v1.Hash, error) {
+	if !strings.HasSuffix(tag, SignatureTagSuffix) {
+		return v1.Hash{}, fmt.Errorf("not a signature tag: %q", tag)
+	}
+	h, err := v1.NewHash(strings.Replace(strings.TrimSuffix(tag, SignatureTagSuffix), "-", ":", 1))
+	if err != nil {
+		return v1.Hash{}, fmt.Errorf("not a signature tag: %q: %v", tag, err)
+	}
+	return h, nil
+}
+
+// MakeSignatureTag is Munge, but checks that desc has a valid digest first.
+func MakeSignatureTag(desc v1.Descriptor) (string, error) {
+	if _, err := v1.NewHash(desc.Digest.String()); err != nil {
+		return "", err
+	}
+	return Munge(desc), nil
+}
+
+// ParseSignatureTag is the inverse of MakeSignatureTag, see Demunge.
+func ParseSignatureTag(tag string) (v1.Hash, error) {
+	return Demunge(tag)
+}
+
+// FetchResult is what ResolveAndFetchSignatures found.
+type FetchResult struct {
+	Signatures []SignedPayload
+	// Descriptor is of the image the signatures were fetched for.
+	Descriptor v1.Descriptor
+	// ResolvedDigest is the digest (sha256:...) that the reference pointed
+	// at, which is what the signatures were looked up by.
+	ResolvedDigest string
+	// Manifests are the signatures of each manifest in an index, by digest.
+	// Only FetchSignaturesRecursive sets it. Their descriptors are the ones
+	// from the index, so they include the platform.
+	Manifests map[v1.Hash]*FetchResult
+}
+
+// FetchSignatures returns the signatures of the image ref points at, and its
+// descriptor. See ResolveAndFetchSignatures.
+func FetchSignatures(ref name.Reference, ro RegistryOptions) ([]SignedPayload, *v1.Descriptor, error) {
+	res, err := ResolveAndFetchSignatures(ref, ro)
+	if err != nil {
+		return nil, nil, err
+	}
+	return res.Signatures, &res.Descriptor, nil
+}
+
+// ResolveAndFetchSignatures resolves ref to a digest once, and then only uses
+// that digest, so a tag that moves halfway through can't mix up the
+// signatures of two images.
+func ResolveAndFetchSignatures(ref name.Reference, ro RegistryOptions) (*FetchResult, error) {
+	start := time.Now()
+	res, err := resolveAndFetchSignatures(ref, ro)
+	metrics.ObserveRegistry(metrics.OperationFetchSignatures, start, err)
+	return res, err
+}
+
+func resolveAndFetchSignatures(ref name.Reference, ro RegistryOptions) (*FetchResult, error) {
+	ro, cancel := ro.forFetch()
+	defer cancel()
+	c := ro.Remote()
+	targetDesc, err := c.Get(ref)
+	if err != nil {
+		return nil, err
+	}
+	res := &FetchResult{
+		Descriptor:     targetDesc,
+		ResolvedDigest: targetDesc.Digest.String(),
+	}
+
+	if res.Signatures, err = FetchDescriptorSignatures(ref.Context(), targetDesc, ro); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// NoSignaturesError is returned when there are no signatures to fetch: Tag,
+// the signature tag, doesn't exist and there are no signatures stored as
+// referrers either.
+type NoSignaturesError struct {
+	Tag name.Tag
+}
+
+func (e *NoSignaturesError) Error() string {
+	return fmt.Sprintf("manifest not found: %s", e.Tag)
+}
+
+// FetchDescriptorSignatures returns the signatures of desc in repo, which can
+// be anything with a digest, such as a layer. They are looked up both as
+// referrers of desc and in its signature tag.
+func FetchDescriptorSignatures(repo name.Repository, desc v1.Descriptor, ro RegistryOptions) ([]SignedPayload, error) {
+	ro, cancel := ro.forFetch()
+	defer cancel()
+	c := ro.Remote()
+	signatures := []SignedPayload{}
+	refs, _, err := c.Referrers(repo, desc.Digest)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range refs {
+		if r.ArtifactType != SignatureArtifactType {
+			continue
+		}
+		descriptors, err := Descriptors(repo.Digest(r.Digest.String()), ro)
+		if err != nil {
+			return nil, err
+		}
+		sps, err := fetchPayloads(repo, descriptors, ro)
+		if err != nil {
+			return nil, err
+		}
+		signatures = append(signatures, sps...)
+	}
+
+	idxRef := repo.Tag(Munge(desc))
+
+	rdesc, err := c.Get(idxRef)
+	if err != nil {
+		if hasStatus(err, http.StatusNotFound) {
+			if len(signatures) != 0 {
+				return signatures, nil
+			}
+			return nil, &NoSignaturesError{Tag: idxRef}
+		}
+		return nil, err
+	}
+
+	if rdesc.MediaType != types.DockerManifestSchema2 {
+		return nil, fmt.Errorf("unsupported media type: %s", rdesc.MediaType)
+	}
+	descriptors, err := Descriptors(idxRef, ro)
+	if err != nil {
+		return nil, err
+	}
+
+	sps, err := fetchPayloads(repo, descriptors, ro)
+	if err != nil {
+		return nil, err
+	}
+	return append(signatures, sps...), nil
+}
+
+// FetchSignaturesRecursive is ResolveAndFetchSignatures, but if ref is an
+// index it also fetches the signatures of every manifest in it. Each of them
+// must be signed.
+func FetchSignaturesRecursive(ref name.Reference, ro RegistryOptions) (*FetchResult, error) {
+	ro, cancel := ro.forFetch()
+	defer cancel()
+	res, err := ResolveAndFetchSignatures(ref, ro)
+	if err != nil {
+		return nil, err
+	}
+	if !res.Descriptor.MediaType.IsIndex() {
+		return res, nil
+	}
+
+	manifests, err := indexManifests(ref.Context().Digest(res.ResolvedDigest), ro.Remote())
+	if err != nil {
+		return nil, err
+	}
+	res.Manifests = map[v1.Hash]*FetchResult{}
+	for _, desc := range manifests {
+		m, err := FetchSignaturesRecursive(ref.Context().Digest(desc.Digest.String()), ro)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", DescribeManifest(desc), err)
+		}
+		m.Descriptor = desc
+		res.Manifests[desc.Digest] = m
+	}
+	return res, nil
+}
+
+// indexManifests returns the descriptors of the manifests in the index ref.
+func indexManifests(ref name.Reference, c Client) ([]v1.Descriptor, error) {
+	idx, err := c.Index(ref)
+	if err != nil {
+		return nil, err
+	}
+	im, err := idx.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+	return im.Manifests, nil
+}
+
+// DescribeManifest names a manifest from an index by its platform, falling
+// back to its digest.
+func DescribeManifest(desc v1.Descriptor) string {
+	if p := desc.Platform; p != nil && p.OS != "" {
+		return fmt.Sprintf("%s (%s)", FormatPlatform(*p), desc.Digest)
+	}
+	return desc.Digest.String()
+}
+
+// fetchPayloads downloads the payloads of the signature layers in descriptors.
+func fetchPayloads(repo name.Repository, descriptors []v1.Descriptor, ro RegistryOptions) ([]SignedPayload, error) {
+	var p *progress
+	if ro.Progress != nil {
+		var total int64
+		for _, desc := range descriptors {
+			if _, ok := desc.Annotations[SignatureAnnotationKey]; ok {
+				total += desc.Size
+			}
+		}
+		p = newProgress(ro.Progress, ProgressFetch, total)
+	}
+
+	signatures := []SignedPayload{}
+	for _, desc := range descriptors {
+		base64sig, ok := desc.Annotations[SignatureAnnotationKey]
+		if !ok {
+			continue
+		}
+		l, err := ro.Remote().Layer(repo.Digest(desc.Digest.String()))
+		if err != nil {
+			return nil, err
+		}
+
+		r, err := l.Compressed()
+		if err != nil {
+			return nil, err
+
+		}
+		if p != nil {
+			r = &progressReader{ReadCloser: r, p: p}
+		}
+
+		payload, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		signatures = append(signatures, SignedPayload{
+			Payload:           payload,
+			Base64Signature:   base64sig,
+			Base64Timestamp:   desc.Annotations[TimestampAnnotationKey],
+			Base64Certificate: desc.Annotations[CertificateAnnotationKey],
+			Base64Chain:       desc.Annotations[ChainAnnotationKey],
+			MediaType:         desc.MediaType,
+		})
+	}
+	if p != nil {
+		p.finish()
+	}
+	return signatures, nil
+}
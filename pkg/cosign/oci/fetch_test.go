@@ -0,0 +1,106 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oci
+
+import (
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+func TestSignatureTag(t *testing.T) {
+	tests := []struct {
+		digest string
+		tag    string
+	}{{
+		// From the README.
+		digest: "sha256:97fc222cee7991b5b061d4d4afdb5f3428fcb0c9054e1690313786befa1e4e36",
+		tag:    "sha256-97fc222cee7991b5b061d4d4afdb5f3428fcb0c9054e1690313786befa1e4e36.cosign",
+	}, {
+		digest: "sha256:71f70e5d29bde87f988740665257c35b1c6f52dafa20fab4ba16b3b1f4c6ba0e",
+		tag:    "sha256-71f70e5d29bde87f988740665257c35b1c6f52dafa20fab4ba16b3b1f4c6ba0e.cosign",
+	}}
+	for _, test := range tests {
+		t.Run(test.digest, func(t *testing.T) {
+			h, err := v1.NewHash(test.digest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tag, err := MakeSignatureTag(v1.Descriptor{Digest: h})
+			if err != nil {
+				t.Fatalf("MakeSignatureTag() = %v", err)
+			}
+			if tag != test.tag {
+				t.Errorf("MakeSignatureTag() = %s, wanted %s", tag, test.tag)
+			}
+			got, err := ParseSignatureTag(tag)
+			if err != nil {
+				t.Fatalf("ParseSignatureTag() = %v", err)
+			}
+			if got != h {
+				t.Errorf("ParseSignatureTag() = %s, wanted %s", got, h)
+			}
+		})
+	}
+}
+
+func TestMungeDemunge(t *testing.T) {
+	tests := []struct {
+		digest string
+		tag    string
+	}{{
+		digest: "sha256:97fc222cee7991b5b061d4d4afdb5f3428fcb0c9054e1690313786befa1e4e36",
+		tag:    "sha256-97fc222cee7991b5b061d4d4afdb5f3428fcb0c9054e1690313786befa1e4e36.cosign",
+	}, {
+		digest: "sha256:87ef60f558bad79beea6425a3b28989f01dd417164150ab3baab98dcbf04def8",
+		tag:    "sha256-87ef60f558bad79beea6425a3b28989f01dd417164150ab3baab98dcbf04def8.cosign",
+	}}
+	for _, test := range tests {
+		t.Run(test.digest, func(t *testing.T) {
+			h, err := v1.NewHash(test.digest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := Munge(v1.Descriptor{Digest: h}); got != test.tag {
+				t.Errorf("Munge() = %s, wanted %s", got, test.tag)
+			}
+			got, err := Demunge(test.tag)
+			if err != nil {
+				t.Fatalf("Demunge() = %v", err)
+			}
+			if got != h {
+				t.Errorf("Demunge() = %s, wanted %s", got, h)
+			}
+		})
+	}
+}
+
+func TestSignatureTagErrors(t *testing.T) {
+	if _, err := MakeSignatureTag(v1.Descriptor{}); err == nil {
+		t.Error("MakeSignatureTag() with no digest, wanted error")
+	}
+	for _, tag := range []string{
+		"latest",
+		"sha256-97fc222cee7991b5b061d4d4afdb5f3428fcb0c9054e1690313786befa1e4e36",
+		"sha256-abc.cosign",
+		"sha256.cosign",
+	} {
+		if _, err := Demunge(tag); err == nil {
+			t.Errorf("Demunge(%q), wanted error", tag)
+		}
+	}
+}
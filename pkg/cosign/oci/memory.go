@@ -0,0 +1,337 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oci
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// MemoryClient is a Client that keeps everything in memory, so signatures can
+// be stored and fetched without a registry, e.g. in tests. It supports the
+// referrers API.
+type MemoryClient struct {
+	mu    sync.Mutex
+	repos map[string]*memoryRepo
+}
+
+type memoryRepo struct {
+	tags      map[string]v1.Hash
+	manifests map[v1.Hash]memoryManifest
+	blobs     map[v1.Hash][]byte
+}
+
+type memoryManifest struct {
+	mediaType types.MediaType
+	raw       []byte
+	// Only one of img and idx is set.
+	img v1.Image
+	idx v1.ImageIndex
+}
+
+var _ Client = (*MemoryClient)(nil)
+
+// NewMemoryClient returns an empty MemoryClient.
+func NewMemoryClient() *MemoryClient {
+	return &MemoryClient{repos: map[string]*memoryRepo{}}
+}
+
+func (c *MemoryClient) repo(r name.Repository) *memoryRepo {
+	mr, ok := c.repos[r.Name()]
+	if !ok {
+		mr = &memoryRepo{
+			tags:      map[string]v1.Hash{},
+			manifests: map[v1.Hash]memoryManifest{},
+			blobs:     map[v1.Hash][]byte{},
+		}
+		c.repos[r.Name()] = mr
+	}
+	return mr
+}
+
+func notFound(what fmt.Stringer) error {
+	return &transport.Error{
+		StatusCode: http.StatusNotFound,
+		Errors: []transport.Diagnostic{{
+			Code:    transport.ManifestUnknownErrorCode,
+			Message: fmt.Sprintf("%s not found", what),
+		}},
+	}
+}
+
+func (c *MemoryClient) manifest(ref name.Reference) (v1.Hash, memoryManifest, error) {
+	mr := c.repo(ref.Context())
+	var h v1.Hash
+	switch r := ref.(type) {
+	case name.Tag:
+		var ok bool
+		if h, ok = mr.tags[r.TagStr()]; !ok {
+			return v1.Hash{}, memoryManifest{}, notFound(ref)
+		}
+	case name.Digest:
+		var err error
+		if h, err = v1.NewHash(r.DigestStr()); err != nil {
+			return v1.Hash{}, memoryManifest{}, err
+		}
+	}
+	m, ok := mr.manifests[h]
+	if !ok {
+		return v1.Hash{}, memoryManifest{}, notFound(ref)
+	}
+	return h, m, nil
+}
+
+func (c *MemoryClient) Get(ref name.Reference) (v1.Descriptor, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	h, m, err := c.manifest(ref)
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	return v1.Descriptor{
+		MediaType: m.mediaType,
+		Size:      int64(len(m.raw)),
+		Digest:    h,
+	}, nil
+}
+
+func (c *MemoryClient) Image(ref name.Reference) (v1.Image, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, m, err := c.manifest(ref)
+	if err != nil {
+		return nil, err
+	}
+	if m.img == nil {
+		return nil, fmt.Errorf("%s is a %s, not an image", ref, m.mediaType)
+	}
+	return m.img, nil
+}
+
+func (c *MemoryClient) Index(ref name.Reference) (v1.ImageIndex, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, m, err := c.manifest(ref)
+	if err != nil {
+		return nil, err
+	}
+	if m.idx == nil {
+		return nil, fmt.Errorf("%s is a %s, not an index", ref, m.mediaType)
+	}
+	return m.idx, nil
+}
+
+func (c *MemoryClient) Layer(ref name.Digest) (v1.Layer, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	h, err := v1.NewHash(ref.DigestStr())
+	if err != nil {
+		return nil, err
+	}
+	b, ok := c.repo(ref.Context()).blobs[h]
+	if !ok {
+		return nil, notFound(ref)
+	}
+	return StaticLayer(b, types.DockerLayer), nil
+}
+
+// Write stores img, reading all of its layers like an upload would.
+func (c *MemoryClient) Write(ref name.Reference, img v1.Image) error {
+	ls, err := img.Layers()
+	if err != nil {
+		return err
+	}
+	blobs := map[v1.Hash][]byte{}
+	for _, l := range ls {
+		h, err := l.Digest()
+		if err != nil {
+			return err
+		}
+		rc, err := l.Compressed()
+		if err != nil {
+			return err
+		}
+		b, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+		blobs[h] = b
+	}
+	raw, err := img.RawManifest()
+	if err != nil {
+		return err
+	}
+	mt, err := img.MediaType()
+	if err != nil {
+		return err
+	}
+	cfg, err := img.RawConfigFile()
+	if err != nil {
+		return err
+	}
+	stored, err := partial.CompressedToImage(&memoryImage{
+		mediaType: mt,
+		manifest:  raw,
+		config:    cfg,
+		blobs:     blobs,
+	})
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	mr := c.repo(ref.Context())
+	for h, b := range blobs {
+		mr.blobs[h] = b
+	}
+	return c.put(mr, ref, memoryManifest{mediaType: mt, raw: raw, img: stored})
+}
+
+// WriteIndex stores idx. The manifests in it have to be written separately.
+func (c *MemoryClient) WriteIndex(ref name.Reference, idx v1.ImageIndex) error {
+	raw, err := idx.RawManifest()
+	if err != nil {
+		return err
+	}
+	mt, err := idx.MediaType()
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.put(c.repo(ref.Context()), ref, memoryManifest{mediaType: mt, raw: raw, idx: idx})
+}
+
+func (c *MemoryClient) put(mr *memoryRepo, ref name.Reference, m memoryManifest) error {
+	h, _, err := v1.SHA256(bytes.NewReader(m.raw))
+	if err != nil {
+		return err
+	}
+	if d, ok := ref.(name.Digest); ok && d.DigestStr() != h.String() {
+		return fmt.Errorf("manifest digest %s doesn't match %s", h, ref)
+	}
+	mr.manifests[h] = m
+	if t, ok := ref.(name.Tag); ok {
+		mr.tags[t.TagStr()] = h
+	}
+	return nil
+}
+
+// Delete deletes the manifest ref points at, and every tag pointing at it.
+func (c *MemoryClient) Delete(ref name.Reference) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	h, _, err := c.manifest(ref)
+	if err != nil {
+		return err
+	}
+	mr := c.repo(ref.Context())
+	delete(mr.manifests, h)
+	for t, th := range mr.tags {
+		if th == h {
+			delete(mr.tags, t)
+		}
+	}
+	return nil
+}
+
+func (c *MemoryClient) List(repo name.Repository) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	tags := []string{}
+	for t := range c.repo(repo).tags {
+		tags = append(tags, t)
+	}
+	sort.Strings(tags)
+	return tags, nil
+}
+
+func (c *MemoryClient) Referrers(repo name.Repository, subject v1.Hash) ([]Referrer, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	refs := []Referrer{}
+	for h, m := range c.repo(repo).manifests {
+		rm := referrerManifest{}
+		if err := json.Unmarshal(m.raw, &rm); err != nil {
+			return nil, true, err
+		}
+		if rm.Subject == nil || rm.Subject.Digest != subject {
+			continue
+		}
+		refs = append(refs, Referrer{
+			Descriptor: v1.Descriptor{
+				MediaType: m.mediaType,
+				Size:      int64(len(m.raw)),
+				Digest:    h,
+			},
+			ArtifactType: rm.ArtifactType,
+		})
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i].Digest.String() < refs[j].Digest.String() })
+	return refs, true, nil
+}
+
+// memoryImage is a v1.Image put back together from what was written.
+type memoryImage struct {
+	mediaType types.MediaType
+	manifest  []byte
+	config    []byte
+	blobs     map[v1.Hash][]byte
+}
+
+func (i *memoryImage) MediaType() (types.MediaType, error) {
+	return i.mediaType, nil
+}
+
+func (i *memoryImage) RawManifest() ([]byte, error) {
+	return i.manifest, nil
+}
+
+func (i *memoryImage) RawConfigFile() ([]byte, error) {
+	return i.config, nil
+}
+
+func (i *memoryImage) LayerByDigest(h v1.Hash) (partial.CompressedLayer, error) {
+	b, ok := i.blobs[h]
+	if !ok {
+		return nil, fmt.Errorf("unknown layer %s", h)
+	}
+	m, err := v1.ParseManifest(bytes.NewReader(i.manifest))
+	if err != nil {
+		return nil, err
+	}
+	mt := types.DockerLayer
+	for _, l := range m.Layers {
+		if l.Digest == h {
+			mt = l.MediaType
+		}
+	}
+	return &staticLayer{b: b, mt: mt}, nil
+}
@@ -0,0 +1,105 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oci
+
+import (
+	"encoding/json"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// SimpleSigningMediaType is the media type of the payloads that Payload
+// generates, and the default for Upload.
+const SimpleSigningMediaType types.MediaType = "application/vnd.dev.cosign.simplesigning.v1+json"
+
+// SimpleSigning is the payload that cosign signs by default. Optional
+// values are usually strings, the annotations passed to sign with -a, but
+// can be any JSON, such as an object referencing an SBOM.
+type SimpleSigning struct {
+	Critical Critical
+	Optional map[string]json.RawMessage
+}
+
+type Critical struct {
+	Identity Identity
+	Image    Image
+	Type     string
+}
+
+type Identity struct {
+	DockerReference string `json:"docker-reference"`
+}
+
+type Image struct {
+	DockerManifestDigest string `json:"Docker-manifest-digest"`
+}
+
+// SimpleSigningV2 is a richer simple signing payload, for signers that need
+// more structure than SimpleSigning. It is told apart from SimpleSigning by
+// its version, which is SimpleSigningV2Version.
+type SimpleSigningV2 struct {
+	Version  string                     `json:"version"`
+	Critical CriticalV2                 `json:"critical"`
+	Optional map[string]json.RawMessage `json:"optional,omitempty"`
+}
+
+// SimpleSigningV2Version is the version of SimpleSigningV2 payloads.
+const SimpleSigningV2Version = "2"
+
+type CriticalV2 struct {
+	Identity Identity `json:"identity"`
+	Image    ImageV2  `json:"image"`
+	Type     string   `json:"type"`
+}
+
+// ImageV2 identifies the signed image by its full digest, including the
+// algorithm, e.g. sha256:87ef60f5....
+type ImageV2 struct {
+	Digest string `json:"digest"`
+}
+
+// Payload returns the simple signing payload for img, with the annotations a
+// as its optional values.
+func Payload(img v1.Descriptor, a map[string]string) ([]byte, error) {
+	var optional map[string]json.RawMessage
+	if a != nil {
+		optional = make(map[string]json.RawMessage, len(a))
+		for k, v := range a {
+			b, err := json.Marshal(v)
+			if err != nil {
+				return nil, err
+			}
+			optional[k] = b
+		}
+	}
+	simpleSigning := SimpleSigning{
+		Critical: Critical{
+			Image: Image{
+				DockerManifestDigest: img.Digest.Hex,
+			},
+			Type: "cosign container signature",
+		},
+		Optional: optional,
+	}
+
+	b, err := json.Marshal(simpleSigning)
+	if err != nil {
+		return nil, err
+	}
+	return b, err
+}
@@ -0,0 +1,82 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oci
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// ParsePlatform parses a platform written as os/arch[/variant], e.g.
+// linux/arm64 or linux/arm/v7.
+func ParsePlatform(s string) (v1.Platform, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return v1.Platform{}, fmt.Errorf("invalid platform %q, wanted os/arch[/variant]", s)
+	}
+	p := v1.Platform{OS: parts[0], Architecture: parts[1]}
+	if len(parts) == 3 {
+		p.Variant = parts[2]
+	}
+	return p, nil
+}
+
+// PlatformManifest returns the digest reference of the manifest for platform
+// in the index ref points at. The variant is only compared if platform has
+// one, so linux/arm64 finds linux/arm64/v8 too, and it's an error if that
+// matches more than one manifest.
+func PlatformManifest(ref name.Reference, platform v1.Platform, ro RegistryOptions) (name.Digest, error) {
+	c := ro.Remote()
+	desc, err := c.Get(ref)
+	if err != nil {
+		return name.Digest{}, err
+	}
+	if !desc.MediaType.IsIndex() {
+		return name.Digest{}, fmt.Errorf("%s is a single image, not an index of platforms", ref)
+	}
+	manifests, err := indexManifests(ref.Context().Digest(desc.Digest.String()), c)
+	if err != nil {
+		return name.Digest{}, err
+	}
+	found := []v1.Descriptor{}
+	for _, m := range manifests {
+		p := m.Platform
+		if p != nil && p.OS == platform.OS && p.Architecture == platform.Architecture && (platform.Variant == "" || p.Variant == platform.Variant) {
+			found = append(found, m)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return name.Digest{}, fmt.Errorf("%s has no manifest for %s", ref, FormatPlatform(platform))
+	case 1:
+		return ref.Context().Digest(found[0].Digest.String()), nil
+	default:
+		return name.Digest{}, fmt.Errorf("%s has %d manifests for %s, give the variant too", ref, len(found), FormatPlatform(platform))
+	}
+}
+
+// FormatPlatform writes p the way ParsePlatform parses it.
+func FormatPlatform(p v1.Platform) string {
+	s := p.OS + "/" + p.Architecture
+	if p.Variant != "" {
+		s += "/" + p.Variant
+	}
+	return s
+}
@@ -0,0 +1,135 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oci
+
+import (
+	"strings"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+)
+
+func TestParsePlatform(t *testing.T) {
+	for _, test := range []struct {
+		in      string
+		want    v1.Platform
+		wantErr bool
+	}{
+		{in: "linux/amd64", want: v1.Platform{OS: "linux", Architecture: "amd64"}},
+		{in: "linux/arm/v7", want: v1.Platform{OS: "linux", Architecture: "arm", Variant: "v7"}},
+		{in: "linux", wantErr: true},
+		{in: "linux/", wantErr: true},
+		{in: "linux/arm/v7/extra", wantErr: true},
+	} {
+		got, err := ParsePlatform(test.in)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("ParsePlatform(%q) = %v, wanted error", test.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParsePlatform(%q) = %v", test.in, err)
+			continue
+		}
+		if !got.Equals(test.want) {
+			t.Errorf("ParsePlatform(%q) = %+v, wanted %+v", test.in, got, test.want)
+		}
+		if s := FormatPlatform(got); s != test.in {
+			t.Errorf("FormatPlatform(%+v) = %q, wanted %q", got, s, test.in)
+		}
+	}
+}
+
+func TestPlatformManifest(t *testing.T) {
+	c := NewMemoryClient()
+	ro := RegistryOptions{Client: c}
+	ref := mustParse(t, "registry.example.com/multiarch:latest")
+
+	adds := []mutate.IndexAddendum{}
+	digests := map[string]v1.Hash{}
+	for _, p := range []v1.Platform{
+		{OS: "linux", Architecture: "amd64"},
+		{OS: "linux", Architecture: "arm64", Variant: "v8"},
+		{OS: "linux", Architecture: "arm", Variant: "v6"},
+		{OS: "linux", Architecture: "arm", Variant: "v7"},
+	} {
+		p := p
+		img, err := random.Image(512, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h, err := img.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Write(ref.Context().Digest(h.String()), img); err != nil {
+			t.Fatal(err)
+		}
+		adds = append(adds, mutate.IndexAddendum{Add: img, Descriptor: v1.Descriptor{Platform: &p}})
+		digests[FormatPlatform(p)] = h
+	}
+	if err := c.WriteIndex(ref, mutate.AppendManifests(empty.Index, adds...)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		platform string
+		want     string
+		wantErr  string
+	}{
+		{platform: "linux/amd64", want: "linux/amd64"},
+		{platform: "linux/arm64", want: "linux/arm64/v8"},
+		{platform: "linux/arm/v7", want: "linux/arm/v7"},
+		{platform: "linux/arm", wantErr: "give the variant"},
+		{platform: "windows/amd64", wantErr: "no manifest for windows/amd64"},
+	} {
+		p, err := ParsePlatform(test.platform)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := PlatformManifest(ref, p, ro)
+		if test.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("PlatformManifest(%s) = %v, wanted error containing %q", test.platform, err, test.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("PlatformManifest(%s) = %v", test.platform, err)
+			continue
+		}
+		if got.DigestStr() != digests[test.want].String() {
+			t.Errorf("PlatformManifest(%s) = %s, wanted the %s manifest %s", test.platform, got, test.want, digests[test.want])
+		}
+	}
+
+	img := mustParse(t, "registry.example.com/single:latest")
+	single, err := random.Image(512, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Write(img, single); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := PlatformManifest(img, v1.Platform{OS: "linux", Architecture: "amd64"}, ro); err == nil {
+		t.Error("PlatformManifest() of an image, wanted error")
+	}
+}
@@ -0,0 +1,141 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oci
+
+import (
+	"io"
+	"sync"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// ProgressFunc is told how far along an upload or fetch is: done of total
+// bytes. event is ProgressUpload or ProgressFetch. Calls are never
+// concurrent, and an operation that succeeds ends with exactly one call where
+// done equals total.
+type ProgressFunc func(event string, done, total int64)
+
+const (
+	// ProgressUpload is the event for uploading signature images.
+	ProgressUpload = "upload"
+	// ProgressFetch is the event for fetching signature payloads.
+	ProgressFetch = "fetch"
+)
+
+// progress adds up the bytes of one operation, which may be transferred
+// concurrently.
+type progress struct {
+	mu          sync.Mutex
+	f           ProgressFunc
+	event       string
+	done, total int64
+	complete    bool
+}
+
+func newProgress(f ProgressFunc, event string, total int64) *progress {
+	return &progress{f: f, event: event, total: total}
+}
+
+func (p *progress) add(n int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.complete {
+		return
+	}
+	p.done += n
+	// Blobs that are uploaded again after a failure are counted twice.
+	if p.done >= p.total {
+		p.done = p.total
+		p.complete = true
+	}
+	p.f(p.event, p.done, p.total)
+}
+
+// finish reports the operation done, including the bytes that weren't
+// transferred because the registry already had them.
+func (p *progress) finish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.complete {
+		return
+	}
+	p.done = p.total
+	p.complete = true
+	p.f(p.event, p.done, p.total)
+}
+
+type progressReader struct {
+	io.ReadCloser
+	p *progress
+}
+
+func (r *progressReader) Read(b []byte) (int, error) {
+	n, err := r.ReadCloser.Read(b)
+	if n > 0 {
+		r.p.add(int64(n))
+	}
+	return n, err
+}
+
+// progressImage reports the bytes of its layers as remote.Write uploads them.
+type progressImage struct {
+	v1.Image
+	p *progress
+}
+
+// withProgress wraps img to report uploading it to f. The config and manifest
+// are small, so only layers are counted.
+func withProgress(img v1.Image, f ProgressFunc) (*progressImage, error) {
+	ls, err := img.Layers()
+	if err != nil {
+		return nil, err
+	}
+	var total int64
+	for _, l := range ls {
+		size, err := l.Size()
+		if err != nil {
+			return nil, err
+		}
+		total += size
+	}
+	return &progressImage{Image: img, p: newProgress(f, ProgressUpload, total)}, nil
+}
+
+func (i *progressImage) Layers() ([]v1.Layer, error) {
+	ls, err := i.Image.Layers()
+	if err != nil {
+		return nil, err
+	}
+	wrapped := make([]v1.Layer, 0, len(ls))
+	for _, l := range ls {
+		wrapped = append(wrapped, &progressLayer{Layer: l, p: i.p})
+	}
+	return wrapped, nil
+}
+
+type progressLayer struct {
+	v1.Layer
+	p *progress
+}
+
+func (l *progressLayer) Compressed() (io.ReadCloser, error) {
+	rc, err := l.Layer.Compressed()
+	if err != nil {
+		return nil, err
+	}
+	return &progressReader{ReadCloser: rc, p: l.p}, nil
+}
@@ -0,0 +1,166 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oci
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// SignatureArtifactType is the artifactType of signature manifests stored
+// with the OCI 1.1 referrers API.
+const SignatureArtifactType = "application/vnd.dev.cosign.signature.v2+json"
+
+// referrersIndex is the response of the referrers API, an image index whose
+// descriptors carry the artifactType of the manifests they point to.
+type referrersIndex struct {
+	Manifests []Referrer `json:"manifests"`
+}
+
+// Referrer is a manifest that has another one as its subject.
+type Referrer struct {
+	v1.Descriptor
+	ArtifactType string `json:"artifactType,omitempty"`
+}
+
+// remoteReferrers returns the descriptors of all manifests in repo that have
+// subject as their subject, as reported by the referrers API.
+// The bool is false if the registry doesn't support the referrers API.
+func remoteReferrers(repo name.Repository, subject v1.Hash, ro RegistryOptions) ([]Referrer, bool, error) {
+	auth, err := ro.authenticator(repo.Registry)
+	if err != nil {
+		return nil, false, err
+	}
+	tr, err := transport.New(repo.Registry, auth, ro.transport(), []string{repo.Scope(transport.PullScope)})
+	if err != nil {
+		return nil, false, err
+	}
+	u := url.URL{
+		Scheme: repo.Registry.Scheme(),
+		Host:   repo.RegistryStr(),
+		Path:   fmt.Sprintf("/v2/%s/referrers/%s", repo.RepositoryStr(), subject),
+	}
+	req, err := http.NewRequestWithContext(ro.context(), http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, false, err
+	}
+	resp, err := (&http.Client{Transport: tr}).Do(req)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+
+	// Registries that implement the referrers API must return an index, even
+	// if it is empty, so anything else means it isn't supported. Some add
+	// parameters such as a charset to the media type.
+	if resp.StatusCode != http.StatusOK {
+		return nil, false, nil
+	}
+	if mt, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type")); err != nil || mt != string(types.OCIImageIndex) {
+		return nil, false, nil
+	}
+
+	idx := referrersIndex{}
+	if err := json.NewDecoder(resp.Body).Decode(&idx); err != nil {
+		return nil, true, err
+	}
+	return idx.Manifests, true, nil
+}
+
+// referrerManifest is an OCI image manifest with the fields added in 1.1.
+type referrerManifest struct {
+	SchemaVersion int64           `json:"schemaVersion"`
+	MediaType     types.MediaType `json:"mediaType"`
+	ArtifactType  string          `json:"artifactType"`
+	Config        v1.Descriptor   `json:"config"`
+	Layers        []v1.Descriptor `json:"layers"`
+	Subject       *v1.Descriptor  `json:"subject"`
+}
+
+// referrerImage overrides the manifest of an image with one that points at
+// a subject, and says what kind of artifact it is.
+type referrerImage struct {
+	v1.Image
+	manifest []byte
+}
+
+func newReferrerImage(img v1.Image, subject v1.Descriptor, artifactType string) (*referrerImage, error) {
+	m, err := img.Manifest()
+	if err != nil {
+		return nil, err
+	}
+	cfg := m.Config
+	cfg.MediaType = types.OCIConfigJSON
+	b, err := json.Marshal(referrerManifest{
+		SchemaVersion: 2,
+		MediaType:     types.OCIManifestSchema1,
+		ArtifactType:  artifactType,
+		Config:        cfg,
+		Layers:        m.Layers,
+		Subject: &v1.Descriptor{
+			MediaType: subject.MediaType,
+			Size:      subject.Size,
+			Digest:    subject.Digest,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &referrerImage{
+		Image:    img,
+		manifest: b,
+	}, nil
+}
+
+func (i *referrerImage) MediaType() (types.MediaType, error) {
+	return types.OCIManifestSchema1, nil
+}
+
+func (i *referrerImage) RawManifest() ([]byte, error) {
+	return i.manifest, nil
+}
+
+func (i *referrerImage) Digest() (v1.Hash, error) {
+	h, _, err := v1.SHA256(bytes.NewReader(i.manifest))
+	return h, err
+}
+
+func (i *referrerImage) Size() (int64, error) {
+	return int64(len(i.manifest)), nil
+}
+
+// uploadReferrer pushes img as a referrer of subject, by digest.
+func uploadReferrer(img v1.Image, repo name.Repository, subject v1.Descriptor, artifactType string, ro RegistryOptions) error {
+	ri, err := newReferrerImage(img, subject, artifactType)
+	if err != nil {
+		return err
+	}
+	h, err := ri.Digest()
+	if err != nil {
+		return err
+	}
+	return ro.write(repo.Digest(h.String()), ri)
+}
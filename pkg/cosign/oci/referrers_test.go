@@ -0,0 +1,72 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oci
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+func TestRemoteReferrersContentType(t *testing.T) {
+	subject := v1.Hash{Algorithm: "sha256", Hex: strings.Repeat("a", 64)}
+	index := `{"schemaVersion":2,"manifests":[{"mediaType":"application/vnd.oci.image.manifest.v1+json","digest":"sha256:` + strings.Repeat("b", 64) + `","size":1,"artifactType":"` + SignatureArtifactType + `"}]}`
+	for _, tc := range []struct {
+		contentType string
+		want        bool
+	}{
+		{"application/vnd.oci.image.index.v1+json", true},
+		{"application/vnd.oci.image.index.v1+json; charset=utf-8", true},
+		{"application/json", false},
+		{"", false},
+	} {
+		t.Run(tc.contentType, func(t *testing.T) {
+			s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/v2/" {
+					return
+				}
+				w.Header().Set("Content-Type", tc.contentType)
+				w.Write([]byte(index))
+			}))
+			defer s.Close()
+			u, err := url.Parse(s.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			repo, err := name.NewRepository(u.Host + "/test")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			refs, ok, err := remoteReferrers(repo, subject, RegistryOptions{AllowInsecure: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != tc.want {
+				t.Fatalf("remoteReferrers() supported = %t, wanted %t", ok, tc.want)
+			}
+			if ok && (len(refs) != 1 || refs[0].ArtifactType != SignatureArtifactType) {
+				t.Errorf("remoteReferrers() = %+v, wanted the signature", refs)
+			}
+		})
+	}
+}
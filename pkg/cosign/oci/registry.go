@@ -0,0 +1,171 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oci
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// RegistryOptions configures how cosign talks to registries. If neither
+// Username nor Password is set, credentials come from authn.DefaultKeychain.
+type RegistryOptions struct {
+	Username string
+	Password string
+
+	// AllowInsecure allows talking to registries over plain HTTP.
+	AllowInsecure bool
+	// SkipTLSVerify accepts any certificate a registry presents, such as a
+	// self-signed one.
+	SkipTLSVerify bool
+
+	// Retry retries requests that fail with a transient error.
+	Retry RetryOptions
+
+	// Progress, if set, is told how uploading signatures and fetching
+	// signature payloads is going.
+	Progress ProgressFunc
+
+	// Client, if set, is used instead of talking to registries with the
+	// options above, e.g. a NewMemoryClient in tests.
+	Client Client
+
+	// Context, if set, bounds every request to the registry, e.g. with a
+	// deadline.
+	Context context.Context
+	// PushTimeout and FetchTimeout, if set, bound uploading and fetching
+	// signatures, within the deadline of Context.
+	PushTimeout  time.Duration
+	FetchTimeout time.Duration
+}
+
+// Remote returns the Client to talk to registries with.
+func (ro RegistryOptions) Remote() Client {
+	return ro.remote(ro.context())
+}
+
+func (ro RegistryOptions) context() context.Context {
+	if ro.Context == nil {
+		return context.Background()
+	}
+	return ro.Context
+}
+
+// withTimeout returns ro with a Context that times out after d, if it's set,
+// or when ro.Context is done, whichever is first.
+func (ro RegistryOptions) withTimeout(d time.Duration) (RegistryOptions, context.CancelFunc) {
+	if d <= 0 {
+		return ro, func() {}
+	}
+	ctx, cancel := context.WithTimeout(ro.context(), d)
+	ro.Context = ctx
+	return ro, cancel
+}
+
+// forPush bounds ro by PushTimeout, which then doesn't apply again.
+func (ro RegistryOptions) forPush() (RegistryOptions, context.CancelFunc) {
+	d := ro.PushTimeout
+	ro.PushTimeout = 0
+	return ro.withTimeout(d)
+}
+
+// forFetch bounds ro by FetchTimeout, which then doesn't apply again to the
+// fetches it is made of.
+func (ro RegistryOptions) forFetch() (RegistryOptions, context.CancelFunc) {
+	d := ro.FetchTimeout
+	ro.FetchTimeout = 0
+	return ro.withTimeout(d)
+}
+
+func (ro RegistryOptions) remote(ctx context.Context) Client {
+	if ro.Client != nil {
+		return ro.Client
+	}
+	return newRemoteClient(ctx, ro)
+}
+
+// NameOptions returns the options to parse references with.
+func (ro RegistryOptions) NameOptions() []name.Option {
+	if ro.AllowInsecure {
+		return []name.Option{name.Insecure}
+	}
+	return nil
+}
+
+// RemoteOptions returns the options for every remote call to a registry.
+func (ro RegistryOptions) RemoteOptions() []remote.Option {
+	return []remote.Option{
+		WithRegistryCredentials(ro),
+		remote.WithTransport(ro.transport()),
+	}
+}
+
+func (ro RegistryOptions) transport() http.RoundTripper {
+	t := http.DefaultTransport
+	if ro.AllowInsecure || ro.SkipTLSVerify {
+		insecure := http.DefaultTransport.(*http.Transport).Clone()
+		insecure.TLSClientConfig = &tls.Config{InsecureSkipVerify: true} // #nosec G402
+		t = insecure
+	}
+	if ro.Retry.MaxAttempts > 1 {
+		t = &retryTransport{inner: t, opts: ro.Retry}
+	}
+	return t
+}
+
+// write is Client.Write, reporting progress to ro.Progress.
+func (ro RegistryOptions) write(ref name.Reference, img v1.Image) error {
+	if ro.Progress == nil {
+		return ro.Remote().Write(ref, img)
+	}
+	pi, err := withProgress(img, ro.Progress)
+	if err != nil {
+		return err
+	}
+	if err := ro.Remote().Write(ref, pi); err != nil {
+		return err
+	}
+	pi.p.finish()
+	return nil
+}
+
+func (ro RegistryOptions) explicit() bool {
+	return ro.Username != "" || ro.Password != ""
+}
+
+func (ro RegistryOptions) authenticator(reg name.Registry) (authn.Authenticator, error) {
+	if ro.explicit() {
+		return &authn.Basic{Username: ro.Username, Password: ro.Password}, nil
+	}
+	return authn.DefaultKeychain.Resolve(reg)
+}
+
+// WithRegistryCredentials returns a remote.Option that authenticates with the
+// credentials in ro, falling back to authn.DefaultKeychain.
+func WithRegistryCredentials(ro RegistryOptions) remote.Option {
+	if ro.explicit() {
+		return remote.WithAuth(&authn.Basic{Username: ro.Username, Password: ro.Password})
+	}
+	return remote.WithAuthFromKeychain(authn.DefaultKeychain)
+}
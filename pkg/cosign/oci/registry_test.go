@@ -0,0 +1,101 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oci
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// deadlineExceeded is errors.Is(err, context.DeadlineExceeded), for errors
+// the remote package doesn't wrap.
+func deadlineExceeded(err error) bool {
+	return err != nil && strings.Contains(err.Error(), context.DeadlineExceeded.Error())
+}
+
+func TestTimeouts(t *testing.T) {
+	var delay int64
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Duration(atomic.LoadInt64(&delay))):
+		case <-r.Context().Done():
+		}
+		http.NotFound(w, r)
+	}))
+	defer s.Close()
+	ref, err := name.ParseReference(strings.TrimPrefix(s.URL, "http://")+"/image:latest", name.Insecure)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+
+	tests := []struct {
+		name         string
+		delay        time.Duration
+		ro           RegistryOptions
+		wantDeadline bool
+	}{{
+		name:         "context",
+		delay:        time.Minute,
+		ro:           RegistryOptions{Context: expired},
+		wantDeadline: true,
+	}, {
+		name:         "fetch timeout",
+		delay:        time.Minute,
+		ro:           RegistryOptions{FetchTimeout: 10 * time.Millisecond},
+		wantDeadline: true,
+	}, {
+		name:  "fetch timeout within context",
+		delay: 0,
+		ro:    RegistryOptions{Context: expired, FetchTimeout: time.Minute},
+		// The context's deadline still applies.
+		wantDeadline: true,
+	}, {
+		name:  "push timeout doesn't apply",
+		delay: 0,
+		ro:    RegistryOptions{Context: expired, PushTimeout: time.Minute},
+		// The context has expired.
+		wantDeadline: true,
+	}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			atomic.StoreInt64(&delay, int64(test.delay))
+			test.ro.AllowInsecure = true
+			_, _, err := FetchSignatures(ref, test.ro)
+			if err == nil {
+				t.Fatal("FetchSignatures() = nil, wanted error")
+			}
+			if got := deadlineExceeded(err); got != test.wantDeadline {
+				t.Errorf("FetchSignatures() = %v, wanted deadline exceeded: %v", err, test.wantDeadline)
+			}
+		})
+	}
+
+	atomic.StoreInt64(&delay, int64(time.Minute))
+	ro := RegistryOptions{AllowInsecure: true, Context: expired, PushTimeout: 10 * time.Millisecond}
+	if err := Upload([]byte("signature"), []byte("payload"), ref.Context().Tag("sig"), UploadRegistryOptions(ro)); !deadlineExceeded(err) {
+		t.Errorf("Upload() = %v, wanted deadline exceeded", err)
+	}
+}
@@ -0,0 +1,111 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oci
+
+import (
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// RetryOptions configures retrying registry requests that fail with a
+// transient error: 429, 500, 502, 503 or 504. The delay doubles after every
+// attempt, and is jittered so that many clients don't retry in lockstep.
+type RetryOptions struct {
+	// MaxAttempts is how many times a request is tried in all. Zero or one
+	// means requests aren't retried.
+	MaxAttempts int
+	// InitialDelay is the delay before the first retry.
+	InitialDelay time.Duration
+	// MaxDelay caps the delay between attempts. Zero means no cap.
+	MaxDelay time.Duration
+}
+
+// delay returns how long to wait before attempt, counting from 1. It is
+// somewhere between half of and the full exponential delay.
+func (r RetryOptions) delay(attempt int) time.Duration {
+	d := r.InitialDelay
+	for i := 1; i < attempt-1; i++ {
+		d *= 2
+		if r.MaxDelay > 0 && d >= r.MaxDelay {
+			break
+		}
+	}
+	if r.MaxDelay > 0 && d > r.MaxDelay {
+		d = r.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	half := int64(d / 2)
+	return time.Duration(half + rand.Int63n(int64(d)-half+1)) // #nosec G404
+}
+
+func retryable(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryTransport retries the requests that inner responds to with a
+// transient error.
+type retryTransport struct {
+	inner http.RoundTripper
+	opts  RetryOptions
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		resp, err := t.inner.RoundTrip(req)
+		if err != nil || !retryable(resp.StatusCode) || attempt >= t.opts.MaxAttempts {
+			return resp, err
+		}
+		// A body that can't be read again can't be retried.
+		if req.Body != nil && req.GetBody == nil {
+			return resp, nil
+		}
+
+		// Let the connection be reused.
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+
+		timer := time.NewTimer(t.opts.delay(attempt + 1))
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+}
@@ -0,0 +1,143 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oci
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flaky responds with fail until it has been called failures times.
+func flaky(failures int32, fail int) (*httptest.Server, *int32) {
+	var calls int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		if n <= failures {
+			w.WriteHeader(fail)
+			return
+		}
+		// Echo the body, to check it is sent again on retries.
+		b, _ := ioutil.ReadAll(r.Body)
+		w.Write(b)
+	}))
+	return s, &calls
+}
+
+func TestRetryTransport(t *testing.T) {
+	opts := RetryOptions{MaxAttempts: 3, InitialDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}
+	tests := []struct {
+		name      string
+		failures  int32
+		fail      int
+		wantCode  int
+		wantCalls int32
+	}{{
+		name:      "succeeds after retries",
+		failures:  2,
+		fail:      http.StatusServiceUnavailable,
+		wantCode:  http.StatusOK,
+		wantCalls: 3,
+	}, {
+		name:      "gives up",
+		failures:  5,
+		fail:      http.StatusTooManyRequests,
+		wantCode:  http.StatusTooManyRequests,
+		wantCalls: 3,
+	}, {
+		name:      "not transient",
+		failures:  1,
+		fail:      http.StatusNotFound,
+		wantCode:  http.StatusNotFound,
+		wantCalls: 1,
+	}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s, calls := flaky(test.failures, test.fail)
+			defer s.Close()
+
+			req, err := http.NewRequest(http.MethodPut, s.URL, bytes.NewReader([]byte("body")))
+			if err != nil {
+				t.Fatal(err)
+			}
+			c := &http.Client{Transport: &retryTransport{inner: http.DefaultTransport, opts: opts}}
+			resp, err := c.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != test.wantCode {
+				t.Errorf("status = %d, wanted %d", resp.StatusCode, test.wantCode)
+			}
+			if got := atomic.LoadInt32(calls); got != test.wantCalls {
+				t.Errorf("calls = %d, wanted %d", got, test.wantCalls)
+			}
+			if resp.StatusCode == http.StatusOK {
+				b, _ := ioutil.ReadAll(resp.Body)
+				if string(b) != "body" {
+					t.Errorf("body = %q, wanted it sent again", b)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryTransportCancel(t *testing.T) {
+	s, calls := flaky(5, http.StatusInternalServerError)
+	defer s.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequest(http.MethodGet, s.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := RetryOptions{MaxAttempts: 5, InitialDelay: time.Hour}
+	c := &http.Client{Transport: &retryTransport{inner: http.DefaultTransport, opts: opts}}
+
+	time.AfterFunc(10*time.Millisecond, cancel)
+	start := time.Now()
+	if _, err := c.Do(req.WithContext(ctx)); err == nil {
+		t.Error("Do() after cancel, wanted error")
+	}
+	if d := time.Since(start); d > time.Minute {
+		t.Errorf("Do() took %v, wanted it to stop waiting when cancelled", d)
+	}
+	if got := atomic.LoadInt32(calls); got != 1 {
+		t.Errorf("calls = %d, wanted 1", got)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	r := RetryOptions{InitialDelay: time.Second, MaxDelay: 4 * time.Second}
+	for attempt, max := range map[int]time.Duration{
+		2: time.Second,
+		3: 2 * time.Second,
+		4: 4 * time.Second,
+		8: 4 * time.Second,
+	} {
+		for i := 0; i < 10; i++ {
+			if d := r.delay(attempt); d < max/2 || d > max {
+				t.Errorf("delay(%d) = %v, wanted between %v and %v", attempt, d, max/2, max)
+			}
+		}
+	}
+}
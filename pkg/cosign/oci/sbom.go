@@ -0,0 +1,88 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oci
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// The media types of layers holding a software bill of materials, such as
+// the ones BuildKit and Syft attach to images.
+const (
+	CycloneDXMediaType types.MediaType = "application/vnd.cyclonedx+json"
+	SPDXMediaType      types.MediaType = "application/spdx+json"
+)
+
+// IsSBOM reports whether mt is the media type of an SBOM layer.
+func IsSBOM(mt types.MediaType) bool {
+	return mt == CycloneDXMediaType || mt == SPDXMediaType
+}
+
+// SBOMLayers returns the SBOM layers of the referrers of desc in repo, once
+// each.
+func SBOMLayers(repo name.Repository, desc v1.Descriptor, ro RegistryOptions) ([]v1.Descriptor, error) {
+	refs, _, err := ro.Remote().Referrers(repo, desc.Digest)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[v1.Hash]bool{}
+	sboms := []v1.Descriptor{}
+	for _, r := range refs {
+		if r.ArtifactType == SignatureArtifactType {
+			continue
+		}
+		layers, err := Descriptors(repo.Digest(r.Digest.String()), ro)
+		if err != nil {
+			return nil, err
+		}
+		for _, l := range layers {
+			if IsSBOM(l.MediaType) && !seen[l.Digest] {
+				seen[l.Digest] = true
+				sboms = append(sboms, l)
+			}
+		}
+	}
+	return sboms, nil
+}
+
+// UploadSBOM stores sbom, with media type mt, as a referrer of subject in
+// repo, the way BuildKit and Syft attach SBOMs to images. The registry has to
+// support the referrers API.
+func UploadSBOM(sbom []byte, mt types.MediaType, subject v1.Descriptor, repo name.Repository, ro RegistryOptions) error {
+	if !IsSBOM(mt) {
+		return fmt.Errorf("%s isn't an SBOM media type", mt)
+	}
+	_, ok, err := ro.Remote().Referrers(repo, subject.Digest)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("the registry doesn't support the referrers API")
+	}
+	img, err := mutate.Append(empty.Image, mutate.Addendum{Layer: StaticLayer(sbom, mt)})
+	if err != nil {
+		return err
+	}
+	return uploadReferrer(img, repo, subject, string(mt), ro)
+}
@@ -0,0 +1,59 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oci
+
+import (
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+func TestSBOMLayers(t *testing.T) {
+	ro := RegistryOptions{Client: NewMemoryClient()}
+	ref := mustParse(t, "registry.example.com/image:latest")
+	desc := writeImage(t, ro, ref)
+
+	if err := UploadSBOM([]byte("{}"), types.MediaType("application/json"), desc, ref.Context(), ro); err == nil {
+		t.Error("UploadSBOM() of plain JSON, wanted error")
+	}
+	for _, mt := range []types.MediaType{CycloneDXMediaType, SPDXMediaType} {
+		if err := UploadSBOM([]byte(`{"sbom":"`+string(mt)+`"}`), mt, desc, ref.Context(), ro); err != nil {
+			t.Fatalf("UploadSBOM(%s) = %v", mt, err)
+		}
+	}
+	// Signatures of the image are referrers too, but not SBOMs.
+	payload, err := Payload(desc, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Upload([]byte("signature"), payload, ref.Context().Tag(Munge(desc)), UploadRegistryOptions(ro), WithReferrers(desc)); err != nil {
+		t.Fatal(err)
+	}
+
+	sboms, err := SBOMLayers(ref.Context(), desc, ro)
+	if err != nil {
+		t.Fatalf("SBOMLayers() = %v", err)
+	}
+	if len(sboms) != 2 {
+		t.Fatalf("SBOMLayers() = %v, wanted both SBOMs", sboms)
+	}
+	for _, l := range sboms {
+		if !IsSBOM(l.MediaType) {
+			t.Errorf("SBOMLayers() returned a %s layer", l.MediaType)
+		}
+	}
+}
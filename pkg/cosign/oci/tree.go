@@ -0,0 +1,79 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oci
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// Attachment is a manifest stored alongside another one, either in its
+// signature tag or as a referrer of it.
+type Attachment struct {
+	// Descriptor is of the attached manifest.
+	Descriptor v1.Descriptor
+	// Tag is the signature tag the manifest is stored in. It is empty for
+	// referrers.
+	Tag string
+	// ArtifactType is the artifactType of referrers.
+	ArtifactType string
+	// Layers are the layers of the manifest, such as signatures.
+	Layers []v1.Descriptor
+	// Attachments are attached to this manifest in turn, e.g. the signature
+	// of a signature.
+	Attachments []Attachment
+}
+
+// FetchAttachments returns the manifests attached to desc in repo, and the
+// ones attached to those, up to depth levels deep. A depth of 1 only returns
+// what is attached to desc itself.
+func FetchAttachments(repo name.Repository, desc v1.Descriptor, depth int, ro RegistryOptions) ([]Attachment, error) {
+	if depth <= 0 {
+		return nil, nil
+	}
+	c := ro.Remote()
+	atts := []Attachment{}
+	refs, _, err := c.Referrers(repo, desc.Digest)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range refs {
+		atts = append(atts, Attachment{Descriptor: r.Descriptor, ArtifactType: r.ArtifactType})
+	}
+	tag := repo.Tag(Munge(desc))
+	tagDesc, err := c.Get(tag)
+	switch {
+	case err == nil:
+		atts = append(atts, Attachment{Descriptor: tagDesc, Tag: tag.TagStr()})
+	case !hasStatus(err, http.StatusNotFound):
+		return nil, err
+	}
+
+	for i := range atts {
+		a := &atts[i]
+		if a.Layers, err = Descriptors(repo.Digest(a.Descriptor.Digest.String()), ro); err != nil {
+			return nil, fmt.Errorf("%s: %v", a.Descriptor.Digest, err)
+		}
+		if a.Attachments, err = FetchAttachments(repo, a.Descriptor, depth-1, ro); err != nil {
+			return nil, err
+		}
+	}
+	return atts, nil
+}
@@ -0,0 +1,83 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oci
+
+import (
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+func TestFetchAttachments(t *testing.T) {
+	ro := RegistryOptions{Client: NewMemoryClient()}
+	ref := mustParse(t, "registry.example.com/image:latest")
+	desc := writeImage(t, ro, ref)
+
+	atts, err := FetchAttachments(ref.Context(), desc, 3, ro)
+	if err != nil {
+		t.Fatalf("FetchAttachments() = %v", err)
+	}
+	if len(atts) != 0 {
+		t.Errorf("FetchAttachments() of an unsigned image = %v, wanted none", atts)
+	}
+
+	sign := func(desc v1.Descriptor, opts ...UploadOption) {
+		t.Helper()
+		payload, err := Payload(desc, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		opts = append(opts, UploadRegistryOptions(ro))
+		if err := Upload([]byte("signature"), payload, ref.Context().Tag(Munge(desc)), opts...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sign(desc)
+	sign(desc, WithReferrers(desc))
+	sigTag := ref.Context().Tag(Munge(desc))
+	sigDesc, err := ro.Remote().Get(sigTag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Countersign the signature tag.
+	sign(sigDesc)
+
+	atts, err = FetchAttachments(ref.Context(), desc, 1, ro)
+	if err != nil {
+		t.Fatalf("FetchAttachments() = %v", err)
+	}
+	if len(atts) != 2 {
+		t.Fatalf("FetchAttachments() = %d attachments, wanted the referrer and the tag", len(atts))
+	}
+	if atts[0].ArtifactType != SignatureArtifactType || atts[0].Tag != "" || len(atts[0].Layers) != 1 {
+		t.Errorf("first attachment = %+v, wanted the referrer with one signature", atts[0])
+	}
+	if atts[1].Tag != sigTag.TagStr() || len(atts[1].Layers) != 1 {
+		t.Errorf("second attachment = %+v, wanted %s with one signature", atts[1], sigTag.TagStr())
+	}
+	if len(atts[1].Attachments) != 0 {
+		t.Errorf("FetchAttachments() with depth 1 followed the countersignature")
+	}
+
+	atts, err = FetchAttachments(ref.Context(), desc, 2, ro)
+	if err != nil {
+		t.Fatalf("FetchAttachments() = %v", err)
+	}
+	if got := atts[1].Attachments; len(got) != 1 || got[0].Tag != Munge(sigDesc) {
+		t.Errorf("attachments of %s = %+v, wanted the countersignature", sigTag, got)
+	}
+}
@@ -0,0 +1,334 @@
+package oci
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/sigstore/cosign/pkg/cosign/metrics"
+)
+
+// Descriptors returns the descriptors of the layers of the image ref points
+// at.
+func Descriptors(ref name.Reference, ro RegistryOptions) ([]v1.Descriptor, error) {
+	img, err := ro.Remote().Image(ref)
+	if err != nil {
+		return nil, err
+	}
+	m, err := img.Manifest()
+	if err != nil {
+		return nil, err
+	}
+
+	return m.Layers, nil
+}
+
+// UploadOption configures Upload.
+type UploadOption func(*uploadOpts)
+
+type uploadOpts struct {
+	subject   *v1.Descriptor
+	registry  RegistryOptions
+	mediaType types.MediaType
+	timestamp []byte
+	cert      []byte
+	chain     []byte
+	replace   []ed25519.PublicKey
+}
+
+// WithReferrers stores the signature as a referrer of subject when the
+// registry supports the OCI referrers API, rather than in the signature tag.
+// Upload falls back to the signature tag when it doesn't.
+func WithReferrers(subject v1.Descriptor) UploadOption {
+	return func(o *uploadOpts) {
+		o.subject = &subject
+	}
+}
+
+// UploadRegistryOptions authenticates to the registry with the credentials in
+// ro rather than the default keychain.
+func UploadRegistryOptions(ro RegistryOptions) UploadOption {
+	return func(o *uploadOpts) {
+		o.registry = ro
+	}
+}
+
+// UploadMediaType stores the payload with media type mt, which says what
+// format it is in, instead of SimpleSigningMediaType. cosign.Verify needs a
+// parser for it, see cosign.RegisterPayloadParser.
+func UploadMediaType(mt types.MediaType) UploadOption {
+	return func(o *uploadOpts) {
+		o.mediaType = mt
+	}
+}
+
+// UploadTimestamp stores token, an RFC 3161 timestamp of the signature from
+// cosign.RequestTimestamp, alongside the signature.
+func UploadTimestamp(token []byte) UploadOption {
+	return func(o *uploadOpts) {
+		o.timestamp = token
+	}
+}
+
+// UploadCertificate stores cert, the PEM encoded certificate for the signing
+// key, and chain, the PEM encoded intermediates it was issued by, alongside
+// the signature. Verifiers can then check the key chains up to a root they
+// trust instead of having the key itself, see cosign.VerifyWithCertificates.
+func UploadCertificate(cert, chain []byte) UploadOption {
+	return func(o *uploadOpts) {
+		o.cert = cert
+		o.chain = chain
+	}
+}
+
+// UploadReplace drops the signatures already in the signature tag that verify
+// with one of keys and are of the same media type as one of the signatures
+// being uploaded, so that signing an image again replaces its signature
+// rather than adding another one. Signatures stored as referrers are left
+// alone.
+func UploadReplace(keys ...ed25519.PublicKey) UploadOption {
+	return func(o *uploadOpts) {
+		o.replace = keys
+	}
+}
+
+func Upload(signature, payload []byte, dstTag name.Reference, opts ...UploadOption) error {
+	o := newUploadOpts(opts)
+	sp := SignedPayload{
+		Base64Signature: base64.StdEncoding.EncodeToString(signature),
+		Payload:         payload,
+		MediaType:       o.mediaType,
+	}
+	if o.timestamp != nil {
+		sp.Base64Timestamp = base64.StdEncoding.EncodeToString(o.timestamp)
+	}
+	if o.cert != nil {
+		sp.Base64Certificate = base64.StdEncoding.EncodeToString(o.cert)
+		if o.chain != nil {
+			sp.Base64Chain = base64.StdEncoding.EncodeToString(o.chain)
+		}
+	}
+	return uploadSignatures([]SignedPayload{sp}, dstTag, o)
+}
+
+// UploadSignatures is Upload, for several signatures at once: they are all
+// appended to the signature image in a single write, so signatures by
+// different keys can't race each other on the tag. Each one is stored with
+// its own media type, timestamp and certificate, from its SignedPayload.
+// Signatures without a MediaType get the one from UploadMediaType, or the
+// default.
+func UploadSignatures(sps []SignedPayload, dstTag name.Reference, opts ...UploadOption) error {
+	if len(sps) == 0 {
+		return errors.New("no signatures to upload")
+	}
+	return uploadSignatures(sps, dstTag, newUploadOpts(opts))
+}
+
+func newUploadOpts(opts []UploadOption) *uploadOpts {
+	o := &uploadOpts{
+		mediaType: SimpleSigningMediaType,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+func uploadSignatures(sps []SignedPayload, dstTag name.Reference, o *uploadOpts) error {
+	start := time.Now()
+	err := writeSignatures(sps, dstTag, o)
+	metrics.ObserveRegistry(metrics.OperationUpload, start, err)
+	return err
+}
+
+func writeSignatures(sps []SignedPayload, dstTag name.Reference, o *uploadOpts) error {
+	ro, cancel := o.registry.forPush()
+	defer cancel()
+	o.registry = ro
+
+	addenda := make([]mutate.Addendum, 0, len(sps))
+	mts := map[types.MediaType]bool{}
+	for _, sp := range sps {
+		mt := sp.MediaType
+		if mt == "" {
+			mt = o.mediaType
+		}
+		mts[mt] = true
+		if _, _, err := mime.ParseMediaType(string(mt)); err != nil {
+			return fmt.Errorf("invalid media type %q: %v", mt, err)
+		}
+		signature, err := base64.StdEncoding.DecodeString(sp.Base64Signature)
+		if err != nil {
+			return err
+		}
+
+		addendum := SignatureAddendum(signature, sp.Payload, mt)
+		if sp.Base64Timestamp != "" {
+			addendum.Annotations[TimestampAnnotationKey] = sp.Base64Timestamp
+		}
+		if sp.Base64Certificate != "" {
+			addendum.Annotations[CertificateAnnotationKey] = sp.Base64Certificate
+			if sp.Base64Chain != "" {
+				addendum.Annotations[ChainAnnotationKey] = sp.Base64Chain
+			}
+		}
+		addenda = append(addenda, addendum)
+	}
+
+	if o.subject != nil {
+		_, ok, err := o.registry.Remote().Referrers(dstTag.Context(), o.subject.Digest)
+		if err != nil {
+			return err
+		}
+		if ok {
+			img, err := mutate.Append(empty.Image, addenda...)
+			if err != nil {
+				return err
+			}
+			return uploadReferrer(img, dstTag.Context(), *o.subject, SignatureArtifactType, o.registry)
+		}
+	}
+
+	base, err := o.registry.Remote().Image(dstTag)
+	if err != nil {
+		if !hasStatus(err, http.StatusNotFound) {
+			return err
+		}
+		base = empty.Image
+	} else if len(o.replace) != 0 {
+		if base, err = dropSignatures(base, mts, o.replace); err != nil {
+			return err
+		}
+	}
+
+	img, err := mutate.Append(base, addenda...)
+	if err != nil {
+		return err
+	}
+
+	return o.registry.write(dstTag, img)
+}
+
+// dropSignatures returns img without the layers holding a payload of one of
+// the media types mts, signed by one of keys. The remaining layers keep their
+// order and annotations.
+func dropSignatures(img v1.Image, mts map[types.MediaType]bool, keys []ed25519.PublicKey) (v1.Image, error) {
+	m, err := img.Manifest()
+	if err != nil {
+		return nil, err
+	}
+	kept := make([]mutate.Addendum, 0, len(m.Layers))
+	for _, desc := range m.Layers {
+		l, err := img.LayerByDigest(desc.Digest)
+		if err != nil {
+			return nil, err
+		}
+		if mts[desc.MediaType] {
+			signed, err := signedBy(l, desc.Annotations[SignatureAnnotationKey], keys)
+			if err != nil {
+				return nil, err
+			}
+			if signed {
+				continue
+			}
+		}
+		kept = append(kept, mutate.Addendum{
+			Layer:       l,
+			Annotations: desc.Annotations,
+			MediaType:   desc.MediaType,
+		})
+	}
+	if len(kept) == len(m.Layers) {
+		return img, nil
+	}
+	return mutate.Append(empty.Image, kept...)
+}
+
+// signedBy reports whether base64sig is a signature of the payload in l by
+// one of keys.
+func signedBy(l v1.Layer, base64sig string, keys []ed25519.PublicKey) (bool, error) {
+	signature, err := base64.StdEncoding.DecodeString(base64sig)
+	if err != nil || base64sig == "" {
+		// Not a signature cosign can check, so not one being replaced.
+		return false, nil
+	}
+	r, err := l.Compressed()
+	if err != nil {
+		return false, err
+	}
+	defer r.Close()
+	payload, err := ioutil.ReadAll(r)
+	if err != nil {
+		return false, err
+	}
+	for _, key := range keys {
+		if ed25519.Verify(key, payload, signature) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// SignatureAddendum is the layer holding payload, annotated with its
+// signature, that is appended to a signature image.
+func SignatureAddendum(signature, payload []byte, mt types.MediaType) mutate.Addendum {
+	return mutate.Addendum{
+		Layer: StaticLayer(payload, mt),
+		Annotations: map[string]string{
+			SignatureAnnotationKey: base64.StdEncoding.EncodeToString(signature),
+		},
+	}
+}
+
+// StaticLayer returns a layer holding b, with media type mt, as it is.
+func StaticLayer(b []byte, mt types.MediaType) v1.Layer {
+	return &staticLayer{b: b, mt: mt}
+}
+
+type staticLayer struct {
+	b  []byte
+	mt types.MediaType
+}
+
+func (l *staticLayer) Digest() (v1.Hash, error) {
+	h, _, err := v1.SHA256(bytes.NewReader(l.b))
+	return h, err
+}
+
+// DiffID returns the Hash of the uncompressed layer.
+func (l *staticLayer) DiffID() (v1.Hash, error) {
+	h, _, err := v1.SHA256(bytes.NewReader(l.b))
+	return h, err
+}
+
+// Compressed returns an io.ReadCloser for the compressed layer contents.
+func (l *staticLayer) Compressed() (io.ReadCloser, error) {
+	return ioutil.NopCloser(bytes.NewReader(l.b)), nil
+}
+
+// Uncompressed returns an io.ReadCloser for the uncompressed layer contents.
+func (l *staticLayer) Uncompressed() (io.ReadCloser, error) {
+	return ioutil.NopCloser(bytes.NewReader(l.b)), nil
+}
+
+// Size returns the compressed size of the Layer.
+func (l *staticLayer) Size() (int64, error) {
+	return int64(len(l.b)), nil
+}
+
+// MediaType returns the media type of the Layer.
+func (l *staticLayer) MediaType() (types.MediaType, error) {
+	return l.mt, nil
+}
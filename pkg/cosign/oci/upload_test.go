@@ -0,0 +1,313 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package oci
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sigstore/cosign/pkg/cosign/metrics"
+)
+
+// writeImage writes a random image to ref with ro's client, and returns
+// its descriptor.
+func writeImage(t *testing.T, ro RegistryOptions, ref name.Reference) v1.Descriptor {
+	t.Helper()
+	img, err := random.Image(512, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ro.Remote().Write(ref, img); err != nil {
+		t.Fatal(err)
+	}
+	desc, err := ro.Remote().Get(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return desc
+}
+
+func mustParse(t *testing.T, s string) name.Reference {
+	t.Helper()
+	ref, err := name.ParseReference(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ref
+}
+
+func TestUploadAndFetch(t *testing.T) {
+	uploaded := 0
+	ro := RegistryOptions{
+		Client: NewMemoryClient(),
+		Progress: func(event string, done, total int64) {
+			if event == ProgressUpload && done == total {
+				uploaded++
+			}
+		},
+	}
+	ref := mustParse(t, "registry.example.com/image:latest")
+	desc := writeImage(t, ro, ref)
+	sigTag := ref.Context().Tag(Munge(desc))
+
+	if _, _, err := FetchSignatures(ref, ro); err == nil {
+		t.Error("FetchSignatures() before signing, wanted error")
+	}
+
+	payload, err := Payload(desc, map[string]string{"foo": "bar"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Upload([]byte("first"), payload, sigTag, UploadRegistryOptions(ro)); err != nil {
+		t.Fatal(err)
+	}
+	if err := Upload([]byte("second"), payload, sigTag, UploadRegistryOptions(ro), UploadTimestamp([]byte("token")), UploadCertificate([]byte("cert"), []byte("chain"))); err != nil {
+		t.Fatal(err)
+	}
+	if uploaded != 2 {
+		t.Errorf("uploads reported = %d, wanted 2", uploaded)
+	}
+
+	sps, got, err := FetchSignatures(ref, ro)
+	if err != nil {
+		t.Fatalf("FetchSignatures() = %v", err)
+	}
+	if got.Digest != desc.Digest {
+		t.Errorf("FetchSignatures() descriptor = %s, wanted %s", got.Digest, desc.Digest)
+	}
+	if len(sps) != 2 {
+		t.Fatalf("FetchSignatures() = %d signatures, wanted 2", len(sps))
+	}
+	b64 := base64.StdEncoding.EncodeToString
+	for i, want := range []SignedPayload{{
+		Base64Signature: b64([]byte("first")),
+		Payload:         payload,
+		MediaType:       SimpleSigningMediaType,
+	}, {
+		Base64Signature:   b64([]byte("second")),
+		Payload:           payload,
+		Base64Timestamp:   b64([]byte("token")),
+		Base64Certificate: b64([]byte("cert")),
+		Base64Chain:       b64([]byte("chain")),
+		MediaType:         SimpleSigningMediaType,
+	}} {
+		sp := sps[i]
+		if sp.Base64Signature != want.Base64Signature || string(sp.Payload) != string(want.Payload) ||
+			sp.Base64Timestamp != want.Base64Timestamp || sp.Base64Certificate != want.Base64Certificate ||
+			sp.Base64Chain != want.Base64Chain || sp.MediaType != want.MediaType {
+			t.Errorf("signature %d = %+v, wanted %+v", i, sp, want)
+		}
+	}
+}
+
+func TestUploadReplace(t *testing.T) {
+	ro := RegistryOptions{Client: NewMemoryClient()}
+	ref := mustParse(t, "registry.example.com/image:latest")
+	desc := writeImage(t, ro, ref)
+	sigTag := ref.Context().Tag(Munge(desc))
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPub, otherPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := Payload(desc, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	upload := func(priv ed25519.PrivateKey, mt types.MediaType, opts ...UploadOption) {
+		t.Helper()
+		opts = append(opts, UploadRegistryOptions(ro), UploadMediaType(mt))
+		if err := Upload(ed25519.Sign(priv, payload), payload, sigTag, opts...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	upload(priv, SimpleSigningMediaType)
+	upload(otherPriv, SimpleSigningMediaType)
+	upload(priv, "application/vnd.example+json")
+	upload(priv, SimpleSigningMediaType, UploadReplace(pub))
+	upload(priv, SimpleSigningMediaType, UploadReplace(pub))
+
+	sps, _, err := FetchSignatures(ref, ro)
+	if err != nil {
+		t.Fatalf("FetchSignatures() = %v", err)
+	}
+	// The other key's signature and the other media type are kept, in order,
+	// and only one simple signing signature by the key is left.
+	want := []struct {
+		key ed25519.PublicKey
+		mt  types.MediaType
+	}{
+		{otherPub, SimpleSigningMediaType},
+		{pub, "application/vnd.example+json"},
+		{pub, SimpleSigningMediaType},
+	}
+	if len(sps) != len(want) {
+		t.Fatalf("FetchSignatures() = %d signatures, wanted %d", len(sps), len(want))
+	}
+	for i, w := range want {
+		sig, err := base64.StdEncoding.DecodeString(sps[i].Base64Signature)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ed25519.Verify(w.key, sps[i].Payload, sig) || sps[i].MediaType != w.mt {
+			t.Errorf("signature %d has media type %s, wanted %s by the %d-th expected key", i, sps[i].MediaType, w.mt, i)
+		}
+	}
+}
+
+func TestUploadReferrers(t *testing.T) {
+	ro := RegistryOptions{Client: NewMemoryClient()}
+	ref := mustParse(t, "registry.example.com/image:latest")
+	desc := writeImage(t, ro, ref)
+	sigTag := ref.Context().Tag(Munge(desc))
+
+	payload, err := Payload(desc, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Upload([]byte("signature"), payload, sigTag, UploadRegistryOptions(ro), WithReferrers(desc)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ro.Remote().Get(sigTag); !hasStatus(err, http.StatusNotFound) {
+		t.Errorf("Get(%s) = %v, wanted the signature stored as a referrer instead", sigTag, err)
+	}
+	refs, ok, err := ro.Remote().Referrers(ref.Context(), desc.Digest)
+	if err != nil || !ok {
+		t.Fatalf("Referrers() = %v, %v", ok, err)
+	}
+	if len(refs) != 1 || refs[0].ArtifactType != SignatureArtifactType {
+		t.Errorf("Referrers() = %v, wanted one signature", refs)
+	}
+
+	sps, _, err := FetchSignatures(ref, ro)
+	if err != nil {
+		t.Fatalf("FetchSignatures() = %v", err)
+	}
+	if len(sps) != 1 || string(sps[0].Payload) != string(payload) {
+		t.Errorf("FetchSignatures() = %v, wanted the referrer", sps)
+	}
+
+	if err := CleanSignatures(context.Background(), ref, ro); err != nil {
+		t.Fatalf("CleanSignatures() = %v", err)
+	}
+	if _, _, err := FetchSignatures(ref, ro); err == nil {
+		t.Error("FetchSignatures() after CleanSignatures(), wanted error")
+	}
+	if err := CleanSignatures(context.Background(), ref, ro); err == nil {
+		t.Error("CleanSignatures() without signatures, wanted error")
+	}
+}
+
+func TestFetchSignaturesRecursive(t *testing.T) {
+	c := NewMemoryClient()
+	ro := RegistryOptions{Client: c}
+	ref := mustParse(t, "registry.example.com/index:latest")
+	idx, err := random.Index(512, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	im, err := idx.IndexManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, desc := range im.Manifests {
+		img, err := idx.Image(desc.Digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Write(ref.Context().Digest(desc.Digest.String()), img); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.WriteIndex(ref, idx); err != nil {
+		t.Fatal(err)
+	}
+
+	sign := func(desc v1.Descriptor) {
+		payload, err := Payload(desc, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := Upload([]byte("signature"), payload, ref.Context().Tag(Munge(desc)), UploadRegistryOptions(ro)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	idxDesc, err := c.Get(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign(idxDesc)
+	sign(im.Manifests[0])
+	if _, err := FetchSignaturesRecursive(ref, ro); err == nil {
+		t.Error("FetchSignaturesRecursive() with an unsigned manifest, wanted error")
+	}
+
+	sign(im.Manifests[1])
+	res, err := FetchSignaturesRecursive(ref, ro)
+	if err != nil {
+		t.Fatalf("FetchSignaturesRecursive() = %v", err)
+	}
+	if len(res.Signatures) != 1 || len(res.Manifests) != 2 {
+		t.Errorf("FetchSignaturesRecursive() = %d signatures and %d manifests, wanted 1 and 2", len(res.Signatures), len(res.Manifests))
+	}
+}
+
+func TestUploadAndFetchMetrics(t *testing.T) {
+	ro := RegistryOptions{Client: NewMemoryClient()}
+	ref := mustParse(t, "registry.example.com/image:latest")
+	desc := writeImage(t, ro, ref)
+	count := func(operation, status string) float64 {
+		return testutil.ToFloat64(metrics.RegistryRequests.WithLabelValues(operation, status))
+	}
+	uploads, fetches, misses := count(metrics.OperationUpload, "ok"), count(metrics.OperationFetchSignatures, "ok"), count(metrics.OperationFetchSignatures, "error")
+
+	if _, _, err := FetchSignatures(ref, ro); err == nil {
+		t.Fatal("FetchSignatures() before signing, wanted error")
+	}
+	payload, err := Payload(desc, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Upload([]byte("signature"), payload, ref.Context().Tag(Munge(desc)), UploadRegistryOptions(ro)); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := FetchSignatures(ref, ro); err != nil {
+		t.Fatal(err)
+	}
+	if got := count(metrics.OperationUpload, "ok") - uploads; got != 1 {
+		t.Errorf("uploads counted = %v, wanted 1", got)
+	}
+	if got := count(metrics.OperationFetchSignatures, "ok") - fetches; got != 1 {
+		t.Errorf("fetches counted = %v, wanted 1", got)
+	}
+	if got := count(metrics.OperationFetchSignatures, "error") - misses; got != 1 {
+		t.Errorf("failed fetches counted = %v, wanted 1", got)
+	}
+}
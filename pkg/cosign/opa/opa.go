@@ -0,0 +1,87 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package opa evaluates cosign verification results with Open Policy Agent.
+package opa
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/open-policy-agent/opa/rego"
+	"github.com/sigstore/cosign/pkg/cosign"
+	"github.com/sigstore/cosign/pkg/cosign/oci"
+)
+
+// VerifyWithOPA verifies the signatures on ref, then evaluates query against
+// regoModule with the verified payloads as input.
+// It returns whether the policy allowed the image, and the raw result set.
+func VerifyWithOPA(ctx context.Context, ref name.Reference, pubKey ed25519.PublicKey, annotations map[string]string, regoModule, query string, opts ...cosign.VerifyOption) (bool, interface{}, error) {
+	verified, err := cosign.Verify(ref, pubKey, true, annotations, opts...)
+	if err != nil {
+		return false, nil, err
+	}
+	return Evaluate(ctx, verified, regoModule, query)
+}
+
+// Evaluate evaluates query against regoModule with signatures as input.
+// The input document looks like:
+//
+//	{"signatures": [{"payload": {...}, "signature": "<base64>"}]}
+//
+// Payloads that are JSON are decoded, anything else is passed as a string.
+// The policy allows the signatures if the query has a single result, and
+// every expression in it is true.
+func Evaluate(ctx context.Context, signatures []oci.SignedPayload, regoModule, query string) (bool, interface{}, error) {
+	r := rego.New(
+		rego.Query(query),
+		rego.Module("cosign.rego", regoModule),
+		rego.Input(Input(signatures)),
+	)
+	rs, err := r.Eval(ctx)
+	if err != nil {
+		return false, nil, err
+	}
+	if len(rs) != 1 || len(rs[0].Expressions) == 0 {
+		return false, rs, nil
+	}
+	for _, e := range rs[0].Expressions {
+		if b, ok := e.Value.(bool); !ok || !b {
+			return false, rs, nil
+		}
+	}
+	return true, rs, nil
+}
+
+// Input converts signatures into the input document for a policy.
+func Input(signatures []oci.SignedPayload) map[string]interface{} {
+	sigs := []interface{}{}
+	for _, sp := range signatures {
+		var payload interface{}
+		if err := json.Unmarshal(sp.Payload, &payload); err != nil {
+			payload = string(sp.Payload)
+		}
+		sigs = append(sigs, map[string]interface{}{
+			"payload":   payload,
+			"signature": sp.Base64Signature,
+		})
+	}
+	return map[string]interface{}{
+		"signatures": sigs,
+	}
+}
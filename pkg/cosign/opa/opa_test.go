@@ -0,0 +1,86 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opa
+
+import (
+	"context"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/sigstore/cosign/pkg/cosign/oci"
+)
+
+const module = `
+package cosign
+
+default allow = false
+
+allow {
+	input.signatures[_].payload.Optional.env == "prod"
+}
+`
+
+func TestEvaluate(t *testing.T) {
+	h, err := v1.NewHash("sha256:87ef60f558bad79beea6425a3b28989f01dd417164150ab3baab98dcbf04def8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := func(a map[string]string) oci.SignedPayload {
+		b, err := oci.Payload(v1.Descriptor{Digest: h}, a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return oci.SignedPayload{Payload: b}
+	}
+
+	tests := []struct {
+		name       string
+		signatures []oci.SignedPayload
+		want       bool
+	}{{
+		name:       "allowed",
+		signatures: []oci.SignedPayload{payload(map[string]string{"env": "prod"})},
+		want:       true,
+	}, {
+		name:       "one of many",
+		signatures: []oci.SignedPayload{payload(nil), payload(map[string]string{"env": "prod"})},
+		want:       true,
+	}, {
+		name:       "wrong annotation",
+		signatures: []oci.SignedPayload{payload(map[string]string{"env": "dev"})},
+		want:       false,
+	}, {
+		name:       "not json",
+		signatures: []oci.SignedPayload{{Payload: []byte("hello")}},
+		want:       false,
+	}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, _, err := Evaluate(context.Background(), test.signatures, module, "data.cosign.allow")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Errorf("Evaluate() = %t, wanted %t", got, test.want)
+			}
+		})
+	}
+
+	if _, _, err := Evaluate(context.Background(), nil, "not rego", "data.cosign.allow"); err == nil {
+		t.Error("expected error evaluating invalid module")
+	}
+}
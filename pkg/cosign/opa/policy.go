@@ -0,0 +1,170 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opa
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/open-policy-agent/opa/rego"
+	"github.com/sigstore/cosign/pkg/cosign"
+	"github.com/sigstore/cosign/pkg/cosign/oci"
+)
+
+// DenyQuery is what CheckPolicy queries a policy for: the messages of its
+// deny rules, in package cosign. Each message is a violation.
+const DenyQuery = "data.cosign.deny"
+
+// Violation is a message of a deny rule for one of the signatures checked.
+type Violation struct {
+	// Signature is the index of the signature in those checked.
+	Signature int
+	Message   string
+}
+
+// PolicyError is returned by CheckPolicy when the policy denies any of the
+// signatures.
+type PolicyError struct {
+	Violations []Violation
+}
+
+func (e *PolicyError) Error() string {
+	msgs := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		msgs = append(msgs, fmt.Sprintf("signature %d: %s", v.Signature, v.Message))
+	}
+	return fmt.Sprintf("signatures violate the policy:\n  %s", strings.Join(msgs, "\n  "))
+}
+
+// CheckPolicy evaluates DenyQuery against the Rego module policy for each of
+// signatures, with SignatureInput as input, and returns a *PolicyError if
+// any rule denies any of them.
+func CheckPolicy(ctx context.Context, policy string, signatures []oci.SignedPayload, tsaRoots *x509.CertPool, rb *cosign.RekorBundle) error {
+	pq, err := rego.New(
+		rego.Query(DenyQuery),
+		rego.Module("policy.rego", policy),
+	).PrepareForEval(ctx)
+	if err != nil {
+		return err
+	}
+	e := &PolicyError{}
+	for i, sp := range signatures {
+		input, err := SignatureInput(sp, tsaRoots, rb)
+		if err != nil {
+			return fmt.Errorf("signature %d: %v", i, err)
+		}
+		rs, err := pq.Eval(ctx, rego.EvalInput(input))
+		if err != nil {
+			return err
+		}
+		msgs := []string{}
+		for _, r := range rs {
+			for _, ex := range r.Expressions {
+				denied, ok := ex.Value.([]interface{})
+				if !ok {
+					return fmt.Errorf("%s is a %T, wanted a set of messages", DenyQuery, ex.Value)
+				}
+				for _, m := range denied {
+					msgs = append(msgs, fmt.Sprint(m))
+				}
+			}
+		}
+		sort.Strings(msgs)
+		for _, m := range msgs {
+			e.Violations = append(e.Violations, Violation{Signature: i, Message: m})
+		}
+	}
+	if len(e.Violations) != 0 {
+		return e
+	}
+	return nil
+}
+
+// SignatureInput converts sp into the input document for CheckPolicy:
+//
+//	{
+//	  "payload": {...},
+//	  "signature": "<base64>",
+//	  "certificate": {"subject": "...", "issuer": "...", "emails": [...], "uris": [...], "notBefore": "...", "notAfter": "..."},
+//	  "timestamp": "<RFC 3339>",
+//	  "rekor": {"logIndex": 1, "integratedTime": 1600000000, "logID": "<hex>"}
+//	}
+//
+// The payload is decoded if it's JSON, like Input does. The certificate is
+// only there if one was stored with the signature, and the timestamp if
+// there's an RFC 3161 timestamp of the signature that verifies with
+// tsaRoots. The Rekor entry comes from rb, if it's set.
+func SignatureInput(sp oci.SignedPayload, tsaRoots *x509.CertPool, rb *cosign.RekorBundle) (map[string]interface{}, error) {
+	var payload interface{}
+	if err := json.Unmarshal(sp.Payload, &payload); err != nil {
+		payload = string(sp.Payload)
+	}
+	input := map[string]interface{}{
+		"payload":   payload,
+		"signature": sp.Base64Signature,
+	}
+
+	if sp.Base64Certificate != "" {
+		cert, err := cosign.ExtractCertificate(sp)
+		if err != nil {
+			return nil, err
+		}
+		uris := []string{}
+		for _, u := range cert.URIs {
+			uris = append(uris, u.String())
+		}
+		input["certificate"] = map[string]interface{}{
+			"subject":   cert.Subject.String(),
+			"issuer":    cert.Issuer.String(),
+			"emails":    append([]string{}, cert.EmailAddresses...),
+			"uris":      uris,
+			"notBefore": cert.NotBefore.UTC().Format(time.RFC3339),
+			"notAfter":  cert.NotAfter.UTC().Format(time.RFC3339),
+		}
+	}
+
+	if sp.Base64Timestamp != "" && tsaRoots != nil {
+		token, err := base64.StdEncoding.DecodeString(sp.Base64Timestamp)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timestamp: %v", err)
+		}
+		signature, err := base64.StdEncoding.DecodeString(sp.Base64Signature)
+		if err != nil {
+			return nil, err
+		}
+		t, err := cosign.VerifyTimestamp(token, signature, tsaRoots)
+		if err != nil {
+			return nil, err
+		}
+		input["timestamp"] = t.UTC().Format(time.RFC3339)
+	}
+
+	if rb != nil {
+		input["rekor"] = map[string]interface{}{
+			"logIndex":       rb.Payload.LogIndex,
+			"integratedTime": rb.Payload.IntegratedTime,
+			"logID":          rb.Payload.LogID,
+		}
+	}
+	return input, nil
+}
@@ -0,0 +1,137 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opa
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/sigstore/cosign/pkg/cosign"
+	"github.com/sigstore/cosign/pkg/cosign/oci"
+)
+
+const denyModule = `
+package cosign
+
+deny[msg] {
+	input.payload.Optional.env != "prod"
+	msg := sprintf("env is %s, not prod", [input.payload.Optional.env])
+}
+
+deny[msg] {
+	email := input.certificate.emails[_]
+	not endswith(email, "@example.com")
+	msg := sprintf("signer %s isn't from example.com", [email])
+}
+
+deny["signature is older than 24 hours"] {
+	time.now_ns() - input.rekor.integratedTime * 1000000000 > 24 * 60 * 60 * 1000000000
+}
+`
+
+func TestCheckPolicy(t *testing.T) {
+	h, err := v1.NewHash("sha256:87ef60f558bad79beea6425a3b28989f01dd417164150ab3baab98dcbf04def8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFor := func(email string) string {
+		tmpl := &x509.Certificate{
+			SerialNumber:   big.NewInt(1),
+			Subject:        pkix.Name{CommonName: email},
+			EmailAddresses: []string{email},
+			NotBefore:      time.Now().Add(-time.Hour),
+			NotAfter:       time.Now().Add(time.Hour),
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, pub, priv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	}
+	signed := func(env, cert string) oci.SignedPayload {
+		b, err := oci.Payload(v1.Descriptor{Digest: h}, map[string]string{"env": env})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return oci.SignedPayload{Payload: b, Base64Signature: "c2lnbmF0dXJl", Base64Certificate: cert}
+	}
+	rekor := func(age time.Duration) *cosign.RekorBundle {
+		return &cosign.RekorBundle{Payload: cosign.RekorPayload{LogIndex: 1, IntegratedTime: time.Now().Add(-age).Unix(), LogID: "abcd"}}
+	}
+
+	for _, test := range []struct {
+		name       string
+		signatures []oci.SignedPayload
+		rb         *cosign.RekorBundle
+		want       []Violation
+	}{{
+		name:       "allowed",
+		signatures: []oci.SignedPayload{signed("prod", certFor("alice@example.com"))},
+		rb:         rekor(time.Hour),
+	}, {
+		name:       "without certificate or rekor",
+		signatures: []oci.SignedPayload{signed("prod", "")},
+	}, {
+		name:       "wrong annotation on one",
+		signatures: []oci.SignedPayload{signed("prod", ""), signed("dev", "")},
+		want:       []Violation{{Signature: 1, Message: "env is dev, not prod"}},
+	}, {
+		name:       "everything wrong",
+		signatures: []oci.SignedPayload{signed("dev", certFor("mallory@example.org"))},
+		rb:         rekor(48 * time.Hour),
+		want: []Violation{
+			{Signature: 0, Message: "env is dev, not prod"},
+			{Signature: 0, Message: "signature is older than 24 hours"},
+			{Signature: 0, Message: "signer mallory@example.org isn't from example.com"},
+		},
+	}} {
+		t.Run(test.name, func(t *testing.T) {
+			err := CheckPolicy(context.Background(), denyModule, test.signatures, nil, test.rb)
+			if test.want == nil {
+				if err != nil {
+					t.Errorf("CheckPolicy() = %v", err)
+				}
+				return
+			}
+			pe, ok := err.(*PolicyError)
+			if !ok {
+				t.Fatalf("CheckPolicy() = %v, wanted a *PolicyError", err)
+			}
+			if !reflect.DeepEqual(pe.Violations, test.want) {
+				t.Errorf("Violations = %+v, wanted %+v", pe.Violations, test.want)
+			}
+		})
+	}
+
+	if err := CheckPolicy(context.Background(), "package cosign\ndeny[", nil, nil, nil); err == nil {
+		t.Error("CheckPolicy() with an invalid policy, wanted error")
+	}
+}
@@ -0,0 +1,93 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cosign
+
+import (
+	"context"
+	"crypto/ed25519"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/sigstore/cosign/pkg/cosign/oci"
+)
+
+// IsPattern reports whether the tag of ref contains glob characters, and
+// should be verified with VerifyPattern.
+func IsPattern(ref string) bool {
+	_, tag := splitPattern(ref)
+	return strings.ContainsAny(tag, "*?[")
+}
+
+// splitPattern splits repo:tag at the ":" before the tag, if there is one.
+// A ":" before the last "/" is a registry port.
+func splitPattern(pattern string) (string, string) {
+	i := strings.LastIndex(pattern, ":")
+	if i == -1 || i < strings.LastIndex(pattern, "/") {
+		return pattern, ""
+	}
+	return pattern[:i], pattern[i+1:]
+}
+
+// VerifyPattern verifies every image in a repository with a tag matching
+// pattern, like myrepo/myimage:v1.*. Tags are matched with filepath.Match.
+// It returns the verified payloads of every image that verified, and the
+// errors of every image that didn't, both keyed by the image's reference.
+func VerifyPattern(ctx context.Context, pattern string, pubKey ed25519.PublicKey, checkClaims bool, annotations map[string]string, opts ...VerifyOption) (map[string][]oci.SignedPayload, map[string]error, error) {
+	o := newVerifyOpts(opts)
+
+	repoStr, tagPattern := splitPattern(pattern)
+	if tagPattern == "" {
+		return nil, nil, fmt.Errorf("no tag pattern in %q", pattern)
+	}
+	if _, err := filepath.Match(tagPattern, ""); err != nil {
+		return nil, nil, fmt.Errorf("invalid tag pattern %q: %v", tagPattern, err)
+	}
+	repo, err := name.NewRepository(repoStr, o.registry.NameOptions()...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tags, err := o.registry.Remote().List(repo)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	verified := map[string][]oci.SignedPayload{}
+	failed := map[string]error{}
+	for _, tag := range tags {
+		// Signature tags never hold images to verify.
+		if strings.HasSuffix(tag, oci.SignatureTagSuffix) {
+			continue
+		}
+		if ok, _ := filepath.Match(tagPattern, tag); !ok {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return verified, failed, err
+		}
+		ref := repo.Tag(tag)
+		sps, err := Verify(ref, pubKey, checkClaims, annotations, opts...)
+		if err != nil {
+			failed[ref.String()] = err
+			continue
+		}
+		verified[ref.String()] = sps
+	}
+	return verified, failed, nil
+}
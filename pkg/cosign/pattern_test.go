@@ -0,0 +1,40 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cosign
+
+import "testing"
+
+func TestIsPattern(t *testing.T) {
+	tests := []struct {
+		ref  string
+		want bool
+	}{
+		{"myrepo/myimage", false},
+		{"myrepo/myimage:v1", false},
+		{"myrepo/myimage:v1.*", true},
+		{"myrepo/myimage:*-alpine", true},
+		{"myrepo/myimage:v[12]", true},
+		{"localhost:5000/myimage", false},
+		{"localhost:5000/myimage:v?", true},
+		{"myrepo/myimage@sha256:abc", false},
+	}
+	for _, test := range tests {
+		if got := IsPattern(test.ref); got != test.want {
+			t.Errorf("IsPattern(%q) = %t, wanted %t", test.ref, got, test.want)
+		}
+	}
+}
@@ -17,25 +17,280 @@ limitations under the License.
 package cosign
 
 import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
 
 	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/sigstore/cosign/pkg/cosign/oci"
 )
 
-func Payload(img v1.Descriptor, a map[string]string) ([]byte, error) {
-	simpleSigning := SimpleSigning{
-		Critical: Critical{
-			Image: Image{
-				DockerManifestDigest: img.Digest.Hex,
-			},
-			Type: "cosign container signature",
-		},
-		Optional: a,
+const (
+	// InTotoMediaType is the media type of in-toto statements.
+	InTotoMediaType types.MediaType = "application/vnd.in-toto+json"
+	// JWSMediaType is the media type of compact serialized JSON web
+	// signatures, which is how Docker Content Trust (Notary v1) signs the
+	// TUF targets metadata of an image.
+	JWSMediaType types.MediaType = "application/jose"
+	// ContainerConfigMediaType is the media type of signatures of an image's
+	// config blob, rather than its manifest. Their payloads are simple
+	// signing, with the digest of the config.
+	ContainerConfigMediaType types.MediaType = types.OCIConfigJSON
+)
+
+// SignerIdentityAnnotation is the annotation naming who signed an image, such
+// as alice@example.com or github.com/acme/deploy-action. It is free-form, and
+// only as trustworthy as the key that signed it.
+const SignerIdentityAnnotation = "dev.sigstore.cosign/signerIdentity"
+
+// The annotations describing the GitHub Actions run that signed an image,
+// from its GITHUB_* environment variables.
+const (
+	GitHubRepositoryAnnotation = "dev.sigstore.cosign/github-repository"
+	// GitHubRefAnnotation is the full ref, e.g. refs/heads/main.
+	GitHubRefAnnotation      = "dev.sigstore.cosign/github-ref"
+	GitHubSHAAnnotation      = "dev.sigstore.cosign/github-sha"
+	GitHubWorkflowAnnotation = "dev.sigstore.cosign/github-workflow"
+)
+
+// ExpiryAnnotation is the RFC 3339 time after which a signature shouldn't be
+// trusted, added by sign -expire-in. Verify rejects claims past it unless
+// VerifyIgnoreExpiry is set.
+const ExpiryAnnotation = "dev.sigstore.cosign/expiry"
+
+// NotBeforeAnnotation is the RFC 3339 time before which a signature shouldn't
+// be trusted yet, added by sign -not-before. Verify rejects claims before it.
+const NotBeforeAnnotation = "dev.sigstore.cosign/not-before"
+
+// TimestampAnnotation is the RFC 3339 time an image was signed, by the
+// signer's clock, added by sign -record-creation-timestamp. It's only as
+// trustworthy as the key that signed it; see VerifyTimestampAuthority for a
+// timestamp that isn't.
+const TimestampAnnotation = "dev.sigstore.cosign/timestamp"
+
+// SBOMAnnotation is the digest of the SBOM layer sign -sbom generated for an
+// image and attached to it as a referrer.
+const SBOMAnnotation = "dev.sigstore.cosign/sbom"
+
+// PayloadClaims is what a PayloadParser found in a payload.
+type PayloadClaims struct {
+	// Digests are the hex encoded sha256 digests of the images the payload
+	// is about. Verify checks the image being verified is one of them.
+	Digests []string
+	// Annotations are checked against the ones passed to Verify.
+	Annotations map[string]string
+}
+
+// PayloadParser parses a payload of one media type.
+type PayloadParser func(payload []byte) (*PayloadClaims, error)
+
+var (
+	payloadParsersMu sync.RWMutex
+	payloadParsers   = map[types.MediaType]PayloadParser{
+		oci.SimpleSigningMediaType: parseSimpleSigning,
+		InTotoMediaType:            parseInToto,
+		JWSMediaType:               parseJWS,
+		ContainerConfigMediaType:   parseSimpleSigning,
 	}
+)
+
+// RegisterPayloadParser makes Verify parse payloads stored with media type mt
+// with p, replacing any parser already registered for mt.
+func RegisterPayloadParser(mt types.MediaType, p PayloadParser) {
+	payloadParsersMu.Lock()
+	defer payloadParsersMu.Unlock()
+	payloadParsers[mt] = p
+}
 
-	b, err := json.Marshal(simpleSigning)
+// ParsePayload parses payload with the parser registered for mt, the way
+// Verify does, so its claims can be checked before it's signed. Payloads
+// without a media type are assumed to be simple signing.
+func ParsePayload(mt types.MediaType, payload []byte) (*PayloadClaims, error) {
+	return digestAndClaims(mt, payload)
+}
+
+// digestAndClaims parses payload with the parser registered for mt. Payloads
+// without a media type are assumed to be simple signing.
+func digestAndClaims(mt types.MediaType, payload []byte) (*PayloadClaims, error) {
+	switch mt {
+	case "":
+		mt = oci.SimpleSigningMediaType
+	case DSSEMediaType:
+		// Envelopes wrap a payload of another media type.
+		return parseDSSE(payload)
+	}
+	payloadParsersMu.RLock()
+	p, ok := payloadParsers[mt]
+	payloadParsersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unsupported payload media type %q", mt)
+	}
+	return p(payload)
+}
+
+// parseSimpleSigning parses oci.SimpleSigning payloads, or
+// oci.SimpleSigningV2 ones if they have a version.
+func parseSimpleSigning(payload []byte) (*PayloadClaims, error) {
+	var version struct {
+		Version string `json:"version"`
+	}
+	if err := json.Unmarshal(payload, &version); err != nil {
+		return nil, err
+	}
+	switch version.Version {
+	case "":
+	case oci.SimpleSigningV2Version:
+		return parseSimpleSigningV2(payload)
+	default:
+		return nil, fmt.Errorf("unsupported simple signing version %q", version.Version)
+	}
+
+	ss := oci.SimpleSigning{}
+	if err := json.Unmarshal(payload, &ss); err != nil {
+		return nil, err
+	}
+	return &PayloadClaims{
+		Digests:     []string{ss.Critical.Image.DockerManifestDigest},
+		Annotations: annotationValues(ss.Optional),
+	}, nil
+}
+
+func parseSimpleSigningV2(payload []byte) (*PayloadClaims, error) {
+	ss := oci.SimpleSigningV2{}
+	if err := json.Unmarshal(payload, &ss); err != nil {
+		return nil, err
+	}
+	h, err := v1.NewHash(ss.Critical.Image.Digest)
 	if err != nil {
+		return nil, fmt.Errorf("invalid image digest: %v", err)
+	}
+	if h.Algorithm != "sha256" {
+		return nil, fmt.Errorf("unsupported image digest algorithm %q", h.Algorithm)
+	}
+	return &PayloadClaims{
+		Digests:     []string{h.Hex},
+		Annotations: annotationValues(ss.Optional),
+	}, nil
+}
+
+// annotationValues flattens structured annotations into strings, so they can
+// be compared with the ones passed to Verify: strings are used as they are,
+// and anything else is compacted JSON.
+func annotationValues(raw map[string]json.RawMessage) map[string]string {
+	if raw == nil {
+		return nil
+	}
+	annotations := make(map[string]string, len(raw))
+	for k, v := range raw {
+		var s string
+		if err := json.Unmarshal(v, &s); err == nil {
+			annotations[k] = s
+			continue
+		}
+		b := bytes.Buffer{}
+		if err := json.Compact(&b, v); err != nil {
+			annotations[k] = string(v)
+			continue
+		}
+		annotations[k] = b.String()
+	}
+	return annotations
+}
+
+// parseInToto parses an in-toto statement, whose subjects are the images it
+// is about. Statements don't have annotations.
+func parseInToto(payload []byte) (*PayloadClaims, error) {
+	var st struct {
+		Subject []struct {
+			Digest map[string]string `json:"digest"`
+		} `json:"subject"`
+	}
+	if err := json.Unmarshal(payload, &st); err != nil {
 		return nil, err
 	}
-	return b, err
+	claims := &PayloadClaims{}
+	for _, s := range st.Subject {
+		if d, ok := s.Digest["sha256"]; ok {
+			claims.Digests = append(claims.Digests, d)
+		}
+	}
+	return claims, nil
+}
+
+// parseJWS parses a compact serialized JWS of Notary v1 TUF targets metadata,
+// so images signed with `docker trust sign` can be verified without signing
+// them again. The JWS signature is Notary's, and isn't checked here: what
+// Verify checks is the cosign signature of the whole JWS. The digests are
+// the sha256 hashes of the targets, and the annotations are their custom
+// metadata.
+func parseJWS(payload []byte) (*PayloadClaims, error) {
+	parts := strings.Split(strings.TrimSpace(string(payload)), ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid JWS: %d parts, wanted 3", len(parts))
+	}
+
+	rawHeader, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid JWS header: %v", err)
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := json.Unmarshal(rawHeader, &header); err != nil {
+		return nil, fmt.Errorf("invalid JWS header: %v", err)
+	}
+	if header.Alg == "" {
+		return nil, errors.New("invalid JWS header: missing alg")
+	}
+
+	rawPayload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid JWS payload: %v", err)
+	}
+	var targets struct {
+		Signed struct {
+			Type    string `json:"_type"`
+			Targets map[string]struct {
+				// TUF hashes are standard base64, which is how
+				// encoding/json decodes []byte.
+				Hashes map[string][]byte          `json:"hashes"`
+				Custom map[string]json.RawMessage `json:"custom"`
+			} `json:"targets"`
+		} `json:"signed"`
+	}
+	if err := json.Unmarshal(rawPayload, &targets); err != nil {
+		return nil, fmt.Errorf("invalid JWS payload: %v", err)
+	}
+	if targets.Signed.Type != "Targets" {
+		return nil, fmt.Errorf("unsupported TUF metadata type %q", targets.Signed.Type)
+	}
+
+	// Walk the targets in order, so the claims don't depend on map order.
+	names := make([]string, 0, len(targets.Signed.Targets))
+	for n := range targets.Signed.Targets {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	claims := &PayloadClaims{}
+	for _, n := range names {
+		target := targets.Signed.Targets[n]
+		if h, ok := target.Hashes["sha256"]; ok {
+			claims.Digests = append(claims.Digests, hex.EncodeToString(h))
+		}
+		for k, v := range annotationValues(target.Custom) {
+			if claims.Annotations == nil {
+				claims.Annotations = map[string]string{}
+			}
+			claims.Annotations[k] = v
+		}
+	}
+	return claims, nil
 }
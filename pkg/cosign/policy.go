@@ -0,0 +1,275 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cosign
+
+import (
+	"crypto/ed25519"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/sigstore/cosign/pkg/cosign/oci"
+	"gopkg.in/yaml.v2"
+)
+
+// ImageSignaturePolicy says which signatures an image needs, for
+// VerifyImagePolicy. It can be unmarshaled from JSON or YAML:
+//
+//	requiredKeys:
+//	- /etc/cosign/release.pub
+//	- /etc/cosign/security.pub
+//	threshold: 1
+//	requiredAnnotations:
+//	  env: prod
+//	allowedIdentities: ["*@example.com"]
+//	rekorRequired: true
+//	maxSignatureAge: 720h
+type ImageSignaturePolicy struct {
+	// RequiredKeys are the public keys that may sign the image, each a PEM
+	// encoded key or anything LoadPublicKey takes.
+	RequiredKeys []string `json:"requiredKeys" yaml:"requiredKeys"`
+	// Threshold is how many of RequiredKeys must have signed the image, or
+	// all of them if it's 0.
+	Threshold int `json:"threshold,omitempty" yaml:"threshold,omitempty"`
+	// RequiredAnnotations must all be in a signed payload for it to count.
+	RequiredAnnotations map[string]string `json:"requiredAnnotations,omitempty" yaml:"requiredAnnotations,omitempty"`
+	// AllowedIdentities, if set, are filepath.Match patterns one of which the
+	// SignerIdentityAnnotation of a payload must match for it to count.
+	AllowedIdentities []string `json:"allowedIdentities,omitempty" yaml:"allowedIdentities,omitempty"`
+	// RekorRequired only counts signatures in the transparency log given with
+	// VerifyTransparencyLog.
+	RekorRequired bool `json:"rekorRequired,omitempty" yaml:"rekorRequired,omitempty"`
+	// MaxSignatureAge, if set, only counts signatures timestamped at most this
+	// long ago by the authority given with VerifyTimestampAuthority.
+	MaxSignatureAge time.Duration `json:"maxSignatureAge,omitempty" yaml:"maxSignatureAge,omitempty"`
+}
+
+// LoadPolicy reads the ImageSignaturePolicy in the YAML or JSON file at path.
+// Unknown fields are rejected, so a misspelled rule isn't silently dropped.
+func LoadPolicy(path string) (ImageSignaturePolicy, error) {
+	policy := ImageSignaturePolicy{}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return policy, err
+	}
+	if err := yaml.UnmarshalStrict(b, &policy); err != nil {
+		return policy, fmt.Errorf("%s: %v", path, err)
+	}
+	return policy, nil
+}
+
+// The rules of an ImageSignaturePolicy, as named in a RuleViolation. They
+// match the fields of the policy.
+const (
+	PolicyRuleRequiredKeys        = "requiredKeys"
+	PolicyRuleThreshold           = "threshold"
+	PolicyRuleRequiredAnnotations = "requiredAnnotations"
+	PolicyRuleAllowedIdentities   = "allowedIdentities"
+	PolicyRuleRekorRequired       = "rekorRequired"
+	PolicyRuleMaxSignatureAge     = "maxSignatureAge"
+)
+
+// RuleViolation is a rule of an ImageSignaturePolicy that an image broke.
+type RuleViolation struct {
+	// Rule is one of the PolicyRule constants.
+	Rule string `json:"rule"`
+	// Key is the index in RequiredKeys of the key whose signatures broke the
+	// rule, or -1 for the threshold.
+	Key     int    `json:"key"`
+	Message string `json:"message"`
+}
+
+// PolicyViolation is returned by VerifyImagePolicy when too few keys signed
+// the image the way the policy requires. It says why each key that didn't
+// count fell short.
+type PolicyViolation struct {
+	Violations []RuleViolation `json:"violations"`
+}
+
+func (e *PolicyViolation) Error() string {
+	msgs := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		if v.Key < 0 {
+			msgs = append(msgs, fmt.Sprintf("%s: %s", v.Rule, v.Message))
+		} else {
+			msgs = append(msgs, fmt.Sprintf("key %d: %s: %s", v.Key, v.Rule, v.Message))
+		}
+	}
+	return fmt.Sprintf("image doesn't satisfy the signature policy:\n  %s", strings.Join(msgs, "\n  "))
+}
+
+// Rules returns the rules that were violated, each once.
+func (e *PolicyViolation) Rules() []string {
+	rules := []string{}
+	for _, v := range e.Violations {
+		if !containsString(rules, v.Rule) {
+			rules = append(rules, v.Rule)
+		}
+	}
+	return rules
+}
+
+// VerifyImagePolicy checks that ref is signed the way policy requires. A key
+// counts towards the threshold if any of its signatures of ref passes every
+// rule of the policy. Of opts, only the registry options, key loader and
+// cache, transparency log and timestamp authority are used, the latter two
+// only if the policy needs them. If the image is fetched but doesn't satisfy
+// the policy, the error is a *PolicyViolation.
+func VerifyImagePolicy(ref name.Reference, policy ImageSignaturePolicy, opts ...VerifyOption) error {
+	o := newVerifyOpts(opts)
+	keys := make([]ed25519.PublicKey, 0, len(policy.RequiredKeys))
+	for i, k := range policy.RequiredKeys {
+		key, err := loadPolicyKey(k, o)
+		if err != nil {
+			return fmt.Errorf("policy key %d: %v", i, err)
+		}
+		keys = append(keys, key)
+	}
+	threshold := policy.Threshold
+	if threshold == 0 {
+		threshold = len(keys)
+	}
+	switch {
+	case len(keys) == 0:
+		return errors.New("policy has no required keys")
+	case threshold < 0 || threshold > len(keys):
+		return fmt.Errorf("policy threshold %d is out of range for %d key(s)", policy.Threshold, len(keys))
+	case policy.RekorRequired && o.tlog == nil:
+		return errors.New("policy requires Rekor, but no transparency log was given")
+	case policy.MaxSignatureAge > 0 && o.tsaRoots == nil:
+		return errors.New("policy limits the signature age, but no timestamp authority was given")
+	}
+	for _, pattern := range policy.AllowedIdentities {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid allowed identity %q: %v", pattern, err)
+		}
+	}
+
+	signatures, desc, err := oci.FetchSignatures(ref, o.registry)
+	if err != nil {
+		return err
+	}
+	violations := []RuleViolation{}
+	signed := 0
+	for i, key := range keys {
+		v := checkPolicyKey(key, desc.Digest.Hex, signatures, policy, o)
+		if len(v) == 0 {
+			signed++
+			continue
+		}
+		for j := range v {
+			v[j].Key = i
+		}
+		violations = append(violations, v...)
+	}
+	if signed >= threshold {
+		return nil
+	}
+	return &PolicyViolation{Violations: append(violations, RuleViolation{
+		Rule:    PolicyRuleThreshold,
+		Key:     -1,
+		Message: fmt.Sprintf("%d of %d key(s) signed the image as required, wanted %d", signed, len(keys), threshold),
+	})}
+}
+
+// checkPolicyKey returns nothing if one of the signatures by key passes every
+// rule of policy, or else the first way each rule was broken.
+func checkPolicyKey(key ed25519.PublicKey, digest string, signatures []oci.SignedPayload, policy ImageSignaturePolicy, o *verifyOpts) []RuleViolation {
+	violations := []RuleViolation{}
+	violated := map[string]bool{}
+	candidates := 0
+	for _, sp := range signatures {
+		if sp.MediaType == ContainerConfigMediaType || verifyStoredSignature(key, sp) != nil {
+			continue
+		}
+		claims, err := digestAndClaims(sp.MediaType, sp.Payload)
+		if err != nil || !containsString(claims.Digests, digest) {
+			continue
+		}
+		candidates++
+		sp.PublicKey = key
+
+		failed := map[string]string{}
+		if ok, diff := correctAnnotations(policy.RequiredAnnotations, claims.Annotations, o.exactAnnotations); !ok {
+			failed[PolicyRuleRequiredAnnotations] = "invalid or missing annotation: " + diff
+		}
+		if len(policy.AllowedIdentities) != 0 {
+			if err := checkIdentity(claims.Annotations[SignerIdentityAnnotation], policy.AllowedIdentities); err != nil {
+				failed[PolicyRuleAllowedIdentities] = err.Error()
+			}
+		}
+		if policy.RekorRequired {
+			if err := verifyLogged(o.context(), o.tlog, key, sp); err != nil {
+				failed[PolicyRuleRekorRequired] = err.Error()
+			}
+		}
+		if policy.MaxSignatureAge > 0 {
+			if ts, err := SignatureTimestamp(o.tsaRoots, sp); err != nil {
+				failed[PolicyRuleMaxSignatureAge] = err.Error()
+			} else if age := time.Since(ts); age > policy.MaxSignatureAge {
+				failed[PolicyRuleMaxSignatureAge] = fmt.Sprintf("signature is %s old, wanted at most %s", age.Round(time.Second), policy.MaxSignatureAge)
+			}
+		}
+		if len(failed) == 0 {
+			return nil
+		}
+		for _, rule := range []string{PolicyRuleRequiredAnnotations, PolicyRuleAllowedIdentities, PolicyRuleRekorRequired, PolicyRuleMaxSignatureAge} {
+			if msg, ok := failed[rule]; ok && !violated[rule] {
+				violated[rule] = true
+				violations = append(violations, RuleViolation{Rule: rule, Message: msg})
+			}
+		}
+	}
+	if candidates == 0 {
+		return []RuleViolation{{Rule: PolicyRuleRequiredKeys, Message: "no valid signature of the image by this key"}}
+	}
+	return violations
+}
+
+func checkIdentity(identity string, allowed []string) error {
+	if identity == "" {
+		return errors.New("payload has no signer identity")
+	}
+	for _, pattern := range allowed {
+		if ok, _ := filepath.Match(pattern, identity); ok {
+			return nil
+		}
+	}
+	return fmt.Errorf("signer identity %q isn't allowed", identity)
+}
+
+// loadPolicyKey loads a key of an ImageSignaturePolicy, which is PEM encoded
+// if it's written out in the policy, and otherwise a reference loaded as o
+// says.
+func loadPolicyKey(k string, o *verifyOpts) (ed25519.PublicKey, error) {
+	if !strings.HasPrefix(strings.TrimSpace(k), "-----BEGIN") {
+		return o.loadKey(k)
+	}
+	p, _ := pem.Decode([]byte(strings.TrimSpace(k)))
+	if p == nil {
+		return nil, errors.New("pem.Decode failed")
+	}
+	if p.Type != pubKeyPemType {
+		return nil, fmt.Errorf("not public: %q", p.Type)
+	}
+	return parsePublicKey(p.Bytes)
+}
@@ -0,0 +1,224 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cosign
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/sigstore/cosign/pkg/cosign/oci"
+)
+
+func TestVerifyImagePolicy(t *testing.T) {
+	tsa := newFakeTSA(t)
+	ts := httptest.NewServer(tsa)
+	defer ts.Close()
+	ro, ref, h := writeRandomImage(t, "policy")
+	td := t.TempDir()
+
+	pub1, priv1, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub2, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pem1, err := MarshalPublicKey(pub1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pem2, err := MarshalPublicKey(pub2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path2 := filepath.Join(td, "key2.pub")
+	if err := ioutil.WriteFile(path2, pem2, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the first key signs, with a timestamp.
+	payload, err := oci.Payload(v1.Descriptor{Digest: h}, map[string]string{"env": "prod", SignerIdentityAnnotation: "alice@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature := ed25519.Sign(priv1, payload)
+	token, err := RequestTimestamp(ts.URL, signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := oci.Upload(signature, payload, ref.Context().Tag(oci.Munge(v1.Descriptor{Digest: h})), oci.UploadRegistryOptions(ro), oci.UploadTimestamp(token)); err != nil {
+		t.Fatal(err)
+	}
+	tl := &memLog{}
+
+	base := ImageSignaturePolicy{RequiredKeys: []string{string(pem1), path2}, Threshold: 1}
+	opts := []VerifyOption{VerifyRegistryOptions(ro), VerifyTransparencyLog(tl), VerifyTimestampAuthority(tsa.roots)}
+	for _, test := range []struct {
+		name   string
+		modify func(p *ImageSignaturePolicy)
+		// wantRules are the rules violated, nil if the policy is satisfied.
+		wantRules []string
+	}{{
+		name:   "one of two keys",
+		modify: func(p *ImageSignaturePolicy) {},
+	}, {
+		name:      "both keys",
+		modify:    func(p *ImageSignaturePolicy) { p.Threshold = 0 },
+		wantRules: []string{PolicyRuleRequiredKeys, PolicyRuleThreshold},
+	}, {
+		name: "annotations and identity",
+		modify: func(p *ImageSignaturePolicy) {
+			p.RequiredAnnotations = map[string]string{"env": "prod"}
+			p.AllowedIdentities = []string{"*@example.com"}
+		},
+	}, {
+		name:      "wrong annotation",
+		modify:    func(p *ImageSignaturePolicy) { p.RequiredAnnotations = map[string]string{"env": "dev"} },
+		wantRules: []string{PolicyRuleRequiredAnnotations, PolicyRuleRequiredKeys, PolicyRuleThreshold},
+	}, {
+		name:      "wrong identity",
+		modify:    func(p *ImageSignaturePolicy) { p.AllowedIdentities = []string{"*@other.com"} },
+		wantRules: []string{PolicyRuleAllowedIdentities, PolicyRuleRequiredKeys, PolicyRuleThreshold},
+	}, {
+		name:      "not in rekor",
+		modify:    func(p *ImageSignaturePolicy) { p.RekorRequired = true },
+		wantRules: []string{PolicyRuleRekorRequired, PolicyRuleRequiredKeys, PolicyRuleThreshold},
+	}, {
+		name:   "recent enough",
+		modify: func(p *ImageSignaturePolicy) { p.MaxSignatureAge = time.Hour },
+	}, {
+		name:      "too old",
+		modify:    func(p *ImageSignaturePolicy) { p.MaxSignatureAge = time.Nanosecond },
+		wantRules: []string{PolicyRuleMaxSignatureAge, PolicyRuleRequiredKeys, PolicyRuleThreshold},
+	}} {
+		t.Run(test.name, func(t *testing.T) {
+			p := base
+			test.modify(&p)
+			err := VerifyImagePolicy(ref, p, opts...)
+			if test.wantRules == nil {
+				if err != nil {
+					t.Fatalf("VerifyImagePolicy() = %v", err)
+				}
+				return
+			}
+			pv, ok := err.(*PolicyViolation)
+			if !ok {
+				t.Fatalf("VerifyImagePolicy() = %v, wanted a *PolicyViolation", err)
+			}
+			if got := pv.Rules(); !reflect.DeepEqual(got, test.wantRules) {
+				t.Errorf("Rules() = %v, wanted %v\n%v", got, test.wantRules, pv)
+			}
+		})
+	}
+
+	// Once the signature is logged, Rekor is satisfied.
+	if _, err := tl.Upload(context.Background(), LogEntry{Payload: payload, Signature: signature, PublicKey: pem1}); err != nil {
+		t.Fatal(err)
+	}
+	p := base
+	p.RekorRequired = true
+	if err := VerifyImagePolicy(ref, p, opts...); err != nil {
+		t.Errorf("VerifyImagePolicy() after logging = %v", err)
+	}
+
+	for _, p := range []ImageSignaturePolicy{
+		{},
+		{RequiredKeys: base.RequiredKeys, Threshold: 3},
+		{RequiredKeys: []string{"not a key"}},
+		{RequiredKeys: base.RequiredKeys, AllowedIdentities: []string{"["}},
+	} {
+		if err := VerifyImagePolicy(ref, p, opts...); err == nil {
+			t.Errorf("VerifyImagePolicy(%+v), wanted error", p)
+		} else if _, ok := err.(*PolicyViolation); ok {
+			t.Errorf("VerifyImagePolicy(%+v) = %v, wanted a configuration error", p, err)
+		}
+	}
+	if err := VerifyImagePolicy(ref, ImageSignaturePolicy{RequiredKeys: base.RequiredKeys, RekorRequired: true}, VerifyRegistryOptions(ro)); err == nil {
+		t.Error("VerifyImagePolicy() requiring Rekor without a log, wanted error")
+	}
+}
+
+func TestImageSignaturePolicyJSON(t *testing.T) {
+	var p ImageSignaturePolicy
+	if err := json.Unmarshal([]byte(`{"requiredKeys": ["a.pub", "b.pub"], "threshold": 1, "requiredAnnotations": {"env": "prod"}, "allowedIdentities": ["*@example.com"], "rekorRequired": true}`), &p); err != nil {
+		t.Fatal(err)
+	}
+	want := ImageSignaturePolicy{
+		RequiredKeys:        []string{"a.pub", "b.pub"},
+		Threshold:           1,
+		RequiredAnnotations: map[string]string{"env": "prod"},
+		AllowedIdentities:   []string{"*@example.com"},
+		RekorRequired:       true,
+	}
+	if !reflect.DeepEqual(p, want) {
+		t.Errorf("json.Unmarshal() = %+v, wanted %+v", p, want)
+	}
+}
+
+func TestLoadPolicy(t *testing.T) {
+	td := t.TempDir()
+	write := func(name, contents string) string {
+		p := filepath.Join(td, name)
+		if err := ioutil.WriteFile(p, []byte(contents), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	yamlPath := write("policy.yaml", `requiredKeys:
+- /etc/cosign/release.pub
+threshold: 1
+requiredAnnotations:
+  env: prod
+allowedIdentities: ["*@example.com"]
+rekorRequired: true
+maxSignatureAge: 720h
+`)
+	got, err := LoadPolicy(yamlPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ImageSignaturePolicy{
+		RequiredKeys:        []string{"/etc/cosign/release.pub"},
+		Threshold:           1,
+		RequiredAnnotations: map[string]string{"env": "prod"},
+		AllowedIdentities:   []string{"*@example.com"},
+		RekorRequired:       true,
+		MaxSignatureAge:     720 * time.Hour,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("LoadPolicy() = %+v, wanted %+v", got, want)
+	}
+
+	jsonPath := write("policy.json", `{"requiredKeys": ["/etc/cosign/release.pub"], "threshold": 1}`)
+	if got, err := LoadPolicy(jsonPath); err != nil || got.Threshold != 1 || len(got.RequiredKeys) != 1 {
+		t.Errorf("LoadPolicy() of JSON = %+v, %v", got, err)
+	}
+	if _, err := LoadPolicy(write("typo.yaml", "requiredKey: [a]\n")); err == nil {
+		t.Error("LoadPolicy() with an unknown field, wanted error")
+	}
+}
@@ -0,0 +1,63 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cosign
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/sha512"
+	"errors"
+	"io"
+)
+
+// PrehashContext is the Ed25519ph context of SignLargePayload signatures,
+// which keeps them from being valid for anything else.
+const PrehashContext = "cosign-prehash-v1"
+
+// prehash streams r through SHA-512.
+func prehash(r io.Reader) ([]byte, error) {
+	h := sha512.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// SignLargePayload signs the payload read from r with Ed25519ph (RFC 8032
+// section 5.1) and PrehashContext, so the payload is hashed as it is read
+// rather than held in memory. The signatures are only valid for
+// VerifyLargePayload, not VerifySignature.
+func SignLargePayload(key ed25519.PrivateKey, r io.Reader) ([]byte, error) {
+	digest, err := prehash(r)
+	if err != nil {
+		return nil, err
+	}
+	return key.Sign(nil, digest, &ed25519.Options{Hash: crypto.SHA512, Context: PrehashContext})
+}
+
+// VerifyLargePayload verifies sig, a SignLargePayload signature of the payload
+// read from r.
+func VerifyLargePayload(key ed25519.PublicKey, r io.Reader, sig []byte) error {
+	digest, err := prehash(r)
+	if err != nil {
+		return err
+	}
+	if err := ed25519.VerifyWithOptions(key, digest, sig, &ed25519.Options{Hash: crypto.SHA512, Context: PrehashContext}); err != nil {
+		return errors.New("unable to verify signature")
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cosign
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"testing"
+)
+
+func TestLargePayload(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := make([]byte, 4<<20)
+	if _, err := io.ReadFull(rand.Reader, payload); err != nil {
+		t.Fatal(err)
+	}
+
+	sig, err := SignLargePayload(priv, bytes.NewReader(payload))
+	if err != nil {
+		t.Fatalf("SignLargePayload() = %v", err)
+	}
+	if err := VerifyLargePayload(pub, bytes.NewReader(payload), sig); err != nil {
+		t.Errorf("VerifyLargePayload() = %v", err)
+	}
+	if err := VerifyLargePayload(otherPub, bytes.NewReader(payload), sig); err == nil {
+		t.Error("VerifyLargePayload() with the wrong key, wanted error")
+	}
+	if err := VerifyLargePayload(pub, bytes.NewReader(payload[1:]), sig); err == nil {
+		t.Error("VerifyLargePayload() of another payload, wanted error")
+	}
+
+	// Prehashed and plain signatures aren't interchangeable.
+	if err := VerifySignature(pub, base64.StdEncoding.EncodeToString(sig), payload); err == nil {
+		t.Error("VerifySignature() of a prehashed signature, wanted error")
+	}
+	if err := VerifyLargePayload(pub, bytes.NewReader(payload), ed25519.Sign(priv, payload)); err == nil {
+		t.Error("VerifyLargePayload() of a plain signature, wanted error")
+	}
+}
@@ -0,0 +1,126 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cosign
+
+import (
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/sigstore/cosign/pkg/cosign/oci"
+)
+
+// SLSAProvenancePredicateType is the predicateType of SLSA v0.2 provenance
+// attestations, see https://slsa.dev/provenance/v0.2.
+const SLSAProvenancePredicateType = "https://slsa.dev/provenance/v0.2"
+
+// SLSAProvenance is the part of a SLSA v0.2 provenance predicate that
+// VerifySLSAProvenance checks.
+type SLSAProvenance struct {
+	Builder struct {
+		ID string `json:"id"`
+	} `json:"builder"`
+	Materials []struct {
+		URI string `json:"uri"`
+	} `json:"materials"`
+}
+
+// VerifySLSAProvenance checks that the image ref points at has a SLSA
+// provenance attestation, see sign -predicate, signed by pubKey, saying it
+// was built by builderID from sourceRepo. sourceRepo must be the URI of the
+// first material, or that URI with an @ and a revision after it, e.g.
+// git+https://github.com/acme/app matches
+// git+https://github.com/acme/app@refs/heads/main. If no attestation
+// matches, the error is a VerifyErrors of why each one didn't. Of opts, only
+// the registry options are used.
+func VerifySLSAProvenance(ref name.Reference, builderID, sourceRepo string, pubKey crypto.PublicKey, opts ...VerifyOption) error {
+	if builderID == "" || sourceRepo == "" {
+		return errors.New("a builder ID and a source repository are needed to check provenance")
+	}
+	o := newVerifyOpts(opts)
+	signatures, desc, err := oci.FetchSignatures(ref, o.registry)
+	if err != nil {
+		return err
+	}
+
+	errs := VerifyErrors{}
+	for i, sp := range signatures {
+		if sp.MediaType != DSSEMediaType {
+			continue
+		}
+		env, err := ParseDSSE(sp.Payload)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("signature %d: %v", i, err))
+			continue
+		}
+		if types.MediaType(env.PayloadType) != InTotoMediaType {
+			continue
+		}
+		payload, err := VerifyDSSE(pubKey, env)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("signature %d: %v", i, err))
+			continue
+		}
+		if err := checkSLSAProvenance(payload, desc.Digest.Hex, builderID, sourceRepo); err != nil {
+			errs = append(errs, fmt.Errorf("signature %d: %v", i, err))
+			continue
+		}
+		return nil
+	}
+	if len(errs) == 0 {
+		return fmt.Errorf("no in-toto attestations found for %s", ref)
+	}
+	return errs
+}
+
+// checkSLSAProvenance checks that statement is SLSA provenance about the
+// image with digest, built by builderID from sourceRepo.
+func checkSLSAProvenance(statement []byte, digest, builderID, sourceRepo string) error {
+	st := InTotoStatement{}
+	if err := json.Unmarshal(statement, &st); err != nil {
+		return fmt.Errorf("invalid in-toto statement: %v", err)
+	}
+	if st.PredicateType != SLSAProvenancePredicateType {
+		return fmt.Errorf("predicate type is %s, wanted %s", st.PredicateType, SLSAProvenancePredicateType)
+	}
+	about := false
+	for _, s := range st.Subject {
+		about = about || s.Digest["sha256"] == digest
+	}
+	if !about {
+		return fmt.Errorf("the statement isn't about sha256:%s", digest)
+	}
+
+	p := SLSAProvenance{}
+	if err := json.Unmarshal(st.Predicate, &p); err != nil {
+		return fmt.Errorf("invalid provenance: %v", err)
+	}
+	if p.Builder.ID != builderID {
+		return fmt.Errorf("builder.id is %q, wanted %q", p.Builder.ID, builderID)
+	}
+	if len(p.Materials) == 0 {
+		return fmt.Errorf("no materials, wanted %q", sourceRepo)
+	}
+	if uri := p.Materials[0].URI; uri != sourceRepo && !strings.HasPrefix(uri, sourceRepo+"@") {
+		return fmt.Errorf("materials[0].uri is %q, wanted %q", uri, sourceRepo)
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cosign
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/sigstore/cosign/pkg/cosign/oci"
+)
+
+func TestVerifySLSAProvenance(t *testing.T) {
+	const (
+		builder = "https://github.com/acme/builder/.github/workflows/build.yml@refs/heads/main"
+		source  = "git+https://github.com/acme/app"
+	)
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// attest writes an image with an attestation of predicateType with
+	// predicate, about subject if it's set or else the image.
+	attest := func(predicateType, predicate string, subject *v1.Hash) (oci.RegistryOptions, name.Reference) {
+		ro, ref, h := writeRandomImage(t, "provenance")
+		if subject == nil {
+			subject = &h
+		}
+		statement, err := AttestationPayload(ref.Context(), v1.Descriptor{Digest: *subject}, predicateType, []byte(predicate))
+		if err != nil {
+			t.Fatal(err)
+		}
+		env, err := SignDSSE(priv, string(InTotoMediaType), statement)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := json.Marshal(env)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sigTag := ref.Context().Tag(oci.Munge(v1.Descriptor{Digest: h}))
+		if err := oci.Upload(ed25519.Sign(priv, b), b, sigTag, oci.UploadMediaType(DSSEMediaType), oci.UploadRegistryOptions(ro)); err != nil {
+			t.Fatal(err)
+		}
+		return ro, ref
+	}
+	provenance := `{"builder": {"id": "` + builder + `"}, "materials": [{"uri": "` + source + `@refs/heads/main", "digest": {"sha1": "abc"}}]}`
+
+	for _, test := range []struct {
+		name          string
+		predicateType string
+		predicate     string
+		otherSubject  bool
+		key           ed25519.PublicKey
+		builderID     string
+		sourceRepo    string
+		wantErr       string
+	}{{
+		name: "matches", predicateType: SLSAProvenancePredicateType, predicate: provenance,
+		key: pub, builderID: builder, sourceRepo: source,
+	}, {
+		name: "exact source", predicateType: SLSAProvenancePredicateType, predicate: provenance,
+		key: pub, builderID: builder, sourceRepo: source + "@refs/heads/main",
+	}, {
+		name: "other builder", predicateType: SLSAProvenancePredicateType, predicate: provenance,
+		key: pub, builderID: "https://example.com/builder", sourceRepo: source,
+		wantErr: `builder.id is "` + builder + `", wanted "https://example.com/builder"`,
+	}, {
+		name: "other source", predicateType: SLSAProvenancePredicateType, predicate: provenance,
+		key: pub, builderID: builder, sourceRepo: "git+https://github.com/acme/ap",
+		wantErr: `materials[0].uri is "` + source + `@refs/heads/main"`,
+	}, {
+		name: "no materials", predicateType: SLSAProvenancePredicateType, predicate: `{"builder": {"id": "` + builder + `"}}`,
+		key: pub, builderID: builder, sourceRepo: source,
+		wantErr: "no materials",
+	}, {
+		name: "other predicate type", predicateType: "https://example.com/test-results", predicate: provenance,
+		key: pub, builderID: builder, sourceRepo: source,
+		wantErr: "predicate type is https://example.com/test-results",
+	}, {
+		name: "other subject", predicateType: SLSAProvenancePredicateType, predicate: provenance, otherSubject: true,
+		key: pub, builderID: builder, sourceRepo: source,
+		wantErr: "the statement isn't about",
+	}, {
+		name: "other key", predicateType: SLSAProvenancePredicateType, predicate: provenance,
+		key: otherPub, builderID: builder, sourceRepo: source,
+		wantErr: "no envelope signature verifies",
+	}} {
+		t.Run(test.name, func(t *testing.T) {
+			var subject *v1.Hash
+			if test.otherSubject {
+				subject = &v1.Hash{Algorithm: "sha256", Hex: strings.Repeat("0", 64)}
+			}
+			ro, ref := attest(test.predicateType, test.predicate, subject)
+			err := VerifySLSAProvenance(ref, test.builderID, test.sourceRepo, test.key, VerifyRegistryOptions(ro))
+			if test.wantErr == "" && err != nil {
+				t.Errorf("VerifySLSAProvenance() = %v", err)
+			} else if test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)) {
+				t.Errorf("VerifySLSAProvenance() = %v, wanted %q", err, test.wantErr)
+			}
+		})
+	}
+
+	// A simple signing signature alone isn't provenance.
+	ro, ref, h := writeRandomImage(t, "provenance")
+	payload, err := oci.Payload(v1.Descriptor{Digest: h}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := oci.Upload(ed25519.Sign(priv, payload), payload, ref.Context().Tag(oci.Munge(v1.Descriptor{Digest: h})), oci.UploadRegistryOptions(ro)); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifySLSAProvenance(ref, builder, source, pub, VerifyRegistryOptions(ro)); err == nil || !strings.Contains(err.Error(), "no in-toto attestations found") {
+		t.Errorf("VerifySLSAProvenance() without attestations = %v", err)
+	}
+}
@@ -0,0 +1,230 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cosign
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/sigstore/cosign/pkg/cosign/oci"
+)
+
+// RekorBundle is what Rekor returns when it adds an entry to the log: the
+// entry, and a signed entry timestamp (SET) promising that it is in the log.
+// The SET is signed with the Rekor key, so it can be checked offline.
+type RekorBundle struct {
+	SignedEntryTimestamp []byte       `json:"SignedEntryTimestamp"`
+	Payload              RekorPayload `json:"Payload"`
+}
+
+// RekorPayload is the part of a RekorBundle that the SET signs. The fields
+// are in the order of their keys, so encoding/json marshals it into the
+// canonical JSON that Rekor signs.
+type RekorPayload struct {
+	// Body is the base64 encoded rekord entry.
+	Body           string `json:"body"`
+	IntegratedTime int64  `json:"integratedTime"`
+	LogID          string `json:"logID"`
+	LogIndex       int64  `json:"logIndex"`
+}
+
+// rekord is the body of a rekord entry, version 0.0.1.
+type rekord struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Spec       struct {
+		Data struct {
+			Hash struct {
+				Algorithm string `json:"algorithm"`
+				Value     string `json:"value"`
+			} `json:"hash"`
+		} `json:"data"`
+		Signature struct {
+			Content   []byte `json:"content"`
+			PublicKey struct {
+				Content []byte `json:"content"`
+			} `json:"publicKey"`
+		} `json:"signature"`
+	} `json:"spec"`
+}
+
+// LoadRekorBundle reads the bundle at path.
+func LoadRekorBundle(path string) (*RekorBundle, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	b := &RekorBundle{}
+	if err := json.Unmarshal(raw, b); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return b, nil
+}
+
+// VerifySET checks that the signed entry timestamp of b was signed by
+// rekorKey.
+func (b *RekorBundle) VerifySET(rekorKey crypto.PublicKey) error {
+	canonical, err := json.Marshal(b.Payload)
+	if err != nil {
+		return err
+	}
+	switch k := rekorKey.(type) {
+	case *ecdsa.PublicKey:
+		h := sha256.Sum256(canonical)
+		if !ecdsa.VerifyASN1(k, h[:], b.SignedEntryTimestamp) {
+			return errors.New("invalid signed entry timestamp")
+		}
+	case ed25519.PublicKey:
+		if !ed25519.Verify(k, canonical, b.SignedEntryTimestamp) {
+			return errors.New("invalid signed entry timestamp")
+		}
+	default:
+		return fmt.Errorf("unsupported rekor key type %T", rekorKey)
+	}
+	return nil
+}
+
+func (b *RekorBundle) entry() (*rekord, error) {
+	body, err := base64.StdEncoding.DecodeString(b.Payload.Body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bundle body: %v", err)
+	}
+	r := &rekord{}
+	if err := json.Unmarshal(body, r); err != nil {
+		return nil, fmt.Errorf("invalid bundle body: %v", err)
+	}
+	if r.Kind != "rekord" {
+		return nil, fmt.Errorf("unsupported entry kind %q", r.Kind)
+	}
+	if r.Spec.Data.Hash.Algorithm != "sha256" {
+		return nil, fmt.Errorf("unsupported hash algorithm %q", r.Spec.Data.Hash.Algorithm)
+	}
+	return r, nil
+}
+
+// offlineLog is a TransparencyLog backed by bundles that Rekor returned
+// earlier. It never talks to Rekor, instead trusting any entry with a valid
+// SET from rekorKey.
+type offlineLog struct {
+	bundles  []*RekorBundle
+	rekorKey crypto.PublicKey
+}
+
+// NewOfflineTransparencyLog returns a read-only TransparencyLog holding the
+// entries in bundles, whose SETs must verify with rekorKey.
+func NewOfflineTransparencyLog(rekorKey crypto.PublicKey, bundles ...*RekorBundle) TransparencyLog {
+	return &offlineLog{bundles: bundles, rekorKey: rekorKey}
+}
+
+func (l *offlineLog) Upload(context.Context, LogEntry) (int64, error) {
+	return 0, errors.New("can't upload to an offline transparency log")
+}
+
+func (l *offlineLog) Lookup(_ context.Context, hash v1.Hash) ([]LogEntry, error) {
+	found := []LogEntry{}
+	for _, b := range l.bundles {
+		r, err := b.entry()
+		if err != nil {
+			return nil, err
+		}
+		if r.Spec.Data.Hash.Value != hash.Hex {
+			continue
+		}
+		found = append(found, LogEntry{
+			LogIndex:  b.Payload.LogIndex,
+			Signature: r.Spec.Signature.Content,
+			PublicKey: r.Spec.Signature.PublicKey.Content,
+		})
+	}
+	return found, nil
+}
+
+func (l *offlineLog) VerifyInclusion(_ context.Context, logIndex int64, entry LogEntry) error {
+	for _, b := range l.bundles {
+		if b.Payload.LogIndex != logIndex {
+			continue
+		}
+		if err := b.VerifySET(l.rekorKey); err != nil {
+			return err
+		}
+		r, err := b.entry()
+		if err != nil {
+			return err
+		}
+		h := sha256.Sum256(entry.Payload)
+		if r.Spec.Data.Hash.Value != hex.EncodeToString(h[:]) {
+			return errors.New("bundle is for a different payload")
+		}
+		if !bytes.Equal(r.Spec.Signature.Content, entry.Signature) {
+			return errors.New("bundle is for a different signature")
+		}
+		if !samePublicKey(r.Spec.Signature.PublicKey.Content, entry.PublicKey) {
+			return errors.New("bundle is for a different public key")
+		}
+		return nil
+	}
+	return fmt.Errorf("no bundle for log index %d", logIndex)
+}
+
+// samePublicKey compares two PEM encoded keys, ignoring how they are wrapped.
+func samePublicKey(a, b []byte) bool {
+	pa, _ := pem.Decode(a)
+	pb, _ := pem.Decode(b)
+	return pa != nil && pb != nil && bytes.Equal(pa.Bytes, pb.Bytes)
+}
+
+// VerifyOffline is Verify, additionally requiring the signature to be in the
+// Rekor bundle at bundlePath. The bundle is checked against the Rekor key
+// pinned by `cosign initialize`, so Rekor itself is never contacted.
+func VerifyOffline(ref name.Reference, pubKey ed25519.PublicKey, bundlePath string, checkClaims bool, annotations map[string]string, opts ...VerifyOption) ([]oci.SignedPayload, error) {
+	rekorKey, err := PinnedRekorKey()
+	if err != nil {
+		return nil, err
+	}
+	b, err := LoadRekorBundle(bundlePath)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, VerifyTransparencyLog(NewOfflineTransparencyLog(rekorKey, b)))
+	return Verify(ref, pubKey, checkClaims, annotations, opts...)
+}
+
+// PinnedRekorKey returns the Rekor public key pinned by `cosign initialize`.
+func PinnedRekorKey() (crypto.PublicKey, error) {
+	path, err := RootsPath()
+	if err != nil {
+		return nil, err
+	}
+	roots, err := LoadRoots(path)
+	if err != nil {
+		return nil, fmt.Errorf("loading pinned roots, run `cosign initialize` first: %v", err)
+	}
+	return roots.RekorPublicKey()
+}
@@ -0,0 +1,117 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cosign
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/sigstore/cosign/pkg/cosign/oci"
+)
+
+// rekorBundle returns the bundle Rekor would return for entry, signed by
+// rekorKey.
+func rekorBundle(t *testing.T, rekorKey *ecdsa.PrivateKey, entry LogEntry, logIndex int64) *RekorBundle {
+	t.Helper()
+	h := sha256.Sum256(entry.Payload)
+	body := fmt.Sprintf(`{"apiVersion":"0.0.1","kind":"rekord","spec":{"data":{"hash":{"algorithm":"sha256","value":%q}},"signature":{"content":%q,"format":"x509","publicKey":{"content":%q}}}}`,
+		hex.EncodeToString(h[:]),
+		base64.StdEncoding.EncodeToString(entry.Signature),
+		base64.StdEncoding.EncodeToString(entry.PublicKey))
+	b := &RekorBundle{
+		Payload: RekorPayload{
+			Body:           base64.StdEncoding.EncodeToString([]byte(body)),
+			IntegratedTime: 1614000000,
+			LogID:          "c0d23d6ad406973f9559f3ba2d1ca01f84147d8ffc5b8445c224f98b9591801d",
+			LogIndex:       logIndex,
+		},
+	}
+	canonical, err := json.Marshal(b.Payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256(canonical)
+	b.SignedEntryTimestamp, err = ecdsa.SignASN1(rand.Reader, rekorKey, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestOfflineTransparencyLog(t *testing.T) {
+	rekorKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherRekorKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	payload := []byte("payload")
+	signature := ed25519.Sign(priv, payload)
+	sp := oci.SignedPayload{
+		Payload:         payload,
+		Base64Signature: base64.StdEncoding.EncodeToString(signature),
+	}
+	entry, err := NewLogEntry(payload, signature, pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := rekorBundle(t, rekorKey, entry, 42)
+
+	if err := verifyLogged(ctx, NewOfflineTransparencyLog(&rekorKey.PublicKey, b), pub, sp); err != nil {
+		t.Errorf("verifyLogged() = %v", err)
+	}
+	if err := verifyLogged(ctx, NewOfflineTransparencyLog(&otherRekorKey.PublicKey, b), pub, sp); err == nil {
+		t.Error("verifyLogged() with the wrong rekor key, wanted error")
+	}
+
+	// A signature of another payload isn't covered by the bundle.
+	other := []byte("other payload")
+	otherSP := oci.SignedPayload{
+		Payload:         other,
+		Base64Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(priv, other)),
+	}
+	if err := verifyLogged(ctx, NewOfflineTransparencyLog(&rekorKey.PublicKey, b), pub, otherSP); err == nil {
+		t.Error("verifyLogged() with another payload, wanted error")
+	}
+
+	// Changing anything the SET covers invalidates it.
+	tampered := *b
+	tampered.Payload.LogIndex = 43
+	if err := tampered.VerifySET(&rekorKey.PublicKey); err == nil {
+		t.Error("VerifySET() of a tampered bundle, wanted error")
+	}
+	if err := b.VerifySET(&rekorKey.PublicKey); err != nil {
+		t.Errorf("VerifySET() = %v", err)
+	}
+}
@@ -0,0 +1,240 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cosign
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	DefaultRekorURL  = "https://rekor.sigstore.dev"
+	DefaultFulcioURL = "https://fulcio.sigstore.dev"
+
+	certPemType = "CERTIFICATE"
+)
+
+// Roots is the trusted root material for Rekor and Fulcio, as pinned by
+// `cosign initialize`.
+type Roots struct {
+	Rekor  RekorRoot  `json:"rekor"`
+	Fulcio FulcioRoot `json:"fulcio"`
+}
+
+type RekorRoot struct {
+	URL       string `json:"url"`
+	PublicKey string `json:"publicKey"`
+}
+
+type FulcioRoot struct {
+	URL      string `json:"url"`
+	RootCert string `json:"rootCert"`
+}
+
+// RootsPath returns where the pinned roots are stored, ~/.config/cosign/roots.json.
+func RootsPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".config", "cosign", "roots.json"), nil
+}
+
+// FetchRoots downloads the Rekor public key and the Fulcio root certificate
+// and checks that they are well formed. ctx bounds the requests.
+func FetchRoots(ctx context.Context, rekorURL, fulcioURL string) (*Roots, error) {
+	pub, err := fetchPEM(ctx, strings.TrimSuffix(rekorURL, "/")+"/api/v1/log/publicKey")
+	if err != nil {
+		return nil, fmt.Errorf("fetching rekor public key: %v", err)
+	}
+	cert, err := fetchPEM(ctx, strings.TrimSuffix(fulcioURL, "/")+"/api/v1/rootCert")
+	if err != nil {
+		return nil, fmt.Errorf("fetching fulcio root certificate: %v", err)
+	}
+	roots := &Roots{
+		Rekor: RekorRoot{
+			URL:       rekorURL,
+			PublicKey: string(pub),
+		},
+		Fulcio: FulcioRoot{
+			URL:      fulcioURL,
+			RootCert: string(cert),
+		},
+	}
+	if err := roots.Validate(); err != nil {
+		return nil, err
+	}
+	return roots, nil
+}
+
+// Validate checks that the Rekor key is a PEM encoded public key, and that
+// the Fulcio root is a self-signed CA certificate.
+func (r *Roots) Validate() error {
+	if _, err := r.RekorPublicKey(); err != nil {
+		return fmt.Errorf("invalid rekor public key: %v", err)
+	}
+	cert, err := r.FulcioRootCert()
+	if err != nil {
+		return fmt.Errorf("invalid fulcio root certificate: %v", err)
+	}
+	if !cert.IsCA {
+		return errors.New("invalid fulcio root certificate: not a CA")
+	}
+	if err := cert.CheckSignatureFrom(cert); err != nil {
+		return fmt.Errorf("invalid fulcio root certificate: %v", err)
+	}
+	return nil
+}
+
+// CheckContinuity checks that r can replace the roots already pinned. A
+// well formed key and certificate only say that they came from whoever
+// answered, so the Rekor key has to be the pinned one, and the Fulcio root
+// has to chain up to the pinned one, that is, be signed with the same key.
+// Roots that can't pass have to be replaced some other way, such as TUF.
+func (r *Roots) CheckContinuity(pinned *Roots) error {
+	oldKey, err := pinned.RekorPublicKey()
+	if err != nil {
+		return fmt.Errorf("invalid pinned rekor public key: %v", err)
+	}
+	newKey, err := r.RekorPublicKey()
+	if err != nil {
+		return fmt.Errorf("invalid rekor public key: %v", err)
+	}
+	oldDER, err := x509.MarshalPKIXPublicKey(oldKey)
+	if err != nil {
+		return err
+	}
+	newDER, err := x509.MarshalPKIXPublicKey(newKey)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(oldDER, newDER) {
+		return errors.New("rekor public key doesn't match the pinned one")
+	}
+
+	oldCert, err := pinned.FulcioRootCert()
+	if err != nil {
+		return fmt.Errorf("invalid pinned fulcio root certificate: %v", err)
+	}
+	newCert, err := r.FulcioRootCert()
+	if err != nil {
+		return fmt.Errorf("invalid fulcio root certificate: %v", err)
+	}
+	if err := newCert.CheckSignatureFrom(oldCert); err != nil {
+		return fmt.Errorf("fulcio root certificate doesn't chain up to the pinned one: %v", err)
+	}
+	return nil
+}
+
+// RekorPublicKey parses the pinned Rekor public key.
+func (r *Roots) RekorPublicKey() (crypto.PublicKey, error) {
+	p, _ := pem.Decode([]byte(r.Rekor.PublicKey))
+	if p == nil {
+		return nil, errors.New("pem.Decode failed")
+	}
+	if p.Type != pubKeyPemType {
+		return nil, fmt.Errorf("not public: %q", p.Type)
+	}
+	return x509.ParsePKIXPublicKey(p.Bytes)
+}
+
+// FulcioRootCert parses the pinned Fulcio root certificate.
+func (r *Roots) FulcioRootCert() (*x509.Certificate, error) {
+	p, _ := pem.Decode([]byte(r.Fulcio.RootCert))
+	if p == nil {
+		return nil, errors.New("pem.Decode failed")
+	}
+	if p.Type != certPemType {
+		return nil, fmt.Errorf("not a certificate: %q", p.Type)
+	}
+	return x509.ParseCertificate(p.Bytes)
+}
+
+// PinnedFulcioRoots returns a pool of the Fulcio root certificate pinned by
+// `cosign initialize`, to verify keyless signatures with.
+func PinnedFulcioRoots() (*x509.CertPool, error) {
+	path, err := RootsPath()
+	if err != nil {
+		return nil, err
+	}
+	roots, err := LoadRoots(path)
+	if err != nil {
+		return nil, fmt.Errorf("loading pinned roots, run `cosign initialize` first: %v", err)
+	}
+	cert, err := roots.FulcioRootCert()
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return pool, nil
+}
+
+// LoadRoots reads and validates the roots pinned at path.
+func LoadRoots(path string) (*Roots, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	roots := &Roots{}
+	if err := json.Unmarshal(b, roots); err != nil {
+		return nil, err
+	}
+	if err := roots.Validate(); err != nil {
+		return nil, err
+	}
+	return roots, nil
+}
+
+// WriteRoots pins roots at path, creating the parent directory if needed.
+func WriteRoots(path string, roots *Roots) error {
+	b, err := json.MarshalIndent(roots, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, 0600)
+}
+
+func fetchPEM(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
@@ -0,0 +1,163 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cosign
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFetchRoots(t *testing.T) {
+	keys, err := GenerateKeyPair(pass("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "fulcio"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, pub, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/log/publicKey", func(w http.ResponseWriter, _ *http.Request) {
+		w.Write(keys.PublicBytes)
+	})
+	mux.HandleFunc("/api/v1/rootCert", func(w http.ResponseWriter, _ *http.Request) {
+		w.Write(certPEM)
+	})
+	mux.HandleFunc("/bad/api/v1/rootCert", func(w http.ResponseWriter, _ *http.Request) {
+		w.Write(keys.PublicBytes)
+	})
+	s := httptest.NewServer(mux)
+	defer s.Close()
+
+	roots, err := FetchRoots(context.Background(), s.URL, s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "cosign", "roots.json")
+	if err := WriteRoots(path, roots); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadRoots(path); err != nil {
+		t.Errorf("unexpected error loading roots: %v", err)
+	}
+
+	// A public key isn't a root certificate.
+	if _, err := FetchRoots(context.Background(), s.URL, s.URL+"/bad"); err == nil {
+		t.Error("expected error fetching roots!")
+	}
+}
+
+func TestCheckContinuity(t *testing.T) {
+	rootPEM := func(name string, pub ed25519.PublicKey, priv ed25519.PrivateKey) string {
+		t.Helper()
+		tmpl := &x509.Certificate{
+			SerialNumber:          big.NewInt(1),
+			Subject:               pkix.Name{CommonName: name},
+			NotBefore:             time.Now(),
+			NotAfter:              time.Now().Add(time.Hour),
+			KeyUsage:              x509.KeyUsageCertSign,
+			BasicConstraintsValid: true,
+			IsCA:                  true,
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, pub, priv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	}
+	rekorPEM := func() string {
+		t.Helper()
+		keys, err := GenerateKeyPair(pass("hello"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(keys.PublicBytes)
+	}
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPub, otherPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rekorKey := rekorPEM()
+	pinned := &Roots{
+		Rekor:  RekorRoot{PublicKey: rekorKey},
+		Fulcio: FulcioRoot{RootCert: rootPEM("fulcio", pub, priv)},
+	}
+
+	for _, tc := range []struct {
+		desc    string
+		roots   *Roots
+		wantErr bool
+	}{{
+		desc:  "same roots",
+		roots: pinned,
+	}, {
+		desc: "fulcio root reissued with the same key",
+		roots: &Roots{
+			Rekor:  RekorRoot{PublicKey: rekorKey},
+			Fulcio: FulcioRoot{RootCert: rootPEM("fulcio 2", pub, priv)},
+		},
+	}, {
+		desc: "fulcio root with another key",
+		roots: &Roots{
+			Rekor:  RekorRoot{PublicKey: rekorKey},
+			Fulcio: FulcioRoot{RootCert: rootPEM("fulcio", otherPub, otherPriv)},
+		},
+		wantErr: true,
+	}, {
+		desc: "another rekor key",
+		roots: &Roots{
+			Rekor:  RekorRoot{PublicKey: rekorPEM()},
+			Fulcio: pinned.Fulcio,
+		},
+		wantErr: true,
+	}} {
+		t.Run(tc.desc, func(t *testing.T) {
+			if err := tc.roots.CheckContinuity(pinned); (err != nil) != tc.wantErr {
+				t.Errorf("CheckContinuity() = %v, wanted error %t", err, tc.wantErr)
+			}
+		})
+	}
+}
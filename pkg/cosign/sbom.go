@@ -0,0 +1,53 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cosign
+
+import (
+	"crypto/ed25519"
+	"fmt"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/sigstore/cosign/pkg/cosign/oci"
+)
+
+// VerifySBOM verifies the signatures of the SBOM layer with digest sbom. It
+// has to be a layer of a referrer of the image ref points at, see
+// oci.SBOMLayers, which makes the chain from the image to the SBOM to its
+// signature. The image's own signatures aren't checked, Verify does that.
+func VerifySBOM(ref name.Reference, sbom v1.Hash, pubKey ed25519.PublicKey, annotations map[string]string, opts ...VerifyOption) ([]oci.SignedPayload, error) {
+	o := newVerifyOpts(opts)
+	desc, err := o.registry.Remote().Get(ref)
+	if err != nil {
+		return nil, err
+	}
+	layers, err := oci.SBOMLayers(ref.Context(), desc, o.registry)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range layers {
+		if l.Digest != sbom {
+			continue
+		}
+		signatures, err := oci.FetchDescriptorSignatures(ref.Context(), l, o.registry)
+		if err != nil {
+			return nil, err
+		}
+		return verifyPayloads(pubKey, sbom.Hex, true, annotations, signatures, o)
+	}
+	return nil, fmt.Errorf("%s isn't an SBOM attached to %s", sbom, ref)
+}
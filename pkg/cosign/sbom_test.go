@@ -0,0 +1,87 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cosign
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/sigstore/cosign/pkg/cosign/oci"
+)
+
+func TestVerifySBOM(t *testing.T) {
+	ro, ref, _ := writeRandomImage(t, "image")
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc, err := ro.Remote().Get(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := oci.UploadSBOM([]byte(`{"bomFormat":"CycloneDX"}`), oci.CycloneDXMediaType, desc, ref.Context(), ro); err != nil {
+		t.Fatal(err)
+	}
+	sboms, err := oci.SBOMLayers(ref.Context(), desc, ro)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sboms) != 1 {
+		t.Fatalf("SBOMLayers() = %v, wanted one SBOM", sboms)
+	}
+	sbom := sboms[0]
+
+	if _, err := VerifySBOM(ref, sbom.Digest, pub, nil, VerifyRegistryOptions(ro)); err == nil {
+		t.Error("VerifySBOM() of an unsigned SBOM, wanted error")
+	}
+
+	payload, err := oci.Payload(sbom, map[string]string{"foo": "bar"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := oci.Upload(ed25519.Sign(priv, payload), payload, ref.Context().Tag(oci.Munge(sbom)), oci.UploadRegistryOptions(ro), oci.WithReferrers(sbom)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifySBOM(ref, sbom.Digest, pub, map[string]string{"foo": "bar"}, VerifyRegistryOptions(ro)); err != nil {
+		t.Errorf("VerifySBOM() = %v", err)
+	}
+	if _, err := VerifySBOM(ref, sbom.Digest, otherPub, nil, VerifyRegistryOptions(ro)); err == nil {
+		t.Error("VerifySBOM() with the wrong key, wanted error")
+	}
+	if _, err := VerifySBOM(ref, sbom.Digest, pub, map[string]string{"foo": "baz"}, VerifyRegistryOptions(ro)); err == nil {
+		t.Error("VerifySBOM() with the wrong annotations, wanted error")
+	}
+
+	// The SBOM has to be attached to the image, not just signed.
+	img, err := random.Image(512, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherRef := ref.Context().Tag("other")
+	if err := ro.Remote().Write(otherRef, img); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifySBOM(otherRef, sbom.Digest, pub, nil, VerifyRegistryOptions(ro)); err == nil {
+		t.Error("VerifySBOM() of an SBOM attached to another image, wanted error")
+	}
+}
@@ -17,7 +17,11 @@ limitations under the License.
 package cosign
 
 import (
+	"crypto"
+	"crypto/ecdsa"
 	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
 	"encoding/pem"
 	"errors"
 	"fmt"
@@ -25,10 +29,7 @@ import (
 	"github.com/theupdateframework/go-tuf/encrypted"
 )
 
-const (
-	pemType = "ENCRYPTED COSIGN PRIVATE KEY"
-	sigkey  = "dev.cosignproject.cosign/signature"
-)
+const pemType = "ENCRYPTED COSIGN PRIVATE KEY"
 
 func LoadPrivateKey(key []byte, pass []byte) (ed25519.PrivateKey, error) {
 	// Decrypt first
@@ -40,28 +41,49 @@ func LoadPrivateKey(key []byte, pass []byte) (ed25519.PrivateKey, error) {
 		return nil, fmt.Errorf("unsupported pem type: %s", p.Type)
 	}
 
-	priv, err := encrypted.Decrypt(p.Bytes, pass)
+	var priv []byte
+	var err error
+	switch kdf := p.Headers[kdfHeader]; kdf {
+	case "":
+		priv, err = encrypted.Decrypt(p.Bytes, pass)
+	case kdfArgon2id:
+		priv, err = decryptArgon2(p, pass)
+	default:
+		return nil, fmt.Errorf("unsupported kdf: %s", kdf)
+	}
 	if err != nil {
 		return nil, err
 	}
 	return ed25519.PrivateKey(priv), nil
 }
 
-type SimpleSigning struct {
-	Critical Critical
-	Optional map[string]string
-}
-
-type Critical struct {
-	Identity Identity
-	Image    Image
-	Type     string
-}
-
-type Identity struct {
-	DockerReference string `json:"docker-reference"`
+// SignPayload signs payload with signer, an ed25519 or ECDSA key. ECDSA keys
+// sign its sha256 digest, like the other signatures cosign verifies with them.
+func SignPayload(signer crypto.Signer, payload []byte) ([]byte, error) {
+	switch signer.Public().(type) {
+	case ed25519.PublicKey:
+		return signer.Sign(rand.Reader, payload, crypto.Hash(0))
+	case *ecdsa.PublicKey:
+		h := sha256.Sum256(payload)
+		return signer.Sign(rand.Reader, h[:], crypto.SHA256)
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", signer.Public())
+	}
 }
 
-type Image struct {
-	DockerManifestDigest string `json:"Docker-manifest-digest"`
+// UpgradePrivateKey re-encrypts a scrypt encrypted private key with argon2id.
+// The bool is false, and nothing is returned, if key was already using argon2id.
+func UpgradePrivateKey(key []byte, pass []byte) ([]byte, bool, error) {
+	priv, err := LoadPrivateKey(key, pass)
+	if err != nil {
+		return nil, false, err
+	}
+	if p, _ := pem.Decode(key); p.Headers[kdfHeader] == kdfArgon2id {
+		return nil, false, nil
+	}
+	b, err := EncryptPrivateKeyArgon2(priv, pass, DefaultArgon2Params)
+	if err != nil {
+		return nil, false, err
+	}
+	return b, true, nil
 }
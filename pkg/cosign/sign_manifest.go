@@ -0,0 +1,114 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cosign
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// SignRequest is an image to sign, with the annotations to sign it with.
+type SignRequest struct {
+	Ref         string
+	Annotations map[string]string
+}
+
+// ParseSignManifest reads the images to sign from the CSV file at path.
+// Each row is an image reference followed by any number of key=value
+// annotations:
+//
+//	gcr.io/foo/bar:v1,env=prod,team=baz
+func ParseSignManifest(path string) ([]SignRequest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	// Rows have different numbers of annotations.
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+
+	reqs := []SignRequest{}
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		row := len(reqs) + 1
+		if record[0] == "" {
+			return nil, fmt.Errorf("%s: row %d: missing image reference", path, row)
+		}
+		req := SignRequest{
+			Ref:         record[0],
+			Annotations: map[string]string{},
+		}
+		for _, field := range record[1:] {
+			kv := strings.SplitN(field, "=", 2)
+			if len(kv) != 2 {
+				return nil, fmt.Errorf("%s: row %d: invalid annotation %q, expected key=value", path, row, field)
+			}
+			req.Annotations[kv[0]] = kv[1]
+		}
+		reqs = append(reqs, req)
+	}
+	return reqs, nil
+}
+
+// ParseImagesFile reads the images to sign from the file at path, one image
+// reference per line. Blank lines and comments, from # to the end of the
+// line, are skipped:
+//
+//	# Built by the release job.
+//	gcr.io/foo/bar:v1
+//	gcr.io/foo/baz@sha256:... # pinned
+func ParseImagesFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	refs := []string{}
+	s := bufio.NewScanner(f)
+	for line := 1; s.Scan(); line++ {
+		ref := s.Text()
+		if i := strings.Index(ref, "#"); i >= 0 {
+			ref = ref[:i]
+		}
+		ref = strings.TrimSpace(ref)
+		if ref == "" {
+			continue
+		}
+		if strings.ContainsAny(ref, " \t") {
+			return nil, fmt.Errorf("%s: line %d: expected one image reference, got %q", path, line, ref)
+		}
+		refs = append(refs, ref)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return refs, nil
+}
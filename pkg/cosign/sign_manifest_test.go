@@ -0,0 +1,117 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cosign
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseSignManifest(t *testing.T) {
+	tests := []struct {
+		name    string
+		csv     string
+		want    []SignRequest
+		wantErr bool
+	}{{
+		name: "no annotations",
+		csv:  "gcr.io/foo/bar:v1\n",
+		want: []SignRequest{{Ref: "gcr.io/foo/bar:v1", Annotations: map[string]string{}}},
+	}, {
+		name: "annotations",
+		csv:  "gcr.io/foo/bar:v1,env=prod, team=baz\ngcr.io/foo/bar:v2,env=a=b\n",
+		want: []SignRequest{{
+			Ref:         "gcr.io/foo/bar:v1",
+			Annotations: map[string]string{"env": "prod", "team": "baz"},
+		}, {
+			Ref:         "gcr.io/foo/bar:v2",
+			Annotations: map[string]string{"env": "a=b"},
+		}},
+	}, {
+		name: "empty",
+		csv:  "",
+		want: []SignRequest{},
+	}, {
+		name:    "bad annotation",
+		csv:     "gcr.io/foo/bar:v1,env\n",
+		wantErr: true,
+	}, {
+		name:    "no ref",
+		csv:     ",env=prod\n",
+		wantErr: true,
+	}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "manifest.csv")
+			if err := ioutil.WriteFile(path, []byte(test.csv), 0600); err != nil {
+				t.Fatal(err)
+			}
+			got, err := ParseSignManifest(path)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("ParseSignManifest() = %v, wanted error: %t", err, test.wantErr)
+			}
+			if !test.wantErr && !reflect.DeepEqual(got, test.want) {
+				t.Errorf("ParseSignManifest() = %v, wanted %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseImagesFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		want    []string
+		wantErr bool
+	}{{
+		name: "tags and digests",
+		file: "gcr.io/foo/bar:v1\ngcr.io/foo/baz@sha256:abc\n",
+		want: []string{"gcr.io/foo/bar:v1", "gcr.io/foo/baz@sha256:abc"},
+	}, {
+		name: "comments and blank lines",
+		file: "# images\n\n  gcr.io/foo/bar:v1  \ngcr.io/foo/bar:v2 # pinned\n\t\n",
+		want: []string{"gcr.io/foo/bar:v1", "gcr.io/foo/bar:v2"},
+	}, {
+		name: "empty",
+		file: "",
+		want: []string{},
+	}, {
+		name:    "two refs on a line",
+		file:    "gcr.io/foo/bar:v1 gcr.io/foo/bar:v2\n",
+		wantErr: true,
+	}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "images.txt")
+			if err := ioutil.WriteFile(path, []byte(test.file), 0600); err != nil {
+				t.Fatal(err)
+			}
+			got, err := ParseImagesFile(path)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("ParseImagesFile() = %v, wanted error: %t", err, test.wantErr)
+			}
+			if !test.wantErr && !reflect.DeepEqual(got, test.want) {
+				t.Errorf("ParseImagesFile() = %v, wanted %v", got, test.want)
+			}
+		})
+	}
+	if _, err := ParseImagesFile(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("ParseImagesFile() of a missing file, wanted error")
+	}
+}
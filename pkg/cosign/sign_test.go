@@ -17,7 +17,14 @@ limitations under the License.
 package cosign
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/pem"
 	"testing"
 )
 
@@ -54,3 +61,113 @@ func TestLoadPrivateKey(t *testing.T) {
 	}
 
 }
+
+func TestLoadPrivateKeyArgon2(t *testing.T) {
+	keys, err := GenerateKeyPairArgon2(pass("hello"), DefaultArgon2Params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadPrivateKey(keys.PrivateBytes, []byte("hello")); err != nil {
+		t.Errorf("unexpected error decrypting key: %s", err)
+	}
+	if _, err := LoadPrivateKey(keys.PrivateBytes, []byte("wrong")); err == nil {
+		t.Error("expected error decrypting key!")
+	}
+
+	// Keys that already use argon2id aren't upgraded.
+	if _, ok, err := UpgradePrivateKey(keys.PrivateBytes, []byte("hello")); err != nil || ok {
+		t.Errorf("UpgradePrivateKey() = %t, %v, wanted false, nil", ok, err)
+	}
+}
+
+func TestUpgradePrivateKey(t *testing.T) {
+	keys, err := GenerateKeyPair(pass("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := UpgradePrivateKey(keys.PrivateBytes, []byte("wrong")); err == nil {
+		t.Error("expected error upgrading key!")
+	}
+
+	upgraded, ok, err := UpgradePrivateKey(keys.PrivateBytes, []byte("hello"))
+	if err != nil || !ok {
+		t.Fatalf("UpgradePrivateKey() = %t, %v, wanted true, nil", ok, err)
+	}
+	before, err := LoadPrivateKey(keys.PrivateBytes, []byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := LoadPrivateKey(upgraded, []byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !before.Equal(after) {
+		t.Error("upgraded key doesn't match the original")
+	}
+}
+
+func TestArgon2Params(t *testing.T) {
+	for _, params := range []Argon2Params{
+		{Memory: 0, Iterations: 3, Parallelism: 4},
+		{Memory: 64 * 1024, Iterations: 0, Parallelism: 4},
+		{Memory: 64 * 1024, Iterations: 3, Parallelism: 0},
+		{Memory: maxArgon2Memory + 1, Iterations: 3, Parallelism: 4},
+		{Memory: 64 * 1024, Iterations: maxArgon2Iterations + 1, Parallelism: 4},
+	} {
+		if _, err := GenerateKeyPairArgon2(pass("hello"), params); err == nil {
+			t.Errorf("GenerateKeyPairArgon2(%+v), wanted error", params)
+		}
+	}
+
+	// The parameters of a key come from its headers, so they're checked when
+	// it's loaded too.
+	keys, err := GenerateKeyPairArgon2(pass("hello"), DefaultArgon2Params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for header, value := range map[string]string{
+		memoryHeader:      "4294967295",
+		iterationsHeader:  "0",
+		parallelismHeader: "0",
+	} {
+		p, _ := pem.Decode(keys.PrivateBytes)
+		p.Headers[header] = value
+		if _, err := LoadPrivateKey(pem.EncodeToMemory(p), []byte("hello")); err == nil {
+			t.Errorf("LoadPrivateKey() with %s: %s, wanted error", header, value)
+		}
+	}
+}
+
+func TestSignPayload(t *testing.T) {
+	_, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecPriv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaPriv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := []byte("payload")
+	for _, signer := range []crypto.Signer{edPriv, ecPriv} {
+		sig, err := SignPayload(signer, payload)
+		if err != nil {
+			t.Fatalf("SignPayload(%T) = %v", signer, err)
+		}
+		b64sig := base64.StdEncoding.EncodeToString(sig)
+		if err := VerifySignature(signer.Public(), b64sig, payload); err != nil {
+			t.Errorf("VerifySignature(%T) = %v", signer, err)
+		}
+		if err := VerifySignature(signer.Public(), b64sig, []byte("other")); err == nil {
+			t.Errorf("VerifySignature(%T) of another payload, wanted error", signer)
+		}
+	}
+	if _, err := SignPayload(rsaPriv, payload); err == nil {
+		t.Error("SignPayload(RSA), wanted error")
+	}
+}
@@ -0,0 +1,407 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cosign
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"time"
+)
+
+const timestampQueryMediaType = "application/timestamp-query"
+
+var (
+	oidSHA256        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+	oidSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidTSTInfo       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+	oidContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+)
+
+// The ASN.1 structures of RFC 3161 and the parts of CMS (RFC 5652) that
+// timestamp tokens use.
+
+type messageImprint struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashedMessage []byte
+}
+
+type timeStampReq struct {
+	Version        int
+	MessageImprint messageImprint
+	ReqPolicy      asn1.ObjectIdentifier `asn1:"optional"`
+	Nonce          *big.Int              `asn1:"optional"`
+	CertReq        bool                  `asn1:"optional,default:false"`
+}
+
+type pkiStatusInfo struct {
+	Status       int
+	StatusString []string       `asn1:"optional,utf8"`
+	FailInfo     asn1.BitString `asn1:"optional"`
+}
+
+type timeStampResp struct {
+	Status         pkiStatusInfo
+	TimeStampToken asn1.RawValue `asn1:"optional"`
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,tag:0"`
+}
+
+type encapsulatedContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     []byte `asn1:"explicit,optional,tag:0"`
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo encapsulatedContentInfo
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      []signerInfo  `asn1:"set"`
+}
+
+type signerInfo struct {
+	Version            int
+	SID                asn1.RawValue
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type issuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
+type tstInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint messageImprint
+	SerialNumber   *big.Int
+	GenTime        time.Time     `asn1:"generalized"`
+	Accuracy       accuracy      `asn1:"optional"`
+	Ordering       bool          `asn1:"optional,default:false"`
+	Nonce          *big.Int      `asn1:"optional"`
+	TSA            asn1.RawValue `asn1:"optional,tag:0"`
+	Extensions     asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type accuracy struct {
+	Seconds int `asn1:"optional"`
+	Millis  int `asn1:"optional,tag:0"`
+	Micros  int `asn1:"optional,tag:1"`
+}
+
+// RequestTimestamp asks the RFC 3161 timestamp authority at tsaURL to
+// countersign signature, and returns the DER encoded timestamp token. The
+// token isn't verified against any roots, that's VerifyTimestamp's job, but
+// it is checked to be for signature.
+func RequestTimestamp(tsaURL string, signature []byte) ([]byte, error) {
+	nonce, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, err
+	}
+	digest := crypto.SHA256.New()
+	digest.Write(signature)
+	req, err := asn1.Marshal(timeStampReq{
+		Version: 1,
+		MessageImprint: messageImprint{
+			HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA256, Parameters: asn1.NullRawValue},
+			HashedMessage: digest.Sum(nil),
+		},
+		Nonce:   nonce,
+		CertReq: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.Post(tsaURL, timestampQueryMediaType, bytes.NewReader(req)) // #nosec G107
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("POST %s: %s", tsaURL, resp.Status)
+	}
+
+	var tsr timeStampResp
+	if rest, err := asn1.Unmarshal(body, &tsr); err != nil {
+		return nil, fmt.Errorf("invalid timestamp response: %v", err)
+	} else if len(rest) != 0 {
+		return nil, errors.New("invalid timestamp response: trailing data")
+	}
+	// 0 is granted, and 1 is granted with modifications.
+	if tsr.Status.Status > 1 {
+		return nil, fmt.Errorf("timestamp authority refused the request, status %d", tsr.Status.Status)
+	}
+	token := tsr.TimeStampToken.FullBytes
+	if len(token) == 0 {
+		return nil, errors.New("timestamp response has no token")
+	}
+
+	_, info, err := parseTimestampToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if info.Nonce == nil || info.Nonce.Cmp(nonce) != 0 {
+		return nil, errors.New("timestamp is for a different request, the nonce doesn't match")
+	}
+	if err := checkMessageImprint(info.MessageImprint, signature); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// VerifyTimestamp checks that token is a timestamp of signature, signed by a
+// timestamp authority whose certificate chains up to roots, and returns the
+// time it was made. The time must be in the past, and within the validity of
+// the authority's certificate.
+func VerifyTimestamp(token, signature []byte, roots *x509.CertPool) (time.Time, error) {
+	sd, info, err := parseTimestampToken(token)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if err := checkMessageImprint(info.MessageImprint, signature); err != nil {
+		return time.Time{}, err
+	}
+	if info.GenTime.After(time.Now()) {
+		return time.Time{}, fmt.Errorf("timestamp is in the future: %v", info.GenTime)
+	}
+
+	if len(sd.SignerInfos) != 1 {
+		return time.Time{}, fmt.Errorf("timestamp has %d signers, wanted 1", len(sd.SignerInfos))
+	}
+	si := sd.SignerInfos[0]
+	certs, err := x509.ParseCertificates(sd.Certificates.Bytes)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timestamp certificates: %v", err)
+	}
+	signer, err := findSigner(si.SID, certs)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, c := range certs {
+		intermediates.AddCert(c)
+	}
+	if _, err := signer.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   info.GenTime,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	}); err != nil {
+		return time.Time{}, fmt.Errorf("untrusted timestamp authority: %v", err)
+	}
+
+	if err := checkSignerInfo(si, signer, sd.EncapContentInfo.EContent); err != nil {
+		return time.Time{}, err
+	}
+	return info.GenTime, nil
+}
+
+func parseTimestampToken(token []byte) (*signedData, *tstInfo, error) {
+	var ci contentInfo
+	if _, err := asn1.Unmarshal(token, &ci); err != nil {
+		return nil, nil, fmt.Errorf("invalid timestamp token: %v", err)
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		return nil, nil, fmt.Errorf("unsupported timestamp token content type %v", ci.ContentType)
+	}
+	sd := &signedData{}
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, sd); err != nil {
+		return nil, nil, fmt.Errorf("invalid timestamp token: %v", err)
+	}
+	if !sd.EncapContentInfo.EContentType.Equal(oidTSTInfo) {
+		return nil, nil, fmt.Errorf("unsupported timestamp content type %v", sd.EncapContentInfo.EContentType)
+	}
+	info := &tstInfo{}
+	if _, err := asn1.Unmarshal(sd.EncapContentInfo.EContent, info); err != nil {
+		return nil, nil, fmt.Errorf("invalid timestamp info: %v", err)
+	}
+	return sd, info, nil
+}
+
+// checkMessageImprint checks that the timestamp is of signature. Timestamps
+// are always requested with SHA256.
+func checkMessageImprint(mi messageImprint, signature []byte) error {
+	if !mi.HashAlgorithm.Algorithm.Equal(oidSHA256) {
+		return fmt.Errorf("unsupported timestamp hash algorithm %v", mi.HashAlgorithm.Algorithm)
+	}
+	digest := crypto.SHA256.New()
+	digest.Write(signature)
+	if !bytes.Equal(mi.HashedMessage, digest.Sum(nil)) {
+		return errors.New("timestamp is for a different signature")
+	}
+	return nil
+}
+
+// findSigner returns the certificate in certs that sid identifies, either by
+// issuer and serial number, or by subject key identifier.
+func findSigner(sid asn1.RawValue, certs []*x509.Certificate) (*x509.Certificate, error) {
+	if sid.Class == asn1.ClassContextSpecific && sid.Tag == 0 {
+		for _, c := range certs {
+			if bytes.Equal(c.SubjectKeyId, sid.Bytes) {
+				return c, nil
+			}
+		}
+		return nil, errors.New("timestamp signer certificate not found")
+	}
+	var ias issuerAndSerialNumber
+	if _, err := asn1.Unmarshal(sid.FullBytes, &ias); err != nil {
+		return nil, fmt.Errorf("invalid timestamp signer: %v", err)
+	}
+	for _, c := range certs {
+		if bytes.Equal(c.RawIssuer, ias.Issuer.FullBytes) && c.SerialNumber.Cmp(ias.SerialNumber) == 0 {
+			return c, nil
+		}
+	}
+	return nil, errors.New("timestamp signer certificate not found")
+}
+
+// checkSignerInfo checks that si is signer's signature of content. The
+// signature covers the signed attributes, which hold the digest of content.
+func checkSignerInfo(si signerInfo, signer *x509.Certificate, content []byte) error {
+	hash, err := hashFor(si.DigestAlgorithm.Algorithm)
+	if err != nil {
+		return err
+	}
+	if len(si.SignedAttrs.Bytes) == 0 {
+		return errors.New("timestamp has no signed attributes")
+	}
+
+	var contentType, messageDigest []byte
+	rest := si.SignedAttrs.Bytes
+	for len(rest) != 0 {
+		var attr attribute
+		if rest, err = asn1.Unmarshal(rest, &attr); err != nil {
+			return fmt.Errorf("invalid timestamp signed attributes: %v", err)
+		}
+		if len(attr.Values) != 1 {
+			continue
+		}
+		switch {
+		case attr.Type.Equal(oidContentType):
+			contentType = attr.Values[0].FullBytes
+		case attr.Type.Equal(oidMessageDigest):
+			messageDigest = attr.Values[0].Bytes
+		}
+	}
+	var ct asn1.ObjectIdentifier
+	if _, err := asn1.Unmarshal(contentType, &ct); err != nil || !ct.Equal(oidTSTInfo) {
+		return errors.New("timestamp signed attributes have the wrong content type")
+	}
+	digest := hash.New()
+	digest.Write(content)
+	if !bytes.Equal(messageDigest, digest.Sum(nil)) {
+		return errors.New("timestamp signed attributes have the wrong message digest")
+	}
+
+	// The signature is over the DER of the attributes as a SET OF, rather
+	// than with the implicit [0] tag they have in the SignerInfo.
+	signed := append([]byte{0x31}, si.SignedAttrs.FullBytes[1:]...)
+	algo, err := signatureAlgorithm(signer.PublicKey, hash)
+	if err != nil {
+		return err
+	}
+	if err := signer.CheckSignature(algo, signed, si.Signature); err != nil {
+		return fmt.Errorf("invalid timestamp signature: %v", err)
+	}
+	return nil
+}
+
+func hashFor(oid asn1.ObjectIdentifier) (crypto.Hash, error) {
+	switch {
+	case oid.Equal(oidSHA256):
+		return crypto.SHA256, nil
+	case oid.Equal(oidSHA384):
+		return crypto.SHA384, nil
+	case oid.Equal(oidSHA512):
+		return crypto.SHA512, nil
+	}
+	return 0, fmt.Errorf("unsupported timestamp digest algorithm %v", oid)
+}
+
+func signatureAlgorithm(pub crypto.PublicKey, hash crypto.Hash) (x509.SignatureAlgorithm, error) {
+	switch pub.(type) {
+	case *rsa.PublicKey:
+		switch hash {
+		case crypto.SHA256:
+			return x509.SHA256WithRSA, nil
+		case crypto.SHA384:
+			return x509.SHA384WithRSA, nil
+		case crypto.SHA512:
+			return x509.SHA512WithRSA, nil
+		}
+	case *ecdsa.PublicKey:
+		switch hash {
+		case crypto.SHA256:
+			return x509.ECDSAWithSHA256, nil
+		case crypto.SHA384:
+			return x509.ECDSAWithSHA384, nil
+		case crypto.SHA512:
+			return x509.ECDSAWithSHA512, nil
+		}
+	case ed25519.PublicKey:
+		return x509.PureEd25519, nil
+	}
+	return x509.UnknownSignatureAlgorithm, fmt.Errorf("unsupported timestamp signer key %T", pub)
+}
+
+// LoadCertPool reads the PEM encoded certificates at path, such as the root
+// certificates of a timestamp authority.
+func LoadCertPool(path string) (*x509.CertPool, error) {
+	certs, err := LoadCertificates(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	for _, c := range certs {
+		pool.AddCert(c)
+	}
+	return pool, nil
+}
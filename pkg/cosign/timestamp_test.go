@@ -0,0 +1,394 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cosign
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/sigstore/cosign/pkg/cosign/oci"
+)
+
+var oidECDSAWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+
+// fakeTSA is an RFC 3161 timestamp authority, with its own root.
+type fakeTSA struct {
+	roots *x509.CertPool
+	root  *x509.Certificate
+	cert  *x509.Certificate
+	key   *ecdsa.PrivateKey
+	// genTime is the time timestamps are made at, or now if it's zero.
+	genTime time.Time
+	// wrongNonce answers with a nonce that wasn't asked for.
+	wrongNonce bool
+}
+
+func newFakeTSA(t *testing.T) *fakeTSA {
+	t.Helper()
+	rootKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "fake tsa root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	rootDER, err := x509.CreateCertificate(rand.Reader, rootTmpl, rootTmpl, &rootKey.PublicKey, rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := x509.ParseCertificate(rootDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "fake tsa"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, root, &key.PublicKey, rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+	return &fakeTSA{roots: roots, root: root, cert: cert, key: key}
+}
+
+func (f *fakeTSA) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	var req timeStampReq
+	if _, err := asn1.Unmarshal(body, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	resp, err := f.respond(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/timestamp-reply")
+	w.Write(resp)
+}
+
+func (f *fakeTSA) respond(req timeStampReq) ([]byte, error) {
+	genTime := f.genTime
+	if genTime.IsZero() {
+		genTime = time.Now().Add(-time.Second)
+	}
+	nonce := req.Nonce
+	if f.wrongNonce {
+		nonce = new(big.Int).Add(nonce, big.NewInt(1))
+	}
+	eContent, err := asn1.Marshal(tstInfo{
+		Version:        1,
+		Policy:         asn1.ObjectIdentifier{1, 2, 3, 4},
+		MessageImprint: req.MessageImprint,
+		SerialNumber:   big.NewInt(42),
+		GenTime:        genTime.UTC().Truncate(time.Second),
+		Nonce:          nonce,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ct, err := asn1.Marshal(oidTSTInfo)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(eContent)
+	md, err := asn1.Marshal(digest[:])
+	if err != nil {
+		return nil, err
+	}
+	var attrs []byte
+	for _, a := range []attribute{
+		{Type: oidContentType, Values: []asn1.RawValue{{FullBytes: ct}}},
+		{Type: oidMessageDigest, Values: []asn1.RawValue{{FullBytes: md}}},
+	} {
+		b, err := asn1.Marshal(a)
+		if err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, b...)
+	}
+	set, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: attrs})
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.Sum256(set)
+	sig, err := ecdsa.SignASN1(rand.Reader, f.key, h[:])
+	if err != nil {
+		return nil, err
+	}
+
+	sid, err := asn1.Marshal(issuerAndSerialNumber{
+		Issuer:       asn1.RawValue{FullBytes: f.cert.RawIssuer},
+		SerialNumber: f.cert.SerialNumber,
+	})
+	if err != nil {
+		return nil, err
+	}
+	sha256Alg := pkix.AlgorithmIdentifier{Algorithm: oidSHA256}
+	sd, err := asn1.Marshal(signedData{
+		Version:          3,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{sha256Alg},
+		EncapContentInfo: encapsulatedContentInfo{EContentType: oidTSTInfo, EContent: eContent},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: f.cert.Raw},
+		SignerInfos: []signerInfo{{
+			Version:            1,
+			SID:                asn1.RawValue{FullBytes: sid},
+			DigestAlgorithm:    sha256Alg,
+			SignedAttrs:        asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: attrs},
+			SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidECDSAWithSHA256},
+			Signature:          sig,
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	token, err := asn1.Marshal(contentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: sd},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(timeStampResp{
+		Status:         pkiStatusInfo{Status: 0},
+		TimeStampToken: asn1.RawValue{FullBytes: token},
+	})
+}
+
+func TestTimestamp(t *testing.T) {
+	tsa := newFakeTSA(t)
+	s := httptest.NewServer(tsa)
+	defer s.Close()
+
+	signature := []byte("signature")
+	token, err := RequestTimestamp(s.URL, signature)
+	if err != nil {
+		t.Fatalf("RequestTimestamp() = %v", err)
+	}
+	got, err := VerifyTimestamp(token, signature, tsa.roots)
+	if err != nil {
+		t.Fatalf("VerifyTimestamp() = %v", err)
+	}
+	if d := time.Since(got); d < 0 || d > time.Minute {
+		t.Errorf("VerifyTimestamp() = %v, wanted about now", got)
+	}
+
+	if _, err := VerifyTimestamp(token, []byte("other signature"), tsa.roots); err == nil {
+		t.Error("VerifyTimestamp() of another signature, wanted error")
+	}
+	if _, err := VerifyTimestamp(token, signature, newFakeTSA(t).roots); err == nil {
+		t.Error("VerifyTimestamp() with other roots, wanted error")
+	}
+	tampered := append([]byte{}, token...)
+	tampered[len(tampered)-1] ^= 0xff
+	if _, err := VerifyTimestamp(tampered, signature, tsa.roots); err == nil {
+		t.Error("VerifyTimestamp() of a tampered token, wanted error")
+	}
+
+	// Outside of the validity of the TSA certificate.
+	tsa.genTime = time.Now().Add(-2 * time.Hour)
+	token, err = RequestTimestamp(s.URL, signature)
+	if err != nil {
+		t.Fatalf("RequestTimestamp() = %v", err)
+	}
+	if _, err := VerifyTimestamp(token, signature, tsa.roots); err == nil {
+		t.Error("VerifyTimestamp() before the TSA certificate is valid, wanted error")
+	}
+
+	tsa.genTime = time.Now().Add(time.Hour)
+	token, err = RequestTimestamp(s.URL, signature)
+	if err != nil {
+		t.Fatalf("RequestTimestamp() = %v", err)
+	}
+	if _, err := VerifyTimestamp(token, signature, tsa.roots); err == nil {
+		t.Error("VerifyTimestamp() in the future, wanted error")
+	}
+
+	tsa.genTime = time.Time{}
+	tsa.wrongNonce = true
+	if _, err := RequestTimestamp(s.URL, signature); err == nil {
+		t.Error("RequestTimestamp() with the wrong nonce, wanted error")
+	}
+}
+
+func TestVerifyTimestampAuthority(t *testing.T) {
+	tsa := newFakeTSA(t)
+	ts := httptest.NewServer(tsa)
+	defer ts.Close()
+	ro, ref, h := writeRandomImage(t, "timestamp")
+	sigTag := ref.Context().Tag(oci.Munge(v1.Descriptor{Digest: h}))
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	upload := func(opts ...oci.UploadOption) {
+		payload, err := oci.Payload(v1.Descriptor{Digest: h}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := oci.Upload(ed25519.Sign(priv, payload), payload, sigTag, append(opts, oci.UploadRegistryOptions(ro))...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Without a timestamp.
+	upload()
+	if _, err := Verify(ref, pub, true, nil, VerifyRegistryOptions(ro), VerifyTimestampAuthority(tsa.roots)); err == nil {
+		t.Error("Verify() without a timestamp, wanted error")
+	}
+
+	payload, err := oci.Payload(v1.Descriptor{Digest: h}, map[string]string{"timestamped": "true"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature := ed25519.Sign(priv, payload)
+	token, err := RequestTimestamp(ts.URL, signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := oci.Upload(signature, payload, sigTag, oci.UploadTimestamp(token), oci.UploadRegistryOptions(ro)); err != nil {
+		t.Fatal(err)
+	}
+	verified, err := Verify(ref, pub, true, nil, VerifyRegistryOptions(ro), VerifyTimestampAuthority(tsa.roots))
+	if err != nil {
+		t.Fatalf("Verify() = %v", err)
+	}
+	if len(verified) != 1 || verified[0].Base64Timestamp == "" {
+		t.Fatalf("Verify() = %v, wanted the timestamped signature", verified)
+	}
+	if ts, err := SignatureTimestamp(tsa.roots, verified[0]); err != nil {
+		t.Errorf("SignatureTimestamp() = %v", err)
+	} else if time.Since(ts) > time.Minute {
+		t.Errorf("SignatureTimestamp() = %v, wanted about now", ts)
+	}
+	if _, err := Verify(ref, pub, true, nil, VerifyRegistryOptions(ro), VerifyTimestampAuthority(newFakeTSA(t).roots)); err == nil {
+		t.Error("Verify() with other timestamp roots, wanted error")
+	}
+	if _, err := Verify(ref, pub, true, nil, VerifyRegistryOptions(ro), VerifyTimestampAuthority(tsa.roots), WithFailFast(false)); err == nil {
+		t.Error("Verify() without fail-fast, wanted an error for the signature without a timestamp")
+	}
+}
+
+func TestVerifyBundleTimestamp(t *testing.T) {
+	tsa := newFakeTSA(t)
+	s := httptest.NewServer(tsa)
+	defer s.Close()
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	td := t.TempDir()
+	keyPath := filepath.Join(td, "cosign.pub")
+	pemBytes, err := MarshalPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyPath, pemBytes, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	blob := []byte("hello world")
+	signature := ed25519.Sign(priv, blob)
+	b, err := NewBundle(pub, blob, signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundlePath := filepath.Join(td, "blob.sigstore")
+	if err := WriteBundle(bundlePath, b); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyBundle(bundlePath, keyPath, blob, tsa.roots); err == nil {
+		t.Error("VerifyBundle() without a timestamp, wanted error")
+	}
+
+	token, err := RequestTimestamp(s.URL, signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.VerificationMaterial.TimestampVerificationData = &TimestampVerificationData{
+		RFC3161Timestamps: []RFC3161SignedTimestamp{{SignedTimestamp: token}},
+	}
+	if err := WriteBundle(bundlePath, b); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyBundle(bundlePath, keyPath, blob, tsa.roots); err != nil {
+		t.Errorf("VerifyBundle() = %v", err)
+	}
+	if err := VerifyBundle(bundlePath, keyPath, blob, newFakeTSA(t).roots); err == nil {
+		t.Error("VerifyBundle() with other timestamp roots, wanted error")
+	}
+}
+
+func TestLoadCertPool(t *testing.T) {
+	tsa := newFakeTSA(t)
+	td := t.TempDir()
+	path := filepath.Join(td, "roots.pem")
+	if err := ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: certPemType, Bytes: tsa.root.Raw}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadCertPool(path); err != nil {
+		t.Errorf("LoadCertPool() = %v", err)
+	}
+
+	empty := filepath.Join(td, "empty.pem")
+	if err := ioutil.WriteFile(empty, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadCertPool(empty); err == nil {
+		t.Error("LoadCertPool() of an empty file, wanted error")
+	}
+}
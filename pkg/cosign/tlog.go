@@ -0,0 +1,118 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cosign
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/sigstore/cosign/pkg/cosign/metrics"
+	"github.com/sigstore/cosign/pkg/cosign/oci"
+)
+
+// TransparencyLog is an append-only log that signatures are recorded in, like
+// Rekor.
+type TransparencyLog interface {
+	// Upload records entry in the log, and returns its index.
+	Upload(ctx context.Context, entry LogEntry) (int64, error)
+	// Lookup returns the entries in the log for the payload with digest hash.
+	Lookup(ctx context.Context, hash v1.Hash) ([]LogEntry, error)
+	// VerifyInclusion checks that entry is the one at logIndex, and that it
+	// is included in the log.
+	VerifyInclusion(ctx context.Context, logIndex int64, entry LogEntry) error
+}
+
+// LogEntry is a signature, as recorded in a TransparencyLog.
+type LogEntry struct {
+	// LogIndex is the index of the entry in the log, set by Lookup.
+	LogIndex  int64
+	Payload   []byte
+	Signature []byte
+	// PublicKey is the PEM encoded key that verifies Signature.
+	PublicKey []byte
+}
+
+// NoOpTransparencyLog doesn't record anything, and vouches for everything:
+// Lookup returns a single empty entry, and VerifyInclusion accepts it. It
+// stands in for a real log in tests.
+type NoOpTransparencyLog struct{}
+
+func (NoOpTransparencyLog) Upload(context.Context, LogEntry) (int64, error) {
+	return 0, nil
+}
+
+func (NoOpTransparencyLog) Lookup(context.Context, v1.Hash) ([]LogEntry, error) {
+	return []LogEntry{{}}, nil
+}
+
+func (NoOpTransparencyLog) VerifyInclusion(context.Context, int64, LogEntry) error {
+	return nil
+}
+
+// NewLogEntry returns the entry recording signature of payload by pub.
+func NewLogEntry(payload, signature []byte, pub crypto.PublicKey) (LogEntry, error) {
+	pemPub, err := MarshalPublicKey(pub)
+	if err != nil {
+		return LogEntry{}, err
+	}
+	return LogEntry{
+		Payload:   payload,
+		Signature: signature,
+		PublicKey: pemPub,
+	}, nil
+}
+
+// verifyLogged checks that sp, signed by pubKey, is included in tl.
+func verifyLogged(ctx context.Context, tl TransparencyLog, pubKey crypto.PublicKey, sp oci.SignedPayload) error {
+	_, err := findLogEntry(ctx, tl, pubKey, sp)
+	return err
+}
+
+// findLogEntry returns the entry in tl for sp, signed by pubKey, checking it
+// is included in the log.
+func findLogEntry(ctx context.Context, tl TransparencyLog, pubKey crypto.PublicKey, sp oci.SignedPayload) (*LogEntry, error) {
+	signature, err := base64.StdEncoding.DecodeString(sp.Base64Signature)
+	if err != nil {
+		return nil, err
+	}
+	want, err := NewLogEntry(sp.Payload, signature, pubKey)
+	if err != nil {
+		return nil, err
+	}
+	h, _, err := v1.SHA256(bytes.NewReader(sp.Payload))
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	entries, err := tl.Lookup(ctx, h)
+	metrics.ObserveSince(metrics.TLogLookupDuration, start)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if err := tl.VerifyInclusion(ctx, e.LogIndex, want); err == nil {
+			want.LogIndex = e.LogIndex
+			return &want, nil
+		}
+	}
+	return nil, errors.New("signature not found in the transparency log")
+}
@@ -0,0 +1,113 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cosign
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/sigstore/cosign/pkg/cosign/oci"
+)
+
+// memLog is a TransparencyLog that keeps entries in memory. Like a remote
+// log, lookups fail once their context is done.
+type memLog struct {
+	entries []LogEntry
+}
+
+func (m *memLog) Upload(_ context.Context, entry LogEntry) (int64, error) {
+	entry.LogIndex = int64(len(m.entries))
+	m.entries = append(m.entries, entry)
+	return entry.LogIndex, nil
+}
+
+func (m *memLog) Lookup(ctx context.Context, hash v1.Hash) ([]LogEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	found := []LogEntry{}
+	for _, e := range m.entries {
+		h, _, err := v1.SHA256(bytes.NewReader(e.Payload))
+		if err != nil {
+			return nil, err
+		}
+		if h == hash {
+			found = append(found, e)
+		}
+	}
+	return found, nil
+}
+
+func (m *memLog) VerifyInclusion(_ context.Context, logIndex int64, entry LogEntry) error {
+	if logIndex < 0 || logIndex >= int64(len(m.entries)) {
+		return errors.New("no such entry")
+	}
+	e := m.entries[logIndex]
+	if !bytes.Equal(e.Payload, entry.Payload) || !bytes.Equal(e.Signature, entry.Signature) || !bytes.Equal(e.PublicKey, entry.PublicKey) {
+		return errors.New("entry doesn't match")
+	}
+	return nil
+}
+
+func TestVerifyLogged(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	payload := []byte("payload")
+	signature := ed25519.Sign(priv, payload)
+	sp := oci.SignedPayload{
+		Payload:         payload,
+		Base64Signature: base64.StdEncoding.EncodeToString(signature),
+	}
+
+	tl := &memLog{}
+	if err := verifyLogged(ctx, tl, pub, sp); err == nil {
+		t.Error("verifyLogged() before upload, wanted error")
+	}
+
+	entry, err := NewLogEntry(payload, signature, pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tl.Upload(ctx, entry); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyLogged(ctx, tl, pub, sp); err != nil {
+		t.Errorf("verifyLogged() = %v", err)
+	}
+	// The entry is for a different key.
+	if err := verifyLogged(ctx, tl, otherPub, sp); err == nil {
+		t.Error("verifyLogged() with the wrong key, wanted error")
+	}
+
+	if err := verifyLogged(ctx, NoOpTransparencyLog{}, pub, sp); err != nil {
+		t.Errorf("verifyLogged() with NoOpTransparencyLog = %v", err)
+	}
+}
@@ -0,0 +1,155 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package tuf gets the Rekor public key and Fulcio root certificate from a
+// TUF repository, so they can be rotated without a new cosign release.
+package tuf
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/sigstore/cosign/pkg/cosign"
+	"github.com/theupdateframework/go-tuf/client"
+)
+
+// The names of the targets in the TUF repository.
+const (
+	RekorTarget  = "rekor.pub"
+	FulcioTarget = "fulcio.crt.pem"
+)
+
+// Client fetches the Rekor and Fulcio roots from a TUF repository.
+type Client struct {
+	// Mirror is the URL of the TUF repository.
+	Mirror string
+	// HTTPClient, if set, is used instead of http.DefaultClient.
+	HTTPClient *http.Client
+
+	root []byte
+}
+
+// NewClient returns a Client for the TUF repository at mirror, trusting root,
+// one of its root.json versions, or EmbeddedRoot if root is nil.
+func NewClient(mirror string, root []byte) (*Client, error) {
+	if root == nil {
+		root = EmbeddedRoot
+	}
+	if len(root) == 0 {
+		return nil, errors.New("no TUF root.json to start from, and none is embedded in this build")
+	}
+	return &Client{Mirror: mirror, root: root}, nil
+}
+
+// Root returns the root.json the Client trusts: the one it started from, or
+// a newer one Update moved to.
+func (c *Client) Root() []byte {
+	return c.root
+}
+
+// Update fetches the latest metadata from the mirror, moving to a newer
+// root.json if the current one signed it, and returns the Rekor and Fulcio
+// roots among its targets. ctx bounds the requests.
+func (c *Client) Update(ctx context.Context, rekorURL, fulcioURL string) (*cosign.Roots, error) {
+	local := client.MemoryLocalStore()
+	if err := local.SetMeta("root.json", c.root); err != nil {
+		return nil, err
+	}
+	remote, err := client.HTTPRemoteStore(strings.TrimSuffix(c.Mirror, "/"), nil, c.httpClient(ctx))
+	if err != nil {
+		return nil, err
+	}
+	tc := client.NewClient(local, remote)
+	if _, err := tc.Update(); err != nil && !client.IsLatestSnapshot(err) {
+		return nil, fmt.Errorf("updating TUF metadata from %s: %v", c.Mirror, err)
+	}
+	meta, err := local.GetMeta()
+	if err != nil {
+		return nil, err
+	}
+	c.root = meta["root.json"]
+
+	pub, err := download(tc, RekorTarget)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := download(tc, FulcioTarget)
+	if err != nil {
+		return nil, err
+	}
+	roots := &cosign.Roots{
+		Rekor: cosign.RekorRoot{
+			URL:       rekorURL,
+			PublicKey: string(pub),
+		},
+		Fulcio: cosign.FulcioRoot{
+			URL:      fulcioURL,
+			RootCert: string(cert),
+		},
+	}
+	if err := roots.Validate(); err != nil {
+		return nil, err
+	}
+	return roots, nil
+}
+
+// httpClient is c.HTTPClient, with every request bound to ctx, as the TUF
+// client doesn't take a context.
+func (c *Client) httpClient(ctx context.Context) *http.Client {
+	hc := http.DefaultClient
+	if c.HTTPClient != nil {
+		hc = c.HTTPClient
+	}
+	t := hc.Transport
+	if t == nil {
+		t = http.DefaultTransport
+	}
+	bound := *hc
+	bound.Transport = &contextTransport{ctx: ctx, inner: t}
+	return &bound
+}
+
+type contextTransport struct {
+	ctx   context.Context
+	inner http.RoundTripper
+}
+
+func (t *contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.inner.RoundTrip(req.WithContext(t.ctx))
+}
+
+// buffer is a client.Destination in memory.
+type buffer struct {
+	bytes.Buffer
+}
+
+func (b *buffer) Delete() error {
+	b.Reset()
+	return nil
+}
+
+// download returns target, checked against the TUF metadata.
+func download(tc *client.Client, target string) ([]byte, error) {
+	b := &buffer{}
+	if err := tc.Download(target, b); err != nil {
+		return nil, fmt.Errorf("downloading %s: %v", target, err)
+	}
+	return b.Bytes(), nil
+}
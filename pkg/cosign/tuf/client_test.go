@@ -0,0 +1,282 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tuf
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sigstore/cosign/pkg/cosign"
+	tuf "github.com/theupdateframework/go-tuf"
+	"github.com/theupdateframework/go-tuf/data"
+	"github.com/theupdateframework/go-tuf/verify"
+)
+
+// testRepo is a TUF repository with the Rekor and Fulcio targets, served
+// over HTTP.
+type testRepo struct {
+	dir  string
+	repo *tuf.Repo
+	s    *httptest.Server
+}
+
+func newTestRepo(t *testing.T) *testRepo {
+	t.Helper()
+	dir := t.TempDir()
+	repo, err := tuf.NewRepo(tuf.FileSystemStore(dir, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Init(false); err != nil {
+		t.Fatal(err)
+	}
+	for _, role := range []string{"root", "targets", "snapshot", "timestamp"} {
+		if _, err := repo.GenKey(role); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := &testRepo{dir: dir, repo: repo, s: httptest.NewServer(http.FileServer(http.Dir(filepath.Join(dir, "repository"))))}
+	t.Cleanup(r.s.Close)
+
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubPEM, err := cosign.MarshalPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.addTarget(t, RekorTarget, pubPEM)
+	r.addTarget(t, FulcioTarget, selfSignedPEM(t))
+	r.commit(t)
+	return r
+}
+
+func (r *testRepo) addTarget(t *testing.T, name string, b []byte) {
+	t.Helper()
+	staged := filepath.Join(r.dir, "staged", "targets")
+	if err := os.MkdirAll(staged, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(staged, name), b, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.repo.AddTarget(name, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (r *testRepo) commit(t *testing.T) {
+	t.Helper()
+	if err := r.repo.Snapshot(tuf.CompressionTypeNone); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.repo.Timestamp(); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.repo.Commit(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (r *testRepo) root(t *testing.T) []byte {
+	t.Helper()
+	b, err := ioutil.ReadFile(filepath.Join(r.dir, "repository", "root.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func (r *testRepo) target(t *testing.T, name string) string {
+	t.Helper()
+	b, err := ioutil.ReadFile(filepath.Join(r.dir, "repository", "targets", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func selfSignedPEM(t *testing.T) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "fake fulcio root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func rootVersion(t *testing.T, root []byte) int {
+	t.Helper()
+	var signed struct {
+		Signed struct {
+			Version int `json:"version"`
+		} `json:"signed"`
+	}
+	if err := json.Unmarshal(root, &signed); err != nil {
+		t.Fatal(err)
+	}
+	return signed.Signed.Version
+}
+
+func TestUpdate(t *testing.T) {
+	ctx := context.Background()
+	r := newTestRepo(t)
+	c, err := NewClient(r.s.URL, r.root(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots, err := c.Update(ctx, "https://rekor.example.com", "https://fulcio.example.com")
+	if err != nil {
+		t.Fatalf("Update() = %v", err)
+	}
+	if roots.Rekor.PublicKey != r.target(t, RekorTarget) || roots.Fulcio.RootCert != r.target(t, FulcioTarget) {
+		t.Errorf("Update() = %+v, wanted the repository's targets", roots)
+	}
+	if roots.Rekor.URL != "https://rekor.example.com" || roots.Fulcio.URL != "https://fulcio.example.com" {
+		t.Errorf("Update() URLs = %s and %s", roots.Rekor.URL, roots.Fulcio.URL)
+	}
+
+	// Rotate the root key and the Rekor key.
+	old := r.root(t)
+	if _, err := r.repo.GenKey("root"); err != nil {
+		t.Fatal(err)
+	}
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubPEM, err := cosign.MarshalPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.addTarget(t, RekorTarget, pubPEM)
+	r.commit(t)
+
+	c, err = NewClient(r.s.URL, old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots, err = c.Update(ctx, "", "")
+	if err != nil {
+		t.Fatalf("Update() after rotating = %v", err)
+	}
+	if roots.Rekor.PublicKey != string(pubPEM) {
+		t.Error("Update() after rotating, wanted the new Rekor key")
+	}
+	if got, want := rootVersion(t, c.Root()), rootVersion(t, r.root(t)); got != want || got == rootVersion(t, old) {
+		t.Errorf("Root() version = %d, wanted %d", got, want)
+	}
+
+	// A root of another repository doesn't trust this one.
+	c, err = NewClient(r.s.URL, newTestRepo(t).root(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Update(ctx, "", ""); err == nil {
+		t.Error("Update() with another repository's root, wanted error")
+	}
+}
+
+func TestNewClientWithoutRoot(t *testing.T) {
+	if len(EmbeddedRoot) != 0 {
+		t.Skip("a root is embedded")
+	}
+	if _, err := NewClient("https://tuf.example.com", nil); err == nil {
+		t.Error("NewClient() without a root, wanted error")
+	}
+}
+
+func TestNewClientEmbeddedRoot(t *testing.T) {
+	r := newTestRepo(t)
+	embedded := EmbeddedRoot
+	defer func() { EmbeddedRoot = embedded }()
+	EmbeddedRoot = r.root(t)
+
+	// Without a root, the client starts from the embedded one.
+	c, err := NewClient(r.s.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots, err := c.Update(context.Background(), "", "")
+	if err != nil {
+		t.Fatalf("Update() from the embedded root = %v", err)
+	}
+	if roots.Rekor.PublicKey != r.target(t, RekorTarget) {
+		t.Errorf("Update() = %+v, wanted the repository's targets", roots)
+	}
+}
+
+func TestEmbeddedRoot(t *testing.T) {
+	if len(EmbeddedRoot) == 0 {
+		t.Skip("no root is embedded")
+	}
+	// The embedded root has to be signed by a threshold of its own root keys.
+	s := &data.Signed{}
+	if err := json.Unmarshal(EmbeddedRoot, s); err != nil {
+		t.Fatal(err)
+	}
+	root := &data.Root{}
+	if err := json.Unmarshal(s.Signed, root); err != nil {
+		t.Fatal(err)
+	}
+	if root.Type != "root" {
+		t.Fatalf("EmbeddedRoot is a %q, wanted a root", root.Type)
+	}
+	db := verify.NewDB()
+	for id, k := range root.Keys {
+		if err := db.AddKey(id, k); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, role := range root.Roles {
+		if err := db.AddRole(name, role); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.VerifySignatures(s, "root"); err != nil {
+		t.Errorf("EmbeddedRoot isn't signed by its root keys: %v", err)
+	}
+}
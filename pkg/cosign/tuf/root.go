@@ -0,0 +1,32 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tuf
+
+import (
+	// For go:embed.
+	_ "embed"
+)
+
+// EmbeddedRoot is the root.json NewClient starts from by default, which
+// decides who may sign the TUF repository. It's root.json in this directory,
+// so a build trusts a new root by replacing that file with a root.json of the
+// repository verified out of band, and rebuilding; if the file is empty,
+// cosign initialize needs -tuf-root. The root is only ever replaced by
+// rebuilding: newer ones that Client.Update moves to are signed by this one.
+//
+//go:embed root.json
+var EmbeddedRoot []byte
@@ -17,48 +17,115 @@ limitations under the License.
 package cosign
 
 import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
 	"crypto/ed25519"
+	"crypto/sha256"
 	"crypto/x509"
 	"encoding/base64"
-	"encoding/json"
+	"encoding/hex"
 	"encoding/pem"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/sigstore/cosign/pkg/cosign/metrics"
+	"github.com/sigstore/cosign/pkg/cosign/oci"
 )
 
 const pubKeyPemType = "PUBLIC KEY"
 
+// LoadPublicKey loads an ed25519 public key with the KeyProvider registered in
+// DefaultKeyProviders for the scheme of keyRef, such as file://. Without one,
+// keyRef is tried as, in order:
+//   - the path to a PEM encoded file
+//   - the raw 32 byte key, hex encoded (64 characters of [0-9a-fA-F])
+//   - the base64 encoded DER (PKIX) of the key
+//
+// Keys of other types are an error.
 func LoadPublicKey(keyRef string) (ed25519.PublicKey, error) {
+	key, err := DefaultKeyProviders.Load(keyRef)
+	if err != nil {
+		return nil, err
+	}
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: %T keys aren't supported, only ed25519 ones", keyRef, key)
+	}
+	return pub, nil
+}
+
+// loadLocalPublicKey is the KeyLoader for references without a scheme.
+func loadLocalPublicKey(keyRef string) (ed25519.PublicKey, error) {
 	// The key could be plaintext or in a file.
 	// First check if the file exists.
-	var pubBytes []byte
-	if _, err := os.Stat(keyRef); os.IsNotExist(err) {
-		pubBytes, err = base64.StdEncoding.DecodeString(keyRef)
-		if err != nil {
-			return nil, err
-		}
-	} else {
-		// PEM encoded file.
-		b, err := ioutil.ReadFile(keyRef)
-		if err != nil {
-			return nil, err
-		}
-		p, _ := pem.Decode(b)
+	if _, err := os.Stat(keyRef); !os.IsNotExist(err) {
+		return loadPEMPublicKey(keyRef)
+	}
+	if isHexKey(keyRef) {
+		return hex.DecodeString(keyRef)
+	}
+	pubBytes, err := base64.StdEncoding.DecodeString(keyRef)
+	if err != nil {
+		return nil, err
+	}
+	return parsePublicKey(pubBytes)
+}
+
+// loadPEMPublicKey loads the PEM encoded key in the file at path.
+func loadPEMPublicKey(path string) (ed25519.PublicKey, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p, _ := pem.Decode(b)
+	if p == nil {
+		return nil, errors.New("pem.Decode failed")
+	}
+	if p.Type != pubKeyPemType {
+		return nil, fmt.Errorf("not public: %q", p.Type)
+	}
+	return parsePublicKey(p.Bytes)
+}
+
+// LoadKeyring loads every ed25519 public key in the file at path, which holds
+// one or more PEM encoded keys, one after another.
+func LoadKeyring(path string) ([]ed25519.PublicKey, error) {
+	rest, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	keys := []ed25519.PublicKey{}
+	for {
+		var p *pem.Block
+		p, rest = pem.Decode(rest)
 		if p == nil {
-			return nil, errors.New("pem.Decode failed")
+			break
 		}
 		if p.Type != pubKeyPemType {
-			return nil, fmt.Errorf("not public: %q", p.Type)
+			return nil, fmt.Errorf("%s: key %d: not public: %q", path, len(keys), p.Type)
+		}
+		key, err := parsePublicKey(p.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: key %d: %v", path, len(keys), err)
 		}
-		pubBytes = p.Bytes
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%s: no public keys found", path)
 	}
+	return keys, nil
+}
 
-	pub, err := x509.ParsePKIXPublicKey(pubBytes)
+func parsePublicKey(der []byte) (ed25519.PublicKey, error) {
+	pub, err := x509.ParsePKIXPublicKey(der)
 	if err != nil {
 		return nil, err
 	}
@@ -69,87 +136,496 @@ func LoadPublicKey(keyRef string) (ed25519.PublicKey, error) {
 	return ed, nil
 }
 
-func VerifySignature(pubkey ed25519.PublicKey, base64sig string, payload []byte) error {
+// isHexKey reports whether keyRef looks like a hex encoded ed25519 key.
+func isHexKey(keyRef string) bool {
+	if len(keyRef) != hex.EncodedLen(ed25519.PublicKeySize) {
+		return false
+	}
+	for _, c := range keyRef {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// VerifySignature checks that base64sig is a signature of payload by pubkey,
+// an ed25519 or ECDSA key, see SignPayload.
+func VerifySignature(pubkey crypto.PublicKey, base64sig string, payload []byte) error {
 	signature, err := base64.StdEncoding.DecodeString(base64sig)
 	if err != nil {
 		return err
 	}
 
-	if !ed25519.Verify(pubkey, payload, signature) {
+	var ok bool
+	switch k := pubkey.(type) {
+	case ed25519.PublicKey:
+		ok = ed25519.Verify(k, payload, signature)
+	case *ecdsa.PublicKey:
+		h := sha256.Sum256(payload)
+		ok = ecdsa.VerifyASN1(k, h[:], signature)
+	default:
+		return fmt.Errorf("unsupported key type %T", pubkey)
+	}
+	if !ok {
 		return errors.New("unable to verify signature")
 	}
 
 	return nil
 }
 
-func Verify(ref name.Reference, pubKey ed25519.PublicKey, checkClaims bool, annotations map[string]string) ([]SignedPayload, error) {
-	signatures, desc, err := FetchSignatures(ref)
+// VerifyOption configures Verify.
+type VerifyOption func(*verifyOpts)
+
+type verifyOpts struct {
+	exactAnnotations bool
+	ignoreExpiry     bool
+	signedAfter      time.Time
+	failFast         bool
+	recursive        bool
+	containerConfig  bool
+	registry         oci.RegistryOptions
+	ctx              context.Context
+	tlog             TransparencyLog
+	tsaRoots         *x509.CertPool
+	intermediates    []*x509.Certificate
+	ctLogURL         string
+	certEmail        string
+	spiffeID         string
+	certIdentity     string
+	certOIDCIssuer   string
+	keyLoader        KeyLoader
+	keyCache         *keyCache
+	maxSignatures    int
+	parallelism      int
+}
+
+// VerifyErrors is returned by Verify when it isn't failing fast. It holds
+// every problem found, across all of the signatures.
+type VerifyErrors []error
+
+func (e VerifyErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Sprintf("%d verification error(s):\n  %s", len(e), strings.Join(msgs, "\n  "))
+}
+
+// VerifyAnnotationsExact rejects payloads with annotations other than the
+// ones passed to Verify. By default, extra annotations are allowed.
+func VerifyAnnotationsExact(o *verifyOpts) {
+	o.exactAnnotations = true
+}
+
+// VerifyIgnoreExpiry accepts claims past the time in their ExpiryAnnotation.
+// By default, they are rejected.
+func VerifyIgnoreExpiry(o *verifyOpts) {
+	o.ignoreExpiry = true
+}
+
+// VerifySignedAfter requires claims to have a TimestampAnnotation no earlier
+// than t.
+func VerifySignedAfter(t time.Time) VerifyOption {
+	return func(o *verifyOpts) {
+		o.signedAfter = t
+	}
+}
+
+// VerifyRecursive additionally requires every manifest in an index to be
+// signed, rather than only the index itself.
+func VerifyRecursive(o *verifyOpts) {
+	o.recursive = true
+}
+
+// VerifyContainerConfig additionally requires the config blob of the image to
+// be signed, see ContainerConfigMediaType. It can't be used with
+// VerifyRecursive.
+func VerifyContainerConfig(o *verifyOpts) {
+	o.containerConfig = true
+}
+
+// VerifyRegistryOptions authenticates to the registry with the credentials in
+// ro rather than the default keychain.
+func VerifyRegistryOptions(ro oci.RegistryOptions) VerifyOption {
+	return func(o *verifyOpts) {
+		o.registry = ro
+	}
+}
+
+// VerifyContext makes the requests Verify sends to the transparency log with
+// ctx. Without it, they use the Context of the VerifyRegistryOptions, if any.
+func VerifyContext(ctx context.Context) VerifyOption {
+	return func(o *verifyOpts) {
+		o.ctx = ctx
+	}
+}
+
+// context is the context to query the transparency log with.
+func (o *verifyOpts) context() context.Context {
+	switch {
+	case o.ctx != nil:
+		return o.ctx
+	case o.registry.Context != nil:
+		return o.registry.Context
+	}
+	return context.Background()
+}
+
+// WithFailFast controls whether Verify gives up as soon as a step leaves no
+// candidate signatures, which is the default. Without it, Verify checks every
+// signature and claim, returning whatever verified along with a VerifyErrors
+// describing everything that didn't.
+func WithFailFast(failFast bool) VerifyOption {
+	return func(o *verifyOpts) {
+		o.failFast = failFast
+	}
+}
+
+// VerifyTransparencyLog requires signatures to be included in tl.
+func VerifyTransparencyLog(tl TransparencyLog) VerifyOption {
+	return func(o *verifyOpts) {
+		o.tlog = tl
+	}
+}
+
+// VerifyTimestampAuthority requires signatures to be countersigned by an RFC
+// 3161 timestamp authority whose certificate chains up to roots.
+func VerifyTimestampAuthority(roots *x509.CertPool) VerifyOption {
+	return func(o *verifyOpts) {
+		o.tsaRoots = roots
+	}
+}
+
+// VerifyCTInclusion requires the certificates of signatures to be included in
+// the certificate transparency log at ctLogURL, as proven by the SCTs embedded
+// in them. Only VerifyWithCertificates checks it.
+func VerifyCTInclusion(ctLogURL string) VerifyOption {
+	return func(o *verifyOpts) {
+		o.ctLogURL = ctLogURL
+	}
+}
+
+// VerifyCertIntermediates adds intermediates to the chain stored with each
+// signature's certificate, for signatures stored without the intermediates
+// that issued them. Only VerifyWithCertificates uses them.
+func VerifyCertIntermediates(intermediates []*x509.Certificate) VerifyOption {
+	return func(o *verifyOpts) {
+		o.intermediates = intermediates
+	}
+}
+
+// VerifyCertEmail requires the certificates of signatures to have an email
+// address in their subject alternative names that matches pattern, a
+// filepath.Match pattern such as *@example.com. Only VerifyWithCertificates
+// checks it.
+func VerifyCertEmail(pattern string) VerifyOption {
+	return func(o *verifyOpts) {
+		o.certEmail = pattern
+	}
+}
+
+// VerifySPIFFEID requires the certificates of signatures to be X.509 SVIDs
+// for the SPIFFE ID id, such as spiffe://example.org/ns/default/sa/builder:
+// their only URI subject alternative name must be id. Only
+// VerifyWithCertificates checks it.
+func VerifySPIFFEID(id string) VerifyOption {
+	return func(o *verifyOpts) {
+		o.spiffeID = id
+	}
+}
+
+// VerifyCertIdentity requires the certificates of signatures to have an
+// email address or URI in their subject alternative names that matches
+// pattern, a filepath.Match pattern such as
+// https://github.com/acme/app/.github/workflows/*@refs/heads/main. Only
+// VerifyWithCertificates checks it.
+func VerifyCertIdentity(pattern string) VerifyOption {
+	return func(o *verifyOpts) {
+		o.certIdentity = pattern
+	}
+}
+
+// VerifyCertOIDCIssuer requires the certificates of signatures to be issued
+// by Fulcio for an OIDC token from issuer, such as
+// https://token.actions.githubusercontent.com, as recorded in the
+// certificate's OIDC issuer extension. Only VerifyWithCertificates checks it.
+func VerifyCertOIDCIssuer(issuer string) VerifyOption {
+	return func(o *verifyOpts) {
+		o.certOIDCIssuer = issuer
+	}
+}
+
+// VerifyMaxSignatures stops checking signatures once n of them have passed
+// every check, claims, timestamps and transparency log entries included,
+// which saves verifying thousands of them when one will do.
+func VerifyMaxSignatures(n int) VerifyOption {
+	return func(o *verifyOpts) {
+		o.maxSignatures = n
+	}
+}
+
+// VerifyParallelism sets how many images VerifyAll verifies at once, 4 by
+// default.
+func VerifyParallelism(n int) VerifyOption {
+	return func(o *verifyOpts) {
+		o.parallelism = n
+	}
+}
+
+func newVerifyOpts(opts []VerifyOption) *verifyOpts {
+	o := &verifyOpts{
+		failFast:    true,
+		parallelism: 4,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// Verify checks that pubKey signed the image ref, returning the payloads of the
+// signatures that verify. VerifyImageSignatures does the same, and returns
+// more about what verified.
+func Verify(ref name.Reference, pubKey ed25519.PublicKey, checkClaims bool, annotations map[string]string, opts ...VerifyOption) ([]oci.SignedPayload, error) {
+	defer metrics.ObserveSince(metrics.VerifyDuration, time.Now())
+	o := newVerifyOpts(opts)
+	if o.recursive {
+		if o.containerConfig {
+			return nil, errors.New("can't verify container configs recursively")
+		}
+		return verifyRecursive(ref, pubKey, checkClaims, annotations, o)
+	}
+
+	signatures, desc, err := oci.FetchSignatures(ref, o.registry)
+	if err != nil {
+		return nil, err
+	}
+	verified, err := verifySignatures(pubKey, desc.Digest.Hex, checkClaims, annotations, signatures, o)
+	if !o.containerConfig || (err != nil && o.failFast) {
+		return verified, err
+	}
+
+	configVerified, configErr := verifyContainerConfig(ref, pubKey, checkClaims, annotations, signatures, o)
+	verified = append(verified, configVerified...)
+	if configErr == nil {
+		return verified, err
+	}
+	configErr = fmt.Errorf("container config: %v", configErr)
+	if o.failFast {
+		return nil, configErr
+	}
+	errs := VerifyErrors{}
+	if err != nil {
+		errs = append(errs, err)
+	}
+	return verified, append(errs, configErr)
+}
+
+// verifyContainerConfig verifies the signatures of the config blob of ref.
+func verifyContainerConfig(ref name.Reference, pubKey ed25519.PublicKey, checkClaims bool, annotations map[string]string, signatures []oci.SignedPayload, o *verifyOpts) ([]oci.SignedPayload, error) {
+	img, err := o.registry.Remote().Image(ref)
+	if err != nil {
+		return nil, err
+	}
+	config, err := img.ConfigName()
 	if err != nil {
 		return nil, err
 	}
+	configSignatures := []oci.SignedPayload{}
+	for _, sp := range signatures {
+		if sp.MediaType == ContainerConfigMediaType {
+			configSignatures = append(configSignatures, sp)
+		}
+	}
+	return verifyPayloads(pubKey, config.Hex, checkClaims, annotations, configSignatures, o)
+}
 
-	// We have a few different checks to do here:
-	// 1. The signatures blobs are valid (the public key can verify the payload and signature)
-	// 2. The payload blobs are in a format we understand, and the digest of the image is correct
+// KeyError is why the key at Index of the keys passed to VerifyKeyring didn't
+// verify any signature.
+type KeyError struct {
+	Index int
+	Err   error
+}
+
+func (e *KeyError) Error() string {
+	return fmt.Sprintf("key %d: %v", e.Index, e.Err)
+}
 
-	// 1. First find all valid signatures
-	valid, err := validSignatures(pubKey, signatures)
+// VerifyKeyring is Verify, for signatures by any of keys. It succeeds if at
+// least one of the keys verifies at least one signature, and the PublicKey of
+// each payload returned is the key that verified it. If none do, the error is
+// a VerifyErrors of a *KeyError for each key.
+func VerifyKeyring(ref name.Reference, keys []ed25519.PublicKey, checkClaims bool, annotations map[string]string, opts ...VerifyOption) ([]oci.SignedPayload, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("empty keyring")
+	}
+	defer metrics.ObserveSince(metrics.VerifyDuration, time.Now())
+	o := newVerifyOpts(opts)
+	if o.containerConfig {
+		return nil, errors.New("can't verify container configs against a keyring")
+	}
+
+	signatures, desc, err := oci.FetchSignatures(ref, o.registry)
 	if err != nil {
 		return nil, err
 	}
+	return verifyKeyring(keys, desc.Digest.Hex, checkClaims, annotations, signatures, o)
+}
 
-	// If we're not verifying claims, just print and exit.
-	if !checkClaims {
-		return valid, nil
+// verifyKeyring returns the signatures of the image with digest that verify
+// with any of keys.
+func verifyKeyring(keys []ed25519.PublicKey, digest string, checkClaims bool, annotations map[string]string, signatures []oci.SignedPayload, o *verifyOpts) ([]oci.SignedPayload, error) {
+	verified := []oci.SignedPayload{}
+	errs := VerifyErrors{}
+	for i, key := range keys {
+		v, err := verifySignatures(key, digest, checkClaims, annotations, signatures, o)
+		if err != nil {
+			errs = append(errs, &KeyError{Index: i, Err: err})
+		}
+		verified = append(verified, v...)
 	}
+	// Keys that verify nothing are expected, that's what the others are for.
+	if len(verified) == 0 {
+		return nil, errs
+	}
+	return verified, nil
+}
 
-	// Now we have to actually parse the payloads and make sure the digest (and other claims) are correct
-	verified, err := verifyClaims(desc.Digest.Hex, annotations, valid)
+// verifyRecursive verifies the signatures of ref, and of every manifest in it
+// if it is an index. The payloads that verified are returned all together.
+func verifyRecursive(ref name.Reference, pubKey ed25519.PublicKey, checkClaims bool, annotations map[string]string, o *verifyOpts) ([]oci.SignedPayload, error) {
+	res, err := oci.FetchSignaturesRecursive(ref, o.registry)
 	if err != nil {
 		return nil, err
 	}
 
+	verified := []oci.SignedPayload{}
+	errs := VerifyErrors{}
+	var walk func(res *oci.FetchResult, what string) bool
+	walk = func(res *oci.FetchResult, what string) bool {
+		v, err := verifySignatures(pubKey, res.Descriptor.Digest.Hex, checkClaims, annotations, res.Signatures, o)
+		verified = append(verified, v...)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", what, err))
+			if o.failFast {
+				return false
+			}
+		}
+		hashes := make([]v1.Hash, 0, len(res.Manifests))
+		for h := range res.Manifests {
+			hashes = append(hashes, h)
+		}
+		sort.Slice(hashes, func(i, j int) bool { return hashes[i].String() < hashes[j].String() })
+		for _, h := range hashes {
+			m := res.Manifests[h]
+			if !walk(m, oci.DescribeManifest(m.Descriptor)) {
+				return false
+			}
+		}
+		return true
+	}
+	if !walk(res, ref.String()) {
+		return nil, errs[0]
+	}
+	if len(errs) != 0 {
+		return verified, errs
+	}
 	return verified, nil
 }
 
-func validSignatures(pubKey ed25519.PublicKey, signatures []SignedPayload) ([]SignedPayload, error) {
-	validSignatures := []SignedPayload{}
+// verifySignatures returns the signatures of the image with digest that
+// verify, however they were fetched. Signatures of its config blob are left
+// to verifyContainerConfig.
+func verifySignatures(pubKey crypto.PublicKey, digest string, checkClaims bool, annotations map[string]string, signatures []oci.SignedPayload, o *verifyOpts) ([]oci.SignedPayload, error) {
+	manifestSignatures := make([]oci.SignedPayload, 0, len(signatures))
+	for _, sp := range signatures {
+		if sp.MediaType != ContainerConfigMediaType {
+			manifestSignatures = append(manifestSignatures, sp)
+		}
+	}
+	return verifyPayloads(pubKey, digest, checkClaims, annotations, manifestSignatures, o)
+}
+
+// verifyPayloads returns the signatures that verify, of payloads about the
+// blob with digest.
+func verifyPayloads(pubKey crypto.PublicKey, digest string, checkClaims bool, annotations map[string]string, signatures []oci.SignedPayload, o *verifyOpts) ([]oci.SignedPayload, error) {
+	if !o.failFast {
+		return verifyEach(pubKey, digest, checkClaims, annotations, signatures, o)
+	}
+	return validSignatures(pubKey, digest, checkClaims, annotations, signatures, o.maxSignatures, o)
+}
+
+// validSignatures returns the signatures that verify, stopping once there
+// are maxValid of them, unless it's 0. A signature only counts once it has
+// passed every check: that pubKey verifies it, its claims if checkClaims is
+// set, and its timestamp and tlog entry if o asks for them. If none does, the
+// error is about the last check any of them got to.
+func validSignatures(pubKey crypto.PublicKey, digest string, checkClaims bool, annotations map[string]string, signatures []oci.SignedPayload, maxValid int, o *verifyOpts) ([]oci.SignedPayload, error) {
+	verified := []oci.SignedPayload{}
 	validationErrs := []string{}
+	checkClaimErrs := []string{}
+	tsErrs := []string{}
+	tlogErrs := []string{}
 
 	for _, sp := range signatures {
-		if err := VerifySignature(pubKey, sp.Base64Signature, sp.Payload); err != nil {
+		if maxValid > 0 && len(verified) == maxValid {
+			break
+		}
+		// The signature blob is valid: the public key verifies the payload
+		// and signature.
+		if err := verifyStoredSignature(pubKey, sp); err != nil {
 			validationErrs = append(validationErrs, err.Error())
 			continue
 		}
-		validSignatures = append(validSignatures, sp)
+		sp.PublicKey = pubKey
+		// The payload is in a format we understand, and the digest of the
+		// image (and other claims) are correct.
+		if checkClaims {
+			if err := verifyClaim(digest, annotations, sp, o); err != nil {
+				checkClaimErrs = append(checkClaimErrs, err.Error())
+				continue
+			}
+		}
+		if o.tsaRoots != nil {
+			if _, err := SignatureTimestamp(o.tsaRoots, sp); err != nil {
+				tsErrs = append(tsErrs, err.Error())
+				continue
+			}
+		}
+		if o.tlog != nil {
+			if err := verifyLogged(o.context(), o.tlog, pubKey, sp); err != nil {
+				tlogErrs = append(tlogErrs, err.Error())
+				continue
+			}
+		}
+		verified = append(verified, sp)
+	}
+
+	if len(verified) != 0 {
+		return verified, nil
 	}
-	// If there are none, we error.
-	if len(validSignatures) == 0 {
+	switch {
+	case len(tlogErrs) != 0:
+		return nil, fmt.Errorf("no signatures in the transparency log:\n%s", strings.Join(tlogErrs, "\n  "))
+	case len(tsErrs) != 0:
+		return nil, fmt.Errorf("no trusted timestamps:\n%s", strings.Join(tsErrs, "\n  "))
+	case len(checkClaimErrs) != 0:
+		return nil, fmt.Errorf("no matching claims:\n%s", strings.Join(checkClaimErrs, "\n  "))
+	default:
 		return nil, fmt.Errorf("no matching signatures:\n%s", strings.Join(validationErrs, "\n  "))
 	}
-	return validSignatures, nil
-
 }
 
-func verifyClaims(digest string, annotations map[string]string, signatures []SignedPayload) ([]SignedPayload, error) {
+func verifyClaims(digest string, annotations map[string]string, signatures []oci.SignedPayload, o *verifyOpts) ([]oci.SignedPayload, error) {
 	checkClaimErrs := []string{}
 	// Now look through the payloads for things we understand
-	verifiedPayloads := []SignedPayload{}
+	verifiedPayloads := []oci.SignedPayload{}
 	for _, sp := range signatures {
-		ss := SimpleSigning{}
-		if err := json.Unmarshal(sp.Payload, &ss); err != nil {
+		if err := verifyClaim(digest, annotations, sp, o); err != nil {
 			checkClaimErrs = append(checkClaimErrs, err.Error())
 			continue
 		}
-		foundDgst := ss.Critical.Image.DockerManifestDigest
-		if foundDgst != digest {
-			checkClaimErrs = append(checkClaimErrs, fmt.Sprintf("invalid or missing digest in claim: %s", foundDgst))
-			continue
-		}
-		if !correctAnnotations(annotations, ss.Optional) {
-			checkClaimErrs = append(checkClaimErrs, fmt.Sprintf("invalid or missing annotation in claim: %v", ss.Optional))
-			continue
-		}
 		verifiedPayloads = append(verifiedPayloads, sp)
 	}
 	if len(verifiedPayloads) == 0 {
@@ -158,11 +634,147 @@ func verifyClaims(digest string, annotations map[string]string, signatures []Sig
 	return verifiedPayloads, nil
 }
 
-func correctAnnotations(wanted, have map[string]string) bool {
-	for k, v := range wanted {
-		if have[k] != v {
-			return false
+func verifyClaim(digest string, annotations map[string]string, sp oci.SignedPayload, o *verifyOpts) error {
+	claims, err := digestAndClaims(sp.MediaType, sp.Payload)
+	if err != nil {
+		return err
+	}
+	if !containsString(claims.Digests, digest) {
+		return fmt.Errorf("invalid or missing digest in claim: %s", strings.Join(claims.Digests, ", "))
+	}
+	if ok, diff := correctAnnotations(annotations, claims.Annotations, o.exactAnnotations); !ok {
+		return fmt.Errorf("invalid or missing annotation in claim: %s", diff)
+	}
+	if expiry, ok := claims.Annotations[ExpiryAnnotation]; ok && !o.ignoreExpiry {
+		t, err := time.Parse(time.RFC3339, expiry)
+		if err != nil {
+			return fmt.Errorf("invalid expiry in claim: %v", err)
+		}
+		if time.Now().After(t) {
+			return fmt.Errorf("claim expired at %s", expiry)
 		}
 	}
-	return true
+	if notBefore, ok := claims.Annotations[NotBeforeAnnotation]; ok {
+		t, err := time.Parse(time.RFC3339, notBefore)
+		if err != nil {
+			return fmt.Errorf("invalid not-before time in claim: %v", err)
+		}
+		if time.Now().Before(t) {
+			return fmt.Errorf("claim isn't valid until %s", notBefore)
+		}
+	}
+	if !o.signedAfter.IsZero() {
+		signed, ok := claims.Annotations[TimestampAnnotation]
+		if !ok {
+			return errors.New("no signing timestamp in claim")
+		}
+		t, err := time.Parse(time.RFC3339, signed)
+		if err != nil {
+			return fmt.Errorf("invalid signing timestamp in claim: %v", err)
+		}
+		if t.Before(o.signedAfter) {
+			return fmt.Errorf("claim signed at %s, before %s", signed, o.signedAfter.Format(time.RFC3339))
+		}
+	}
+	return nil
+}
+
+// verifyEach checks every signature, and its claims if checkClaims is set,
+// collecting every failure instead of stopping at the first step that fails.
+func verifyEach(pubKey crypto.PublicKey, digest string, checkClaims bool, annotations map[string]string, signatures []oci.SignedPayload, o *verifyOpts) ([]oci.SignedPayload, error) {
+	verified := []oci.SignedPayload{}
+	errs := VerifyErrors{}
+	for i, sp := range signatures {
+		if o.maxSignatures > 0 && len(verified) == o.maxSignatures {
+			break
+		}
+		if err := verifyStoredSignature(pubKey, sp); err != nil {
+			errs = append(errs, fmt.Errorf("signature %d: %v", i, err))
+			continue
+		}
+		sp.PublicKey = pubKey
+		if checkClaims {
+			if err := verifyClaim(digest, annotations, sp, o); err != nil {
+				errs = append(errs, fmt.Errorf("signature %d: %v", i, err))
+				continue
+			}
+		}
+		if o.tsaRoots != nil {
+			if _, err := SignatureTimestamp(o.tsaRoots, sp); err != nil {
+				errs = append(errs, fmt.Errorf("signature %d: %v", i, err))
+				continue
+			}
+		}
+		if o.tlog != nil {
+			if err := verifyLogged(o.context(), o.tlog, pubKey, sp); err != nil {
+				errs = append(errs, fmt.Errorf("signature %d: %v", i, err))
+				continue
+			}
+		}
+		verified = append(verified, sp)
+	}
+	if len(errs) != 0 {
+		return verified, errs
+	}
+	return verified, nil
+}
+
+// SignatureTimestamp checks that the signature of sp has a timestamp from an
+// authority trusted by roots, and returns the time it was made. Unlike the
+// time a signature was uploaded, it can't be backdated by whoever signed.
+func SignatureTimestamp(roots *x509.CertPool, sp oci.SignedPayload) (time.Time, error) {
+	if sp.Base64Timestamp == "" {
+		return time.Time{}, errors.New("signature has no timestamp")
+	}
+	token, err := base64.StdEncoding.DecodeString(sp.Base64Timestamp)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timestamp: %v", err)
+	}
+	signature, err := base64.StdEncoding.DecodeString(sp.Base64Signature)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return VerifyTimestamp(token, signature, roots)
+}
+
+// correctAnnotations checks that have contains wanted. If exact is set, have
+// can't contain anything else either. Structured values in have are compacted
+// JSON, see annotationValues. If not, the string describes every
+// annotation that is missing, wrong or unexpected.
+func correctAnnotations(wanted, have map[string]string, exact bool) (bool, string) {
+	diffs := []string{}
+	for _, k := range sortedKeys(wanted) {
+		got, ok := have[k]
+		if !ok {
+			diffs = append(diffs, fmt.Sprintf("%s: missing, wanted %q", k, wanted[k]))
+		} else if got != wanted[k] {
+			diffs = append(diffs, fmt.Sprintf("%s: wanted %q, got %q", k, wanted[k], got))
+		}
+	}
+	if exact {
+		for _, k := range sortedKeys(have) {
+			if _, ok := wanted[k]; !ok {
+				diffs = append(diffs, fmt.Sprintf("%s: unexpected, got %q", k, have[k]))
+			}
+		}
+	}
+	return len(diffs) == 0, strings.Join(diffs, ", ")
+}
+
+func containsString(ss []string, s string) bool {
+	for _, x := range ss {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
 }
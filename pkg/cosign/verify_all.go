@@ -0,0 +1,82 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cosign
+
+import (
+	"context"
+	"crypto/ed25519"
+	"sync"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/sigstore/cosign/pkg/cosign/oci"
+)
+
+// VerifyResult is what verifying one of the images passed to VerifyAll found.
+type VerifyResult struct {
+	Ref      name.Reference
+	Verified []oci.SignedPayload
+	// Err is the error Verify returned. Without fail-fast, Verified can be
+	// set along with it.
+	Err error
+}
+
+// VerifyAll verifies each of refs like Verify does, several at once (see
+// VerifyParallelism), and returns their results in the same order as refs.
+// Images that haven't been started when ctx is done fail with its error.
+func VerifyAll(ctx context.Context, refs []name.Reference, pubKey ed25519.PublicKey, checkClaims bool, annotations map[string]string, opts ...VerifyOption) []VerifyResult {
+	o := newVerifyOpts(opts)
+	parallelism := o.parallelism
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	if f := o.registry.Progress; f != nil {
+		// Progress functions are never called concurrently.
+		var mu sync.Mutex
+		ro := o.registry
+		ro.Progress = func(event string, done, total int64) {
+			mu.Lock()
+			defer mu.Unlock()
+			f(event, done, total)
+		}
+		opts = append(opts, VerifyRegistryOptions(ro))
+	}
+
+	results := make([]VerifyResult, len(refs))
+	sem := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	for i, ref := range refs {
+		results[i].Ref = ref
+		if err := ctx.Err(); err != nil {
+			results[i].Err = err
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			results[i].Err = ctx.Err()
+			continue
+		case sem <- struct{}{}:
+		}
+		wg.Add(1)
+		go func(r *VerifyResult) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			r.Verified, r.Err = Verify(r.Ref, pubKey, checkClaims, annotations, opts...)
+		}(&results[i])
+	}
+	wg.Wait()
+	return results
+}
@@ -0,0 +1,138 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cosign
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/x509"
+	"errors"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/sigstore/cosign/pkg/cosign/metrics"
+	"github.com/sigstore/cosign/pkg/cosign/oci"
+)
+
+// CheckOpts configures VerifyImageSignatures.
+type CheckOpts struct {
+	// PubKeys are the keys signatures are checked with; a signature by any
+	// of them verifies. Exactly one of PubKeys and Roots has to be set.
+	PubKeys []ed25519.PublicKey
+	// Roots checks signatures with the key in the certificate stored with
+	// each of them instead, which has to chain up to one of Roots, through
+	// Intermediates if they aren't stored with it, see
+	// VerifyWithCertificates.
+	Roots         *x509.CertPool
+	Intermediates []*x509.Certificate
+	// CertEmail, if set, is a pattern the SAN email address of each
+	// certificate has to match, see VerifyCertEmail.
+	CertEmail string
+
+	// CheckClaims checks the payloads are about the image, and have
+	// Annotations.
+	CheckClaims bool
+	Annotations map[string]string
+
+	// TransparencyLog, if set, requires signatures to be in it, such as
+	// Rekor.
+	TransparencyLog TransparencyLog
+
+	// RegistryOptions authenticate to the registry. Its Context defaults to
+	// the one passed to VerifyImageSignatures.
+	RegistryOptions oci.RegistryOptions
+
+	// Options are any other VerifyOptions, such as WithFailFast or
+	// VerifyTimestampAuthority. VerifyRecursive and VerifyContainerConfig
+	// aren't supported.
+	Options []VerifyOption
+}
+
+// VerificationResult is what VerifyImageSignatures verified.
+type VerificationResult struct {
+	// Verified are the payloads of the signatures that verified, and the
+	// key that verified each.
+	Verified []oci.SignedPayload
+	// Digest is the digest of the image the signatures are of, which its
+	// reference resolved to.
+	Digest v1.Hash
+	// Certificate is the certificate of the first verified signature, if
+	// CheckOpts.Roots was set.
+	Certificate *x509.Certificate
+	// LogEntry is the entry of the first verified signature in the
+	// transparency log, if CheckOpts.TransparencyLog was set.
+	LogEntry *LogEntry
+}
+
+// VerifyImageSignatures checks that the image ref is signed as co requires.
+// It's Verify, VerifyKeyring or VerifyWithCertificates, returning more than
+// the payloads that verified.
+func VerifyImageSignatures(ctx context.Context, ref name.Reference, co *CheckOpts) (*VerificationResult, error) {
+	if (len(co.PubKeys) == 0) == (co.Roots == nil) {
+		return nil, errors.New("exactly one of the public keys and the certificate roots has to be set")
+	}
+	defer metrics.ObserveSince(metrics.VerifyDuration, time.Now())
+
+	ro := co.RegistryOptions
+	if ro.Context == nil {
+		ro.Context = ctx
+	}
+	o := newVerifyOpts(append([]VerifyOption{VerifyRegistryOptions(ro)}, co.Options...))
+	if o.recursive || o.containerConfig {
+		return nil, errors.New("VerifyImageSignatures doesn't verify recursively or container configs")
+	}
+	if co.TransparencyLog != nil {
+		o.tlog = co.TransparencyLog
+	}
+	if co.Roots != nil {
+		o.intermediates = append(o.intermediates, co.Intermediates...)
+		if co.CertEmail != "" {
+			o.certEmail = co.CertEmail
+		}
+		if err := checkCertificateOpts(o); err != nil {
+			return nil, err
+		}
+	}
+
+	signatures, desc, err := oci.FetchSignatures(ref, o.registry)
+	if err != nil {
+		return nil, err
+	}
+	res := &VerificationResult{Digest: desc.Digest}
+	if co.Roots != nil {
+		res.Verified, err = verifyCertificateSignatures(co.Roots, desc.Digest.Hex, co.CheckClaims, co.Annotations, signatures, o)
+	} else {
+		res.Verified, err = verifyKeyring(co.PubKeys, desc.Digest.Hex, co.CheckClaims, co.Annotations, signatures, o)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	first := res.Verified[0]
+	if co.Roots != nil {
+		if res.Certificate, err = ExtractCertificate(first); err != nil {
+			return nil, err
+		}
+	}
+	if co.TransparencyLog != nil {
+		if res.LogEntry, err = findLogEntry(ctx, co.TransparencyLog, first.PublicKey, first); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
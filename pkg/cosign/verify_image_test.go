@@ -0,0 +1,157 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cosign
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/sigstore/cosign/pkg/cosign/oci"
+)
+
+func TestVerifyImageSignatures(t *testing.T) {
+	ctx := context.Background()
+	ro, ref, h := writeRandomImage(t, "verify-image")
+	sigTag := ref.Context().Tag(oci.Munge(v1.Descriptor{Digest: h}))
+	payload, err := oci.Payload(v1.Descriptor{Digest: h}, map[string]string{"env": "prod"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature := ed25519.Sign(priv, payload)
+	if err := oci.Upload(signature, payload, sigTag, oci.UploadRegistryOptions(ro)); err != nil {
+		t.Fatal(err)
+	}
+
+	co := &CheckOpts{
+		PubKeys:         []ed25519.PublicKey{otherPub, pub},
+		CheckClaims:     true,
+		Annotations:     map[string]string{"env": "prod"},
+		RegistryOptions: ro,
+	}
+	res, err := VerifyImageSignatures(ctx, ref, co)
+	if err != nil {
+		t.Fatalf("VerifyImageSignatures() = %v", err)
+	}
+	if res.Digest != h {
+		t.Errorf("VerifyImageSignatures() digest = %v, wanted %v", res.Digest, h)
+	}
+	if len(res.Verified) != 1 || !pub.Equal(res.Verified[0].PublicKey) {
+		t.Errorf("VerifyImageSignatures() = %v, wanted the signature by pub", res.Verified)
+	}
+	if res.Certificate != nil || res.LogEntry != nil {
+		t.Errorf("VerifyImageSignatures() = %v, wanted no certificate or log entry", res)
+	}
+
+	co.Annotations = map[string]string{"env": "dev"}
+	if _, err := VerifyImageSignatures(ctx, ref, co); err == nil {
+		t.Error("VerifyImageSignatures() with the wrong annotations, wanted error")
+	}
+	co.Annotations = nil
+
+	// The signature has to be in the transparency log, and its entry is
+	// returned.
+	tl := &memLog{}
+	co.TransparencyLog = tl
+	if _, err := VerifyImageSignatures(ctx, ref, co); err == nil {
+		t.Error("VerifyImageSignatures() before the log upload, wanted error")
+	}
+	entry, err := NewLogEntry(payload, signature, pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tl.Upload(ctx, entry); err != nil {
+		t.Fatal(err)
+	}
+	if res, err = VerifyImageSignatures(ctx, ref, co); err != nil {
+		t.Fatalf("VerifyImageSignatures() = %v", err)
+	}
+	if res.LogEntry == nil || res.LogEntry.LogIndex != 0 || string(res.LogEntry.Payload) != string(payload) {
+		t.Errorf("VerifyImageSignatures() log entry = %v, wanted the uploaded one", res.LogEntry)
+	}
+	// The log is queried with the verify context, not the registry's.
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := Verify(ref, pub, false, nil, VerifyRegistryOptions(ro), VerifyTransparencyLog(tl), VerifyContext(canceled)); err == nil {
+		t.Error("Verify() with a canceled context, wanted error")
+	}
+	if _, err := Verify(ref, pub, false, nil, VerifyRegistryOptions(ro), VerifyTransparencyLog(tl), VerifyContext(ctx)); err != nil {
+		t.Errorf("Verify() = %v", err)
+	}
+
+	if _, err := VerifyImageSignatures(ctx, ref, &CheckOpts{RegistryOptions: ro}); err == nil {
+		t.Error("VerifyImageSignatures() without keys or roots, wanted error")
+	}
+	if _, err := VerifyImageSignatures(ctx, ref, &CheckOpts{PubKeys: []ed25519.PublicKey{pub}, RegistryOptions: ro, Options: []VerifyOption{VerifyRecursive}}); err == nil {
+		t.Error("VerifyImageSignatures() recursively, wanted error")
+	}
+}
+
+func TestVerifyImageSignaturesWithCertificates(t *testing.T) {
+	ctx := context.Background()
+	ca := newTestCA(t)
+	ro, ref, h := writeRandomImage(t, "verify-image-certificate")
+	sigTag := ref.Context().Tag(oci.Munge(v1.Descriptor{Digest: h}))
+	payload, err := oci.Payload(v1.Descriptor{Digest: h}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := ca.issue(t, pub, "alice@example.com")
+	if err := oci.Upload(ed25519.Sign(priv, payload), payload, sigTag, oci.UploadCertificate(cert, nil), oci.UploadRegistryOptions(ro)); err != nil {
+		t.Fatal(err)
+	}
+
+	co := &CheckOpts{
+		Roots:           ca.roots,
+		Intermediates:   []*x509.Certificate{ca.intermediate},
+		CertEmail:       "*@example.com",
+		CheckClaims:     true,
+		RegistryOptions: ro,
+	}
+	res, err := VerifyImageSignatures(ctx, ref, co)
+	if err != nil {
+		t.Fatalf("VerifyImageSignatures() = %v", err)
+	}
+	if res.Certificate == nil || res.Certificate.EmailAddresses[0] != "alice@example.com" {
+		t.Errorf("VerifyImageSignatures() certificate = %v, wanted alice's", res.Certificate)
+	}
+
+	co.CertEmail = "*@example.org"
+	if _, err := VerifyImageSignatures(ctx, ref, co); err == nil {
+		t.Error("VerifyImageSignatures() with another email, wanted error")
+	}
+	co.CertEmail = ""
+	co.PubKeys = []ed25519.PublicKey{pub}
+	if _, err := VerifyImageSignatures(ctx, ref, co); err == nil {
+		t.Error("VerifyImageSignatures() with keys and roots, wanted error")
+	}
+}
@@ -0,0 +1,193 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cosign
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/sigstore/cosign/pkg/cosign/oci"
+)
+
+// ChangeType is the kind of change WatchVerify saw.
+type ChangeType string
+
+const (
+	// ChangeDigest is when the reference points at a different image.
+	ChangeDigest ChangeType = "digest"
+	// ChangeSignatureAdded is when a signature appears, whether or not it
+	// verifies.
+	ChangeSignatureAdded ChangeType = "signature-added"
+	// ChangeSignatureRemoved is when a signature that verified disappears.
+	ChangeSignatureRemoved ChangeType = "signature-removed"
+	// ChangePollFailed is when the image or its signatures couldn't be
+	// fetched. The next poll is compared with the last one that succeeded.
+	ChangePollFailed ChangeType = "poll-failed"
+)
+
+// ChangeEvent is a change WatchVerify saw between two polls of an image.
+type ChangeEvent struct {
+	Type ChangeType `json:"type"`
+	// OldDigest and NewDigest are the digest of the image at the previous
+	// poll and this one. They only differ for ChangeDigest.
+	OldDigest v1.Hash `json:"oldDigest"`
+	NewDigest v1.Hash `json:"newDigest"`
+	// Old and New are every signature of the image at the previous poll and
+	// this one. Those that verify have their PublicKey set.
+	Old []oci.SignedPayload `json:"old"`
+	New []oci.SignedPayload `json:"new"`
+	// Changed are the signatures that were added or removed, and nothing
+	// for ChangeDigest.
+	Changed []oci.SignedPayload `json:"changed,omitempty"`
+	// Error is why the poll failed, only for ChangePollFailed, which has
+	// neither a NewDigest nor New signatures.
+	Error string `json:"error,omitempty"`
+}
+
+// watchState is what WatchVerify saw at one poll.
+type watchState struct {
+	digest     v1.Hash
+	signatures []oci.SignedPayload
+}
+
+// WatchVerify polls the image ref points at every interval, verifying its
+// signatures with pubKey, checkClaims and annotations as Verify does, and
+// calls onChange when its digest changes, when a signature that verified
+// disappears, or when a new signature appears. The first poll only records
+// what's there, and if it fails, WatchVerify returns why. Later polls that
+// fail are passed to onChange as ChangePollFailed, and the watch goes on. It
+// runs until ctx is done, returning ctx.Err(). Of opts, the registry options
+// and what a signature must pass to verify are used, as for Verify.
+func WatchVerify(ctx context.Context, ref name.Reference, pubKey ed25519.PublicKey, checkClaims bool, annotations map[string]string, interval time.Duration, onChange func(ChangeEvent), opts ...VerifyOption) error {
+	if interval <= 0 {
+		return errors.New("watch interval must be positive")
+	}
+	o := newVerifyOpts(append(opts, WithFailFast(false)))
+	poll := func() (*watchState, error) {
+		return pollWatch(ref, pubKey, checkClaims, annotations, o)
+	}
+	last, err := poll()
+	if err != nil {
+		return err
+	}
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+		cur, err := poll()
+		if err != nil {
+			onChange(ChangeEvent{
+				Type:      ChangePollFailed,
+				OldDigest: last.digest,
+				Old:       last.signatures,
+				Error:     err.Error(),
+			})
+			continue
+		}
+		for _, e := range watchChanges(last, cur) {
+			onChange(e)
+		}
+		last = cur
+	}
+}
+
+// pollWatch fetches the signatures of ref, setting the PublicKey of those
+// that verify. Having no signatures isn't an error.
+func pollWatch(ref name.Reference, pubKey ed25519.PublicKey, checkClaims bool, annotations map[string]string, o *verifyOpts) (*watchState, error) {
+	desc, err := o.registry.Remote().Get(ref)
+	if err != nil {
+		return nil, err
+	}
+	signatures, err := oci.FetchDescriptorSignatures(ref.Context(), desc, o.registry)
+	if _, ok := err.(*oci.NoSignaturesError); ok {
+		signatures, err = []oci.SignedPayload{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Errors are for the signatures that don't verify, which are reported
+	// without a PublicKey rather than stopping the watch.
+	verified, _ := verifySignatures(pubKey, desc.Digest.Hex, checkClaims, annotations, signatures, o)
+	valid := map[string]bool{}
+	for _, sp := range verified {
+		valid[sp.Base64Signature] = true
+	}
+	for i := range signatures {
+		if valid[signatures[i].Base64Signature] {
+			signatures[i].PublicKey = pubKey
+		}
+	}
+	return &watchState{digest: desc.Digest, signatures: signatures}, nil
+}
+
+// watchChanges returns the changes from last to cur, if any.
+func watchChanges(last, cur *watchState) []ChangeEvent {
+	event := func(t ChangeType, changed []oci.SignedPayload) ChangeEvent {
+		return ChangeEvent{
+			Type:      t,
+			OldDigest: last.digest,
+			NewDigest: cur.digest,
+			Old:       last.signatures,
+			New:       cur.signatures,
+			Changed:   changed,
+		}
+	}
+	if last.digest != cur.digest {
+		// The signatures are of another image, so comparing them says
+		// nothing more.
+		return []ChangeEvent{event(ChangeDigest, nil)}
+	}
+
+	seen := func(signatures []oci.SignedPayload) map[string]bool {
+		m := map[string]bool{}
+		for _, sp := range signatures {
+			m[sp.Base64Signature] = true
+		}
+		return m
+	}
+	before, after := seen(last.signatures), seen(cur.signatures)
+	removed := []oci.SignedPayload{}
+	for _, sp := range last.signatures {
+		if sp.PublicKey != nil && !after[sp.Base64Signature] {
+			removed = append(removed, sp)
+		}
+	}
+	added := []oci.SignedPayload{}
+	for _, sp := range cur.signatures {
+		if !before[sp.Base64Signature] {
+			added = append(added, sp)
+		}
+	}
+
+	events := []ChangeEvent{}
+	if len(removed) != 0 {
+		events = append(events, event(ChangeSignatureRemoved, removed))
+	}
+	if len(added) != 0 {
+		events = append(events, event(ChangeSignatureAdded, added))
+	}
+	return events
+}
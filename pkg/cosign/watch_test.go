@@ -0,0 +1,132 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cosign
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/sigstore/cosign/pkg/cosign/oci"
+)
+
+func TestWatchVerify(t *testing.T) {
+	ro, ref, h := writeRandomImage(t, "watch")
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, otherPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := oci.Payload(v1.Descriptor{Digest: h}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sigTag := ref.Context().Tag(oci.Munge(v1.Descriptor{Digest: h}))
+	upload := func(priv ed25519.PrivateKey, payload []byte, opts ...oci.UploadOption) {
+		t.Helper()
+		opts = append(opts, oci.UploadRegistryOptions(ro))
+		if err := oci.Upload(ed25519.Sign(priv, payload), payload, sigTag, opts...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	upload(priv, payload)
+
+	events := make(chan ChangeEvent, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- WatchVerify(ctx, ref, pub, true, nil, 10*time.Millisecond, func(e ChangeEvent) { events <- e }, VerifyRegistryOptions(ro))
+	}()
+	next := func(want ChangeType) ChangeEvent {
+		t.Helper()
+		select {
+		case e := <-events:
+			if e.Type != want {
+				t.Fatalf("WatchVerify() saw %s, wanted %s", e.Type, want)
+			}
+			return e
+		case err := <-done:
+			t.Fatalf("WatchVerify() = %v, wanted %s", err, want)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("WatchVerify() saw nothing, wanted %s", want)
+		}
+		return ChangeEvent{}
+	}
+	// Let the first poll record the signature before changing anything.
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case e := <-events:
+		t.Fatalf("WatchVerify() saw %s before anything changed", e.Type)
+	default:
+	}
+
+	// A signature by another key is added, but doesn't verify.
+	upload(otherPriv, payload)
+	e := next(ChangeSignatureAdded)
+	if len(e.Changed) != 1 || e.Changed[0].PublicKey != nil || len(e.Old) != 1 || len(e.New) != 2 {
+		t.Errorf("WatchVerify() = %+v, wanted one unverified signature added", e)
+	}
+
+	// Replacing the valid signature removes it and adds another.
+	upload(otherPriv, append(payload, '\n'), oci.UploadReplace(pub))
+	e = next(ChangeSignatureRemoved)
+	if len(e.Changed) != 1 || !pub.Equal(e.Changed[0].PublicKey) {
+		t.Errorf("WatchVerify() = %+v, wanted the verified signature removed", e)
+	}
+	e = next(ChangeSignatureAdded)
+	if len(e.Changed) != 1 || e.Changed[0].PublicKey != nil {
+		t.Errorf("WatchVerify() = %+v, wanted one unverified signature added", e)
+	}
+
+	// The tag moves to another image.
+	img, err := random.Image(512, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ro.Remote().Write(ref, img); err != nil {
+		t.Fatal(err)
+	}
+	e = next(ChangeDigest)
+	if e.OldDigest != h || e.NewDigest == h || len(e.New) != 0 {
+		t.Errorf("WatchVerify() = %+v, wanted the digest to change from %s", e, h)
+	}
+
+	// Once the tag is gone, polls fail, but the watch goes on.
+	newH, err := img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ro.Remote().Delete(ref); err != nil {
+		t.Fatal(err)
+	}
+	e = next(ChangePollFailed)
+	if e.Error == "" || e.OldDigest != newH {
+		t.Errorf("WatchVerify() = %+v, wanted an error after %s", e, newH)
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("WatchVerify() = %v, wanted %v", err, context.Canceled)
+	}
+}
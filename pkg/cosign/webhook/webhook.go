@@ -0,0 +1,256 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package webhook is a Kubernetes validating admission webhook that only
+// admits pods whose images are signed.
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/sigstore/cosign/pkg/cosign"
+	"github.com/sigstore/cosign/pkg/cosign/oci"
+	"gopkg.in/yaml.v2"
+)
+
+// Rule requires the images matching ImagePattern to be signed by Threshold
+// of the keys in PubKey.
+type Rule struct {
+	// ImagePattern is matched against the image references of containers,
+	// as written in the pod. * matches any characters, including /, and ?
+	// any one character.
+	ImagePattern string `yaml:"imagePattern"`
+	// PubKey is the path to a file of one or more PEM encoded public keys,
+	// see cosign.LoadKeyring, or a PEM encoded key written out in the config.
+	PubKey string `yaml:"pubKey"`
+	// Threshold is how many of the keys have to sign, 1 if it isn't set.
+	Threshold int `yaml:"threshold"`
+
+	pattern *regexp.Regexp
+	policy  cosign.ImageSignaturePolicy
+}
+
+// LoadConfig reads a YAML list of Rules from the file at path, and loads
+// their keys.
+func LoadConfig(path string) ([]Rule, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	rules := []Rule{}
+	if err := yaml.UnmarshalStrict(b, &rules); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("%s: no rules", path)
+	}
+	for i := range rules {
+		if err := rules[i].compile(); err != nil {
+			return nil, fmt.Errorf("%s: rule %d: %v", path, i, err)
+		}
+	}
+	return rules, nil
+}
+
+// compile parses the pattern of r and loads its keys into a policy.
+func (r *Rule) compile() error {
+	if r.ImagePattern == "" {
+		return errors.New("no imagePattern")
+	}
+	re := regexp.QuoteMeta(r.ImagePattern)
+	re = strings.NewReplacer(`\*`, ".*", `\?`, ".").Replace(re)
+	r.pattern = regexp.MustCompile("^" + re + "$")
+
+	keys := []string{}
+	switch {
+	case r.PubKey == "":
+		return errors.New("no pubKey")
+	case strings.HasPrefix(strings.TrimSpace(r.PubKey), "-----BEGIN"):
+		keys = append(keys, r.PubKey)
+	default:
+		keyring, err := cosign.LoadKeyring(r.PubKey)
+		if err != nil {
+			return err
+		}
+		for _, k := range keyring {
+			pem, err := cosign.MarshalPublicKey(k)
+			if err != nil {
+				return err
+			}
+			keys = append(keys, string(pem))
+		}
+	}
+	threshold := r.Threshold
+	if threshold == 0 {
+		threshold = 1
+	}
+	if threshold < 0 || threshold > len(keys) {
+		return fmt.Errorf("threshold %d is out of range for %d key(s)", r.Threshold, len(keys))
+	}
+	r.policy = cosign.ImageSignaturePolicy{RequiredKeys: keys, Threshold: threshold}
+	return nil
+}
+
+// Match reports whether image matches the pattern of r.
+func (r *Rule) Match(image string) bool {
+	return r.pattern != nil && r.pattern.MatchString(image)
+}
+
+// AdmissionReview is the subset of a Kubernetes admission.k8s.io/v1
+// AdmissionReview that the webhook reads and writes.
+type AdmissionReview struct {
+	APIVersion string             `json:"apiVersion"`
+	Kind       string             `json:"kind"`
+	Request    *AdmissionRequest  `json:"request,omitempty"`
+	Response   *AdmissionResponse `json:"response,omitempty"`
+}
+
+// AdmissionRequest is the object being admitted, and what's being done to
+// it.
+type AdmissionRequest struct {
+	UID  string `json:"uid"`
+	Kind struct {
+		Group   string `json:"group"`
+		Version string `json:"version"`
+		Kind    string `json:"kind"`
+	} `json:"kind"`
+	Operation string          `json:"operation"`
+	Namespace string          `json:"namespace"`
+	Name      string          `json:"name"`
+	Object    json.RawMessage `json:"object"`
+}
+
+// AdmissionResponse says whether the request is allowed, and if not, why.
+type AdmissionResponse struct {
+	UID     string  `json:"uid"`
+	Allowed bool    `json:"allowed"`
+	Result  *Status `json:"status,omitempty"`
+}
+
+// Status is the reason a request was denied.
+type Status struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// pod is the subset of a Kubernetes Pod with its images.
+type pod struct {
+	Spec struct {
+		InitContainers      []container `json:"initContainers"`
+		Containers          []container `json:"containers"`
+		EphemeralContainers []container `json:"ephemeralContainers"`
+	} `json:"spec"`
+}
+
+type container struct {
+	Name  string `json:"name"`
+	Image string `json:"image"`
+}
+
+// Webhook verifies the images of pods against its rules.
+type Webhook struct {
+	rules []Rule
+	ro    oci.RegistryOptions
+	opts  []cosign.VerifyOption
+}
+
+// New returns a Webhook enforcing rules, fetching images with ro and
+// verifying them with opts, see cosign.VerifyImagePolicy.
+func New(rules []Rule, ro oci.RegistryOptions, opts ...cosign.VerifyOption) *Webhook {
+	opts = append(opts, cosign.VerifyRegistryOptions(ro))
+	return &Webhook{rules: rules, ro: ro, opts: opts}
+}
+
+// Review decides on req. Pods being created or updated are allowed if every
+// rule matching each of their images is satisfied; images no rule matches
+// are allowed. Anything else is allowed as is.
+func (w *Webhook) Review(req *AdmissionRequest) *AdmissionResponse {
+	resp := &AdmissionResponse{UID: req.UID, Allowed: true}
+	if req.Kind.Kind != "Pod" || (req.Operation != "CREATE" && req.Operation != "UPDATE") {
+		return resp
+	}
+	p := pod{}
+	if err := json.Unmarshal(req.Object, &p); err != nil {
+		return deny(resp, fmt.Sprintf("invalid pod: %v", err))
+	}
+
+	reasons := []string{}
+	containers := append(append(append([]container{}, p.Spec.InitContainers...), p.Spec.Containers...), p.Spec.EphemeralContainers...)
+	for _, c := range containers {
+		if err := w.verifyImage(c.Image); err != nil {
+			reasons = append(reasons, fmt.Sprintf("container %s: image %s: %v", c.Name, c.Image, err))
+		}
+	}
+	if len(reasons) != 0 {
+		return deny(resp, strings.Join(reasons, "; "))
+	}
+	return resp
+}
+
+// verifyImage checks image against every rule matching it.
+func (w *Webhook) verifyImage(image string) error {
+	var ref name.Reference
+	for i := range w.rules {
+		r := &w.rules[i]
+		if !r.Match(image) {
+			continue
+		}
+		if ref == nil {
+			var err error
+			if ref, err = name.ParseReference(image, w.ro.NameOptions()...); err != nil {
+				return err
+			}
+		}
+		if err := cosign.VerifyImagePolicy(ref, r.policy, w.opts...); err != nil {
+			return fmt.Errorf("rule %s: %v", r.ImagePattern, err)
+		}
+	}
+	return nil
+}
+
+func deny(resp *AdmissionResponse, reason string) *AdmissionResponse {
+	resp.Allowed = false
+	resp.Result = &Status{Code: http.StatusForbidden, Message: reason}
+	return resp
+}
+
+// ServeHTTP answers an AdmissionReview posted by the Kubernetes API server.
+func (w *Webhook) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(rw, "only POST is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	review := AdmissionReview{}
+	if err := json.NewDecoder(r.Body).Decode(&review); err != nil {
+		http.Error(rw, fmt.Sprintf("invalid AdmissionReview: %v", err), http.StatusBadRequest)
+		return
+	}
+	if review.Request == nil {
+		http.Error(rw, "AdmissionReview has no request", http.StatusBadRequest)
+		return
+	}
+	review.Response = w.Review(review.Request)
+	review.Request = nil
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(review)
+}
@@ -0,0 +1,251 @@
+/*
+Copyright The Rekor Authors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/sigstore/cosign/pkg/cosign"
+	"github.com/sigstore/cosign/pkg/cosign/oci"
+)
+
+func writeImage(t *testing.T, ro oci.RegistryOptions, image string, priv ed25519.PrivateKey) {
+	t.Helper()
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := random.Image(512, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ro.Remote().Write(ref, img); err != nil {
+		t.Fatal(err)
+	}
+	if priv == nil {
+		return
+	}
+	h, err := img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := oci.Payload(v1.Descriptor{Digest: h}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := oci.Upload(ed25519.Sign(priv, payload), payload, ref.Context().Tag(oci.Munge(v1.Descriptor{Digest: h})), oci.UploadRegistryOptions(ro)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	td := t.TempDir()
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pem, err := cosign.MarshalPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPath := filepath.Join(td, "key.pub")
+	if err := ioutil.WriteFile(keyPath, pem, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name    string
+		config  string
+		wantErr string
+	}{{
+		name:   "key file",
+		config: "- imagePattern: registry.example.com/*\n  pubKey: " + keyPath + "\n",
+	}, {
+		name:   "inline key",
+		config: "- imagePattern: registry.example.com/*\n  threshold: 1\n  pubKey: |\n    " + strings.ReplaceAll(strings.TrimSpace(string(pem)), "\n", "\n    ") + "\n",
+	}, {
+		name:    "empty",
+		config:  "[]\n",
+		wantErr: "no rules",
+	}, {
+		name:    "unknown field",
+		config:  "- imagePattern: registry.example.com/*\n  pubKey: " + keyPath + "\n  keys: 2\n",
+		wantErr: "not found",
+	}, {
+		name:    "no pattern",
+		config:  "- pubKey: " + keyPath + "\n",
+		wantErr: "no imagePattern",
+	}, {
+		name:    "threshold too high",
+		config:  "- imagePattern: registry.example.com/*\n  pubKey: " + keyPath + "\n  threshold: 2\n",
+		wantErr: "out of range",
+	}} {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(td, "config.yaml")
+			if err := ioutil.WriteFile(path, []byte(test.config), 0600); err != nil {
+				t.Fatal(err)
+			}
+			rules, err := LoadConfig(path)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("LoadConfig() = %v, want error containing %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rules) != 1 || !rules[0].Match("registry.example.com/team/app:v1") || rules[0].Match("docker.io/library/busybox") {
+				t.Errorf("LoadConfig() = %+v, want one rule matching registry.example.com", rules)
+			}
+		})
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	ro := oci.RegistryOptions{Client: oci.NewMemoryClient()}
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pem, err := cosign.MarshalPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, other, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeImage(t, ro, "registry.example.com/prod/signed:v1", priv)
+	writeImage(t, ro, "registry.example.com/prod/unsigned:v1", nil)
+	writeImage(t, ro, "registry.example.com/prod/other:v1", other)
+	writeImage(t, ro, "registry.example.com/dev/unsigned:v1", nil)
+
+	rule := Rule{ImagePattern: "registry.example.com/prod/*", PubKey: string(pem)}
+	if err := rule.compile(); err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(New([]Rule{rule}, ro))
+	defer ts.Close()
+
+	for _, test := range []struct {
+		name      string
+		kind      string
+		operation string
+		images    []string
+		// wantDenied are the images the response should name, none if the
+		// pod is allowed.
+		wantDenied []string
+	}{{
+		name:      "signed",
+		kind:      "Pod",
+		operation: "CREATE",
+		images:    []string{"registry.example.com/prod/signed:v1", "registry.example.com/dev/unsigned:v1"},
+	}, {
+		name:       "unsigned",
+		kind:       "Pod",
+		operation:  "CREATE",
+		images:     []string{"registry.example.com/prod/signed:v1", "registry.example.com/prod/unsigned:v1"},
+		wantDenied: []string{"registry.example.com/prod/unsigned:v1"},
+	}, {
+		name:       "wrong key on update",
+		kind:       "Pod",
+		operation:  "UPDATE",
+		images:     []string{"registry.example.com/prod/other:v1", "registry.example.com/prod/unsigned:v1"},
+		wantDenied: []string{"registry.example.com/prod/other:v1", "registry.example.com/prod/unsigned:v1"},
+	}, {
+		name:      "delete",
+		kind:      "Pod",
+		operation: "DELETE",
+		images:    []string{"registry.example.com/prod/unsigned:v1"},
+	}, {
+		name:      "not a pod",
+		kind:      "Deployment",
+		operation: "CREATE",
+		images:    []string{"registry.example.com/prod/unsigned:v1"},
+	}} {
+		t.Run(test.name, func(t *testing.T) {
+			p := pod{}
+			for i, image := range test.images {
+				p.Spec.Containers = append(p.Spec.Containers, container{Name: string(rune('a' + i)), Image: image})
+			}
+			object, err := json.Marshal(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req := &AdmissionRequest{UID: "1234", Operation: test.operation, Object: object}
+			req.Kind.Version = "v1"
+			req.Kind.Kind = test.kind
+			body, err := json.Marshal(AdmissionReview{APIVersion: "admission.k8s.io/v1", Kind: "AdmissionReview", Request: req})
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := http.Post(ts.URL, "application/json", bytes.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			review := AdmissionReview{}
+			if err := json.NewDecoder(resp.Body).Decode(&review); err != nil {
+				t.Fatal(err)
+			}
+			if review.APIVersion != "admission.k8s.io/v1" || review.Response == nil || review.Response.UID != "1234" {
+				t.Fatalf("got review %+v, want a response to request 1234", review)
+			}
+			if review.Response.Allowed != (len(test.wantDenied) == 0) {
+				t.Fatalf("Allowed = %v, status %+v", review.Response.Allowed, review.Response.Result)
+			}
+			for _, image := range test.wantDenied {
+				if !strings.Contains(review.Response.Result.Message, image) {
+					t.Errorf("message %q doesn't name %s", review.Response.Result.Message, image)
+				}
+			}
+			if review.Response.Allowed {
+				return
+			}
+			if review.Response.Result.Code != http.StatusForbidden {
+				t.Errorf("Code = %d, want %d", review.Response.Result.Code, http.StatusForbidden)
+			}
+			for _, image := range test.images {
+				if strings.Contains(review.Response.Result.Message, image) != contains(test.wantDenied, image) {
+					t.Errorf("message %q, want it to name only %v", review.Response.Result.Message, test.wantDenied)
+				}
+			}
+		})
+	}
+}
+
+func contains(s []string, v string) bool {
+	for _, e := range s {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
@@ -3,25 +3,48 @@ package test
 import (
 	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
+	"math/big"
+	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
 	"path"
 	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/name"
 	"github.com/google/go-containerregistry/pkg/registry"
 
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
 	"github.com/google/go-containerregistry/pkg/v1/random"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/peterbourgon/ff/v3/ffcli"
 	"github.com/sigstore/cosign/cmd/cli"
 	"github.com/sigstore/cosign/pkg/cosign"
+	"github.com/sigstore/cosign/pkg/cosign/oci"
+	"github.com/spiffe/go-spiffe/v2/spiffeid"
+	"github.com/spiffe/go-spiffe/v2/svid/x509svid"
 )
 
 var keyPass = []byte("hello")
@@ -31,7 +54,7 @@ var passFunc = func(_ bool) ([]byte, error) {
 }
 
 var verify = func(k, i string, b bool, a map[string]string) error {
-	_, err := cli.VerifyCmd(context.Background(), k, i, b, a)
+	_, err := cli.VerifyCmd(context.Background(), k, i, b, a, oci.RegistryOptions{})
 	return err
 }
 
@@ -52,7 +75,7 @@ func TestSignVerify(t *testing.T) {
 	mustErr(verify(pubKeyPath, imgName, true, nil), t)
 
 	// Now sign the image
-	must(cli.SignCmd(ctx, privKeyPath, imgName, true, "", nil, passFunc), t)
+	must(cli.SignCmd(ctx, privKeyPath, imgName, cli.SignOptions{Upload: true}, passFunc), t)
 
 	// Now verify should work!
 	must(verify(pubKeyPath, imgName, true, nil), t)
@@ -61,7 +84,7 @@ func TestSignVerify(t *testing.T) {
 	mustErr(verify(pubKeyPath, imgName, true, map[string]string{"foo": "bar"}), t)
 
 	// Sign the image with an annotation
-	must(cli.SignCmd(ctx, privKeyPath, imgName, true, "", map[string]string{"foo": "bar"}, passFunc), t)
+	must(cli.SignCmd(ctx, privKeyPath, imgName, cli.SignOptions{Upload: true, Annotations: map[string]string{"foo": "bar"}}, passFunc), t)
 
 	// It should match this time.
 	must(verify(pubKeyPath, imgName, true, map[string]string{"foo": "bar"}), t)
@@ -70,39 +93,1698 @@ func TestSignVerify(t *testing.T) {
 	mustErr(verify(pubKeyPath, imgName, true, map[string]string{"foo": "bar", "baz": "bat"}), t)
 }
 
+func TestSignVerifyRecursive(t *testing.T) {
+	repo, stop := reg(t)
+	defer stop()
+	td := t.TempDir()
+
+	imgName := path.Join(repo, "cosign-e2e-index")
+	ref, err := name.ParseReference(imgName)
+	must(err, t)
+	idx, err := random.Index(512, 1, 2)
+	must(err, t)
+	must(remote.WriteIndex(ref, idx, remote.WithAuthFromKeychain(authn.DefaultKeychain)), t)
+
+	_, privKeyPath, pubKeyPath := keypair(t, td)
+	ctx := context.Background()
+	verifyRecursive := func() error {
+		_, err := cli.VerifyCmd(ctx, pubKeyPath, imgName, true, nil, oci.RegistryOptions{}, cosign.VerifyRecursive)
+		return err
+	}
+
+	// Only the index is signed.
+	must(cli.SignCmd(ctx, privKeyPath, imgName, cli.SignOptions{Upload: true}, passFunc), t)
+	must(verify(pubKeyPath, imgName, true, nil), t)
+	mustErr(verifyRecursive(), t)
+
+	must(cli.SignCmd(ctx, privKeyPath, imgName, cli.SignOptions{Upload: true, Recursive: true}, passFunc), t)
+	must(verifyRecursive(), t)
+
+	res, err := oci.FetchSignaturesRecursive(ref, oci.RegistryOptions{})
+	must(err, t)
+	equals(len(res.Manifests), 2, t)
+	im, err := idx.IndexManifest()
+	must(err, t)
+	for _, desc := range im.Manifests {
+		m, ok := res.Manifests[desc.Digest]
+		if !ok {
+			t.Fatalf("no signatures for %s", desc.Digest)
+		}
+		equals(len(m.Signatures), 1, t)
+	}
+}
+
+func TestSignVerifyPlatforms(t *testing.T) {
+	repo, stop := reg(t)
+	defer stop()
+	td := t.TempDir()
+
+	imgName := path.Join(repo, "cosign-e2e-multiarch")
+	ref, err := name.ParseReference(imgName)
+	must(err, t)
+	adds := []mutate.IndexAddendum{}
+	for _, p := range []string{"linux/amd64", "linux/arm64/v8"} {
+		platform, err := oci.ParsePlatform(p)
+		must(err, t)
+		img, err := random.Image(512, 1)
+		must(err, t)
+		adds = append(adds, mutate.IndexAddendum{Add: img, Descriptor: v1.Descriptor{Platform: &platform}})
+	}
+	must(remote.WriteIndex(ref, mutate.AppendManifests(empty.Index, adds...), remote.WithAuthFromKeychain(authn.DefaultKeychain)), t)
+
+	_, privKeyPath, pubKeyPath := keypair(t, td)
+	ctx := context.Background()
+	platforms := func(ps ...string) []v1.Platform {
+		res := []v1.Platform{}
+		for _, p := range ps {
+			platform, err := oci.ParsePlatform(p)
+			must(err, t)
+			res = append(res, platform)
+		}
+		return res
+	}
+	verifyPlatforms := func(ps ...string) error {
+		_, err := cli.VerifyPlatformsCmd(ctx, pubKeyPath, imgName, platforms(ps...), true, nil, oci.RegistryOptions{})
+		return err
+	}
+
+	// A missing platform fails before anything is signed.
+	mustErr(cli.SignCmd(ctx, privKeyPath, imgName, cli.SignOptions{Upload: true, Platforms: platforms("linux/amd64", "linux/s390x")}, passFunc), t)
+	mustErr(verifyPlatforms("linux/amd64"), t)
+
+	must(cli.SignCmd(ctx, privKeyPath, imgName, cli.SignOptions{Upload: true, Platforms: platforms("linux/amd64")}, passFunc), t)
+	must(verifyPlatforms("linux/amd64"), t)
+	mustErr(verifyPlatforms("linux/amd64", "linux/arm64"), t)
+	// Only the platform is signed, not the index.
+	mustErr(verify(pubKeyPath, imgName, true, nil), t)
+
+	must(cli.SignCmd(ctx, privKeyPath, imgName, cli.SignOptions{Upload: true, Platforms: platforms("linux/arm64")}, passFunc), t)
+	must(verifyPlatforms("linux/amd64", "linux/arm64"), t)
+}
+
+func TestSignVerifyContainerConfig(t *testing.T) {
+	repo, stop := reg(t)
+	defer stop()
+	td := t.TempDir()
+
+	imgName := path.Join(repo, "cosign-e2e")
+	ref, _, cleanup := mkimage(t, imgName)
+	defer cleanup()
+
+	_, privKeyPath, pubKeyPath := keypair(t, td)
+	ctx := context.Background()
+	verifyConfig := func() ([]oci.SignedPayload, error) {
+		return cli.VerifyCmd(ctx, pubKeyPath, imgName, true, nil, oci.RegistryOptions{}, cosign.VerifyContainerConfig)
+	}
+
+	// Only the manifest is signed.
+	must(cli.SignCmd(ctx, privKeyPath, imgName, cli.SignOptions{Upload: true}, passFunc), t)
+	_, err := verifyConfig()
+	mustErr(err, t)
+
+	must(cli.SignCmd(ctx, privKeyPath, imgName, cli.SignOptions{Upload: true, SignConfig: true}, passFunc), t)
+	verified, err := verifyConfig()
+	must(err, t)
+
+	img, err := remote.Image(ref)
+	must(err, t)
+	config, err := img.ConfigName()
+	must(err, t)
+	var configSigned bool
+	for _, sp := range verified {
+		if sp.MediaType != cosign.ContainerConfigMediaType {
+			continue
+		}
+		ss := oci.SimpleSigning{}
+		must(json.Unmarshal(sp.Payload, &ss), t)
+		equals(ss.Critical.Image.DockerManifestDigest, config.Hex, t)
+		configSigned = true
+	}
+	if !configSigned {
+		t.Error("no verified signature of the container config")
+	}
+
+	// The config signature doesn't count as a signature of the manifest.
+	verified, err = cli.VerifyCmd(ctx, pubKeyPath, imgName, true, nil, oci.RegistryOptions{})
+	must(err, t)
+	for _, sp := range verified {
+		if sp.MediaType == cosign.ContainerConfigMediaType {
+			t.Error("verify without -verify-container-config returned the config signature")
+		}
+	}
+}
+
+func TestSignDryRun(t *testing.T) {
+	repo, stop := reg(t)
+	defer stop()
+	td := t.TempDir()
+
+	imgName := path.Join(repo, "cosign-e2e")
+	_, _, cleanup := mkimage(t, imgName)
+	defer cleanup()
+
+	_, privKeyPath, pubKeyPath := keypair(t, td)
+
+	// Nothing is uploaded, so there is still nothing to verify.
+	must(cli.SignCmd(context.Background(), privKeyPath, imgName, cli.SignOptions{Upload: true, DryRun: true}, passFunc), t)
+	mustErr(verify(pubKeyPath, imgName, true, nil), t)
+}
+
+func TestSignReservedAnnotations(t *testing.T) {
+	repo, stop := reg(t)
+	defer stop()
+	td := t.TempDir()
+
+	imgName := path.Join(repo, "cosign-e2e")
+	_, _, cleanup := mkimage(t, imgName)
+	defer cleanup()
+
+	_, privKeyPath, pubKeyPath := keypair(t, td)
+	ctx := context.Background()
+
+	// Keys starting with cosign. are reserved.
+	mustErr(cli.Sign().ParseAndRun(ctx, []string{"-key", privKeyPath, "-annotations", "cosign.foo=bar", imgName}), t)
+	mustErr(verify(pubKeyPath, imgName, true, nil), t)
+
+	must(cli.SignCmd(ctx, privKeyPath, imgName, cli.SignOptions{Upload: true, Annotations: map[string]string{"run": "42", "commit": "abc"}}, passFunc), t)
+	must(verify(pubKeyPath, imgName, true, map[string]string{"run": "42", "commit": "abc"}), t)
+}
+
+func TestSignIdentity(t *testing.T) {
+	repo, stop := reg(t)
+	defer stop()
+	td := t.TempDir()
+
+	imgName := path.Join(repo, "cosign-e2e")
+	_, _, cleanup := mkimage(t, imgName)
+	defer cleanup()
+
+	_, privKeyPath, pubKeyPath := keypair(t, td)
+	ctx := context.Background()
+
+	// The identity can't be passed as an annotation too.
+	mustErr(cli.SignCmd(ctx, privKeyPath, imgName, cli.SignOptions{Upload: true, Identity: "alice@example.com", Annotations: map[string]string{cosign.SignerIdentityAnnotation: "bob@example.com"}}, passFunc), t)
+
+	must(cli.SignCmd(ctx, privKeyPath, imgName, cli.SignOptions{Upload: true, Identity: "alice@example.com", Annotations: map[string]string{"run": "42"}}, passFunc), t)
+	must(verify(pubKeyPath, imgName, true, map[string]string{cosign.SignerIdentityAnnotation: "alice@example.com", "run": "42"}), t)
+
+	must(cli.Verify().ParseAndRun(ctx, []string{"-key", pubKeyPath, "-expected-identity", "alice@example.com", imgName}), t)
+	mustErr(cli.Verify().ParseAndRun(ctx, []string{"-key", pubKeyPath, "-expected-identity", "mallory@example.com", imgName}), t)
+	mustErr(cli.Verify().ParseAndRun(ctx, []string{"-key", pubKeyPath, "-expected-identity", "alice@example.com", "-check-claims=false", imgName}), t)
+}
+
+func TestSignExpireIn(t *testing.T) {
+	repo, stop := reg(t)
+	defer stop()
+	td := t.TempDir()
+
+	imgName := path.Join(repo, "cosign-e2e")
+	_, _, cleanup := mkimage(t, imgName)
+	defer cleanup()
+	expiredName := path.Join(repo, "cosign-e2e-expired")
+	_, _, cleanup = mkimage(t, expiredName)
+	defer cleanup()
+
+	_, privKeyPath, pubKeyPath := keypair(t, td)
+	ctx := context.Background()
+
+	// The expiry is signed into the generated payload.
+	must(ioutil.WriteFile(filepath.Join(td, "payload.json"), []byte("{}"), 0600), t)
+	mustErr(cli.SignCmd(ctx, privKeyPath, imgName, cli.SignOptions{Upload: true, ExpireIn: time.Hour, PayloadPath: filepath.Join(td, "payload.json")}, passFunc), t)
+
+	must(cli.SignCmd(ctx, privKeyPath, imgName, cli.SignOptions{Upload: true, ExpireIn: time.Hour}, passFunc), t)
+	must(cli.Verify().ParseAndRun(ctx, []string{"-key", pubKeyPath, imgName}), t)
+
+	// RFC 3339 only has seconds, so this has expired by the time it's verified.
+	must(cli.SignCmd(ctx, privKeyPath, expiredName, cli.SignOptions{Upload: true, ExpireIn: time.Nanosecond}, passFunc), t)
+	mustErr(cli.Verify().ParseAndRun(ctx, []string{"-key", pubKeyPath, expiredName}), t)
+	must(cli.Verify().ParseAndRun(ctx, []string{"-key", pubKeyPath, "-ignore-expiry", expiredName}), t)
+}
+
+func TestSignRecordCreationTimestamp(t *testing.T) {
+	repo, stop := reg(t)
+	defer stop()
+	td := t.TempDir()
+
+	imgName := path.Join(repo, "cosign-e2e")
+	_, _, cleanup := mkimage(t, imgName)
+	defer cleanup()
+
+	_, privKeyPath, pubKeyPath := keypair(t, td)
+	ctx := context.Background()
+
+	before := time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+	must(cli.SignCmd(ctx, privKeyPath, imgName, cli.SignOptions{Upload: true, RecordCreationTimestamp: true}, passFunc), t)
+	must(cli.Verify().ParseAndRun(ctx, []string{"-key", pubKeyPath, "-assert-signed-after", before, imgName}), t)
+
+	later := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	mustErr(cli.Verify().ParseAndRun(ctx, []string{"-key", pubKeyPath, "-assert-signed-after", later, imgName}), t)
+	mustErr(cli.Verify().ParseAndRun(ctx, []string{"-key", pubKeyPath, "-assert-signed-after", before, "-check-claims=false", imgName}), t)
+}
+
+func TestSignNotBefore(t *testing.T) {
+	repo, stop := reg(t)
+	defer stop()
+	td := t.TempDir()
+
+	imgName := path.Join(repo, "cosign-e2e")
+	_, _, cleanup := mkimage(t, imgName)
+	defer cleanup()
+	laterName := path.Join(repo, "cosign-e2e-later")
+	_, _, cleanup = mkimage(t, laterName)
+	defer cleanup()
+
+	_, privKeyPath, pubKeyPath := keypair(t, td)
+	ctx := context.Background()
+
+	must(cli.SignCmd(ctx, privKeyPath, imgName, cli.SignOptions{Upload: true, NotBefore: time.Now().Add(-time.Hour), ExpireIn: time.Hour}, passFunc), t)
+	must(cli.Verify().ParseAndRun(ctx, []string{"-key", pubKeyPath, imgName}), t)
+
+	must(cli.SignCmd(ctx, privKeyPath, laterName, cli.SignOptions{Upload: true, NotBefore: time.Now().Add(time.Hour)}, passFunc), t)
+	mustErr(cli.Verify().ParseAndRun(ctx, []string{"-key", pubKeyPath, laterName}), t)
+}
+
+func TestSignGitHubAnnotations(t *testing.T) {
+	repo, stop := reg(t)
+	defer stop()
+	td := t.TempDir()
+
+	imgName := path.Join(repo, "cosign-e2e")
+	_, _, cleanup := mkimage(t, imgName)
+	defer cleanup()
+
+	_, privKeyPath, pubKeyPath := keypair(t, td)
+	ctx := context.Background()
+
+	env := map[string]string{
+		"GITHUB_REPOSITORY": "acme/app",
+		"GITHUB_REF":        "refs/heads/main",
+		"GITHUB_SHA":        "0123456789abcdef",
+		"GITHUB_WORKFLOW":   "release",
+	}
+	for k := range env {
+		if old, ok := os.LookupEnv(k); ok {
+			defer os.Setenv(k, old)
+		} else {
+			defer os.Unsetenv(k)
+		}
+		os.Unsetenv(k)
+	}
+
+	so := cli.SignOptions{Upload: true, GitHubAnnotations: true}
+	// Outside of GitHub Actions there is nothing to sign.
+	mustErr(cli.SignCmd(ctx, privKeyPath, imgName, so, passFunc), t)
+
+	for k, v := range env {
+		os.Setenv(k, v)
+	}
+	must(cli.SignCmd(ctx, privKeyPath, imgName, so, passFunc), t)
+	must(verify(pubKeyPath, imgName, true, map[string]string{
+		cosign.GitHubRepositoryAnnotation: "acme/app",
+		cosign.GitHubRefAnnotation:        "refs/heads/main",
+		cosign.GitHubSHAAnnotation:        "0123456789abcdef",
+		cosign.GitHubWorkflowAnnotation:   "release",
+	}), t)
+
+	must(cli.Verify().ParseAndRun(ctx, []string{"-key", pubKeyPath, "-github-repository", "acme/app", "-github-ref", "refs/heads/main", imgName}), t)
+	mustErr(cli.Verify().ParseAndRun(ctx, []string{"-key", pubKeyPath, "-github-repository", "acme/app", "-github-ref", "refs/heads/feature", imgName}), t)
+	mustErr(cli.Verify().ParseAndRun(ctx, []string{"-key", pubKeyPath, "-github-repository", "acme/fork", imgName}), t)
+}
+
+func TestSignForce(t *testing.T) {
+	repo, stop := reg(t)
+	defer stop()
+	td := t.TempDir()
+
+	imgName := path.Join(repo, "cosign-e2e")
+	ref, _, cleanup := mkimage(t, imgName)
+	defer cleanup()
+
+	_, privKeyPath, pubKeyPath := keypair(t, td)
+	_, otherPrivKeyPath, _ := keypair(t, t.TempDir())
+	ctx := context.Background()
+	count := func() int {
+		signatures, _, err := oci.FetchSignatures(ref, oci.RegistryOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(signatures)
+	}
+
+	// Without -force, every signing adds a signature.
+	must(cli.SignCmd(ctx, privKeyPath, imgName, cli.SignOptions{Upload: true}, passFunc), t)
+	must(cli.SignCmd(ctx, privKeyPath, imgName, cli.SignOptions{Upload: true}, passFunc), t)
+	must(cli.SignCmd(ctx, otherPrivKeyPath, imgName, cli.SignOptions{Upload: true}, passFunc), t)
+	equals(count(), 3, t)
+
+	// With it, the key's signatures are replaced by the new one, and the
+	// other key's is kept.
+	so := cli.SignOptions{Upload: true, Force: true, Annotations: map[string]string{"run": "2"}}
+	must(cli.SignCmd(ctx, privKeyPath, imgName, so, passFunc), t)
+	must(cli.SignCmd(ctx, privKeyPath, imgName, so, passFunc), t)
+	equals(count(), 2, t)
+	must(verify(pubKeyPath, imgName, true, map[string]string{"run": "2"}), t)
+}
+
+func TestSignOCILayoutOutput(t *testing.T) {
+	repo, stop := reg(t)
+	defer stop()
+	td := t.TempDir()
+
+	imgName := path.Join(repo, "cosign-e2e")
+	_, _, cleanup := mkimage(t, imgName)
+	defer cleanup()
+
+	_, privKeyPath, pubKeyPath := keypair(t, td)
+	pub, err := cosign.LoadPublicKey(pubKeyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	layoutPath := filepath.Join(td, "output")
+	ctx := context.Background()
+	so := cli.SignOptions{Upload: true, OCILayoutOutput: layoutPath}
+	must(cli.SignCmd(ctx, privKeyPath, imgName, so, passFunc), t)
+	_, err = cosign.VerifyOCILayout(layoutPath, pub, true, nil)
+	must(err, t)
+
+	// Everything in the layout can be pushed somewhere else by name, like
+	// an air-gapped registry, and verifies there.
+	p, err := layout.FromPath(layoutPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ii, err := p.ImageIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	im, err := ii.IndexManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	equals(len(im.Manifests), 2, t)
+	copied := path.Join(repo, "copied")
+	for _, desc := range im.Manifests {
+		refName := desc.Annotations["org.opencontainers.image.ref.name"]
+		img, err := p.Image(desc.Digest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// This version of the layout package can only read gzipped layers,
+		// so signature images are put back together from their blobs.
+		if strings.HasSuffix(refName, oci.SignatureTagSuffix) {
+			m, err := img.Manifest()
+			if err != nil {
+				t.Fatal(err)
+			}
+			adds := []mutate.Addendum{}
+			for _, l := range m.Layers {
+				b, err := p.Bytes(l.Digest)
+				if err != nil {
+					t.Fatal(err)
+				}
+				adds = append(adds, mutate.Addendum{Layer: oci.StaticLayer(b, l.MediaType), Annotations: l.Annotations})
+			}
+			if img, err = mutate.Append(empty.Image, adds...); err != nil {
+				t.Fatal(err)
+			}
+		}
+		tag, err := name.NewTag(copied + ":" + refName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		must(remote.Write(tag, img), t)
+	}
+	must(verify(pubKeyPath, copied, true, nil), t)
+}
+
+func TestVerifyPolicyFile(t *testing.T) {
+	repo, stop := reg(t)
+	defer stop()
+	td := t.TempDir()
+
+	imgName := path.Join(repo, "cosign-e2e")
+	_, _, cleanup := mkimage(t, imgName)
+	defer cleanup()
+
+	_, privKeyPath, pubKeyPath := keypair(t, td)
+	ctx := context.Background()
+	so := cli.SignOptions{Upload: true, Annotations: map[string]string{"env": "dev"}}
+	must(cli.SignCmd(ctx, privKeyPath, imgName, so, passFunc), t)
+	verified, err := cli.VerifyCmd(ctx, pubKeyPath, imgName, true, nil, oci.RegistryOptions{})
+	must(err, t)
+
+	policy := func(env string) string {
+		p := filepath.Join(td, env+".rego")
+		must(ioutil.WriteFile(p, []byte("package cosign\n\ndeny[\"env must be "+env+"\"] {\n\tinput.payload.Optional.env != \""+env+"\"\n}\n"), 0600), t)
+		return p
+	}
+	must(cli.CheckPolicyFileCmd(ctx, policy("dev"), verified, nil, ""), t)
+	err = cli.CheckPolicyFileCmd(ctx, policy("prod"), verified, nil, "")
+	if err == nil || !strings.Contains(err.Error(), "env must be prod") {
+		t.Errorf("CheckPolicyFileCmd() = %v, wanted the violated rule", err)
+	}
+
+	mustErr(cli.CheckPolicyFileCmd(ctx, filepath.Join(td, "policy.cue"), verified, nil, ""), t)
+}
+
+func TestSignOutputPayload(t *testing.T) {
+	repo, stop := reg(t)
+	defer stop()
+	td := t.TempDir()
+
+	imgName := path.Join(repo, "cosign-e2e")
+	_, _, cleanup := mkimage(t, imgName)
+	defer cleanup()
+
+	_, privKeyPath, pubKeyPath := keypair(t, td)
+	ctx := context.Background()
+
+	out := filepath.Join(td, "payload.json")
+	must(cli.SignCmd(ctx, privKeyPath, imgName, cli.SignOptions{Upload: true, OutputPayload: out, Annotations: map[string]string{"run": "42"}}, passFunc), t)
+	verified, err := cli.VerifyCmd(ctx, pubKeyPath, imgName, true, nil, oci.RegistryOptions{})
+	must(err, t)
+	b, err := ioutil.ReadFile(out)
+	must(err, t)
+	if string(b) != string(verified[0].Payload) {
+		t.Errorf("-output-payload wrote %q, wanted the signed payload %q", b, verified[0].Payload)
+	}
+
+	// The payload is written even if signing fails.
+	must(os.Remove(out), t)
+	mustErr(cli.SignCmd(ctx, privKeyPath, imgName, cli.SignOptions{Upload: true, OutputPayload: out, TimestampAuthority: "http://127.0.0.1:0"}, passFunc), t)
+	_, err = os.Stat(out)
+	must(err, t)
+
+	// With DSSE, the envelope is what's signed.
+	dsseRef, _, cleanup := mkimage(t, path.Join(repo, "cosign-e2e-dsse"))
+	defer cleanup()
+	must(cli.SignCmd(ctx, privKeyPath, dsseRef.String(), cli.SignOptions{Upload: true, DSSE: true, OutputPayload: out}, passFunc), t)
+	signatures, _, err := oci.FetchSignatures(dsseRef, oci.RegistryOptions{})
+	must(err, t)
+	b, err = ioutil.ReadFile(out)
+	must(err, t)
+	if string(b) != string(signatures[0].Payload) {
+		t.Errorf("-output-payload wrote %q, wanted the signed envelope %q", b, signatures[0].Payload)
+	}
+}
+
+func TestVerifyOutputFile(t *testing.T) {
+	repo, stop := reg(t)
+	defer stop()
+	td := t.TempDir()
+
+	imgName := path.Join(repo, "cosign-e2e")
+	_, _, cleanup := mkimage(t, imgName)
+	defer cleanup()
+
+	_, privKeyPath, pubKeyPath := keypair(t, td)
+	ctx := context.Background()
+	must(cli.SignCmd(ctx, privKeyPath, imgName, cli.SignOptions{Upload: true}, passFunc), t)
+	verified, err := cli.VerifyCmd(ctx, pubKeyPath, imgName, true, nil, oci.RegistryOptions{})
+	must(err, t)
+
+	out := filepath.Join(td, "verified.json")
+	must(cli.Verify().ParseAndRun(ctx, []string{"-key", pubKeyPath, "-output-file", out, imgName}), t)
+	b, err := ioutil.ReadFile(out)
+	must(err, t)
+	if string(b) != string(verified[0].Payload)+"\n" {
+		t.Errorf("-output-file wrote %q, wanted the payload %q", b, verified[0].Payload)
+	}
+
+	// The file isn't replaced without -overwrite.
+	mustErr(cli.Verify().ParseAndRun(ctx, []string{"-key", pubKeyPath, "-output-file", out, imgName}), t)
+	must(cli.Verify().ParseAndRun(ctx, []string{"-key", pubKeyPath, "-output-file", out, "-overwrite", imgName}), t)
+}
+
+func TestVerifyNoFailFast(t *testing.T) {
+	repo, stop := reg(t)
+	defer stop()
+	td := t.TempDir()
+
+	imgName := path.Join(repo, "cosign-e2e")
+	_, _, cleanup := mkimage(t, imgName)
+	defer cleanup()
+
+	_, privKeyPath, pubKeyPath := keypair(t, td)
+	ctx := context.Background()
+	must(cli.SignCmd(ctx, privKeyPath, imgName, cli.SignOptions{Upload: true, Annotations: map[string]string{"env": "prod"}}, passFunc), t)
+	must(cli.SignCmd(ctx, privKeyPath, imgName, cli.SignOptions{Upload: true, Annotations: map[string]string{"env": "dev"}}, passFunc), t)
+
+	// The signature with the wrong claim fails, the other one is still returned.
+	prod := map[string]string{"env": "prod"}
+	verified, err := cli.VerifyCmd(ctx, pubKeyPath, imgName, true, prod, oci.RegistryOptions{}, cosign.WithFailFast(false))
+	if _, ok := err.(cosign.VerifyErrors); !ok {
+		t.Fatalf("VerifyCmd() = %v, wanted a VerifyErrors", err)
+	}
+	if len(verified) != 1 {
+		t.Fatalf("VerifyCmd() verified %d signatures, wanted 1", len(verified))
+	}
+
+	out := filepath.Join(td, "verified.json")
+	err = cli.Verify().ParseAndRun(ctx, []string{"-key", pubKeyPath, "-a", "env=prod", "-no-fail-fast", "-output-file", out, imgName})
+	if e, ok := err.(*cli.ExitError); !ok || e.Code != cli.PartiallyVerifiedExitCode {
+		t.Fatalf("verify -no-fail-fast = %v, wanted exit code %d", err, cli.PartiallyVerifiedExitCode)
+	}
+	b, err := ioutil.ReadFile(out)
+	must(err, t)
+	if string(b) != string(verified[0].Payload)+"\n" {
+		t.Errorf("-no-fail-fast wrote %q, wanted the payload %q", b, verified[0].Payload)
+	}
+
+	// When nothing verifies it's an ordinary failure.
+	err = cli.Verify().ParseAndRun(ctx, []string{"-key", pubKeyPath, "-a", "env=staging", "-no-fail-fast", imgName})
+	if _, ok := err.(cosign.VerifyErrors); !ok {
+		t.Errorf("verify -no-fail-fast = %v, wanted a VerifyErrors", err)
+	}
+}
+
+func TestVerifyWatch(t *testing.T) {
+	repo, stop := reg(t)
+	defer stop()
+	td := t.TempDir()
+
+	imgName := path.Join(repo, "cosign-e2e")
+	_, _, cleanup := mkimage(t, imgName)
+	defer cleanup()
+
+	_, privKeyPath, pubKeyPath := keypair(t, td)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	must(cli.SignCmd(ctx, privKeyPath, imgName, cli.SignOptions{Upload: true}, passFunc), t)
+
+	alerts := make(chan map[string]interface{}, 10)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		alert := map[string]interface{}{}
+		if err := json.NewDecoder(r.Body).Decode(&alert); err != nil {
+			t.Error(err)
+		}
+		alerts <- alert
+	}))
+	defer s.Close()
+
+	done := make(chan error)
+	go func() {
+		done <- cli.VerifyWatchCmd(ctx, pubKeyPath, imgName, true, nil, 50*time.Millisecond, s.URL, oci.RegistryOptions{})
+	}()
+	time.Sleep(200 * time.Millisecond)
+	must(cli.SignCmd(ctx, privKeyPath, imgName, cli.SignOptions{Upload: true, Annotations: map[string]string{"run": "2"}}, passFunc), t)
+
+	select {
+	case alert := <-alerts:
+		equals(alert["type"], string(cosign.ChangeSignatureAdded), t)
+		equals(alert["ref"], imgName, t)
+	case err := <-done:
+		t.Fatalf("VerifyWatchCmd() = %v", err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("no alert was posted")
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("VerifyWatchCmd() = %v, wanted %v", err, context.Canceled)
+	}
+}
+
+func TestSignConfirm(t *testing.T) {
+	repo, stop := reg(t)
+	defer stop()
+	td := t.TempDir()
+
+	imgName := path.Join(repo, "cosign-e2e")
+	ref, desc, cleanup := mkimage(t, imgName)
+	defer cleanup()
+
+	_, privKeyPath, pubKeyPath := keypair(t, td)
+	ctx := context.Background()
+	so := cli.SignOptions{Upload: true, Confirm: true}
+
+	stdin := os.Stdin
+	defer func() { os.Stdin = stdin }()
+	answer := func(s string) {
+		f, err := os.Open(mkfile(s, td, t))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { f.Close() })
+		os.Stdin = f
+	}
+
+	answer("n\n")
+	mustErr(cli.SignCmd(ctx, privKeyPath, imgName, so, passFunc), t)
+	mustErr(verify(pubKeyPath, imgName, true, nil), t)
+
+	answer("y\n")
+	must(cli.SignCmd(ctx, privKeyPath, imgName, so, passFunc), t)
+	must(verify(pubKeyPath, imgName, true, nil), t)
+
+	// Digests can't move, so there's nothing to confirm.
+	answer("")
+	must(cli.SignCmd(ctx, privKeyPath, ref.Context().Digest(desc.Digest.String()).String(), so, passFunc), t)
+}
+
+func TestSignDSSE(t *testing.T) {
+	repo, stop := reg(t)
+	defer stop()
+	td := t.TempDir()
+
+	imgName := path.Join(repo, "cosign-e2e")
+	ref, _, cleanup := mkimage(t, imgName)
+	defer cleanup()
+
+	_, privKeyPath, pubKeyPath := keypair(t, td)
+	ctx := context.Background()
+
+	mustErr(cli.SignCmd(ctx, privKeyPath, imgName, cli.SignOptions{Upload: true, DSSE: true, SignConfig: true}, passFunc), t)
+	must(cli.SignCmd(ctx, privKeyPath, imgName, cli.SignOptions{Upload: true, DSSE: true, Annotations: map[string]string{"foo": "bar"}}, passFunc), t)
+	must(verify(pubKeyPath, imgName, true, map[string]string{"foo": "bar"}), t)
+
+	signatures, _, err := oci.FetchSignatures(ref, oci.RegistryOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	equals(len(signatures), 1, t)
+	equals(signatures[0].MediaType, cosign.DSSEMediaType, t)
+	env, err := cosign.ParseDSSE(signatures[0].Payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	equals(env.PayloadType, string(oci.SimpleSigningMediaType), t)
+}
+
+func TestSignAttestation(t *testing.T) {
+	repo, stop := reg(t)
+	defer stop()
+	td := t.TempDir()
+
+	imgName := path.Join(repo, "cosign-e2e")
+	ref, _, cleanup := mkimage(t, imgName)
+	defer cleanup()
+
+	_, privKeyPath, pubKeyPath := keypair(t, td)
+	ctx := context.Background()
+	predicateType := "https://slsa.dev/provenance/v0.2"
+
+	// Without a predicate, sign still signs a simple signing payload.
+	must(cli.SignCmd(ctx, privKeyPath, imgName, cli.SignOptions{Upload: true}, passFunc), t)
+
+	mustErr(cli.AttestCmd(ctx, []string{privKeyPath}, imgName, predicateType, mkfile("not json", td, t), cli.SignOptions{Upload: true}, passFunc), t)
+	mustErr(cli.AttestCmd(ctx, []string{privKeyPath}, imgName, predicateType, mkfile("{}", td, t), cli.SignOptions{Upload: true, Annotations: map[string]string{"foo": "bar"}}, passFunc), t)
+	predicatePath := mkfile(`{"builder": {"id": "https://example.com/ci"}}`, td, t)
+	must(cli.AttestCmd(ctx, []string{privKeyPath}, imgName, predicateType, predicatePath, cli.SignOptions{Upload: true}, passFunc), t)
+	must(verify(pubKeyPath, imgName, true, nil), t)
+
+	signatures, _, err := oci.FetchSignatures(ref, oci.RegistryOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	equals(len(signatures), 2, t)
+	equals(signatures[0].MediaType, oci.SimpleSigningMediaType, t)
+	equals(signatures[1].MediaType, cosign.DSSEMediaType, t)
+	env, err := cosign.ParseDSSE(signatures[1].Payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	equals(env.PayloadType, string(cosign.InTotoMediaType), t)
+	payload, err := base64.StdEncoding.DecodeString(env.Payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := cosign.InTotoStatement{}
+	if err := json.Unmarshal(payload, &st); err != nil {
+		t.Fatal(err)
+	}
+	equals(st.PredicateType, predicateType, t)
+}
+
+func TestVerifyProvenance(t *testing.T) {
+	repo, stop := reg(t)
+	defer stop()
+	td := t.TempDir()
+
+	imgName := path.Join(repo, "cosign-e2e")
+	_, _, cleanup := mkimage(t, imgName)
+	defer cleanup()
+
+	_, privKeyPath, pubKeyPath := keypair(t, td)
+	ctx := context.Background()
+	builder := "https://github.com/acme/builder/.github/workflows/build.yml@refs/heads/main"
+	source := "git+https://github.com/acme/app"
+
+	mustErr(cli.VerifyProvenanceCmd(ctx, pubKeyPath, imgName, builder, source, oci.RegistryOptions{}), t)
+	predicatePath := mkfile(`{"builder": {"id": "`+builder+`"}, "materials": [{"uri": "`+source+`@refs/heads/main"}]}`, td, t)
+	must(cli.AttestCmd(ctx, []string{privKeyPath}, imgName, cosign.SLSAProvenancePredicateType, predicatePath, cli.SignOptions{Upload: true}, passFunc), t)
+	must(cli.VerifyProvenanceCmd(ctx, pubKeyPath, imgName, builder, source, oci.RegistryOptions{}), t)
+	mustErr(cli.VerifyProvenanceCmd(ctx, pubKeyPath, imgName, builder, "git+https://github.com/acme/other", oci.RegistryOptions{}), t)
+}
+
+func TestVerifyLocalBundle(t *testing.T) {
+	repo, stop := reg(t)
+	defer stop()
+	td := t.TempDir()
+
+	imgName := path.Join(repo, "cosign-e2e")
+	_, otherDesc, cleanupOther := mkimage(t, imgName+":other")
+	defer cleanupOther()
+	_, desc, cleanup := mkimage(t, imgName)
+	defer cleanup()
+
+	_, privKeyPath, pubKeyPath := keypair(t, td)
+	ctx := context.Background()
+	signBundle := func(d v1.Descriptor) string {
+		payload, err := oci.Payload(d, map[string]string{"foo": "bar"})
+		must(err, t)
+		bundlePath := filepath.Join(td, d.Digest.Hex+".sigstore")
+		must(cli.SignBlobCmd(ctx, privKeyPath, mkfile(string(payload), td, t), true, false, bundlePath, "", nil, nil, string(oci.SimpleSigningMediaType), "", passFunc), t)
+		return bundlePath
+	}
+
+	// Nothing is in the registry, the signature is only in the bundle.
+	bundlePath := signBundle(desc.Descriptor)
+	mustErr(verify(pubKeyPath, imgName, true, nil), t)
+	res, err := cli.VerifyLocalBundleCmd(ctx, pubKeyPath, imgName, bundlePath, true, map[string]string{"foo": "bar"}, oci.RegistryOptions{})
+	must(err, t)
+	equals(res.Source, cosign.SourceBundle, t)
+	equals(len(res.Verified), 1, t)
+
+	_, err = cli.VerifyLocalBundleCmd(ctx, pubKeyPath, imgName, bundlePath, true, map[string]string{"foo": "baz"}, oci.RegistryOptions{})
+	mustErr(err, t)
+	_, err = cli.VerifyLocalBundleCmd(ctx, pubKeyPath, imgName, signBundle(otherDesc.Descriptor), true, nil, oci.RegistryOptions{})
+	mustErr(err, t)
+
+	// -output-payload writes the signed envelope.
+	out := filepath.Join(td, "envelope.json")
+	must(cli.SignBlobCmd(ctx, privKeyPath, mkfile("hello", td, t), true, false, "", "", nil, nil, "text/plain", out, passFunc), t)
+	b, err := ioutil.ReadFile(out)
+	must(err, t)
+	env, err := cosign.ParseDSSE(b)
+	must(err, t)
+	pub, err := cosign.LoadPublicKey(pubKeyPath)
+	must(err, t)
+	payload, err := cosign.VerifyDSSE(pub, env)
+	must(err, t)
+	equals(string(payload), "hello", t)
+}
+
+func TestSignPayload(t *testing.T) {
+	repo, stop := reg(t)
+	defer stop()
+	td := t.TempDir()
+
+	imgName := path.Join(repo, "cosign-e2e")
+	_, otherDesc, cleanupOther := mkimage(t, imgName+":other")
+	defer cleanupOther()
+	_, desc, cleanup := mkimage(t, imgName)
+	defer cleanup()
+
+	_, privKeyPath, pubKeyPath := keypair(t, td)
+	ctx := context.Background()
+
+	// A payload for another image is rejected before anything is uploaded.
+	otherPayload, err := oci.Payload(otherDesc.Descriptor, nil)
+	must(err, t)
+	otherPath := mkfile(string(otherPayload), td, t)
+	mustErr(cli.SignCmd(ctx, privKeyPath, imgName, cli.SignOptions{Upload: true, PayloadPath: otherPath}, passFunc), t)
+	mustErr(verify(pubKeyPath, imgName, true, nil), t)
+
+	payload, err := oci.Payload(desc.Descriptor, map[string]string{"build": "42"})
+	must(err, t)
+	payloadPath := mkfile(string(payload), td, t)
+	must(cli.SignCmd(ctx, privKeyPath, imgName, cli.SignOptions{Upload: true, PayloadPath: payloadPath}, passFunc), t)
+	must(verify(pubKeyPath, imgName, true, map[string]string{"build": "42"}), t)
+}
+
+func TestSignDigest(t *testing.T) {
+	repo, stop := reg(t)
+	defer stop()
+	td := t.TempDir()
+
+	imgName := path.Join(repo, "cosign-e2e")
+	_, oldDesc, cleanupOld := mkimage(t, imgName+":old")
+	defer cleanupOld()
+	_, _, cleanup := mkimage(t, imgName)
+	defer cleanup()
+
+	_, privKeyPath, pubKeyPath := keypair(t, td)
+	ctx := context.Background()
+
+	// The tag points at another image, but the digest wins.
+	digestRef, err := cli.DigestReference(imgName, oldDesc.Digest.String(), oci.RegistryOptions{})
+	must(err, t)
+	equals(digestRef, imgName+"@"+oldDesc.Digest.String(), t)
+	must(cli.SignCmd(ctx, privKeyPath, digestRef, cli.SignOptions{Upload: true}, passFunc), t)
+
+	must(verify(pubKeyPath, imgName+":old", true, nil), t)
+	mustErr(verify(pubKeyPath, imgName, true, nil), t)
+
+	_, err = cli.DigestReference(imgName, "sha256:nope", oci.RegistryOptions{})
+	mustErr(err, t)
+	_, err = cli.DigestReference(digestRef, "sha256:"+strings.Repeat("0", 64), oci.RegistryOptions{})
+	mustErr(err, t)
+}
+
+func TestResolveAndFetchSignatures(t *testing.T) {
+	repo, stop := reg(t)
+	defer stop()
+	td := t.TempDir()
+
+	imgName := path.Join(repo, "cosign-e2e")
+	ref, desc, cleanup := mkimage(t, imgName)
+	defer cleanup()
+
+	_, privKeyPath, _ := keypair(t, td)
+	must(cli.SignCmd(context.Background(), privKeyPath, imgName, cli.SignOptions{Upload: true}, passFunc), t)
+
+	res, err := oci.ResolveAndFetchSignatures(ref, oci.RegistryOptions{})
+	must(err, t)
+	equals(res.ResolvedDigest, desc.Digest.String(), t)
+	equals(res.Descriptor.Digest, desc.Digest, t)
+	equals(len(res.Signatures), 1, t)
+
+	// Once the tag moves, it resolves to an image without signatures.
+	_, _, cleanupNew := mkimage(t, imgName)
+	defer cleanupNew()
+	_, err = oci.ResolveAndFetchSignatures(ref, oci.RegistryOptions{})
+	mustErr(err, t)
+
+	res, err = oci.ResolveAndFetchSignatures(ref.Context().Digest(desc.Digest.String()), oci.RegistryOptions{})
+	must(err, t)
+	equals(res.ResolvedDigest, desc.Digest.String(), t)
+	equals(len(res.Signatures), 1, t)
+}
+
+func TestProgress(t *testing.T) {
+	repo, stop := reg(t)
+	defer stop()
+	td := t.TempDir()
+
+	imgName := path.Join(repo, "cosign-e2e")
+	ref, _, cleanup := mkimage(t, imgName)
+	defer cleanup()
+
+	type call struct {
+		event       string
+		done, total int64
+	}
+	calls := []call{}
+	ro := oci.RegistryOptions{
+		Progress: func(event string, done, total int64) {
+			calls = append(calls, call{event, done, total})
+		},
+	}
+
+	_, privKeyPath, _ := keypair(t, td)
+	must(cli.SignCmd(context.Background(), privKeyPath, imgName, cli.SignOptions{Upload: true, Registry: ro}, passFunc), t)
+	_, _, err := oci.FetchSignatures(ref, ro)
+	must(err, t)
+
+	// Each operation ends with exactly one call where done is total.
+	finished := []string{}
+	for i, c := range calls {
+		if c.done > c.total || c.total == 0 {
+			t.Errorf("call %d = %+v, wanted 0 < done <= total", i, c)
+		}
+		if i > 0 && calls[i-1].event == c.event && calls[i-1].done != calls[i-1].total && c.done < calls[i-1].done {
+			t.Errorf("call %d = %+v, went backwards from %+v", i, c, calls[i-1])
+		}
+		if c.done == c.total {
+			finished = append(finished, c.event)
+		}
+	}
+	equals(finished, []string{oci.ProgressUpload, oci.ProgressFetch}, t)
+}
+
 func TestMultipleSignatures(t *testing.T) {
 	repo, stop := reg(t)
 	defer stop()
 
-	td1 := t.TempDir()
-	td2 := t.TempDir()
+	td1 := t.TempDir()
+	td2 := t.TempDir()
+
+	imgName := path.Join(repo, "cosign-e2e")
+
+	_, _, cleanup := mkimage(t, imgName)
+	defer cleanup()
+
+	_, priv1, pub1 := keypair(t, td1)
+	_, priv2, pub2 := keypair(t, td2)
+
+	ctx := context.Background()
+
+	// Verify should fail at first for both keys
+	mustErr(verify(pub1, imgName, true, nil), t)
+	mustErr(verify(pub2, imgName, true, nil), t)
+
+	// Now sign the image with one key
+	must(cli.SignCmd(ctx, priv1, imgName, cli.SignOptions{Upload: true}, passFunc), t)
+	// Now verify should work with that one, but not the other
+	must(verify(pub1, imgName, true, nil), t)
+	mustErr(verify(pub2, imgName, true, nil), t)
+
+	// Now sign with the other key too
+	must(cli.SignCmd(ctx, priv2, imgName, cli.SignOptions{Upload: true}, passFunc), t)
+
+	// Now verify should work with both
+	must(verify(pub1, imgName, true, nil), t)
+	must(verify(pub2, imgName, true, nil), t)
+}
+
+func TestSignMultipleKeys(t *testing.T) {
+	repo, stop := reg(t)
+	defer stop()
+
+	td1 := t.TempDir()
+	td2 := t.TempDir()
+
+	imgName := path.Join(repo, "cosign-e2e")
+
+	_, _, cleanup := mkimage(t, imgName)
+	defer cleanup()
+
+	_, priv1, pub1 := keypair(t, td1)
+	_, priv2, pub2 := keypair(t, td2)
+
+	ctx := context.Background()
+	ro := oci.RegistryOptions{}
+	writes := 0
+	ro.Progress = func(event string, done, total int64) {
+		if event == oci.ProgressUpload && done == total {
+			writes++
+		}
+	}
+
+	// Both signatures go up in one write.
+	must(cli.SignKeysCmd(ctx, []string{priv1, priv2}, imgName, cli.SignOptions{Upload: true, Registry: ro}, passFunc), t)
+	equals(writes, 1, t)
+	must(verify(pub1, imgName, true, nil), t)
+	must(verify(pub2, imgName, true, nil), t)
+
+	ref, err := name.ParseReference(imgName)
+	must(err, t)
+	sps, _, err := oci.FetchSignatures(ref, oci.RegistryOptions{})
+	must(err, t)
+	equals(len(sps), 2, t)
+}
+
+func TestSignLocalKeyring(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the fake keychain is a secret-tool")
+	}
+	repo, stop := reg(t)
+	defer stop()
+	td := t.TempDir()
+	must(os.Chdir(td), t)
+
+	imgName := path.Join(repo, "cosign-e2e")
+	_, _, cleanup := mkimage(t, imgName)
+	defer cleanup()
+	ctx := context.Background()
+
+	// A fake secret-tool, that keeps secrets in files.
+	bin := filepath.Join(td, "bin")
+	must(os.Mkdir(bin, 0700), t)
+	secretTool := `#!/bin/sh
+eval name=\$$#
+case "$1" in
+store) cat > "$(dirname "$0")/$name.secret" ;;
+lookup) cat "$(dirname "$0")/$name.secret" 2>/dev/null ;;
+esac
+`
+	must(ioutil.WriteFile(filepath.Join(bin, "secret-tool"), []byte(secretTool), 0700), t) // #nosec G306
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	must(os.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH")), t)
+
+	must(cli.GenerateKeyPairCmd(ctx, "scrypt", "release", cosign.DefaultArgon2Params), t)
+	if _, err := os.Stat("release.key"); !os.IsNotExist(err) {
+		t.Errorf("private key written to release.key, wanted it in the keychain")
+	}
+	pubKeyPath := filepath.Join(td, "release.pub")
+
+	mustErr(verify(pubKeyPath, imgName, true, nil), t)
+	mustErr(cli.SignKeysCmd(ctx, nil, imgName, cli.SignOptions{Upload: true, LocalKeyring: "missing"}, passFunc), t)
+	must(cli.SignKeysCmd(ctx, nil, imgName, cli.SignOptions{Upload: true, LocalKeyring: "release"}, passFunc), t)
+	must(verify(pubKeyPath, imgName, true, nil), t)
+}
+
+func TestSignVerifyReferrers(t *testing.T) {
+	repo, stop := fakeReg(t, true)
+	defer stop()
+	td := t.TempDir()
+
+	imgName := path.Join(repo, "cosign-e2e")
+
+	ref, desc, cleanup := mkimage(t, imgName)
+	defer cleanup()
+
+	_, privKeyPath, pubKeyPath := keypair(t, td)
+
+	ctx := context.Background()
+	mustErr(verify(pubKeyPath, imgName, true, nil), t)
+
+	// Sign using the referrers API, nothing should be written to the signature tag.
+	must(cli.SignCmd(ctx, privKeyPath, imgName, cli.SignOptions{Upload: true, Referrers: true}, passFunc), t)
+	must(verify(pubKeyPath, imgName, true, nil), t)
+	if _, err := remote.Get(ref.Context().Tag(oci.Munge(desc.Descriptor))); err == nil {
+		t.Error("expected no signature tag")
+	}
+
+	// Signatures from both locations are found.
+	must(cli.SignCmd(ctx, privKeyPath, imgName, cli.SignOptions{Upload: true}, passFunc), t)
+	signatures, _, err := oci.FetchSignatures(ref, oci.RegistryOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	equals(len(signatures), 2, t)
+}
+
+func TestSignVerifySBOM(t *testing.T) {
+	repo, stop := fakeReg(t, true)
+	defer stop()
+	td := t.TempDir()
+
+	imgName := path.Join(repo, "cosign-e2e")
+
+	ref, desc, cleanup := mkimage(t, imgName)
+	defer cleanup()
+
+	_, privKeyPath, pubKeyPath := keypair(t, td)
+
+	ctx := context.Background()
+	so := cli.SignOptions{Upload: true, RecursiveSBOM: true}
+	// There is nothing to sign without an SBOM.
+	mustErr(cli.SignCmd(ctx, privKeyPath, imgName, so, passFunc), t)
+
+	must(oci.UploadSBOM([]byte(`{"spdxVersion":"SPDX-2.2"}`), oci.SPDXMediaType, desc.Descriptor, ref.Context(), oci.RegistryOptions{}), t)
+	sboms, err := oci.SBOMLayers(ref.Context(), desc.Descriptor, oci.RegistryOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	equals(len(sboms), 1, t)
+	sbom := sboms[0].Digest.String()
+	if _, err := cli.VerifySBOMCmd(ctx, pubKeyPath, imgName, sbom, nil, oci.RegistryOptions{}); err == nil {
+		t.Fatal("expected an unsigned SBOM not to verify")
+	}
+
+	must(cli.SignCmd(ctx, privKeyPath, imgName, so, passFunc), t)
+	must(verify(pubKeyPath, imgName, true, nil), t)
+	if _, err := cli.VerifySBOMCmd(ctx, pubKeyPath, imgName, sbom, nil, oci.RegistryOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	must(cli.Verify().ParseAndRun(ctx, []string{"-key", pubKeyPath, "-sbom", sbom, imgName}), t)
+	mustErr(cli.Verify().ParseAndRun(ctx, []string{"-key", pubKeyPath, "-sbom", desc.Digest.String(), imgName}), t)
+}
+
+func TestSignGenerateSBOM(t *testing.T) {
+	repo, stop := fakeReg(t, true)
+	defer stop()
+	td := t.TempDir()
+
+	imgName := path.Join(repo, "cosign-e2e")
+	ref, desc, cleanup := mkimage(t, imgName)
+	defer cleanup()
+	_, privKeyPath, pubKeyPath := keypair(t, td)
+	ctx := context.Background()
+
+	// A fake syft, that outputs its arguments.
+	bin := filepath.Join(td, "bin")
+	must(os.Mkdir(bin, 0700), t)
+	syft := `#!/bin/sh
+echo "{\"args\": \"$*\"}"
+`
+	must(ioutil.WriteFile(filepath.Join(bin, "syft"), []byte(syft), 0700), t) // #nosec G306
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	must(os.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH")), t)
+
+	mustErr(cli.Sign().ParseAndRun(ctx, []string{"-key", privKeyPath, "-sbom", "-upload=false", imgName}), t)
+	mustErr(cli.SignCmd(ctx, privKeyPath, imgName, cli.SignOptions{Upload: true, SBOMFormat: "swid"}, passFunc), t)
+	must(cli.SignCmd(ctx, privKeyPath, imgName, cli.SignOptions{Upload: true, SBOMFormat: "cyclonedx"}, passFunc), t)
+
+	sboms, err := oci.SBOMLayers(ref.Context(), desc.Descriptor, oci.RegistryOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	equals(len(sboms), 1, t)
+	equals(sboms[0].MediaType, oci.CycloneDXMediaType, t)
+	l, err := remote.Layer(ref.Context().Digest(sboms[0].Digest.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := l.Compressed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	b, err := ioutil.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	equals(strings.TrimSpace(string(b)), fmt.Sprintf(`{"args": "-q registry:%s -o cyclonedx-json"}`, ref.Context().Digest(desc.Digest.String())), t)
+
+	// The image's payload names the SBOM, which is signed too.
+	sbom := sboms[0].Digest.String()
+	must(verify(pubKeyPath, imgName, true, map[string]string{cosign.SBOMAnnotation: sbom}), t)
+	if _, err := cli.VerifySBOMCmd(ctx, pubKeyPath, imgName, sbom, nil, oci.RegistryOptions{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMigrateSignatures(t *testing.T) {
+	repo, stop := reg(t)
+	defer stop()
+
+	td1 := t.TempDir()
+	td2 := t.TempDir()
+
+	imgName := path.Join(repo, "cosign-e2e")
+
+	_, _, cleanup := mkimage(t, imgName)
+	defer cleanup()
+
+	_, oldPriv, oldPub := keypair(t, td1)
+	_, newPriv, newPub := keypair(t, td2)
+
+	ctx := context.Background()
+
+	// Sign with the old key only.
+	must(cli.SignCmd(ctx, oldPriv, imgName, cli.SignOptions{Upload: true, Annotations: map[string]string{"foo": "bar"}}, passFunc), t)
+	mustErr(verify(newPub, imgName, true, nil), t)
+
+	// Requests to the registry are made with ctx.
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	mustErr(cli.MigrateSignaturesCmd(canceled, oldPub, newPriv, imgName, true, false, passFunc), t)
+
+	// A dry run shouldn't upload anything.
+	must(cli.MigrateSignaturesCmd(ctx, oldPub, newPriv, imgName, true, false, passFunc), t)
+	mustErr(verify(newPub, imgName, true, nil), t)
+
+	// Now migrate for real, the payload (and its annotations) should carry over.
+	must(cli.MigrateSignaturesCmd(ctx, oldPub, newPriv, imgName, false, true, passFunc), t)
+	must(verify(newPub, imgName, true, map[string]string{"foo": "bar"}), t)
+	must(verify(oldPub, imgName, true, nil), t)
+}
+
+func TestClean(t *testing.T) {
+	repo, stop := reg(t)
+	defer stop()
+	td := t.TempDir()
+
+	imgName := path.Join(repo, "cosign-e2e")
+	_, _, cleanup := mkimage(t, imgName)
+	defer cleanup()
+
+	_, privKeyPath, pubKeyPath := keypair(t, td)
+	ctx := context.Background()
+
+	must(cli.SignCmd(ctx, privKeyPath, imgName, cli.SignOptions{Upload: true}, passFunc), t)
+	must(verify(pubKeyPath, imgName, true, nil), t)
+
+	must(cli.CleanCmd(ctx, imgName, true, oci.RegistryOptions{}), t)
+	mustErr(verify(pubKeyPath, imgName, true, nil), t)
+
+	// There's nothing left to clean.
+	mustErr(cli.CleanCmd(ctx, imgName, true, oci.RegistryOptions{}), t)
+
+	// The library function does the same.
+	must(cli.SignCmd(ctx, privKeyPath, imgName, cli.SignOptions{Upload: true}, passFunc), t)
+	ref, err := name.ParseReference(imgName)
+	must(err, t)
+	must(cosign.CleanSignatures(ctx, ref), t)
+	mustErr(verify(pubKeyPath, imgName, true, nil), t)
+	mustErr(cosign.CleanSignatures(ctx, ref), t)
+}
+
+func TestTree(t *testing.T) {
+	repo, stop := reg(t)
+	defer stop()
+	td := t.TempDir()
 
 	imgName := path.Join(repo, "cosign-e2e")
+	_, desc, cleanup := mkimage(t, imgName)
+	defer cleanup()
+
+	_, privKeyPath, _ := keypair(t, td)
+	ctx := context.Background()
 
+	var b bytes.Buffer
+	must(cli.TreeCmd(ctx, imgName, 3, true, oci.RegistryOptions{}, &b), t)
+	if !strings.Contains(b.String(), "└── no attachments") {
+		t.Errorf("tree of an unsigned image:\n%s", b.String())
+	}
+
+	must(cli.SignCmd(ctx, privKeyPath, imgName, cli.SignOptions{Upload: true}, passFunc), t)
+	b.Reset()
+	must(cli.TreeCmd(ctx, imgName, 3, false, oci.RegistryOptions{}, &b), t)
+	for _, want := range []string{"`-- tag " + oci.Munge(desc.Descriptor), "    `-- " + string(oci.SimpleSigningMediaType), "(signature)"} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("tree is missing %q:\n%s", want, b.String())
+		}
+	}
+}
+
+func TestTriangulateVerifyExists(t *testing.T) {
+	repo, stop := reg(t)
+	defer stop()
+	td := t.TempDir()
+
+	imgName := path.Join(repo, "cosign-e2e")
 	_, _, cleanup := mkimage(t, imgName)
 	defer cleanup()
 
-	_, priv1, pub1 := keypair(t, td1)
-	_, priv2, pub2 := keypair(t, td2)
+	_, privKeyPath, _ := keypair(t, td)
+	ctx := context.Background()
+
+	must(cli.MungeCmd(ctx, imgName, false), t)
+	err := cli.MungeCmd(ctx, imgName, true)
+	if ee, ok := err.(*cli.ExitError); !ok || ee.Code != 2 {
+		t.Fatalf("MungeCmd() before signing = %v, wanted an ExitError with code 2", err)
+	}
 
+	must(cli.SignCmd(ctx, privKeyPath, imgName, cli.SignOptions{Upload: true}, passFunc), t)
+	must(cli.MungeCmd(ctx, imgName, true), t)
+}
+
+func TestCleanNotAllowed(t *testing.T) {
+	handler := registry.New()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	must(err, t)
+	td := t.TempDir()
+
+	imgName := path.Join(u.Host, "cosign-e2e")
+	_, _, cleanup := mkimage(t, imgName)
+	defer cleanup()
+
+	_, privKeyPath, pubKeyPath := keypair(t, td)
 	ctx := context.Background()
+	must(cli.SignCmd(ctx, privKeyPath, imgName, cli.SignOptions{Upload: true}, passFunc), t)
 
-	// Verify should fail at first for both keys
-	mustErr(verify(pub1, imgName, true, nil), t)
-	mustErr(verify(pub2, imgName, true, nil), t)
+	err = cli.CleanCmd(ctx, imgName, true, oci.RegistryOptions{})
+	if err == nil || !strings.Contains(err.Error(), "doesn't allow deleting") {
+		t.Errorf("CleanCmd() = %v, wanted an error about deleting not being allowed", err)
+	}
+	must(verify(pubKeyPath, imgName, true, nil), t)
+}
 
-	// Now sign the image with one key
-	must(cli.SignCmd(ctx, priv1, imgName, true, "", nil, passFunc), t)
-	// Now verify should work with that one, but not the other
-	must(verify(pub1, imgName, true, nil), t)
-	mustErr(verify(pub2, imgName, true, nil), t)
+func TestVerifyKeyring(t *testing.T) {
+	repo, stop := reg(t)
+	defer stop()
 
-	// Now sign with the other key too
-	must(cli.SignCmd(ctx, priv2, imgName, true, "", nil, passFunc), t)
+	imgName := path.Join(repo, "cosign-e2e")
+	_, _, cleanup := mkimage(t, imgName)
+	defer cleanup()
 
-	// Now verify should work with both
-	must(verify(pub1, imgName, true, nil), t)
-	must(verify(pub2, imgName, true, nil), t)
+	first, _, _ := keypair(t, t.TempDir())
+	second, privKeyPath, secondPubPath := keypair(t, t.TempDir())
+	ctx := context.Background()
+	must(cli.SignCmd(ctx, privKeyPath, imgName, cli.SignOptions{Upload: true}, passFunc), t)
+
+	td := t.TempDir()
+	keyring := mkfile(string(first.PublicBytes)+string(second.PublicBytes), td, t)
+	verified, err := cli.VerifyKeyringCmd(ctx, keyring, imgName, true, nil, oci.RegistryOptions{})
+	must(err, t)
+	want, err := cosign.LoadPublicKey(secondPubPath)
+	must(err, t)
+	if len(verified) != 1 || !want.Equal(verified[0].PublicKey) {
+		t.Errorf("VerifyKeyringCmd() = %v, wanted one signature by the second key", verified)
+	}
+
+	// Nothing in a keyring of just the first key signed the image.
+	_, err = cli.VerifyKeyringCmd(ctx, mkfile(string(first.PublicBytes), td, t), imgName, true, nil, oci.RegistryOptions{})
+	mustErr(err, t)
+}
+
+func TestSignSVID(t *testing.T) {
+	repo, stop := reg(t)
+	defer stop()
+
+	imgName := path.Join(repo, "cosign-e2e")
+	_, _, cleanup := mkimage(t, imgName)
+	defer cleanup()
+
+	// An ECDSA SVID, like SPIRE issues by default, from a CA whose root is the
+	// trust bundle.
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	must(err, t)
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "example.org"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	must(err, t)
+	ca, err := x509.ParseCertificate(caDER)
+	must(err, t)
+	const id = "spiffe://example.org/ns/default/sa/cosign-builder"
+	svidKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	must(err, t)
+	svidDER, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		URIs:         []*url.URL{{Scheme: "spiffe", Host: "example.org", Path: "/ns/default/sa/cosign-builder"}},
+	}, ca, &svidKey.PublicKey, caKey)
+	must(err, t)
+	svidCert, err := x509.ParseCertificate(svidDER)
+	must(err, t)
+	svid := &x509svid.SVID{
+		ID:           spiffeid.RequireFromString(id),
+		Certificates: []*x509.Certificate{svidCert},
+		PrivateKey:   svidKey,
+	}
+
+	ctx := context.Background()
+	must(cli.SignSVIDCmd(ctx, svid, imgName, cli.SignOptions{Upload: true}), t)
+
+	bundle := mkfile(string(cosign.MarshalCertificates([]*x509.Certificate{ca})), t.TempDir(), t)
+	verified, err := cli.VerifyCertificatesCmd(ctx, bundle, false, imgName, true, nil, oci.RegistryOptions{}, cosign.VerifySPIFFEID(id))
+	must(err, t)
+	if len(verified) != 1 || !svidKey.PublicKey.Equal(verified[0].PublicKey) {
+		t.Errorf("VerifyCertificatesCmd() = %v, wanted one signature by the SVID key", verified)
+	}
+	_, err = cli.VerifyCertificatesCmd(ctx, bundle, false, imgName, true, nil, oci.RegistryOptions{}, cosign.VerifySPIFFEID("spiffe://example.org/ns/default/sa/other"))
+	mustErr(err, t)
+
+	// Without an upload, there's nowhere to keep the certificate.
+	mustErr(cli.SignSVIDCmd(ctx, svid, imgName, cli.SignOptions{}), t)
+}
+
+func TestVerifyKeys(t *testing.T) {
+	repo, stop := reg(t)
+	defer stop()
+
+	imgName := path.Join(repo, "cosign-e2e")
+	_, _, cleanup := mkimage(t, imgName)
+	defer cleanup()
+
+	_, _, oldPub := keypair(t, t.TempDir())
+	_, newPriv, newPub := keypair(t, t.TempDir())
+	_, _, otherPub := keypair(t, t.TempDir())
+	ctx := context.Background()
+	must(cli.SignCmd(ctx, newPriv, imgName, cli.SignOptions{Upload: true}, passFunc), t)
+
+	// Either key will do while rotating.
+	verified, err := cli.VerifyKeysCmd(ctx, []string{oldPub, newPub}, imgName, true, nil, oci.RegistryOptions{})
+	must(err, t)
+	equals(len(verified), 1, t)
+	must(cli.Verify().ParseAndRun(ctx, []string{"-key", oldPub, "-key", newPub, imgName}), t)
+	mustErr(cli.Verify().ParseAndRun(ctx, []string{"-key", oldPub, "-key", newPub, "-recursive", imgName}), t)
+
+	// Each key's error names it.
+	_, err = cli.VerifyKeysCmd(ctx, []string{oldPub, otherPub}, imgName, true, nil, oci.RegistryOptions{})
+	if err == nil || !strings.Contains(err.Error(), oldPub+": ") || !strings.Contains(err.Error(), otherPub+": ") {
+		t.Errorf("VerifyKeysCmd() = %v, wanted an error for each key", err)
+	}
+}
+
+func TestVerifyPattern(t *testing.T) {
+	repo, stop := fakeReg(t, false)
+	defer stop()
+	td := t.TempDir()
+
+	imgName := path.Join(repo, "cosign-e2e")
+	for _, tag := range []string{"v1.0", "v1.1", "v2.0"} {
+		_, _, cleanup := mkimage(t, imgName+":"+tag)
+		defer cleanup()
+	}
+
+	_, privKeyPath, pubKeyPath := keypair(t, td)
+
+	ctx := context.Background()
+	must(cli.SignCmd(ctx, privKeyPath, imgName+":v1.0", cli.SignOptions{Upload: true}, passFunc), t)
+	must(cli.SignCmd(ctx, privKeyPath, imgName+":v1.1", cli.SignOptions{Upload: true}, passFunc), t)
+
+	// Only the signed images match.
+	b := bytes.Buffer{}
+	must(cli.VerifyPatternCmd(ctx, pubKeyPath, imgName+":v1.*", true, nil, oci.RegistryOptions{}, &b), t)
+	equals(strings.Count(b.String(), "PASS"), 2, t)
+	equals(strings.Count(b.String(), "FAIL"), 0, t)
+
+	// Everything matches, including the unsigned image.
+	b.Reset()
+	mustErr(cli.VerifyPatternCmd(ctx, pubKeyPath, imgName+":*", true, nil, oci.RegistryOptions{}, &b), t)
+	equals(strings.Count(b.String(), "PASS"), 2, t)
+	equals(strings.Count(b.String(), "FAIL"), 1, t)
+
+	// Nothing matches.
+	mustErr(cli.VerifyPatternCmd(ctx, pubKeyPath, imgName+":v3.*", true, nil, oci.RegistryOptions{}, &b), t)
+}
+
+func TestVerifyParallel(t *testing.T) {
+	repo, stop := reg(t)
+	defer stop()
+	td := t.TempDir()
+
+	imgs := []string{}
+	for _, n := range []string{"cosign-e2e-1", "cosign-e2e-2", "cosign-e2e-3"} {
+		imgName := path.Join(repo, n)
+		_, _, cleanup := mkimage(t, imgName)
+		defer cleanup()
+		imgs = append(imgs, imgName)
+	}
+
+	_, privKeyPath, pubKeyPath := keypair(t, td)
+
+	ctx := context.Background()
+	must(cli.SignCmd(ctx, privKeyPath, imgs[0], cli.SignOptions{Upload: true}, passFunc), t)
+	must(cli.SignCmd(ctx, privKeyPath, imgs[2], cli.SignOptions{Upload: true}, passFunc), t)
+
+	b := bytes.Buffer{}
+	must(cli.VerifyParallelCmd(ctx, pubKeyPath, []string{imgs[0], imgs[2]}, 2, true, nil, oci.RegistryOptions{}, &b), t)
+	equals(strings.Count(b.String(), "PASS"), 2, t)
+
+	// The unsigned image fails, and the results are in the order given.
+	b.Reset()
+	mustErr(cli.VerifyParallelCmd(ctx, pubKeyPath, imgs, 2, true, nil, oci.RegistryOptions{}, &b), t)
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	equals(len(lines), 4, t)
+	for i, want := range []string{"PASS", "FAIL", "PASS"} {
+		if !strings.HasPrefix(lines[i+1], imgs[i]) || !strings.Contains(lines[i+1], want) {
+			t.Errorf("line %d = %q, wanted %s for %s", i+1, lines[i+1], want, imgs[i])
+		}
+	}
+
+	mustErr(cli.VerifyParallelCmd(ctx, pubKeyPath, imgs, 0, true, nil, oci.RegistryOptions{}, &b), t)
+}
+
+func TestSignManifest(t *testing.T) {
+	repo, stop := reg(t)
+	defer stop()
+	td := t.TempDir()
+
+	img1 := path.Join(repo, "cosign-e2e-1")
+	img2 := path.Join(repo, "cosign-e2e-2")
+	_, _, cleanup1 := mkimage(t, img1)
+	defer cleanup1()
+	_, _, cleanup2 := mkimage(t, img2)
+	defer cleanup2()
+
+	_, privKeyPath, pubKeyPath := keypair(t, td)
+
+	manifest := mkfile(img1+",env=prod\n"+img2+",env=dev,team=foo\n"+path.Join(repo, "missing")+"\n", td, t)
+
+	// The missing image fails, but the others are still signed.
+	b := bytes.Buffer{}
+	mustErr(cli.SignManifestCmd(context.Background(), privKeyPath, manifest, nil, 2, false, false, oci.RegistryOptions{}, passFunc, &b), t)
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	equals(len(lines), 3, t)
+	equals(lines[0], img1+",env=prod,success", t)
+	equals(lines[1], img2+",env=dev,team=foo,success", t)
+
+	must(verify(pubKeyPath, img1, true, map[string]string{"env": "prod"}), t)
+	must(verify(pubKeyPath, img2, true, map[string]string{"env": "dev", "team": "foo"}), t)
+
+	// Annotations passed with -a are signed with every row, but can't be
+	// set by a row too.
+	b.Reset()
+	must(cli.SignManifestCmd(context.Background(), privKeyPath, mkfile(img1+",env=prod\n", td, t), map[string]string{"team": "bar"}, 2, false, false, oci.RegistryOptions{}, passFunc, &b), t)
+	must(verify(pubKeyPath, img1, true, map[string]string{"env": "prod", "team": "bar"}), t)
+	b.Reset()
+	mustErr(cli.SignManifestCmd(context.Background(), privKeyPath, mkfile(img1+",env=prod\n", td, t), map[string]string{"env": "dev"}, 2, false, false, oci.RegistryOptions{}, passFunc, &b), t)
+
+	// A dry run with a manifest would still upload the signatures.
+	for _, flag := range []string{"-dry-run", "-upload=false"} {
+		mustErr(cli.Sign().ParseAndRun(context.Background(), []string{"-key", privKeyPath, "-manifest", manifest, flag}), t)
+	}
+}
+
+func TestSignImagesFile(t *testing.T) {
+	repo, stop := reg(t)
+	defer stop()
+	td := t.TempDir()
+
+	img1 := path.Join(repo, "cosign-e2e-1")
+	img2 := path.Join(repo, "cosign-e2e-2")
+	_, _, cleanup1 := mkimage(t, img1)
+	defer cleanup1()
+	ref2, desc2, cleanup2 := mkimage(t, img2)
+	defer cleanup2()
+	byDigest := ref2.Context().Digest(desc2.Digest.String()).String()
+
+	_, privKeyPath, pubKeyPath := keypair(t, td)
+	ctx := context.Background()
+	so := cli.SignOptions{Upload: true, Annotations: map[string]string{"build": "42"}}
+
+	err := cli.SignImagesFileCmd(ctx, []string{privKeyPath}, filepath.Join(td, "missing.txt"), 2, so, passFunc)
+	if ee, ok := err.(*cli.ExitError); !ok || ee.Code != 2 {
+		t.Fatalf("SignImagesFileCmd() of a missing file = %v, wanted an ExitError with code 2", err)
+	}
+
+	// The missing image fails, but the others are still signed.
+	images := mkfile("# release\n"+img1+"\n\n"+byDigest+" # pinned\n"+path.Join(repo, "missing")+"\n", td, t)
+	err = cli.SignImagesFileCmd(ctx, []string{privKeyPath}, images, 2, so, passFunc)
+	if _, ok := err.(*cli.ExitError); err == nil || ok {
+		t.Fatalf("SignImagesFileCmd() with a missing image = %v, wanted a plain error", err)
+	}
+	must(verify(pubKeyPath, img1, true, map[string]string{"build": "42"}), t)
+	must(verify(pubKeyPath, img2, true, map[string]string{"build": "42"}), t)
+}
+
+func TestDockerfileSign(t *testing.T) {
+	repo, stop := reg(t)
+	defer stop()
+	td := t.TempDir()
+
+	img1 := path.Join(repo, "cosign-e2e-1")
+	img2 := path.Join(repo, "cosign-e2e-2")
+	ref1, desc1, cleanup1 := mkimage(t, img1)
+	defer cleanup1()
+	_, _, cleanup2 := mkimage(t, img2)
+	defer cleanup2()
+
+	_, privKeyPath, pubKeyPath := keypair(t, td)
+	ctx := context.Background()
+	so := cli.SignOptions{Upload: true}
+
+	dockerfile := mkfile("ARG BASE="+img1+"\nFROM $BASE AS build\nFROM "+img2+"\nCOPY --from=build /app /app\nFROM scratch\nFROM build\n", td, t)
+	out := bytes.Buffer{}
+	must(cli.DockerfileSignCmd(ctx, dockerfile, privKeyPath, so, passFunc, &out), t)
+	must(verify(pubKeyPath, img1, true, nil), t)
+	must(verify(pubKeyPath, img2, true, nil), t)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	equals(len(lines), 2, t)
+	equals(lines[0], strings.Join([]string{img1, ref1.Context().Digest(desc1.Digest.String()).String(), ref1.Context().Tag(oci.Munge(desc1.Descriptor)).String()}, "\t"), t)
+
+	// Nothing is written unless every image is signed.
+	out.Reset()
+	missing := mkfile("FROM "+img1+"\nFROM "+path.Join(repo, "missing")+"\n", td, t)
+	mustErr(cli.DockerfileSignCmd(ctx, missing, privKeyPath, so, passFunc, &out), t)
+	equals(out.Len(), 0, t)
+	mustErr(cli.DockerfileSignCmd(ctx, mkfile("FROM scratch\n", td, t), privKeyPath, so, passFunc, &out), t)
+}
+
+func TestDockerfileVerify(t *testing.T) {
+	repo, stop := reg(t)
+	defer stop()
+	td := t.TempDir()
+
+	img1 := path.Join(repo, "cosign-e2e-1")
+	img2 := path.Join(repo, "cosign-e2e-2")
+	_, desc1, cleanup1 := mkimage(t, img1)
+	defer cleanup1()
+	_, desc2, cleanup2 := mkimage(t, img2)
+	defer cleanup2()
+
+	_, privKeyPath, pubKeyPath := keypair(t, td)
+	ctx := context.Background()
+	must(cli.SignKeysCmd(ctx, []string{privKeyPath}, img1, cli.SignOptions{Upload: true}, passFunc), t)
+
+	policy := mkfile("requiredKeys:\n- "+pubKeyPath+"\n", td, t)
+	contents := "FROM " + img1 + " AS build\nFROM " + img2 + "\n"
+	dockerfile := mkfile(contents, td, t)
+
+	// img2 isn't signed, so the Dockerfile is left alone.
+	out := bytes.Buffer{}
+	mustErr(cli.DockerfileVerifyCmd(ctx, dockerfile, policy, true, oci.RegistryOptions{}, &out), t)
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	equals(len(lines), 2, t)
+	equals(strings.HasSuffix(lines[0], "\tsigned"), true, t)
+	equals(strings.Contains(lines[1], "\tunsigned: "), true, t)
+	b, err := ioutil.ReadFile(dockerfile)
+	must(err, t)
+	equals(string(b), contents, t)
+
+	must(cli.SignKeysCmd(ctx, []string{privKeyPath}, img2, cli.SignOptions{Upload: true}, passFunc), t)
+	must(cli.DockerfileVerifyCmd(ctx, dockerfile, policy, true, oci.RegistryOptions{}, ioutil.Discard), t)
+	b, err = ioutil.ReadFile(dockerfile)
+	must(err, t)
+	equals(string(b), "FROM "+img1+"@"+desc1.Digest.String()+" AS build\nFROM "+img2+"@"+desc2.Digest.String()+"\n", t)
+
+	// The pinned Dockerfile still verifies.
+	must(cli.DockerfileVerifyCmd(ctx, dockerfile, policy, false, oci.RegistryOptions{}, ioutil.Discard), t)
+}
+
+func TestCompletion(t *testing.T) {
+	root := &ffcli.Command{
+		Subcommands: []*ffcli.Command{cli.Sign(), cli.Verify()},
+	}
+	for _, shell := range []string{"bash", "zsh", "fish", "powershell"} {
+		b := bytes.Buffer{}
+		must(cli.CompletionCmd(context.Background(), root, shell, &b), t)
+		for _, want := range []string{"sign", "verify", "key", "strict-annotations"} {
+			if !strings.Contains(b.String(), want) {
+				t.Errorf("%s completion is missing %q", shell, want)
+			}
+		}
+	}
+	mustErr(cli.CompletionCmd(context.Background(), root, "tcsh", ioutil.Discard), t)
+}
+
+func TestJSONLogging(t *testing.T) {
+	repo, stop := reg(t)
+	defer stop()
+	td := t.TempDir()
+
+	imgName := path.Join(repo, "cosign-e2e")
+	_, _, cleanup := mkimage(t, imgName)
+	defer cleanup()
+	_, privKeyPath, _ := keypair(t, td)
+
+	b := bytes.Buffer{}
+	must(cli.SetupLogging(&b, "json", "info"), t)
+	defer func() {
+		must(cli.SetupLogging(os.Stderr, "text", "info"), t)
+	}()
+
+	ctx := context.Background()
+	must(cli.SignCmd(ctx, privKeyPath, imgName, cli.SignOptions{Upload: true}, passFunc), t)
+
+	// One JSON object per line: the digest being signed, then the push.
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	equals(len(lines), 2, t)
+	entry := map[string]interface{}{}
+	must(json.Unmarshal([]byte(lines[0]), &entry), t)
+	equals(entry["msg"], "Signing image", t)
+	if digest, _ := entry["digest"].(string); !strings.HasPrefix(digest, "sha256:") {
+		t.Errorf("digest = %q, wanted the digest being signed", digest)
+	}
+	entry = map[string]interface{}{}
+	must(json.Unmarshal([]byte(lines[1]), &entry), t)
+	equals(entry["level"], "info", t)
+	equals(entry["msg"], "Pushing signature", t)
+	if ref, _ := entry["ref"].(string); !strings.HasPrefix(ref, imgName+":sha256-") {
+		t.Errorf("ref = %q, wanted the signature tag of %s", ref, imgName)
+	}
+
+	// Below the configured level, nothing is logged.
+	b.Reset()
+	must(cli.SetupLogging(&b, "json", "warn"), t)
+	must(cli.SignCmd(ctx, privKeyPath, imgName, cli.SignOptions{Upload: true}, passFunc), t)
+	equals(b.Len(), 0, t)
+
+	mustErr(cli.SetupLogging(&b, "yaml", "info"), t)
+	mustErr(cli.SetupLogging(&b, "json", "loud"), t)
 }
 
 func TestGenerate(t *testing.T) {
@@ -116,7 +1798,7 @@ func TestGenerate(t *testing.T) {
 	// Generate the payload for the image, and check the digest.
 	b := bytes.Buffer{}
 	must(cli.GenerateCmd(context.Background(), imgName, nil, &b), t)
-	ss := cosign.SimpleSigning{}
+	ss := oci.SimpleSigning{}
 	must(json.Unmarshal(b.Bytes(), &ss), t)
 
 	equals(desc.Digest.Hex, ss.Critical.Image.DockerManifestDigest, t)
@@ -128,7 +1810,29 @@ func TestGenerate(t *testing.T) {
 	must(json.Unmarshal(b.Bytes(), &ss), t)
 
 	equals(desc.Digest.Hex, ss.Critical.Image.DockerManifestDigest, t)
-	equals(ss.Optional["foo"], "bar", t)
+	equals(string(ss.Optional["foo"]), `"bar"`, t)
+}
+
+func TestPublicKey(t *testing.T) {
+	td := t.TempDir()
+	keys, privKeyPath, _ := keypair(t, td)
+
+	b := bytes.Buffer{}
+	must(cli.PublicKeyCmd(context.Background(), privKeyPath, "", passFunc, &b), t)
+	equals(b.String(), string(keys.PublicBytes), t)
+
+	out := filepath.Join(td, "pub.pem")
+	must(cli.PublicKeyCmd(context.Background(), privKeyPath, out, passFunc, &b), t)
+	got, err := ioutil.ReadFile(out)
+	must(err, t)
+	equals(string(got), string(keys.PublicBytes), t)
+
+	// KMS keys fail without asking for a password.
+	noPass := func(bool) ([]byte, error) {
+		t.Fatal("asked for a password")
+		return nil, nil
+	}
+	mustErr(cli.PublicKeyCmd(context.Background(), "kms://projects/p/locations/l/keyRings/r/cryptoKeys/k", "", noPass, &b), t)
 }
 
 func keypair(t *testing.T, td string) (*cosign.Keys, string, string) {
@@ -168,10 +1872,10 @@ func TestUploadDownload(t *testing.T) {
 	sigPath := mkfile(signature, td, t)
 
 	// Upload it!
-	must(cli.UploadCmd(ctx, sigPath, payloadPath, imgName), t)
+	must(cli.UploadCmd(ctx, sigPath, payloadPath, "", imgName, false, oci.RegistryOptions{}), t)
 
 	// Now download it!
-	signatures, _, err := cosign.FetchSignatures(ref)
+	signatures, _, err := oci.FetchSignatures(ref, oci.RegistryOptions{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -186,6 +1890,33 @@ func TestUploadDownload(t *testing.T) {
 	}
 }
 
+func TestUploadPayloadType(t *testing.T) {
+	repo, stop := reg(t)
+	defer stop()
+	td := t.TempDir()
+	ctx := context.Background()
+
+	imgName := path.Join(repo, "cosign-e2e")
+	_, desc, cleanup := mkimage(t, imgName)
+	defer cleanup()
+	keys, _, pubKeyPath := keypair(t, td)
+	priv, err := cosign.LoadPrivateKey(keys.PrivateBytes, keyPass)
+	must(err, t)
+
+	statement := `{"_type":"https://in-toto.io/Statement/v0.1","subject":[{"name":"cosign-e2e","digest":{"sha256":"` + desc.Digest.Hex + `"}}],"predicateType":"https://example.com/test","predicate":{}}`
+	payloadPath := mkfile(statement, td, t)
+	sigPath := mkfile(base64.StdEncoding.EncodeToString(ed25519.Sign(priv, []byte(statement))), td, t)
+
+	mustErr(cli.UploadCmd(ctx, sigPath, payloadPath, "not a media type", imgName, false, oci.RegistryOptions{}), t)
+
+	// Stored as simple signing, the digest isn't found where it is expected.
+	must(cli.UploadCmd(ctx, sigPath, payloadPath, "", imgName, false, oci.RegistryOptions{}), t)
+	mustErr(verify(pubKeyPath, imgName, true, nil), t)
+
+	must(cli.UploadCmd(ctx, sigPath, payloadPath, string(cosign.InTotoMediaType), imgName, false, oci.RegistryOptions{}), t)
+	must(verify(pubKeyPath, imgName, true, nil), t)
+}
+
 func mkfile(contents, td string, t *testing.T) string {
 	f, err := ioutil.TempFile(td, "")
 	if err != nil {
@@ -219,7 +1950,7 @@ func mkimage(t *testing.T, n string) (name.Reference, *remote.Descriptor, func()
 
 	cleanup := func() {
 		_ = remote.Delete(ref, remote.WithAuthFromKeychain(authn.DefaultKeychain))
-		munged := cosign.Munge(remoteImage.Descriptor)
+		munged := oci.Munge(remoteImage.Descriptor)
 		ref, _ := name.ParseReference(munged)
 		_ = remote.Delete(ref, remote.WithAuthFromKeychain(authn.DefaultKeychain))
 	}
@@ -253,10 +1984,97 @@ func reg(t *testing.T) (string, func()) {
 	}
 
 	t.Log("COSIGN_TEST_REPO unset, using fake registry")
-	r := httptest.NewServer(registry.New())
+	return fakeReg(t, false)
+}
+
+func fakeReg(t *testing.T, referrers bool) (string, func()) {
+	r := httptest.NewServer(&fakeRegistry{
+		handler:   registry.New(),
+		referrers: referrers,
+		tags:      map[string][]string{},
+		refs:      map[string][]referrerDescriptor{},
+	})
 	u, err := url.Parse(r.URL)
 	if err != nil {
 		t.Fatal(err)
 	}
 	return u.Host, r.Close
 }
+
+// fakeRegistry adds the parts of the registry API that the fake registry
+// doesn't implement: listing tags and, optionally, the referrers API.
+type fakeRegistry struct {
+	handler   http.Handler
+	referrers bool
+
+	sync.Mutex
+	tags map[string][]string
+	refs map[string][]referrerDescriptor
+}
+
+type referrerDescriptor struct {
+	MediaType    string `json:"mediaType"`
+	Size         int64  `json:"size"`
+	Digest       string `json:"digest"`
+	ArtifactType string `json:"artifactType,omitempty"`
+}
+
+func (fr *fakeRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	elem := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(elem) < 4 || elem[0] != "v2" {
+		fr.handler.ServeHTTP(w, r)
+		return
+	}
+	repo := strings.Join(elem[1:len(elem)-2], "/")
+	kind, target := elem[len(elem)-2], elem[len(elem)-1]
+
+	fr.Lock()
+	defer fr.Unlock()
+	switch {
+	case r.Method == http.MethodGet && kind == "tags" && target == "list":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			Name string   `json:"name"`
+			Tags []string `json:"tags"`
+		}{repo, fr.tags[repo]})
+		return
+	case r.Method == http.MethodGet && kind == "referrers" && fr.referrers:
+		w.Header().Set("Content-Type", "application/vnd.oci.image.index.v1+json")
+		json.NewEncoder(w).Encode(struct {
+			SchemaVersion int                  `json:"schemaVersion"`
+			Manifests     []referrerDescriptor `json:"manifests"`
+		}{2, fr.refs[repo+"@"+target]})
+		return
+	case r.Method == http.MethodPut && kind == "manifests":
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(b))
+		if !strings.Contains(target, ":") {
+			found := false
+			for _, tag := range fr.tags[repo] {
+				found = found || tag == target
+			}
+			if !found {
+				fr.tags[repo] = append(fr.tags[repo], target)
+			}
+		}
+		m := struct {
+			ArtifactType string
+			Subject      *struct{ Digest string }
+		}{}
+		if err := json.Unmarshal(b, &m); err == nil && m.Subject != nil {
+			h := sha256.Sum256(b)
+			key := repo + "@" + m.Subject.Digest
+			fr.refs[key] = append(fr.refs[key], referrerDescriptor{
+				MediaType:    r.Header.Get("Content-Type"),
+				Size:         int64(len(b)),
+				Digest:       "sha256:" + hex.EncodeToString(h[:]),
+				ArtifactType: m.ArtifactType,
+			})
+		}
+	}
+	fr.handler.ServeHTTP(w, r)
+}